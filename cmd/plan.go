@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/ygqygq2/influxdb-sync/internal/common"
+	"github.com/ygqygq2/influxdb-sync/internal/config"
+	"github.com/ygqygq2/influxdb-sync/internal/influxdb1"
+	"github.com/ygqygq2/influxdb-sync/internal/influxdb2"
+	"github.com/ygqygq2/influxdb-sync/internal/influxdb3"
+	"github.com/ygqygq2/influxdb-sync/internal/logx"
+)
+
+// Plan 连接源端生成迁移计划并写入 planPath，不写入目标端
+func Plan(cfgPath, planPath string) error {
+	cfg, err := config.LoadConfig(cfgPath)
+	if err != nil {
+		return err
+	}
+	// apply 可能在其他目录执行，记录配置文件的绝对路径
+	absPath, err := filepath.Abs(cfgPath)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := notifyShutdown()
+	defer cancel()
+
+	syncConfig := newSyncConfig(cfg)
+	source, err := newSource(cfg, syncConfig.SourceDB)
+	if err != nil {
+		return err
+	}
+	plan, err := common.NewSyncer(syncConfig, source, nil).Plan(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return common.ErrInterrupted
+		}
+		return err
+	}
+	plan.Config = absPath
+	plan.Mode = detectSyncMode(cfg)
+
+	if err := plan.Save(planPath); err != nil {
+		return err
+	}
+	logx.Info(fmt.Sprintf("迁移计划已写入 %s，共 %d 个数据库", planPath, len(plan.Databases)))
+	return nil
+}
+
+// Apply 按迁移计划执行同步，连接信息读取计划中记录的配置文件，
+// 同步范围和时间窗口以计划为准
+func Apply(planPath string) error {
+	plan, err := common.LoadPlan(planPath)
+	if err != nil {
+		return err
+	}
+	cfg, err := config.LoadConfig(plan.Config)
+	if err != nil {
+		return err
+	}
+	mode := detectSyncMode(cfg)
+	if plan.Mode != "" && plan.Mode != mode {
+		return fmt.Errorf("迁移计划的同步模式 %s 与配置文件 %s 的模式 %s 不一致", plan.Mode, plan.Config, mode)
+	}
+
+	syncConfig := newSyncConfig(cfg)
+	syncConfig.Start = plan.Start
+	syncConfig.End = plan.End
+	syncConfig.Plan = plan
+
+	ctx, cancel := notifyShutdown()
+	defer cancel()
+	return runMode(ctx, mode, syncConfig)
+}
+
+// 按配置的源端版本创建数据源，与各同步模式使用的数据源一致
+func newSource(cfg *config.Config, sourceDB string) (common.DataSource, error) {
+	switch detectSyncMode(cfg)[:2] {
+	case "2x":
+		return &influxdb2.Adapter{
+			URL:    cfg.Source.URL,
+			Token:  cfg.Source.Token,
+			Org:    cfg.Source.Org,
+			Bucket: cfg.Source.Bucket,
+		}, nil
+	case "3x":
+		return influxdb3.NewSource(newSyncConfig(cfg), sourceDB)
+	default:
+		return influxdb1.NewDataSource(influxdb1.DataSourceConfig{
+			Addr: cfg.Source.URL,
+			User: cfg.Source.User,
+			Pass: cfg.Source.Pass,
+		}), nil
+	}
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ygqygq2/influxdb-sync/internal/common"
+	"github.com/ygqygq2/influxdb-sync/internal/config"
+	"github.com/ygqygq2/influxdb-sync/internal/influxdb1"
+	"github.com/ygqygq2/influxdb-sync/internal/influxdb2"
+	"github.com/ygqygq2/influxdb-sync/internal/influxdb3"
+)
+
+func TestNewSource(t *testing.T) {
+	cfg := &config.Config{Source: config.DBConfig{Type: 1, URL: "http://source:8086"}}
+	if s, err := newSource(cfg, ""); err != nil {
+		t.Fatalf("newSource() error = %v", err)
+	} else if _, ok := s.(*influxdb1.DataSource); !ok {
+		t.Error("1.x 源应创建 influxdb1.DataSource")
+	}
+
+	cfg.Source = config.DBConfig{Type: 2, Bucket: "bucket"}
+	if s, err := newSource(cfg, ""); err != nil {
+		t.Fatalf("newSource() error = %v", err)
+	} else if a, ok := s.(*influxdb2.Adapter); !ok || a.Bucket != "bucket" {
+		t.Error("2.x 源应创建读取配置 bucket 的 influxdb2.Adapter")
+	}
+
+	cfg.Source = config.DBConfig{Type: 3}
+	if s, err := newSource(cfg, "db"); err != nil {
+		t.Fatalf("newSource() error = %v", err)
+	} else if _, ok := s.(*influxdb3.DataSource3x); !ok {
+		t.Error("3.x 源应创建 influxdb3.DataSource3x")
+	}
+
+	cfg.Source = config.DBConfig{Type: 3, CompatMode: "v3"}
+	if _, err := newSource(cfg, "db"); err == nil {
+		t.Error("不支持的 compat_mode 应返回错误")
+	}
+}
+
+func TestApplyRejectsModeMismatch(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	content := `
+source:
+  type: 1
+  url: "http://localhost:8086"
+target:
+  type: 1
+  url: "http://localhost:8087"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("无法创建测试配置文件: %v", err)
+	}
+
+	plan := &common.Plan{Version: 1, Config: configPath, Mode: "2x2x"}
+	planPath := filepath.Join(dir, "plan.json")
+	if err := plan.Save(planPath); err != nil {
+		t.Fatalf("保存迁移计划失败: %v", err)
+	}
+
+	if err := Apply(planPath); err == nil || !strings.Contains(err.Error(), "不一致") {
+		t.Errorf("同步模式不一致时应返回错误, 实际为: %v", err)
+	}
+}
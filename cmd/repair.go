@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/ygqygq2/influxdb-sync/internal/common"
+	"github.com/ygqygq2/influxdb-sync/internal/config"
+	"github.com/ygqygq2/influxdb-sync/internal/influxdb3"
+	"github.com/ygqygq2/influxdb-sync/internal/logx"
+)
+
+// Repair 只重新同步不一致的时间窗口并重新校验。diffsPath 为 verify 输出的不一致窗口列表，
+// 为空时先按配置校验一遍得到列表
+func Repair(cfgPath, diffsPath string) error {
+	cfg, err := config.LoadConfig(cfgPath)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := notifyShutdown()
+	defer cancel()
+
+	syncConfig := newSyncConfig(cfg)
+	opts := verifyOptions(cfg)
+	source, err := newSource(cfg, syncConfig.SourceDB)
+	if err != nil {
+		return err
+	}
+	targetSource, err := newTargetSource(cfg)
+	if err != nil {
+		return err
+	}
+	var diffs []common.WindowDiff
+	if diffsPath != "" {
+		if diffs, err = common.LoadWindowDiffs(diffsPath); err != nil {
+			return err
+		}
+	} else {
+		logx.Info("未指定不一致窗口列表，先校验源端和目标端")
+		verifier := common.NewSyncer(syncConfig, source, nil)
+		if diffs, err = verifier.Verify(ctx, targetSource, opts); err != nil {
+			if ctx.Err() != nil {
+				return common.ErrInterrupted
+			}
+			return err
+		}
+	}
+
+	// 3.x 目标默认写入创建时指定的数据库，与 3.x 同步模式使用相同的名称
+	target, err := newTarget(cfg, influxdb3.TargetDatabase(syncConfig, syncConfig.SourceDB))
+	if err != nil {
+		return err
+	}
+	syncer := common.NewSyncer(syncConfig, source, target)
+	remaining, err := syncer.Repair(ctx, targetSource, diffs, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range remaining {
+		fmt.Println(d)
+	}
+	if len(remaining) > 0 {
+		return fmt.Errorf("%w: 修复后仍有 %d 个时间窗口", ErrMismatch, len(remaining))
+	}
+	return nil
+}
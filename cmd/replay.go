@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/ygqygq2/influxdb-sync/internal/common"
+	"github.com/ygqygq2/influxdb-sync/internal/config"
+	"github.com/ygqygq2/influxdb-sync/internal/influxdb1"
+	"github.com/ygqygq2/influxdb-sync/internal/influxdb2"
+	"github.com/ygqygq2/influxdb-sync/internal/influxdb3"
+	"github.com/ygqygq2/influxdb-sync/internal/logx"
+)
+
+// ReplayDLQ 把配置的死信目录中的点重新写入目标端
+func ReplayDLQ(cfgPath string) error {
+	cfg, err := config.LoadConfig(cfgPath)
+	if err != nil {
+		return err
+	}
+	if cfg.Sync.DeadLetterDir == "" {
+		return fmt.Errorf("未配置 sync.dead_letter_dir")
+	}
+
+	ctx, cancel := notifyShutdown()
+	defer cancel()
+
+	n, err := common.ReplayDeadLetters(ctx, cfg.Sync.DeadLetterDir, cfg.Sync.BatchSize, func(name string) (common.DataTarget, error) {
+		return newTarget(cfg, name)
+	})
+	logx.Info(fmt.Sprintf("共重放 %d 个点", n))
+	if ctx.Err() != nil {
+		return common.ErrInterrupted
+	}
+	return err
+}
+
+// 按配置的目标端版本创建写入 name 库/bucket 的数据目标，与各同步模式使用的目标一致
+func newTarget(cfg *config.Config, name string) (common.DataTarget, error) {
+	switch detectSyncMode(cfg)[2:] {
+	case "2x":
+		return &influxdb2.Adapter{
+			URL:    cfg.Target.URL,
+			Token:  cfg.Target.Token,
+			Org:    cfg.Target.Org,
+			Bucket: name,
+		}, nil
+	case "3x":
+		return influxdb3.NewTarget(newSyncConfig(cfg), name)
+	default:
+		return influxdb1.NewDataTarget(influxdb1.DataTargetConfig{
+			Addr: cfg.Target.URL,
+			User: cfg.Target.User,
+			Pass: cfg.Target.Pass,
+		}), nil
+	}
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ygqygq2/influxdb-sync/internal/config"
+	"github.com/ygqygq2/influxdb-sync/internal/influxdb1"
+	"github.com/ygqygq2/influxdb-sync/internal/influxdb2"
+	"github.com/ygqygq2/influxdb-sync/internal/influxdb3"
+)
+
+func TestNewTarget(t *testing.T) {
+	cfg := &config.Config{Target: config.DBConfig{Type: 1, URL: "http://target:8086"}}
+	if target, err := newTarget(cfg, "db"); err != nil {
+		t.Fatalf("newTarget() error = %v", err)
+	} else if _, ok := target.(*influxdb1.DataTarget); !ok {
+		t.Error("1.x 目标应创建 influxdb1.DataTarget")
+	}
+
+	cfg.Target.Type = 2
+	if target, err := newTarget(cfg, "bucket"); err != nil {
+		t.Fatalf("newTarget() error = %v", err)
+	} else if a, ok := target.(*influxdb2.Adapter); !ok || a.Bucket != "bucket" {
+		t.Error("2.x 目标应创建写入指定 bucket 的 influxdb2.Adapter")
+	}
+
+	cfg.Target.Type = 3
+	if target, err := newTarget(cfg, "db"); err != nil {
+		t.Fatalf("newTarget() error = %v", err)
+	} else if _, ok := target.(*influxdb3.DataTarget3x); !ok {
+		t.Error("3.x 目标应创建 influxdb3.DataTarget3x")
+	}
+
+	cfg.Target.CompatMode = "v3"
+	if _, err := newTarget(cfg, "db"); err == nil {
+		t.Error("不支持的 compat_mode 应返回错误")
+	}
+}
+
+func TestReplayDLQRequiresDir(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+source:
+  type: 1
+  url: "http://localhost:8086"
+target:
+  type: 1
+  url: "http://localhost:8087"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("无法创建测试配置文件: %v", err)
+	}
+
+	if err := ReplayDLQ(configPath); err == nil || !strings.Contains(err.Error(), "dead_letter_dir") {
+		t.Errorf("未配置死信目录时应返回错误, 实际为: %v", err)
+	}
+}
+
+// 重放与同步使用相同的目标端构造，compat_mode: native 时通过 /v1/write 写入
+func TestReplayDLQNativeTarget(t *testing.T) {
+	var writes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			return
+		}
+		if r.URL.Path != "/v1/write" || r.URL.Query().Get("database") != "metrics" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		writes = append(writes, string(body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	dlqDir := filepath.Join(dir, "dlq")
+	if err := os.MkdirAll(dlqDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	line := `cpu,host=a\ b msg="x\\y" 1700000000000000000` + "\n"
+	if err := os.WriteFile(filepath.Join(dlqDir, "metrics.lp"), []byte("# rejected\n"+line), 0644); err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(dir, "config.yaml")
+	content := fmt.Sprintf(`
+source:
+  type: 3
+  url: "http://localhost:8181"
+target:
+  type: 3
+  url: %q
+  compat_mode: native
+sync:
+  dead_letter_dir: %q
+`, server.URL, dlqDir)
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ReplayDLQ(configPath); err != nil {
+		t.Fatalf("ReplayDLQ() error = %v", err)
+	}
+	if len(writes) != 1 || writes[0] != line {
+		t.Errorf("目标端写入 = %q, want %q", writes, line)
+	}
+}
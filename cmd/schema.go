@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ygqygq2/influxdb-sync/internal/common"
+	"github.com/ygqygq2/influxdb-sync/internal/config"
+	"github.com/ygqygq2/influxdb-sync/internal/logx"
+)
+
+// ErrSchemaMismatch 目标端的结构与源端不一致
+var ErrSchemaMismatch = errors.New("源端和目标端结构不一致")
+
+// SchemaExport 导出源端每个数据库的 measurement、tag 和字段类型，
+// outPath 扩展名为 .yaml/.yml 时写入 YAML，否则写入 JSON
+func SchemaExport(cfgPath, outPath string) error {
+	cfg, err := config.LoadConfig(cfgPath)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := notifyShutdown()
+	defer cancel()
+
+	syncConfig := newSyncConfig(cfg)
+	source, err := newSource(cfg, syncConfig.SourceDB)
+	if err != nil {
+		return err
+	}
+	schema, err := common.NewSyncer(syncConfig, source, nil).ExportSchema(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return common.ErrInterrupted
+		}
+		return err
+	}
+	if err := schema.Save(outPath); err != nil {
+		return err
+	}
+	logx.Info(fmt.Sprintf("结构已写入 %s，共 %d 个数据库", outPath, len(schema.Databases)))
+	return nil
+}
+
+// SchemaDiff 比较源端和目标端的结构并打印差异。outPath 不为空时把差异列表写入该 JSON 文件
+func SchemaDiff(cfgPath, outPath string) error {
+	cfg, err := config.LoadConfig(cfgPath)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := notifyShutdown()
+	defer cancel()
+
+	syncConfig := newSyncConfig(cfg)
+	source, err := newSource(cfg, syncConfig.SourceDB)
+	if err != nil {
+		return err
+	}
+	targetSource, err := newTargetSource(cfg)
+	if err != nil {
+		return err
+	}
+	syncer := common.NewSyncer(syncConfig, source, nil)
+	diffs, err := syncer.DiffSchema(ctx, targetSource)
+	if err != nil {
+		if ctx.Err() != nil {
+			return common.ErrInterrupted
+		}
+		return err
+	}
+
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	if outPath != "" {
+		if err := common.SaveSchemaDiffs(outPath, diffs); err != nil {
+			return err
+		}
+		logx.Info(fmt.Sprintf("结构差异已写入 %s", outPath))
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("%w: %d 处差异", ErrSchemaMismatch, len(diffs))
+	}
+	return nil
+}
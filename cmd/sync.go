@@ -2,14 +2,20 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/ygqygq2/influxdb-sync/internal/common"
 	"github.com/ygqygq2/influxdb-sync/internal/config"
 	"github.com/ygqygq2/influxdb-sync/internal/influxdb1"
 	"github.com/ygqygq2/influxdb-sync/internal/influxdb2"
 	"github.com/ygqygq2/influxdb-sync/internal/influxdb3"
+	"github.com/ygqygq2/influxdb-sync/internal/logx"
 )
 
 // detectSyncMode 根据配置自动识别同步模式
@@ -68,10 +74,15 @@ func Run(cfgPath string) error {
 		return err
 	}
 
+	ctx, cancel := notifyShutdown()
+	defer cancel()
+
 	// 自动识别同步模式
-	mode := detectSyncMode(cfg)
+	return runMode(ctx, detectSyncMode(cfg), newSyncConfig(cfg))
+}
 
-	// 转换配置为通用格式
+// 转换配置为通用格式
+func newSyncConfig(cfg *config.Config) common.SyncConfig {
 	// 对于3.x版本，优先使用Database字段；对于1.x/2.x版本，使用DB字段
 	sourceDB := cfg.Source.DB
 	if cfg.Source.Type == 3 && cfg.Source.Database != "" {
@@ -83,76 +94,196 @@ func Run(cfgPath string) error {
 		targetDB = cfg.Target.Database
 	}
 
-	syncConfig := common.SyncConfig{
-		SourceAddr:      cfg.Source.URL,
-		SourceUser:      cfg.Source.User,
-		SourcePass:      cfg.Source.Pass,
-		SourceDB:        sourceDB,
-		SourceDBExclude: cfg.Source.DBExclude,
-		SourceToken:     cfg.Source.Token,
-		SourceOrg:       cfg.Source.Org,
-		SourceBucket:    cfg.Source.Bucket,
-		TargetAddr:      cfg.Target.URL,
-		TargetUser:      cfg.Target.User,
-		TargetPass:      cfg.Target.Pass,
-		TargetDB:        targetDB,
-		TargetDBPrefix:  cfg.Target.DBPrefix,
-		TargetDBSuffix:  cfg.Target.DBSuffix,
-		TargetToken:     cfg.Target.Token,
-		TargetOrg:       cfg.Target.Org,
-		TargetBucket:    cfg.Target.Bucket,
-		BatchSize:       cfg.Sync.BatchSize,
-		Start:           cfg.Sync.Start,
-		End:             cfg.Sync.End,
-		ResumeFile:      cfg.Sync.ResumeFile,
-		Parallel:        cfg.Sync.Parallel,
-		RetryCount:      cfg.Sync.RetryCount,
-		RetryInterval:   cfg.Sync.RetryInterval,
-		RateLimit:       cfg.Sync.RateLimit,
-		LogLevel:        cfg.Log.Level,
+	return common.SyncConfig{
+		SourceAddr:               cfg.Source.URL,
+		SourceUser:               cfg.Source.User,
+		SourcePass:               cfg.Source.Pass,
+		SourceDB:                 sourceDB,
+		SourceDBExclude:          cfg.Source.DBExclude,
+		SourceToken:              cfg.Source.Token,
+		SourceOrg:                cfg.Source.Org,
+		SourceBucket:             cfg.Source.Bucket,
+		SourceCompatMode:         cfg.Source.CompatMode,
+		SourceNamespace:          cfg.Source.Namespace,
+		TargetAddr:               cfg.Target.URL,
+		TargetUser:               cfg.Target.User,
+		TargetPass:               cfg.Target.Pass,
+		TargetDB:                 targetDB,
+		TargetDBPrefix:           cfg.Target.DBPrefix,
+		TargetDBSuffix:           cfg.Target.DBSuffix,
+		TargetToken:              cfg.Target.Token,
+		TargetOrg:                cfg.Target.Org,
+		TargetBucket:             cfg.Target.Bucket,
+		TargetCompatMode:         cfg.Target.CompatMode,
+		TargetNamespace:          cfg.Target.Namespace,
+		BatchSize:                cfg.Sync.BatchSize,
+		Start:                    cfg.Sync.Start,
+		End:                      cfg.Sync.End,
+		ResumeFile:               cfg.Sync.ResumeFile,
+		CheckpointType:           cfg.Sync.Checkpoint.Type,
+		CheckpointDB:             cfg.Sync.Checkpoint.Database,
+		Parallel:                 cfg.Sync.Parallel,
+		RetryCount:               cfg.Sync.RetryCount,
+		RetryInterval:            cfg.Sync.RetryInterval,
+		RateLimit:                cfg.Sync.RateLimit,
+		Follow:                   cfg.Sync.Follow.Enabled,
+		FollowInterval:           time.Duration(cfg.Sync.Follow.Interval) * time.Second,
+		FollowLookback:           time.Duration(cfg.Sync.Follow.Lookback) * time.Second,
+		QueryTimeout:             time.Duration(cfg.Sync.QueryTimeout) * time.Second,
+		WriteTimeout:             time.Duration(cfg.Sync.WriteTimeout) * time.Second,
+		MaxInflightBytes:         int64(cfg.Sync.MaxInflightMB) << 20,
+		ShardWindow:              time.Duration(cfg.Sync.ShardHours) * time.Hour,
+		AdaptiveBatch:            cfg.Sync.AdaptiveBatch.Enabled,
+		MinBatchSize:             cfg.Sync.AdaptiveBatch.Min,
+		MaxBatchSize:             cfg.Sync.AdaptiveBatch.Max,
+		TargetWriteLatency:       time.Duration(cfg.Sync.AdaptiveBatch.TargetLatencyMs) * time.Millisecond,
+		TargetBatchBytes:         int64(cfg.Sync.AdaptiveBatch.TargetBodyKB) << 10,
+		SourcePointsPerSec:       cfg.Sync.Throughput.Source.PointsPerSec,
+		SourceBytesPerSec:        cfg.Sync.Throughput.Source.BytesPerSec,
+		TargetPointsPerSec:       cfg.Sync.Throughput.Target.PointsPerSec,
+		TargetBytesPerSec:        cfg.Sync.Throughput.Target.BytesPerSec,
+		DeadLetterDir:            cfg.Sync.DeadLetterDir,
+		OnError:                  cfg.Sync.OnError,
+		MaxFailures:              cfg.Sync.MaxFailures,
+		ReportFile:               cfg.Sync.ReportFile,
+		Version:                  Version,
+		CreateMissing:            cfg.Sync.CreateMissing.Enabled,
+		CreateRetention:          time.Duration(cfg.Sync.CreateMissing.RetentionHours) * time.Hour,
+		AllRetentionPolicies:     cfg.Sync.RetentionPolicies.All,
+		RetentionPolicyMap:       cfg.Sync.RetentionPolicies.Mapping,
+		CreateDBRP:               cfg.Sync.CreateDBRP,
+		MigrateContinuousQueries: cfg.Sync.MigrateContinuousQueries,
+		LogLevel:                 cfg.Log.Level,
 	}
+}
 
-	// 根据模式选择同步方式
+// 根据模式选择同步方式
+func runMode(ctx context.Context, mode string, syncConfig common.SyncConfig) error {
 	switch strings.ToLower(mode) {
 	case "1x1x", "1x-1x", "":
 		// 兼容原有的1x-1x同步
-		return runInfluxdb1Sync(syncConfig)
+		return runInfluxdb1Sync(ctx, syncConfig)
 	case "1x2x", "1x-2x":
 		// 1x到2x同步
-		return influxdb1.Sync1x2x(context.Background(), syncConfig)
+		return influxdb1.Sync1x2x(ctx, syncConfig)
 	case "2x2x", "2x-2x":
 		// 2x到2x同步
-		return influxdb2.Sync2x2x(context.Background(), syncConfig)
+		return influxdb2.Sync2x2x(ctx, syncConfig)
 	case "1x3x", "1x-3x":
 		// 1x到3x同步
-		return influxdb3.Sync1x3x(context.Background(), syncConfig)
+		return influxdb3.Sync1x3x(ctx, syncConfig)
 	case "2x3x", "2x-3x":
 		// 2x到3x同步
-		return influxdb3.Sync2x3x(context.Background(), syncConfig)
+		return influxdb3.Sync2x3x(ctx, syncConfig)
 	case "3x3x", "3x-3x":
 		// 3x到3x同步
-		return influxdb3.Sync3x3x(context.Background(), syncConfig)
+		return influxdb3.Sync3x3x(ctx, syncConfig)
 	default:
 		return fmt.Errorf("不支持的同步模式: %s，支持的模式: 1x1x, 1x2x, 2x2x, 1x3x, 2x3x, 3x3x", mode)
 	}
 }
 
 // runInfluxdb1Sync 执行原有的1x-1x同步
-func runInfluxdb1Sync(cfg common.SyncConfig) error {
+func runInfluxdb1Sync(ctx context.Context, cfg common.SyncConfig) error {
 	// 转换为influxdb1的配置格式
 	c := influxdb1.SyncConfig{
-		SourceAddr: cfg.SourceAddr,
-		SourceUser: cfg.SourceUser,
-		SourcePass: cfg.SourcePass,
-		SourceDB:   cfg.SourceDB,
-		TargetAddr: cfg.TargetAddr,
-		TargetUser: cfg.TargetUser,
-		TargetPass: cfg.TargetPass,
-		TargetDB:   cfg.TargetDB,
-		BatchSize:  cfg.BatchSize,
-		ResumeFile: cfg.ResumeFile,
+		SourceAddr:               cfg.SourceAddr,
+		SourceUser:               cfg.SourceUser,
+		SourcePass:               cfg.SourcePass,
+		SourceDB:                 cfg.SourceDB,
+		TargetAddr:               cfg.TargetAddr,
+		TargetUser:               cfg.TargetUser,
+		TargetPass:               cfg.TargetPass,
+		TargetDB:                 cfg.TargetDB,
+		BatchSize:                cfg.BatchSize,
+		Start:                    cfg.Start,
+		End:                      cfg.End,
+		ResumeFile:               cfg.ResumeFile,
+		CheckpointType:           cfg.CheckpointType,
+		CheckpointDB:             cfg.CheckpointDB,
+		Follow:                   cfg.Follow,
+		FollowInterval:           cfg.FollowInterval,
+		FollowLookback:           cfg.FollowLookback,
+		QueryTimeout:             cfg.QueryTimeout,
+		WriteTimeout:             cfg.WriteTimeout,
+		MaxInflightBytes:         cfg.MaxInflightBytes,
+		ShardWindow:              cfg.ShardWindow,
+		AdaptiveBatch:            cfg.AdaptiveBatch,
+		MinBatchSize:             cfg.MinBatchSize,
+		MaxBatchSize:             cfg.MaxBatchSize,
+		TargetWriteLatency:       cfg.TargetWriteLatency,
+		TargetBatchBytes:         cfg.TargetBatchBytes,
+		SourcePointsPerSec:       cfg.SourcePointsPerSec,
+		SourceBytesPerSec:        cfg.SourceBytesPerSec,
+		TargetPointsPerSec:       cfg.TargetPointsPerSec,
+		TargetBytesPerSec:        cfg.TargetBytesPerSec,
+		DeadLetterDir:            cfg.DeadLetterDir,
+		OnError:                  cfg.OnError,
+		MaxFailures:              cfg.MaxFailures,
+		Plan:                     cfg.Plan,
+		ReportFile:               cfg.ReportFile,
+		Version:                  cfg.Version,
+		CreateMissing:            cfg.CreateMissing,
+		CreateRetention:          cfg.CreateRetention,
+		AllRetentionPolicies:     cfg.AllRetentionPolicies,
+		RetentionPolicyMap:       cfg.RetentionPolicyMap,
+		CreateDBRP:               cfg.CreateDBRP,
+		MigrateContinuousQueries: cfg.MigrateContinuousQueries,
+	}
+	return influxdb1.Sync(ctx, c)
+}
+
+// Version 工具版本，由 main 包设置，记录在运行报告中
+var Version = "dev"
+
+// 进程退出码
+const (
+	ExitOK          = 0
+	ExitFailure     = 1   // 没有 measurement 同步完成，或配置、连接等错误
+	ExitPartial     = 2   // 部分 measurement 同步完成，其余失败
+	ExitInterrupted = 130 // 收到 SIGINT/SIGTERM，已完成的批次断点均已保存
+)
+
+// ExitCode 根据同步结果返回进程退出码
+func ExitCode(err error) int {
+	var syncErr *common.SyncError
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, common.ErrInterrupted):
+		return ExitInterrupted
+	case errors.As(err, &syncErr) && syncErr.Partial():
+		return ExitPartial
+	default:
+		return ExitFailure
+	}
+}
+
+// notifyShutdown 收到第一个 SIGINT/SIGTERM 时取消 ctx，worker 完成当前批次、保存断点后退出；
+// 再次收到信号时立即退出
+func notifyShutdown() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-sigCh:
+			logx.Warn(fmt.Sprintf("收到信号 %v，完成当前批次并保存断点后退出，再次发送信号将立即退出", sig))
+			cancel()
+		case <-ctx.Done():
+			return
+		}
+		if sig, ok := <-sigCh; ok {
+			logx.Error(fmt.Sprintf("再次收到信号 %v，立即退出", sig))
+			os.Exit(ExitInterrupted)
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(sigCh)
+		cancel()
 	}
-	return influxdb1.Sync(context.Background(), c)
 }
 
 // ShowUsage 显示使用说明
@@ -161,6 +292,13 @@ func ShowUsage() {
 	fmt.Println("")
 	fmt.Println("用法:")
 	fmt.Println("  influxdb-sync <config.yaml>")
+	fmt.Println("  influxdb-sync plan <config.yaml> [plan.json]  连接源端生成迁移计划，默认写入 plan.json")
+	fmt.Println("  influxdb-sync apply <plan.json>  按迁移计划执行同步")
+	fmt.Println("  influxdb-sync verify <config.yaml> [diffs.json]  按时间窗口比较源端和目标端，可把不一致窗口写入 JSON 文件")
+	fmt.Println("  influxdb-sync repair <config.yaml> [diffs.json]  只重新同步不一致的时间窗口并重新校验，未指定列表时先校验")
+	fmt.Println("  influxdb-sync replay-dlq <config.yaml>  重新写入死信目录中的点")
+	fmt.Println("  influxdb-sync schema export <config.yaml> [schema.json|schema.yaml]  导出源端的 measurement、tag 和字段类型，默认写入 schema.json")
+	fmt.Println("  influxdb-sync schema diff <config.yaml> [schema_diffs.json]  比较源端和目标端的结构，报告缺少的 measurement、tag 和字段类型不一致")
 	fmt.Println("")
 	fmt.Println("参数:")
 	fmt.Println("  config.yaml  配置文件路径")
@@ -180,4 +318,11 @@ func ShowUsage() {
 	fmt.Println("  influxdb-sync config_1x3x.yaml")
 	fmt.Println("  influxdb-sync config_2x3x.yaml")
 	fmt.Println("  influxdb-sync config_3x3x.yaml")
+	fmt.Println("  influxdb-sync plan config.yaml plan.json")
+	fmt.Println("  influxdb-sync apply plan.json")
+	fmt.Println("  influxdb-sync verify config.yaml diffs.json")
+	fmt.Println("  influxdb-sync repair config.yaml diffs.json")
+	fmt.Println("  influxdb-sync replay-dlq config.yaml")
+	fmt.Println("  influxdb-sync schema export config.yaml schema.yaml")
+	fmt.Println("  influxdb-sync schema diff config.yaml")
 }
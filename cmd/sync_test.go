@@ -1,9 +1,19 @@
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+
+	"github.com/ygqygq2/influxdb-sync/internal/common"
 )
 
 func TestShowUsage(t *testing.T) {
@@ -225,3 +235,102 @@ log:
 		t.Logf("预期的错误（可能是连接失败）: %v", err)
 	}
 }
+
+func TestExitCode(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected int
+	}{
+		{nil, ExitOK},
+		{errors.New("连接失败"), ExitFailure},
+		{common.ErrInterrupted, ExitInterrupted},
+		{fmt.Errorf("同步 db1: %w", common.ErrInterrupted), ExitInterrupted},
+		{&common.SyncError{Failures: make([]common.Failure, 2)}, ExitFailure},
+		{&common.SyncError{Failures: make([]common.Failure, 1), Succeeded: 3}, ExitPartial},
+	}
+
+	for _, tc := range testCases {
+		if got := ExitCode(tc.err); got != tc.expected {
+			t.Errorf("ExitCode(%v) = %d, 期望 %d", tc.err, got, tc.expected)
+		}
+	}
+}
+
+// compat_mode: native 的配置应通过 /api/v3/query_sql 读取源库、通过 /v1/write 写入目标库
+func TestRunNativeCompatMode(t *testing.T) {
+	var mu sync.Mutex
+	var queries, writes []string
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			return
+		}
+		var body map[string]string
+		if r.URL.Path != "/api/v3/query_sql" || json.NewDecoder(r.Body).Decode(&body) != nil || body["db"] != "metrics" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		q := body["q"]
+		mu.Lock()
+		queries = append(queries, q)
+		mu.Unlock()
+		switch {
+		case strings.Contains(q, "information_schema.tables"):
+			fmt.Fprintln(w, `{"table_name":"cpu"}`)
+		case strings.Contains(q, "information_schema.columns"):
+			fmt.Fprintln(w, `{"column_name":"host","data_type":"Dictionary(Int32, Utf8)"}`)
+			fmt.Fprintln(w, `{"column_name":"time","data_type":"Timestamp(Nanosecond, None)"}`)
+			fmt.Fprintln(w, `{"column_name":"count","data_type":"Int64"}`)
+		case strings.Contains(q, "min(time)"), strings.Contains(q, "max(time)"):
+			fmt.Fprintln(w, `{"time":"2024-01-01T00:00:00"}`)
+		default:
+			fmt.Fprintln(w, `{"count":1,"host":"a","time":"2024-01-01T00:00:00"}`)
+		}
+	}))
+	defer source.Close()
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			return
+		}
+		if r.URL.Path != "/v1/write" || r.URL.Query().Get("database") != "copy_metrics" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		writes = append(writes, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer target.Close()
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	content := fmt.Sprintf(`
+source:
+  type: 3
+  url: %q
+  database: metrics
+  compat_mode: native
+target:
+  type: 3
+  url: %q
+  db_prefix: copy_
+  compat_mode: native
+sync:
+  batch_size: 100
+  resume_file: %q
+`, source.URL, target.URL, filepath.Join(dir, "resume.state"))
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Run(configPath); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(queries) == 0 {
+		t.Error("源端应通过 SQL 查询读取")
+	}
+	if len(writes) != 1 || !strings.HasPrefix(writes[0], "cpu,host=a count=1i ") {
+		t.Errorf("目标端写入 = %q", writes)
+	}
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ygqygq2/influxdb-sync/internal/common"
+	"github.com/ygqygq2/influxdb-sync/internal/config"
+	"github.com/ygqygq2/influxdb-sync/internal/influxdb1"
+	"github.com/ygqygq2/influxdb-sync/internal/influxdb2"
+	"github.com/ygqygq2/influxdb-sync/internal/influxdb3"
+	"github.com/ygqygq2/influxdb-sync/internal/logx"
+)
+
+// ErrMismatch 校验发现源端和目标端不一致
+var ErrMismatch = errors.New("源端和目标端数据不一致")
+
+// Verify 按时间窗口比较源端和目标端每个 measurement 的点数（可选字段校验和），
+// 打印不一致的窗口。outPath 不为空时把不一致窗口列表写入该 JSON 文件
+func Verify(cfgPath, outPath string) error {
+	cfg, err := config.LoadConfig(cfgPath)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := notifyShutdown()
+	defer cancel()
+
+	syncConfig := newSyncConfig(cfg)
+	source, err := newSource(cfg, syncConfig.SourceDB)
+	if err != nil {
+		return err
+	}
+	targetSource, err := newTargetSource(cfg)
+	if err != nil {
+		return err
+	}
+	syncer := common.NewSyncer(syncConfig, source, nil)
+	diffs, err := syncer.Verify(ctx, targetSource, verifyOptions(cfg))
+	if err != nil {
+		if ctx.Err() != nil {
+			return common.ErrInterrupted
+		}
+		return err
+	}
+
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	if outPath != "" {
+		if err := common.SaveWindowDiffs(outPath, diffs); err != nil {
+			return err
+		}
+		logx.Info(fmt.Sprintf("不一致窗口列表已写入 %s", outPath))
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("%w: %d 个时间窗口", ErrMismatch, len(diffs))
+	}
+	return nil
+}
+
+func verifyOptions(cfg *config.Config) common.VerifyOptions {
+	return common.VerifyOptions{
+		Window:   time.Duration(cfg.Verify.WindowHours) * time.Hour,
+		Checksum: cfg.Verify.Checksum,
+	}
+}
+
+// 按配置的目标端版本创建读取目标端的数据源，查询时按目标库名称读取
+func newTargetSource(cfg *config.Config) (common.DataSource, error) {
+	switch detectSyncMode(cfg)[2:] {
+	case "2x":
+		return &influxdb2.Adapter{
+			URL:   cfg.Target.URL,
+			Token: cfg.Target.Token,
+			Org:   cfg.Target.Org,
+		}, nil
+	case "3x":
+		return influxdb3.NewTargetSource(newSyncConfig(cfg), "")
+	default:
+		return influxdb1.NewDataSource(influxdb1.DataSourceConfig{
+			Addr: cfg.Target.URL,
+			User: cfg.Target.User,
+			Pass: cfg.Target.Pass,
+		}), nil
+	}
+}
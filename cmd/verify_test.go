@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ygqygq2/influxdb-sync/internal/common"
+	"github.com/ygqygq2/influxdb-sync/internal/config"
+	"github.com/ygqygq2/influxdb-sync/internal/influxdb1"
+	"github.com/ygqygq2/influxdb-sync/internal/influxdb2"
+	"github.com/ygqygq2/influxdb-sync/internal/influxdb3"
+)
+
+func TestNewTargetSource(t *testing.T) {
+	cfg := &config.Config{Target: config.DBConfig{Type: 1, URL: "http://target:8086"}}
+	if s, err := newTargetSource(cfg); err != nil {
+		t.Fatalf("newTargetSource() error = %v", err)
+	} else if _, ok := s.(*influxdb1.DataSource); !ok {
+		t.Error("1.x 目标应创建 influxdb1.DataSource")
+	}
+
+	cfg.Target = config.DBConfig{Type: 2, URL: "http://target:8086", Bucket: "fixed"}
+	if s, err := newTargetSource(cfg); err != nil {
+		t.Fatalf("newTargetSource() error = %v", err)
+	} else if a, ok := s.(*influxdb2.Adapter); !ok || a.Bucket != "" {
+		t.Error("2.x 目标应创建按查询中的 bucket 读取的 influxdb2.Adapter")
+	}
+
+	cfg.Target = config.DBConfig{Type: 3}
+	if s, err := newTargetSource(cfg); err != nil {
+		t.Fatalf("newTargetSource() error = %v", err)
+	} else if _, ok := s.(*influxdb3.DataSource3x); !ok {
+		t.Error("3.x 目标应创建 influxdb3.DataSource3x")
+	}
+}
+
+func TestVerifyOptions(t *testing.T) {
+	cfg := &config.Config{Verify: config.VerifyConfig{WindowHours: 6, Checksum: true}}
+	if opts := verifyOptions(cfg); opts.Window.Hours() != 6 || !opts.Checksum {
+		t.Errorf("校验参数转换错误: %+v", opts)
+	}
+}
+
+func TestRepairWithEmptyDiffs(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	content := `
+source:
+  type: 1
+  url: "http://localhost:8086"
+target:
+  type: 1
+  url: "http://localhost:8087"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("无法创建测试配置文件: %v", err)
+	}
+	diffsPath := filepath.Join(dir, "diffs.json")
+	if err := common.SaveWindowDiffs(diffsPath, nil); err != nil {
+		t.Fatalf("保存不一致窗口列表失败: %v", err)
+	}
+
+	// 没有不一致的窗口时不需要连接源端和目标端
+	if err := Repair(configPath, diffsPath); err != nil {
+		t.Errorf("没有需要修复的窗口时应成功, 实际为: %v", err)
+	}
+}
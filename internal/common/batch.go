@@ -0,0 +1,156 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ygqygq2/influxdb-sync/internal/lineprotocol"
+	"github.com/ygqygq2/influxdb-sync/internal/logx"
+)
+
+// 自适应批次大小：每个 measurement 一个，根据写入耗时和请求体大小调整，
+// 同一 measurement 的所有时间窗口和 follow 轮次共用
+type batchSizer struct {
+	name     string
+	adaptive bool
+	min, max int
+	// 目标写入耗时和请求体大小
+	latency time.Duration
+	bytes   int64
+
+	size int
+	mu   sync.Mutex
+}
+
+func newBatchSizer(name string, cfg SyncConfig, initial int) *batchSizer {
+	b := &batchSizer{
+		name:     name,
+		adaptive: cfg.AdaptiveBatch,
+		min:      cfg.MinBatchSize,
+		max:      cfg.MaxBatchSize,
+		latency:  cfg.TargetWriteLatency,
+		bytes:    cfg.TargetBatchBytes,
+		size:     initial,
+	}
+	if b.min <= 0 {
+		b.min = 100
+	}
+	if b.max <= 0 {
+		b.max = 50000
+	}
+	if b.max < b.min {
+		b.max = b.min
+	}
+	if b.latency <= 0 {
+		b.latency = 2 * time.Second
+	}
+	if b.bytes <= 0 {
+		b.bytes = 4 << 20
+	}
+	if b.adaptive {
+		b.size = b.clamp(initial)
+	}
+	return b
+}
+
+// 当前批次大小
+func (b *batchSizer) current() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.size
+}
+
+// observe 记录一次成功写入，按每个点的平均耗时和大小估算达到目标所需的批次大小。
+// 只根据满批调整，最后一批点数少、固定开销占比高，估算不准
+func (b *batchSizer) observe(points int, bytes int64, latency time.Duration) {
+	if !b.adaptive || points <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if points < b.size {
+		return
+	}
+
+	ideal := float64(points) * float64(b.bytes) / float64(max(bytes, 1))
+	if latency > 0 {
+		ideal = min(ideal, float64(points)*float64(b.latency)/float64(latency))
+	}
+	// 每次最多翻倍或减半，变化不足 20% 时不调整，避免来回抖动
+	next := b.clamp(int(min(max(ideal, float64(b.size)/2), float64(b.size)*2)))
+	if abs(next-b.size)*5 < b.size {
+		return
+	}
+	b.set(next, fmt.Sprintf("写入 %d 个点耗时 %v，约 %d 字节", points, latency.Round(time.Millisecond), bytes))
+}
+
+// backoff 写入超时或请求体过大时把批次减半
+func (b *batchSizer) backoff(reason string) {
+	if !b.adaptive {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if next := b.clamp(b.size / 2); next != b.size {
+		b.set(next, reason)
+	}
+}
+
+func (b *batchSizer) set(next int, reason string) {
+	logx.Info(fmt.Sprintf("measurement %s 批次大小 %d -> %d（%s）", b.name, b.size, next, reason))
+	b.size = next
+}
+
+func (b *batchSizer) clamp(n int) int {
+	return min(max(n, b.min), b.max)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// 一批数据点编码为 line protocol 后的请求体字节数，无法编码的点不计入
+func encodedSize(points []DataPoint) int64 {
+	var size int64
+	var buf []byte
+	for _, p := range points {
+		line, err := lineprotocol.AppendPoint(buf[:0], p.Measurement, p.Tags, p.Fields, p.Time)
+		if err == nil {
+			size += int64(len(line))
+		}
+		buf = line
+	}
+	return size
+}
+
+// 目标端拒绝过大的请求体（HTTP 413）。没有状态码时只匹配标准的状态文本，
+// 避免把错误信息中恰好含有 413 的时间戳、行号等误判为请求体过大
+func isEntityTooLarge(err error) bool {
+	var ae *AdapterError
+	if errors.As(err, &ae) && ae.StatusCode == http.StatusRequestEntityTooLarge {
+		return true
+	}
+	return strings.Contains(strings.ToLower(err.Error()), "request entity too large")
+}
+
+// 写入超时
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var t interface{ Timeout() bool }
+	if errors.As(err, &t) && t.Timeout() {
+		return true
+	}
+	return strings.Contains(strings.ToLower(err.Error()), "timeout")
+}
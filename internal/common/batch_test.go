@@ -0,0 +1,155 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBatchSizer(t *testing.T) {
+	cfg := SyncConfig{
+		AdaptiveBatch:      true,
+		MinBatchSize:       100,
+		MaxBatchSize:       10000,
+		TargetWriteLatency: time.Second,
+		TargetBatchBytes:   1 << 20,
+	}
+	b := newBatchSizer("db/cpu", cfg, 1000)
+
+	// 写入很快且请求体很小时最多翻倍
+	b.observe(1000, 1000, 10*time.Millisecond)
+	if got := b.current(); got != 2000 {
+		t.Errorf("期望增大到 2000, 实际为 %d", got)
+	}
+
+	// 不满一批时不调整
+	b.observe(10, 10, 5*time.Second)
+	if got := b.current(); got != 2000 {
+		t.Errorf("不满一批时不应调整, 实际为 %d", got)
+	}
+
+	// 耗时超出目标时按比例缩小
+	b.observe(2000, 1000, 1600*time.Millisecond)
+	if got := b.current(); got != 1250 {
+		t.Errorf("期望缩小到 1250, 实际为 %d", got)
+	}
+
+	// 请求体超出目标时按比例缩小
+	b.observe(1250, 2<<20, 10*time.Millisecond)
+	if got := b.current(); got != 625 {
+		t.Errorf("期望缩小到 625, 实际为 %d", got)
+	}
+
+	// 接近目标时不调整
+	b.observe(625, 900<<10, 10*time.Millisecond)
+	if got := b.current(); got != 625 {
+		t.Errorf("变化不足 20%% 时不应调整, 实际为 %d", got)
+	}
+
+	// 超时后减半，不低于下限
+	for i := 0; i < 5; i++ {
+		b.backoff("写入超时")
+	}
+	if got := b.current(); got != 100 {
+		t.Errorf("期望减到下限 100, 实际为 %d", got)
+	}
+
+	// 初始值超出上下限时截断
+	if got := newBatchSizer("db/cpu", cfg, 50000).current(); got != 10000 {
+		t.Errorf("期望截断到上限 10000, 实际为 %d", got)
+	}
+
+	// 未开启时保持固定大小
+	fixed := newBatchSizer("db/cpu", SyncConfig{}, 10)
+	fixed.observe(10, 1, time.Millisecond)
+	fixed.backoff("写入超时")
+	if got := fixed.current(); got != 10 {
+		t.Errorf("未开启自适应时批次大小应保持 10, 实际为 %d", got)
+	}
+}
+
+func TestWriteErrorClassification(t *testing.T) {
+	if !isEntityTooLarge(errors.New("413 Request Entity Too Large")) {
+		t.Error("应识别请求体过大")
+	}
+	if !isTimeout(fmt.Errorf("write: %w", context.DeadlineExceeded)) {
+		t.Error("应识别 ctx 超时")
+	}
+	if !isEntityTooLarge(NewHTTPError(http.StatusRequestEntityTooLarge, 0, errors.New("write failed"))) {
+		t.Error("应按状态码识别请求体过大")
+	}
+	if isEntityTooLarge(errors.New("写入失败")) || isTimeout(errors.New("写入失败")) {
+		t.Error("普通错误不应被识别为超时或请求体过大")
+	}
+	// 错误信息中的数字恰好是 413 时不应拆分批次
+	for _, msg := range []string{"unable to parse line 413", "partial write: points beyond retention policy dropped=413", "point time 1700000413000000000 out of range"} {
+		if isEntityTooLarge(NewHTTPError(http.StatusBadRequest, 0, errors.New(msg))) {
+			t.Errorf("%q 不应被识别为请求体过大", msg)
+		}
+	}
+}
+
+func TestEncodedSize(t *testing.T) {
+	points := []DataPoint{
+		{Measurement: "cpu", Tags: map[string]string{"host": "a b"}, Fields: map[string]interface{}{"value": 1.5}, Time: time.Unix(0, 1)},
+		{Measurement: "cpu", Fields: map[string]interface{}{"n": int64(2)}, Time: time.Unix(0, 2)},
+		// 无法编码的点不计入
+		{Measurement: "cpu", Fields: map[string]interface{}{}, Time: time.Unix(0, 3)},
+	}
+	want := len("cpu,host=a\\ b value=1.5 1\n") + len("cpu n=2i 2\n")
+	if got := encodedSize(points); got != int64(want) {
+		t.Errorf("期望请求体 %d 字节, 实际为 %d", want, got)
+	}
+}
+
+// 单次写入超过 limit 个点时返回 413 的目标
+type limitedDataTarget struct {
+	mockDataTarget
+	limit    int
+	rejected int
+}
+
+func (m *limitedDataTarget) WritePoints(ctx context.Context, db string, points []DataPoint) error {
+	if len(points) > m.limit {
+		m.mu.Lock()
+		m.rejected++
+		m.mu.Unlock()
+		return errors.New("413 Request Entity Too Large")
+	}
+	return m.mockDataTarget.WritePoints(ctx, db, points)
+}
+
+func TestSyncSplitsTooLargeBatch(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := &seriesDataSource{mockDataSource: mockDataSource{measurements: []string{"cpu"}}}
+	for i := 0; i < 1000; i++ {
+		source.add(DataPoint{Measurement: "cpu", Fields: map[string]interface{}{"value": i}, Time: base.Add(time.Duration(i) * time.Second)})
+	}
+	target := &limitedDataTarget{limit: 300}
+
+	cfg := SyncConfig{
+		SourceDB:      "testdb",
+		BatchSize:     800,
+		AdaptiveBatch: true,
+		MinBatchSize:  100,
+		RetryInterval: 1,
+	}
+	syncer := NewSyncer(cfg, source, target)
+	if err := syncer.Sync(context.Background()); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	// 被拒绝的批次拆分后全部写入，后续批次按减小后的大小读取
+	if got := target.GetWrittenDataCount(); got != 1000 {
+		t.Errorf("期望写入 1000 个点, 实际为 %d", got)
+	}
+	if target.rejected == 0 {
+		t.Error("期望目标端拒绝过大的批次")
+	}
+	if got := syncer.batchSizer(CheckpointKey{DB: "testdb", Measurement: "cpu"}, 0).current(); got >= 800 {
+		t.Errorf("请求体过大后批次应减小, 实际为 %d", got)
+	}
+}
@@ -0,0 +1,69 @@
+package common
+
+import (
+	"context"
+	"sync"
+)
+
+// 跨 worker 共享的在途字节预算，限制已读取但尚未写入目标端的数据量
+type byteBudget struct {
+	limit int64
+	used  int64
+	wait  chan struct{}
+	mu    sync.Mutex
+}
+
+func newByteBudget(limit int64) *byteBudget {
+	return &byteBudget{limit: limit, wait: make(chan struct{})}
+}
+
+// acquire 占用 n 字节，预算不足时等待其他批次写完释放。
+// 单个批次超过总预算时，只要没有其他在途数据就放行，避免永久阻塞
+func (b *byteBudget) acquire(ctx context.Context, n int64) error {
+	for {
+		b.mu.Lock()
+		if b.limit <= 0 || b.used == 0 || b.used+n <= b.limit {
+			b.used += n
+			b.mu.Unlock()
+			return nil
+		}
+		wait := b.wait
+		b.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release 释放 n 字节并唤醒等待者
+func (b *byteBudget) release(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+	close(b.wait)
+	b.wait = make(chan struct{})
+}
+
+// 估算一批数据点占用的内存字节数
+func pointsSize(points []DataPoint) int64 {
+	var size int64
+	for _, p := range points {
+		// 结构体、map 头和时间戳的固定开销
+		size += 96 + int64(len(p.Measurement))
+		for k, v := range p.Tags {
+			size += int64(len(k) + len(v) + 16)
+		}
+		for k, v := range p.Fields {
+			size += int64(len(k) + 16)
+			if s, ok := v.(string); ok {
+				size += int64(len(s))
+			} else {
+				size += 8
+			}
+		}
+	}
+	return size
+}
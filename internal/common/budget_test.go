@@ -0,0 +1,64 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestByteBudget(t *testing.T) {
+	b := newByteBudget(100)
+	ctx := context.Background()
+
+	if err := b.acquire(ctx, 60); err != nil {
+		t.Fatalf("预算充足时应立即成功: %v", err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		_ = b.acquire(ctx, 60)
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("超出预算时应等待")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	b.release(60)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("释放后等待者应获得预算")
+	}
+	b.release(60)
+
+	// 单个批次超过总预算时，没有其他在途数据则放行
+	if err := b.acquire(ctx, 500); err != nil {
+		t.Fatalf("空闲时超大批次应放行: %v", err)
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := b.acquire(timeout, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ctx 结束时应返回错误, 实际为: %v", err)
+	}
+}
+
+func TestPointsSize(t *testing.T) {
+	small := []DataPoint{{Measurement: "cpu", Fields: map[string]interface{}{"value": 1.0}}}
+	large := []DataPoint{{
+		Measurement: "cpu",
+		Tags:        map[string]string{"host": "server01"},
+		Fields:      map[string]interface{}{"value": 1.0, "msg": "a long string field value"},
+	}}
+
+	if pointsSize(nil) != 0 {
+		t.Error("空批次大小应为 0")
+	}
+	if pointsSize(large) <= pointsSize(small) {
+		t.Error("包含更多标签和字段的点应估算得更大")
+	}
+}
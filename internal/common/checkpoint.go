@@ -0,0 +1,252 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ygqygq2/influxdb-sync/internal/logx"
+)
+
+// 断点存储类型
+const (
+	CheckpointTypeFile   = "file"
+	CheckpointTypeTarget = "target"
+)
+
+// 断点键，每个 (源库, 保留策略, measurement) 独立记录同步进度，RP 为空表示默认保留策略；
+// 大表按时间窗口拆分时，除最后一个窗口外每个窗口以 Shard（窗口起始时间）区分。
+// 窗口可能从 1970-01-01 开始，Shard 为 0 也是合法的窗口，因此用 Sharded 标记
+type CheckpointKey struct {
+	DB          string `json:"db"`
+	RP          string `json:"rp,omitempty"`
+	Measurement string `json:"measurement"`
+	Shard       int64  `json:"shard,omitempty"`
+	Sharded     bool   `json:"sharded,omitempty"`
+}
+
+// 从 start 开始的时间窗口的断点键
+func (k CheckpointKey) window(start int64) CheckpointKey {
+	k.Shard, k.Sharded = start, true
+	return k
+}
+
+func (k CheckpointKey) String() string {
+	name := k.DB + "/" + k.Measurement
+	if k.RP != "" {
+		name = k.DB + "/" + k.RP + "/" + k.Measurement
+	}
+	if k.Sharded {
+		return fmt.Sprintf("%s@%s", name, time.Unix(0, k.Shard).UTC().Format(time.RFC3339))
+	}
+	return name
+}
+
+// 单个 measurement 的同步进度，LastTime 和 Offset 对应分页游标
+type Checkpoint struct {
+	LastTime  int64     `json:"last_time"`
+	Offset    int       `json:"offset,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// 根据游标创建断点
+func NewCheckpoint(cur Cursor) Checkpoint {
+	return Checkpoint{LastTime: cur.Time, Offset: cur.Offset, UpdatedAt: time.Now()}
+}
+
+// Cursor 返回断点对应的分页游标
+func (cp Checkpoint) Cursor() Cursor {
+	return Cursor{Time: cp.LastTime, Offset: cp.Offset}
+}
+
+// 旧版本断点文件迁移后的断点键，对没有自己断点的 measurement 生效
+var legacyCheckpointKey = CheckpointKey{}
+
+// 断点存储接口，实现需保证并发安全
+type CheckpointStore interface {
+	// Lock 获取独占锁，防止两个任务同时使用同一份状态
+	Lock() error
+	Unlock() error
+	// Load 加载属于当前任务指纹的全部断点
+	Load() (map[CheckpointKey]Checkpoint, error)
+	// Save 保存单个 measurement 的断点
+	Save(key CheckpointKey, cp Checkpoint) error
+}
+
+// Fingerprint 根据源和目标的标识计算任务指纹，
+// 断点只会应用到指纹相同的任务上
+func Fingerprint(cfg SyncConfig) string {
+	parts := []string{
+		cfg.SourceAddr, cfg.SourceDB, cfg.SourceOrg, cfg.SourceBucket,
+		cfg.TargetAddr, cfg.TargetDB, cfg.TargetOrg, cfg.TargetBucket,
+		cfg.TargetDBPrefix, cfg.TargetDBSuffix,
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// 断点文件内容
+type checkpointFile struct {
+	Fingerprint string            `json:"fingerprint"`
+	Checkpoints []checkpointEntry `json:"checkpoints"`
+}
+
+type checkpointEntry struct {
+	CheckpointKey
+	Checkpoint
+}
+
+// 基于本地文件的断点存储
+type FileCheckpointStore struct {
+	path        string
+	fingerprint string
+	checkpoints map[CheckpointKey]Checkpoint
+	locked      bool
+	mu          sync.Mutex
+}
+
+// 创建文件断点存储
+func NewFileCheckpointStore(path, fingerprint string) *FileCheckpointStore {
+	return &FileCheckpointStore{
+		path:        path,
+		fingerprint: fingerprint,
+		checkpoints: make(map[CheckpointKey]Checkpoint),
+	}
+}
+
+func (f *FileCheckpointStore) lockPath() string {
+	return f.path + ".lock"
+}
+
+func (f *FileCheckpointStore) Lock() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	lf, err := os.OpenFile(f.lockPath(), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			owner, _ := os.ReadFile(f.lockPath())
+			return fmt.Errorf("断点文件 %s 已被其他任务锁定 (%s)，如确认没有任务在运行，请删除 %s",
+				f.path, strings.TrimSpace(string(owner)), f.lockPath())
+		}
+		return err
+	}
+	defer lf.Close()
+
+	if _, err := fmt.Fprintf(lf, "%s\n", lockOwner()); err != nil {
+		return err
+	}
+	f.locked = true
+	return nil
+}
+
+func (f *FileCheckpointStore) Unlock() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.locked {
+		return nil
+	}
+	f.locked = false
+	return os.Remove(f.lockPath())
+}
+
+func (f *FileCheckpointStore) Load() (map[CheckpointKey]Checkpoint, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	result := make(map[CheckpointKey]Checkpoint)
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, nil
+		}
+		return nil, err
+	}
+
+	content := strings.TrimSpace(string(data))
+	if content == "" {
+		return result, nil
+	}
+	// 旧版本的断点文件只记录一个时间戳，迁移为对所有 measurement 生效的断点
+	if t, err := time.Parse(time.RFC3339Nano, content); err == nil {
+		return f.migrateLegacy(t)
+	}
+
+	var state checkpointFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("解析断点文件 %s 失败: %v", f.path, err)
+	}
+	if state.Fingerprint != f.fingerprint {
+		return nil, fmt.Errorf("断点文件 %s 属于其他源/目标组合 (指纹 %s，当前 %s)，请更换 resume_file 或删除该文件",
+			f.path, state.Fingerprint, f.fingerprint)
+	}
+
+	for _, e := range state.Checkpoints {
+		key := e.CheckpointKey
+		// 旧版本只用非 0 的 Shard 表示窗口
+		if key.Shard != 0 {
+			key.Sharded = true
+		}
+		f.checkpoints[key] = e.Checkpoint
+		result[key] = e.Checkpoint
+	}
+	return result, nil
+}
+
+// 把旧版本的时间戳断点改写为当前格式，只在首次加载旧文件时执行一次
+func (f *FileCheckpointStore) migrateLegacy(last time.Time) (map[CheckpointKey]Checkpoint, error) {
+	cp := Checkpoint{LastTime: last.UnixNano(), UpdatedAt: time.Now()}
+	f.checkpoints[legacyCheckpointKey] = cp
+	if err := f.write(); err != nil {
+		return nil, fmt.Errorf("迁移旧版本断点文件 %s 失败: %v", f.path, err)
+	}
+	logx.Info(fmt.Sprintf("已将旧版本断点文件 %s 迁移为新格式，所有 measurement 从 %s 之后继续",
+		f.path, last.UTC().Format(time.RFC3339Nano)))
+	return map[CheckpointKey]Checkpoint{legacyCheckpointKey: cp}, nil
+}
+
+func (f *FileCheckpointStore) Save(key CheckpointKey, cp Checkpoint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.checkpoints[key] = cp
+	return f.write()
+}
+
+// 把全部断点写入文件，调用方需持有 f.mu
+func (f *FileCheckpointStore) write() error {
+	state := checkpointFile{Fingerprint: f.fingerprint}
+	for k, v := range f.checkpoints {
+		state.Checkpoints = append(state.Checkpoints, checkpointEntry{CheckpointKey: k, Checkpoint: v})
+	}
+	// 按键排序，保证文件内容稳定
+	sort.Slice(state.Checkpoints, func(i, j int) bool {
+		return state.Checkpoints[i].String() < state.Checkpoints[j].String()
+	})
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// 先写临时文件再重命名，避免中断时留下不完整的断点文件
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path)
+}
+
+// 锁持有者标识
+func lockOwner() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d:%s", host, os.Getpid(), filepath.Base(os.Args[0]))
+}
@@ -0,0 +1,243 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ygqygq2/influxdb-sync/internal/logx"
+)
+
+// StateTarget 可选接口：目标端支持查询最新状态点时实现，用于在目标库中保存断点
+type StateTarget interface {
+	// QueryLatest 返回 measurement 中匹配 tags 的每个 series 的最新一个点
+	QueryLatest(ctx context.Context, db, measurement string, tags map[string]string) ([]DataPoint, error)
+}
+
+const (
+	checkpointMeasurement = "influxdb_sync_checkpoint"
+	lockMeasurement       = "influxdb_sync_lock"
+	targetLockTTL         = 10 * time.Minute
+	// 持有锁期间按该间隔续期，单次续期失败后仍有机会在过期前重试
+	targetLockRenewInterval = targetLockTTL / 4
+	// 断点读写不受同步 ctx 取消影响，保证退出时仍能保存断点
+	stateOpTimeout = 30 * time.Second
+)
+
+// 基于目标库的断点存储，断点以数据点形式写入目标端的指定库/bucket
+type TargetCheckpointStore struct {
+	target      DataTarget
+	reader      StateTarget
+	db          string
+	fingerprint string
+	owner       string
+	lockExpires time.Time
+	mu          sync.Mutex
+	// 后台续期锁的 goroutine，Unlock 时停止
+	renewEvery time.Duration
+	stopRenew  chan struct{}
+	renewDone  chan struct{}
+}
+
+// 创建目标库断点存储，目标端需实现 StateTarget
+func NewTargetCheckpointStore(target DataTarget, db, fingerprint string) (*TargetCheckpointStore, error) {
+	reader, ok := target.(StateTarget)
+	if !ok {
+		return nil, fmt.Errorf("目标端 %T 不支持保存断点", target)
+	}
+	if db == "" {
+		return nil, fmt.Errorf("使用目标库保存断点时必须配置 checkpoint.database")
+	}
+	return &TargetCheckpointStore{
+		target:      target,
+		reader:      reader,
+		db:          db,
+		fingerprint: fingerprint,
+		owner:       lockOwner(),
+		renewEvery:  targetLockRenewInterval,
+	}, nil
+}
+
+func (t *TargetCheckpointStore) Lock() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	owner, expires, err := t.currentLock()
+	if err != nil {
+		return err
+	}
+	if owner != "" && owner != t.owner && expires.After(time.Now()) {
+		return fmt.Errorf("断点已被其他任务锁定 (%s)，锁将于 %s 过期", owner, expires.Format(time.RFC3339))
+	}
+
+	if err := t.writeLock(time.Now().Add(targetLockTTL)); err != nil {
+		return err
+	}
+
+	// 回读确认，避免两个任务同时抢锁
+	owner, _, err = t.currentLock()
+	if err != nil {
+		return err
+	}
+	if owner != t.owner {
+		return fmt.Errorf("断点已被其他任务锁定 (%s)", owner)
+	}
+
+	// 单个批次或重试可能超过锁的有效期，由后台定时续期直到 Unlock
+	t.stopRenew = make(chan struct{})
+	t.renewDone = make(chan struct{})
+	go t.renewLock(t.stopRenew, t.renewDone)
+	return nil
+}
+
+// 定时续期锁，直到 stop 关闭
+func (t *TargetCheckpointStore) renewLock(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(t.renewEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			t.mu.Lock()
+			err := t.writeLock(time.Now().Add(targetLockTTL))
+			t.mu.Unlock()
+			if err != nil {
+				logx.Warn("续期断点锁失败:", err)
+			}
+		}
+	}
+}
+
+func (t *TargetCheckpointStore) Unlock() error {
+	// 先停止续期，避免释放后又被续期
+	if t.stopRenew != nil {
+		close(t.stopRenew)
+		<-t.renewDone
+		t.stopRenew = nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.lockExpires.IsZero() {
+		return nil
+	}
+	err := t.writeLock(time.Unix(0, 0))
+	t.lockExpires = time.Time{}
+	return err
+}
+
+func (t *TargetCheckpointStore) Load() (map[CheckpointKey]Checkpoint, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), stateOpTimeout)
+	defer cancel()
+	points, err := t.reader.QueryLatest(ctx, t.db, checkpointMeasurement, map[string]string{"job": t.fingerprint})
+	if err != nil {
+		return nil, fmt.Errorf("读取目标库断点失败: %v", err)
+	}
+
+	result := make(map[CheckpointKey]Checkpoint)
+	for _, p := range points {
+		key := CheckpointKey{DB: p.Tags["source_db"], RP: p.Tags["source_rp"], Measurement: p.Tags["source_measurement"]}
+		if shard := p.Tags["shard"]; shard != "" {
+			key.Shard, _ = strconv.ParseInt(shard, 10, 64)
+			key.Sharded = true
+		}
+		result[key] = Checkpoint{
+			LastTime:  toInt64(p.Fields["last_time"]),
+			Offset:    int(toInt64(p.Fields["offset"])),
+			UpdatedAt: p.Time,
+		}
+	}
+	return result, nil
+}
+
+func (t *TargetCheckpointStore) Save(key CheckpointKey, cp Checkpoint) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	point := DataPoint{
+		Measurement: checkpointMeasurement,
+		Tags: map[string]string{
+			"job":                t.fingerprint,
+			"source_db":          key.DB,
+			"source_measurement": key.Measurement,
+		},
+		Fields: map[string]interface{}{
+			"last_time": cp.LastTime,
+			"offset":    int64(cp.Offset),
+		},
+		Time: cp.UpdatedAt,
+	}
+	if key.RP != "" {
+		point.Tags["source_rp"] = key.RP
+	}
+	if key.Sharded {
+		point.Tags["shard"] = strconv.FormatInt(key.Shard, 10)
+	}
+	return t.writeState(point)
+}
+
+// 读取当前锁的持有者和过期时间
+func (t *TargetCheckpointStore) currentLock() (string, time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), stateOpTimeout)
+	defer cancel()
+	points, err := t.reader.QueryLatest(ctx, t.db, lockMeasurement, map[string]string{"job": t.fingerprint})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("读取目标库断点锁失败: %v", err)
+	}
+	if len(points) == 0 {
+		return "", time.Time{}, nil
+	}
+	owner, _ := points[0].Fields["owner"].(string)
+	return owner, time.Unix(0, toInt64(points[0].Fields["expires_at"])), nil
+}
+
+func (t *TargetCheckpointStore) writeLock(expires time.Time) error {
+	point := DataPoint{
+		Measurement: lockMeasurement,
+		Tags:        map[string]string{"job": t.fingerprint},
+		Fields: map[string]interface{}{
+			"owner":      t.owner,
+			"expires_at": expires.UnixNano(),
+		},
+		Time: time.Now(),
+	}
+	if err := t.writeState(point); err != nil {
+		return err
+	}
+	t.lockExpires = expires
+	return nil
+}
+
+func (t *TargetCheckpointStore) writeState(point DataPoint) error {
+	ctx, cancel := context.WithTimeout(context.Background(), stateOpTimeout)
+	defer cancel()
+	return t.target.WritePoints(ctx, t.db, []DataPoint{point})
+}
+
+// 将各版本客户端解码出的数值统一转换为 int64
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	case uint64:
+		return int64(n)
+	case float64:
+		return int64(n)
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return i
+		}
+		if f, err := n.Float64(); err == nil {
+			return int64(f)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,316 @@
+package common
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileCheckpointStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resume.state")
+	store := NewFileCheckpointStore(path, "job-a")
+
+	if err := store.Lock(); err != nil {
+		t.Fatalf("加锁失败: %v", err)
+	}
+
+	// 同一份状态不能被第二个任务加锁
+	other := NewFileCheckpointStore(path, "job-a")
+	if err := other.Lock(); err == nil {
+		t.Error("期望第二次加锁失败")
+	}
+
+	cpu := CheckpointKey{DB: "db1", Measurement: "cpu"}
+	mem := CheckpointKey{DB: "db/rp", Measurement: "mem/used"}
+	if err := store.Save(cpu, Checkpoint{LastTime: 100}); err != nil {
+		t.Fatalf("保存断点失败: %v", err)
+	}
+	if err := store.Save(mem, Checkpoint{LastTime: 200}); err != nil {
+		t.Fatalf("保存断点失败: %v", err)
+	}
+	if err := store.Unlock(); err != nil {
+		t.Fatalf("解锁失败: %v", err)
+	}
+
+	loaded, err := NewFileCheckpointStore(path, "job-a").Load()
+	if err != nil {
+		t.Fatalf("加载断点失败: %v", err)
+	}
+	if loaded[cpu].LastTime != 100 || loaded[mem].LastTime != 200 {
+		t.Errorf("加载的断点不正确: %+v", loaded)
+	}
+
+	// 指纹不同的任务不能使用该状态
+	if _, err := NewFileCheckpointStore(path, "job-b").Load(); err == nil {
+		t.Error("期望指纹不匹配时返回错误")
+	}
+}
+
+func TestFileCheckpointStoreWindowKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resume.state")
+	whole := CheckpointKey{DB: "db1", Measurement: "cpu"}
+	epoch := whole.window(0)
+	store := NewFileCheckpointStore(path, "job-a")
+	_ = store.Save(whole, Checkpoint{LastTime: 100})
+	_ = store.Save(epoch, Checkpoint{LastTime: 200})
+
+	// 从 1970-01-01 开始的窗口与 measurement 的断点互不覆盖
+	loaded, err := NewFileCheckpointStore(path, "job-a").Load()
+	if err != nil || len(loaded) != 2 || loaded[whole].LastTime != 100 || loaded[epoch].LastTime != 200 {
+		t.Errorf("加载的断点不正确: %+v, %v", loaded, err)
+	}
+
+	// 旧版本文件只记录非 0 的 shard，加载后仍是窗口断点
+	old := `{"fingerprint":"job-a","checkpoints":[{"db":"db1","measurement":"cpu","shard":3600000000000,"last_time":300}]}`
+	if err := os.WriteFile(path, []byte(old), 0644); err != nil {
+		t.Fatalf("无法创建断点文件: %v", err)
+	}
+	loaded, err = NewFileCheckpointStore(path, "job-a").Load()
+	if err != nil || loaded[whole.window(int64(time.Hour))].LastTime != 300 {
+		t.Errorf("旧版本窗口断点加载不正确: %+v, %v", loaded, err)
+	}
+}
+
+func TestFileCheckpointStoreLegacyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resume.state")
+	if err := os.WriteFile(path, []byte("2024-06-01T00:00:00Z"), 0644); err != nil {
+		t.Fatalf("无法创建断点文件: %v", err)
+	}
+
+	want := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC).UnixNano()
+	loaded, err := NewFileCheckpointStore(path, "job-a").Load()
+	if err != nil {
+		t.Fatalf("旧格式断点文件不应报错: %v", err)
+	}
+	if len(loaded) != 1 || loaded[legacyCheckpointKey].LastTime != want {
+		t.Errorf("旧格式断点应迁移为对所有 measurement 生效的断点: %+v", loaded)
+	}
+
+	// 迁移后文件已改写为当前格式，再次加载得到相同的断点
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), `"fingerprint": "job-a"`) {
+		t.Errorf("旧格式断点文件应被改写为当前格式: %s", data)
+	}
+	loaded, err = NewFileCheckpointStore(path, "job-a").Load()
+	if err != nil || loaded[legacyCheckpointKey].LastTime != want {
+		t.Errorf("再次加载迁移后的断点不正确: %+v, %v", loaded, err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	a := SyncConfig{SourceAddr: "http://a:8086", TargetAddr: "http://b:8086", BatchSize: 100}
+	b := a
+	b.BatchSize = 5000
+	if Fingerprint(a) != Fingerprint(b) {
+		t.Error("非源/目标相关的配置不应影响指纹")
+	}
+
+	c := a
+	c.TargetAddr = "http://c:8086"
+	if Fingerprint(a) == Fingerprint(c) {
+		t.Error("不同目标的指纹应该不同")
+	}
+}
+
+// 支持读取最新状态的 mock 目标
+type stateDataTarget struct {
+	mockDataTarget
+}
+
+func (m *stateDataTarget) QueryLatest(ctx context.Context, db, measurement string, tags map[string]string) ([]DataPoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	latest := map[string]DataPoint{}
+	for _, p := range m.writtenData {
+		if p.Measurement != measurement {
+			continue
+		}
+		match := true
+		for k, v := range tags {
+			if p.Tags[k] != v {
+				match = false
+			}
+		}
+		if match {
+			key := p.Tags["source_db"] + "/" + p.Tags["source_measurement"] + "@" + p.Tags["shard"]
+			latest[key] = p
+		}
+	}
+
+	var points []DataPoint
+	for _, p := range latest {
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+func TestTargetCheckpointStore(t *testing.T) {
+	target := &stateDataTarget{}
+	store, err := NewTargetCheckpointStore(target, "sync_state", "job-a")
+	if err != nil {
+		t.Fatalf("创建目标库断点存储失败: %v", err)
+	}
+
+	if err := store.Lock(); err != nil {
+		t.Fatalf("加锁失败: %v", err)
+	}
+
+	other, _ := NewTargetCheckpointStore(target, "sync_state", "job-a")
+	other.owner = "other-host:1:influxdb-sync"
+	if err := other.Lock(); err == nil {
+		t.Error("期望其他任务加锁失败")
+	}
+
+	key := CheckpointKey{DB: "db1", Measurement: "cpu"}
+	if err := store.Save(key, Checkpoint{LastTime: 42, UpdatedAt: time.Now()}); err != nil {
+		t.Fatalf("保存断点失败: %v", err)
+	}
+	if err := store.Unlock(); err != nil {
+		t.Fatalf("解锁失败: %v", err)
+	}
+
+	// 解锁后其他任务可以加锁
+	if err := other.Lock(); err != nil {
+		t.Errorf("解锁后加锁失败: %v", err)
+	}
+	defer other.Unlock()
+
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("加载断点失败: %v", err)
+	}
+	if loaded[key].LastTime != 42 {
+		t.Errorf("期望断点为 42, 实际为 %d", loaded[key].LastTime)
+	}
+
+	// 其他任务的断点不可见
+	otherJob, _ := NewTargetCheckpointStore(target, "sync_state", "job-b")
+	if loaded, _ := otherJob.Load(); len(loaded) != 0 {
+		t.Errorf("不应加载其他任务的断点: %+v", loaded)
+	}
+}
+
+func TestTargetCheckpointStoreRenewsLock(t *testing.T) {
+	target := &stateDataTarget{}
+	store, _ := NewTargetCheckpointStore(target, "sync_state", "job-a")
+	store.renewEvery = 10 * time.Millisecond
+	if err := store.Lock(); err != nil {
+		t.Fatalf("加锁失败: %v", err)
+	}
+
+	// 没有保存断点时也应在后台续期
+	_, first, _ := store.currentLock()
+	time.Sleep(50 * time.Millisecond)
+	_, renewed, _ := store.currentLock()
+	if !renewed.After(first) {
+		t.Errorf("锁未续期: %v -> %v", first, renewed)
+	}
+
+	if err := store.Unlock(); err != nil {
+		t.Fatalf("解锁失败: %v", err)
+	}
+	// 解锁后不再续期
+	time.Sleep(30 * time.Millisecond)
+	if _, expires, _ := store.currentLock(); expires.After(time.Now()) {
+		t.Errorf("解锁后锁不应再被续期，过期时间为 %v", expires)
+	}
+}
+
+func TestTargetCheckpointStoreUnsupportedTarget(t *testing.T) {
+	if _, err := NewTargetCheckpointStore(&mockDataTarget{}, "sync_state", "job-a"); err == nil {
+		t.Error("目标端不支持 StateTarget 时应返回错误")
+	}
+}
+
+// 记录每个 measurement 查询起始时间的 mock 数据源
+type resumeDataSource struct {
+	mockDataSource
+	starts map[string]int64
+	mu     sync.Mutex
+}
+
+func (m *resumeDataSource) QueryData(ctx context.Context, q Query) ([]DataPoint, Cursor, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.starts[q.Measurement]; !ok {
+		m.starts[q.Measurement] = q.Cursor.Time
+	}
+	return nil, q.Cursor, nil
+}
+
+func TestSyncResumesEachMeasurement(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resume.state")
+	cfg := SyncConfig{
+		SourceDB:   "testdb",
+		Start:      "2024-01-01T00:00:00Z",
+		ResumeFile: path,
+		Parallel:   2,
+	}
+
+	store := NewFileCheckpointStore(path, Fingerprint(cfg))
+	cpuTime := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC).UnixNano()
+	memTime := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC).UnixNano()
+	_ = store.Save(CheckpointKey{DB: "testdb", Measurement: "cpu"}, Checkpoint{LastTime: cpuTime})
+	_ = store.Save(CheckpointKey{DB: "testdb", Measurement: "mem"}, Checkpoint{LastTime: memTime})
+
+	source := &resumeDataSource{
+		mockDataSource: mockDataSource{measurements: []string{"cpu", "mem", "disk"}},
+		starts:         map[string]int64{},
+	}
+	if err := NewSyncer(cfg, source, &mockDataTarget{}).Sync(context.Background()); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	startTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano()
+	expected := map[string]int64{"cpu": cpuTime, "mem": memTime, "disk": startTime}
+	for m, want := range expected {
+		if got := source.starts[m]; got != want {
+			t.Errorf("measurement %s 期望从 %d 开始, 实际为 %d", m, want, got)
+		}
+	}
+
+	// 同步结束后应释放锁
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Error("同步结束后锁文件应被删除")
+	}
+}
+
+func TestSyncResumesFromLegacyCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resume.state")
+	if err := os.WriteFile(path, []byte("2024-06-01T00:00:00Z"), 0644); err != nil {
+		t.Fatalf("无法创建断点文件: %v", err)
+	}
+	cfg := SyncConfig{SourceDB: "testdb", Start: "2024-01-01T00:00:00Z", ResumeFile: path}
+
+	source := &resumeDataSource{
+		mockDataSource: mockDataSource{measurements: []string{"cpu", "mem"}},
+		starts:         map[string]int64{},
+	}
+	if err := NewSyncer(cfg, source, &mockDataTarget{}).Sync(context.Background()); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	want := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC).UnixNano()
+	for _, m := range []string{"cpu", "mem"} {
+		if got := source.starts[m]; got != want {
+			t.Errorf("measurement %s 期望从旧断点 %d 开始, 实际为 %d", m, want, got)
+		}
+	}
+}
+
+func TestSyncRejectsForeignCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resume.state")
+	_ = NewFileCheckpointStore(path, "another-job").Save(CheckpointKey{DB: "db", Measurement: "cpu"}, Checkpoint{LastTime: 1})
+
+	cfg := SyncConfig{SourceDB: "testdb", ResumeFile: path}
+	source := &mockDataSource{measurements: []string{"cpu"}}
+	err := NewSyncer(cfg, source, &mockDataTarget{}).Sync(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "其他源/目标组合") {
+		t.Errorf("期望指纹不匹配错误, 实际为: %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ygqygq2/influxdb-sync/internal/logx"
+)
+
+// ContinuousQuery 源端的连续查询，Downsample 为空时 Reason 说明无法自动迁移的原因
+type ContinuousQuery struct {
+	DB         string
+	Name       string
+	Query      string
+	Downsample *Downsample
+	Reason     string
+}
+
+// Downsample 从连续查询解析出的降采样规则：按 Interval 时间窗口聚合源 measurement 的字段，
+// 写入目标 measurement。数据库和保留策略为源端名称，保留策略为空表示默认保留策略
+type Downsample struct {
+	SourceDB          string
+	SourceRP          string
+	SourceMeasurement string
+	TargetDB          string
+	TargetRP          string
+	TargetMeasurement string
+	Fields            []DownsampleField
+	Interval          time.Duration // GROUP BY time() 的窗口
+	Every             time.Duration // 执行间隔，RESAMPLE EVERY，默认等于 Interval
+	For               time.Duration // 每次重新计算的时间范围，RESAMPLE FOR，默认等于 Interval
+	Tags              []string      // 分组保留的 tag，为空时合并所有 series
+	AllTags           bool          // GROUP BY *，保留所有 tag
+}
+
+// DownsampleField 一个聚合字段，As 为写入的字段名
+type DownsampleField struct {
+	Func  string
+	Field string
+	As    string
+}
+
+// DownsampleTask 目标端的降采样任务，源和目标名称已按同步的库名映射改写
+type DownsampleTask struct {
+	Name         string
+	SourceBucket string
+	TargetBucket string
+	Downsample
+}
+
+// ContinuousQuerySource 可选接口：数据源有连续查询（1.x）时实现，
+// 配置 migrate_continuous_queries 后读取并尽量解析为降采样规则
+type ContinuousQuerySource interface {
+	ContinuousQueries(ctx context.Context, db string) ([]ContinuousQuery, error)
+}
+
+// TaskCreator 可选接口：数据目标支持定时任务（2.x）时实现
+type TaskCreator interface {
+	// CreateDownsampleTask 创建任务并返回是否新建，已存在同名任务时不做修改
+	CreateDownsampleTask(ctx context.Context, task DownsampleTask) (bool, error)
+}
+
+// 连续查询迁移结果
+const (
+	CQCreated = "created" // 已创建任务
+	CQExists  = "exists"  // 同名任务已存在
+	CQManual  = "manual"  // 无法自动迁移，需要手动处理
+	CQFailed  = "failed"  // 创建任务失败
+)
+
+// ContinuousQueryReport 单个连续查询的迁移结果，写入运行报告
+type ContinuousQueryReport struct {
+	DB     string `json:"db"`
+	Name   string `json:"name"`
+	Query  string `json:"query"`
+	Task   string `json:"task,omitempty"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// 配置 MigrateContinuousQueries 时，把源库的连续查询迁移为目标端的降采样任务，
+// 源和目标名称使用与数据同步相同的映射。迁移失败不影响数据同步，
+// 无法自动迁移的连续查询输出到日志和运行报告，需要手动处理
+func (s *Syncer) migrateContinuousQueries(ctx context.Context) {
+	if !s.cfg.MigrateContinuousQueries {
+		return
+	}
+	src, ok := s.source.(ContinuousQuerySource)
+	if !ok {
+		logx.Warn("源端不支持连续查询，跳过连续查询迁移")
+		return
+	}
+	creator, _ := s.target.(TaskCreator)
+
+	dbs, err := s.getDatabases(ctx)
+	if err != nil {
+		logx.Error("获取数据库列表失败，跳过连续查询迁移:", err)
+		return
+	}
+	// 任务名称和 bucket 依赖保留策略映射，先加载所有库的保留策略，与数据同步的目标一致
+	for _, db := range dbs {
+		if _, err := s.retentionPolicies(ctx, db); err != nil {
+			logx.Warn(fmt.Sprintf("%v，连续查询按默认保留策略映射", err))
+		}
+	}
+	var reports []ContinuousQueryReport
+	for _, db := range dbs {
+		var cqs []ContinuousQuery
+		err := s.retry(ctx, "获取连续查询", nil, func() error {
+			opCtx, cancel := s.opContext(ctx, s.queryTimeout())
+			defer cancel()
+			var err error
+			cqs, err = src.ContinuousQueries(opCtx, db)
+			return err
+		})
+		if err != nil {
+			logx.Error(fmt.Sprintf("获取数据库 %s 的连续查询失败: %v", db, err))
+			continue
+		}
+		for _, cq := range cqs {
+			reports = append(reports, s.migrateContinuousQuery(ctx, creator, cq))
+		}
+	}
+
+	var manual int
+	for _, r := range reports {
+		if r.Status == CQManual || r.Status == CQFailed {
+			manual++
+			logx.Warn(fmt.Sprintf("连续查询 %s.%s 需要手动迁移（%s）: %s", r.DB, r.Name, r.Reason, r.Query))
+		}
+	}
+	logx.Info(fmt.Sprintf("连续查询迁移完成：共 %d 个，%d 个需要手动迁移", len(reports), manual))
+
+	s.mu.Lock()
+	s.cqReports = reports
+	s.mu.Unlock()
+}
+
+func (s *Syncer) migrateContinuousQuery(ctx context.Context, creator TaskCreator, cq ContinuousQuery) ContinuousQueryReport {
+	r := ContinuousQueryReport{DB: cq.DB, Name: cq.Name, Query: cq.Query, Status: CQManual, Reason: cq.Reason}
+	switch {
+	case cq.Downsample == nil:
+		return r
+	case creator == nil:
+		r.Reason = "目标端不支持定时任务"
+		return r
+	}
+
+	d := *cq.Downsample
+	task := DownsampleTask{
+		Name:         s.targetFor(cq.DB, "") + "_" + cq.Name,
+		SourceBucket: s.targetFor(d.SourceDB, s.normalizeRP(ctx, d.SourceDB, d.SourceRP)),
+		TargetBucket: s.targetFor(d.TargetDB, s.normalizeRP(ctx, d.TargetDB, d.TargetRP)),
+		Downsample:   d,
+	}
+	r.Task = task.Name
+	var created bool
+	err := s.retry(ctx, "创建任务 "+task.Name, nil, func() error {
+		opCtx, cancel := s.opContext(ctx, s.writeTimeout())
+		defer cancel()
+		var err error
+		created, err = creator.CreateDownsampleTask(opCtx, task)
+		return err
+	})
+	switch {
+	case err != nil:
+		r.Status, r.Reason = CQFailed, err.Error()
+	case created:
+		r.Status, r.Reason = CQCreated, ""
+		logx.Info(fmt.Sprintf("连续查询 %s.%s 已迁移为任务 %s: %s -> %s", cq.DB, cq.Name, task.Name, task.SourceBucket, task.TargetBucket))
+	default:
+		r.Status, r.Reason = CQExists, ""
+		logx.Info(fmt.Sprintf("任务 %s 已存在，未修改", task.Name))
+	}
+	return r
+}
+
+// 连续查询中显式写出的默认保留策略与省略保留策略时等价，统一为空字符串
+func (s *Syncer) normalizeRP(ctx context.Context, db, rp string) string {
+	if rp == "" {
+		return ""
+	}
+	policy, ok := s.sourcePolicy(db, "")
+	if !ok {
+		var err error
+		if policy, err = s.defaultRetention(ctx, db); err != nil {
+			logx.Warn(fmt.Sprintf("获取 %s 的默认保留策略失败: %v", db, err))
+		}
+	}
+	if policy.Name == rp {
+		return ""
+	}
+	return rp
+}
+
+// 连续查询的迁移结果
+func (s *Syncer) continuousQueryReports() []ContinuousQueryReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ContinuousQueryReport(nil), s.cqReports...)
+}
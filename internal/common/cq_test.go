@@ -0,0 +1,166 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 带连续查询的 mock 数据源，默认保留策略为 autogen
+type cqDataSource struct {
+	retentionDataSource
+	cqs map[string][]ContinuousQuery
+}
+
+func (m *cqDataSource) ContinuousQueries(ctx context.Context, db string) ([]ContinuousQuery, error) {
+	return m.cqs[db], nil
+}
+
+// 记录降采样任务的 mock 数据目标
+type taskDataTarget struct {
+	mockDataTarget
+	tasks map[string]DownsampleTask
+}
+
+func (m *taskDataTarget) CreateDownsampleTask(ctx context.Context, task DownsampleTask) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.tasks[task.Name]; ok {
+		return false, nil
+	}
+	m.tasks[task.Name] = task
+	return true, nil
+}
+
+func newCQSource() *cqDataSource {
+	downsample := func(src, srcRP, dstRP string) *Downsample {
+		return &Downsample{
+			SourceDB: src, SourceRP: srcRP, SourceMeasurement: "cpu", TargetDB: "db1", TargetRP: dstRP, TargetMeasurement: "cpu_1h",
+			Fields: []DownsampleField{{Func: "mean", Field: "value", As: "mean"}}, Interval: time.Hour, Every: time.Hour, For: time.Hour,
+		}
+	}
+	return &cqDataSource{
+		retentionDataSource: retentionDataSource{
+			seriesDataSource: seriesDataSource{mockDataSource: mockDataSource{databases: []string{"db1", "db2"}, measurements: []string{"cpu"}}},
+			retention:        map[string]RetentionPolicy{"db1": {Name: "autogen", Default: true}},
+		},
+		cqs: map[string][]ContinuousQuery{
+			"db1": {
+				{DB: "db1", Name: "cq_1h", Query: "CREATE CONTINUOUS QUERY cq_1h ...", Downsample: downsample("db1", "autogen", "rp_1y")},
+				{DB: "db1", Name: "cq_where", Query: "CREATE CONTINUOUS QUERY cq_where ...", Reason: "不支持 WHERE 条件"},
+				{DB: "db1", Name: "cq_old", Query: "CREATE CONTINUOUS QUERY cq_old ...", Downsample: downsample("db1", "", "")},
+			},
+		},
+	}
+}
+
+func TestSyncMigratesContinuousQueries(t *testing.T) {
+	report := filepath.Join(t.TempDir(), "report.json")
+	cfg := SyncConfig{Start: "2024-01-01T00:00:00Z", TargetDBPrefix: "bak_", ReportFile: report, MigrateContinuousQueries: true}
+	target := &taskDataTarget{tasks: map[string]DownsampleTask{"bak_db1_cq_old": {}}}
+	if err := NewSyncer(cfg, newCQSource(), target).Sync(context.Background()); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	// 显式写出的默认保留策略与数据同步一样写入目标库，其他保留策略写入 "目标库/保留策略"
+	task, ok := target.tasks["bak_db1_cq_1h"]
+	if !ok {
+		t.Fatalf("期望创建任务 bak_db1_cq_1h, 实际为 %v", target.tasks)
+	}
+	if task.SourceBucket != "bak_db1" || task.TargetBucket != "bak_db1/rp_1y" || task.TargetMeasurement != "cpu_1h" {
+		t.Errorf("任务的 bucket 映射不正确: %+v", task)
+	}
+
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatalf("读取运行报告失败: %v", err)
+	}
+	var r RunReport
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatalf("解析运行报告失败: %v", err)
+	}
+	expected := map[string]string{"cq_1h": CQCreated, "cq_where": CQManual, "cq_old": CQExists}
+	if len(r.ContinuousQueries) != len(expected) {
+		t.Fatalf("期望 %d 个连续查询, 实际为 %+v", len(expected), r.ContinuousQueries)
+	}
+	for _, cq := range r.ContinuousQueries {
+		if cq.Status != expected[cq.Name] {
+			t.Errorf("%s 期望为 %s, 实际为 %s", cq.Name, expected[cq.Name], cq.Status)
+		}
+		if cq.Name == "cq_where" && (cq.Reason == "" || cq.Query == "") {
+			t.Errorf("需要手动迁移的连续查询应包含原因和原始查询: %+v", cq)
+		}
+	}
+}
+
+func TestMigrateContinuousQueriesWithoutTaskSupport(t *testing.T) {
+	cfg := SyncConfig{Start: "2024-01-01T00:00:00Z", MigrateContinuousQueries: true}
+	s := NewSyncer(cfg, newCQSource(), &mockDataTarget{})
+	if err := s.Sync(context.Background()); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	// 目标端不支持任务时全部需要手动迁移
+	reports := s.continuousQueryReports()
+	if len(reports) != 3 {
+		t.Fatalf("期望 3 个连续查询, 实际为 %+v", reports)
+	}
+	for _, r := range reports {
+		if r.Status != CQManual || r.Reason == "" {
+			t.Errorf("%s 应标记为需要手动迁移, 实际为 %+v", r.Name, r)
+		}
+	}
+
+	// 未开启时不读取连续查询
+	cfg.MigrateContinuousQueries = false
+	s = NewSyncer(cfg, newCQSource(), &mockDataTarget{})
+	if err := s.Sync(context.Background()); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if reports := s.continuousQueryReports(); len(reports) != 0 {
+		t.Errorf("未开启时不应迁移连续查询, 实际为 %+v", reports)
+	}
+}
+
+// 同步全部保留策略的 mock 数据源，同时带有连续查询
+type multiRPCQDataSource struct {
+	*multiRPDataSource
+	cqs map[string][]ContinuousQuery
+}
+
+func (m *multiRPCQDataSource) ContinuousQueries(ctx context.Context, db string) ([]ContinuousQuery, error) {
+	return m.cqs[db], nil
+}
+
+func TestMigrateContinuousQueriesMappedDefaultRP(t *testing.T) {
+	source := &multiRPCQDataSource{
+		multiRPDataSource: newMultiRPSource(),
+		cqs: map[string][]ContinuousQuery{"db1": {{DB: "db1", Name: "cq", Downsample: &Downsample{
+			SourceDB: "db1", SourceRP: "autogen", SourceMeasurement: "cpu", TargetDB: "db1", TargetRP: "rp_1y", TargetMeasurement: "cpu_1h",
+			Fields: []DownsampleField{{Func: "mean", Field: "value", As: "mean"}}, Interval: time.Hour, Every: time.Hour,
+		}}}},
+	}
+	cfg := SyncConfig{
+		Start: "2024-01-01T00:00:00Z", TargetDBPrefix: "bak_", MigrateContinuousQueries: true,
+		AllRetentionPolicies: true, RetentionPolicyMap: map[string]string{"autogen": "{db}_main"},
+	}
+	target := &taskDataTarget{tasks: map[string]DownsampleTask{}}
+	s := NewSyncer(cfg, source, target)
+	if err := s.Sync(context.Background()); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	// 映射后的默认保留策略与数据同步写入同一个目标
+	if got := s.targetFor("db1", ""); got != "bak_db1_main" {
+		t.Fatalf("默认保留策略的目标 = %s, want bak_db1_main", got)
+	}
+	task, ok := target.tasks["bak_db1_main_cq"]
+	if !ok {
+		t.Fatalf("期望创建任务 bak_db1_main_cq, 实际为 %v", target.tasks)
+	}
+	if task.SourceBucket != "bak_db1_main" || task.TargetBucket != "bak_db1/rp_1y" {
+		t.Errorf("任务的 bucket 映射不正确: %+v", task)
+	}
+}
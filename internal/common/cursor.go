@@ -0,0 +1,56 @@
+package common
+
+// Cursor 分页游标，由数据源根据返回的数据生成，引擎只负责保存和回传。
+// 含义为：时间早于 Time 的点已全部读取，时间等于 Time 的点已按数据源的
+// 稳定顺序读取了前 Offset 个。下一页从 time >= Time 开始并跳过 Offset 个点，
+// 因此同一时间戳上的点无论多少、是否跨批次，都只会返回一次。
+type Cursor struct {
+	Time   int64 `json:"time"`
+	Offset int   `json:"offset,omitempty"`
+	// Rows 本页从数据源读取的行数，包括无法解析而跳过的行，0 表示与返回的点数相同。
+	// 只在 QueryData 返回时有效，不保存到断点
+	Rows int `json:"-"`
+}
+
+// PageRows 返回本页占用 Limit 的行数，不足 Limit 时说明已读到末尾
+func PageRows(points []DataPoint, next Cursor) int {
+	if next.Rows > len(points) {
+		return next.Rows
+	}
+	return len(points)
+}
+
+// After 判断游标是否位于 other 之后
+func (c Cursor) After(other Cursor) bool {
+	return c.Time > other.Time || (c.Time == other.Time && c.Offset > other.Offset)
+}
+
+// 数据查询参数
+type Query struct {
+	DB          string
+	RP          string // 保留策略，为空时读取默认保留策略，仅 1.x 数据源使用
+	Measurement string
+	Cursor      Cursor
+	End         int64 // 结束时间（不含），0 表示不限制
+	Limit       int
+}
+
+// NextCursor 根据本批数据计算下一页游标，points 必须按查询返回的顺序排列
+// （时间升序，同一时间戳内顺序稳定）
+func NextCursor(cur Cursor, points []DataPoint) Cursor {
+	if len(points) == 0 {
+		return cur
+	}
+
+	last := points[len(points)-1].Time.UnixNano()
+	n := 0
+	for i := len(points) - 1; i >= 0 && points[i].Time.UnixNano() == last; i-- {
+		n++
+	}
+
+	// 整批都落在游标所在的时间戳上，在原偏移基础上累加
+	if last == cur.Time {
+		return Cursor{Time: last, Offset: cur.Offset + n}
+	}
+	return Cursor{Time: last, Offset: n}
+}
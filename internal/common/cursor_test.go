@@ -0,0 +1,89 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func pointsAt(times ...int64) []DataPoint {
+	var points []DataPoint
+	for _, ts := range times {
+		points = append(points, DataPoint{Time: time.Unix(0, ts)})
+	}
+	return points
+}
+
+func TestNextCursor(t *testing.T) {
+	testCases := []struct {
+		name     string
+		cursor   Cursor
+		times    []int64
+		expected Cursor
+	}{
+		{"空批次保持不变", Cursor{Time: 5, Offset: 2}, nil, Cursor{Time: 5, Offset: 2}},
+		{"批次结束在新时间戳", Cursor{Time: 1}, []int64{1, 2, 3, 3}, Cursor{Time: 3, Offset: 2}},
+		{"整批都在游标时间戳上", Cursor{Time: 7, Offset: 4}, []int64{7, 7, 7}, Cursor{Time: 7, Offset: 7}},
+		{"批次从游标时间戳开始", Cursor{Time: 7, Offset: 4}, []int64{7, 8}, Cursor{Time: 8, Offset: 1}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := NextCursor(tc.cursor, pointsAt(tc.times...)); got != tc.expected {
+				t.Errorf("NextCursor() = %+v, 期望 %+v", got, tc.expected)
+			}
+		})
+	}
+}
+
+// 构造同一时间戳上有多个 series 的数据集，部分时间戳上的点数超过批次大小
+func tiedDataset() []DataPoint {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	seriesPerTime := []int{1, 7, 2, 3, 10, 1, 4}
+	var points []DataPoint
+	for i, n := range seriesPerTime {
+		for s := 0; s < n; s++ {
+			points = append(points, DataPoint{
+				Measurement: "cpu",
+				Tags:        map[string]string{"host": fmt.Sprintf("host%02d", s)},
+				Fields:      map[string]interface{}{"value": float64(i)},
+				Time:        base.Add(time.Duration(i) * time.Second),
+			})
+		}
+	}
+	return points
+}
+
+func TestSyncCopiesTiedPointsExactlyOnce(t *testing.T) {
+	dataset := tiedDataset()
+
+	for _, batchSize := range []int{1, 2, 3, 5, 7, 10, 11, 100} {
+		t.Run(fmt.Sprintf("batch_%d", batchSize), func(t *testing.T) {
+			source := &seriesDataSource{
+				mockDataSource: mockDataSource{measurements: []string{"cpu"}},
+				points:         dataset,
+			}
+			target := &mockDataTarget{}
+			cfg := SyncConfig{SourceDB: "testdb", BatchSize: batchSize, Parallel: 1}
+
+			if err := NewSyncer(cfg, source, target).Sync(context.Background()); err != nil {
+				t.Fatalf("同步失败: %v", err)
+			}
+
+			seen := map[string]int{}
+			for _, p := range target.writtenData {
+				seen[fmt.Sprintf("%d/%s", p.Time.UnixNano(), p.Tags["host"])]++
+			}
+			if len(target.writtenData) != len(dataset) {
+				t.Errorf("期望写入 %d 个点, 实际为 %d", len(dataset), len(target.writtenData))
+			}
+			for _, p := range dataset {
+				key := fmt.Sprintf("%d/%s", p.Time.UnixNano(), p.Tags["host"])
+				if seen[key] != 1 {
+					t.Errorf("点 %s 写入了 %d 次", key, seen[key])
+				}
+			}
+		})
+	}
+}
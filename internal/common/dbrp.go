@@ -0,0 +1,120 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ygqygq2/influxdb-sync/internal/logx"
+)
+
+// 源端没有保留策略名称（如 2.x bucket）时映射使用的保留策略
+const defaultDBRPPolicy = "autogen"
+
+// DBRPMapping InfluxQL 查询使用的 数据库/保留策略 到 bucket 的映射
+type DBRPMapping struct {
+	Database        string `json:"database"`
+	RetentionPolicy string `json:"retention_policy"`
+	Bucket          string `json:"bucket"`
+	Default         bool   `json:"default"`
+}
+
+// DBRPMapper 可选接口：数据目标支持 DBRP 映射（2.x）时实现，配置 create_dbrp 后在每轮同步完成后调用
+type DBRPMapper interface {
+	// EnsureDBRP 创建映射并返回是否新建，已存在相同数据库和保留策略的映射时不做修改
+	EnsureDBRP(ctx context.Context, m DBRPMapping) (bool, error)
+}
+
+// 已处理过的 (源库, 保留策略) 和本次运行新建的映射
+type dbrpMappings struct {
+	mu      sync.Mutex
+	done    map[CheckpointKey]bool
+	created []DBRPMapping
+}
+
+// 配置 create_dbrp 时，为本轮所有 measurement 都同步完成的 (源库, 保留策略) 创建 DBRP 映射。
+// 每个只成功处理一次，失败时记录日志，follow 模式下一轮重试
+func (s *Syncer) createDBRPs(ctx context.Context, tasks []syncTask) {
+	if !s.cfg.CreateDBRP || ctx.Err() != nil {
+		return
+	}
+	mapper, ok := s.target.(DBRPMapper)
+	if !ok {
+		return
+	}
+
+	complete := make(map[CheckpointKey]bool)
+	s.mu.Lock()
+	for _, t := range tasks {
+		m := t.measurementKey()
+		k := CheckpointKey{DB: m.DB, RP: m.RP}
+		ok, seen := complete[k]
+		complete[k] = (ok || !seen) && !s.incomplete[m]
+	}
+	s.mu.Unlock()
+
+	keys := make([]CheckpointKey, 0, len(complete))
+	s.dbrp.mu.Lock()
+	for k, ok := range complete {
+		if ok && !s.dbrp.done[k] {
+			keys = append(keys, k)
+		}
+	}
+	s.dbrp.mu.Unlock()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+	for _, k := range keys {
+		m := s.dbrpMapping(ctx, k.DB, k.RP)
+		var created bool
+		err := s.retry(ctx, "创建 DBRP 映射", nil, func() error {
+			opCtx, cancel := s.opContext(ctx, s.writeTimeout())
+			defer cancel()
+			var err error
+			created, err = mapper.EnsureDBRP(opCtx, m)
+			return err
+		})
+		if err != nil {
+			logx.Error(fmt.Sprintf("创建 DBRP 映射 %s/%s -> %s 失败: %v", m.Database, m.RetentionPolicy, m.Bucket, err))
+			continue
+		}
+		s.dbrp.mu.Lock()
+		s.dbrp.done[k] = true
+		if created {
+			s.dbrp.created = append(s.dbrp.created, m)
+		}
+		s.dbrp.mu.Unlock()
+		if created {
+			logx.Info(fmt.Sprintf("已创建 DBRP 映射 %s/%s -> %s，默认: %v", m.Database, m.RetentionPolicy, m.Bucket, m.Default))
+		} else {
+			logx.Info(fmt.Sprintf("DBRP 映射 %s/%s 已存在", m.Database, m.RetentionPolicy))
+		}
+	}
+}
+
+// 源保留策略 rp 对应的映射，rp 为空时使用源库默认保留策略的名称并标记为默认
+func (s *Syncer) dbrpMapping(ctx context.Context, db, rp string) DBRPMapping {
+	m := DBRPMapping{Database: db, RetentionPolicy: rp, Bucket: s.targetFor(db, rp), Default: rp == ""}
+	if rp != "" {
+		return m
+	}
+	policy, ok := s.sourcePolicy(db, "")
+	if !ok {
+		var err error
+		if policy, err = s.defaultRetention(ctx, db); err != nil {
+			logx.Warn(fmt.Sprintf("获取 %s 的默认保留策略失败，映射使用 %s: %v", db, defaultDBRPPolicy, err))
+		}
+	}
+	m.RetentionPolicy = policy.Name
+	if m.RetentionPolicy == "" {
+		m.RetentionPolicy = defaultDBRPPolicy
+	}
+	return m
+}
+
+// 本次运行新建的 DBRP 映射
+func (s *Syncer) createdDBRPs() []DBRPMapping {
+	s.dbrp.mu.Lock()
+	defer s.dbrp.mu.Unlock()
+	return append([]DBRPMapping(nil), s.dbrp.created...)
+}
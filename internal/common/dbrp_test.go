@@ -0,0 +1,100 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 记录 DBRP 映射的 mock 数据目标
+type mapperDataTarget struct {
+	mockDataTarget
+	mappings map[string]DBRPMapping
+	calls    int
+	failDB   string // 写入该库时返回不可重试的错误
+}
+
+func (m *mapperDataTarget) WritePoints(ctx context.Context, db string, points []DataPoint) error {
+	if db == m.failDB {
+		return NewHTTPError(403, 0, fmt.Errorf("没有写入 %s 的权限", db))
+	}
+	return m.mockDataTarget.WritePoints(ctx, db, points)
+}
+
+func (m *mapperDataTarget) EnsureDBRP(ctx context.Context, mapping DBRPMapping) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	key := mapping.Database + "/" + mapping.RetentionPolicy
+	if _, ok := m.mappings[key]; ok {
+		return false, nil
+	}
+	m.mappings[key] = mapping
+	return true, nil
+}
+
+func TestSyncCreatesDBRPMappings(t *testing.T) {
+	report := filepath.Join(t.TempDir(), "report.json")
+	cfg := SyncConfig{
+		Start: "2024-01-01T00:00:00Z", TargetDBPrefix: "bak_", Parallel: 2, ReportFile: report,
+		AllRetentionPolicies: true, CreateDBRP: true,
+	}
+	target := &mapperDataTarget{mappings: map[string]DBRPMapping{"db1/rp_30d": {Bucket: "old"}}}
+	if err := NewSyncer(cfg, newMultiRPSource(), target).Sync(context.Background()); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	// 默认保留策略使用源端名称并标记为默认，已存在的映射不修改
+	expected := map[string]DBRPMapping{
+		"db1/autogen": {Database: "db1", RetentionPolicy: "autogen", Bucket: "bak_db1", Default: true},
+		"db1/rp_1y":   {Database: "db1", RetentionPolicy: "rp_1y", Bucket: "bak_db1/rp_1y"},
+		"db1/rp_30d":  {Bucket: "old"},
+	}
+	for k, m := range expected {
+		if target.mappings[k] != m {
+			t.Errorf("映射 %s 期望为 %+v, 实际为 %+v", k, m, target.mappings[k])
+		}
+	}
+
+	// 运行报告只包含新建的映射
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatalf("读取运行报告失败: %v", err)
+	}
+	var r RunReport
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatalf("解析运行报告失败: %v", err)
+	}
+	if len(r.DBRPMappings) != 2 || r.DBRPMappings[0] != expected["db1/autogen"] || r.DBRPMappings[1] != expected["db1/rp_1y"] {
+		t.Errorf("运行报告中的映射不正确: %+v", r.DBRPMappings)
+	}
+
+	// 未开启时不创建
+	target = &mapperDataTarget{mappings: make(map[string]DBRPMapping)}
+	cfg.CreateDBRP, cfg.ReportFile = false, ""
+	if err := NewSyncer(cfg, newMultiRPSource(), target).Sync(context.Background()); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if target.calls != 0 {
+		t.Errorf("未开启 create_dbrp 时不应创建映射, 实际调用 %d 次", target.calls)
+	}
+}
+
+func TestSyncSkipsDBRPForFailedDatabase(t *testing.T) {
+	target := &mapperDataTarget{mappings: make(map[string]DBRPMapping), failDB: "db2"}
+	cfg := SyncConfig{Start: "2024-01-01T00:00:00Z", Parallel: 2, CreateDBRP: true}
+	if err := NewSyncer(cfg, newRetentionSource(), target).Sync(context.Background()); err == nil {
+		t.Fatal("期望 db2 同步失败")
+	}
+
+	// db2 没有同步完成，不创建映射；db1 的默认保留策略名称通过 DefaultRetention 查询
+	if len(target.mappings) != 1 {
+		t.Fatalf("期望只创建 db1 的映射, 实际为 %v", target.mappings)
+	}
+	if m := target.mappings["db1/one_week"]; m.Bucket != "db1" || !m.Default {
+		t.Errorf("db1 的映射不正确: %+v", m)
+	}
+}
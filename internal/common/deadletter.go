@@ -0,0 +1,181 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ygqygq2/influxdb-sync/internal/lineprotocol"
+	"github.com/ygqygq2/influxdb-sync/internal/logx"
+)
+
+// 死信文件扩展名
+const deadLetterExt = ".lp"
+
+// RejectedPoint 目标端拒绝或无法编码的点
+type RejectedPoint struct {
+	Point  DataPoint
+	Reason string
+}
+
+// RejectedPointsError 批次中部分点被拒绝，其余点已写入。同步引擎把被拒绝的点写入死信目录
+type RejectedPointsError struct {
+	Rejected []RejectedPoint
+}
+
+func (e *RejectedPointsError) Error() string {
+	return fmt.Sprintf("%d 个点被拒绝，首个原因: %s", len(e.Rejected), e.Rejected[0].Reason)
+}
+
+// NewRejectedPointsError 没有被拒绝的点时返回 nil
+func NewRejectedPointsError(rejected []RejectedPoint) error {
+	if len(rejected) == 0 {
+		return nil
+	}
+	return &RejectedPointsError{Rejected: rejected}
+}
+
+// 死信目录：目标端拒绝的点按目标库追加到 <dir>/<目标库>.lp，格式为 line protocol，
+// 每组点之前有一行以 # 开头的注释记录时间和原因，可用 replay-dlq 命令重新写入
+type deadLetter struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func newDeadLetter(dir string) *deadLetter {
+	if dir == "" {
+		return nil
+	}
+	return &deadLetter{dir: dir}
+}
+
+// write 追加一组点，reason 为拒绝原因
+func (d *deadLetter) write(target string, points []DataPoint, reason string) error {
+	// 与写入目标端使用同一个编码器，重放时转义规则一致
+	var b []byte
+	b = fmt.Appendf(b, "# %s %d 个点: %s\n", time.Now().UTC().Format(time.RFC3339), len(points), oneLine(reason))
+	for _, p := range points {
+		line, err := lineprotocol.AppendPoint(b, p.Measurement, p.Tags, p.Fields, p.Time)
+		if err != nil {
+			// 无法编码的点只能以注释形式保留原始内容，不会被重放
+			b = fmt.Appendf(b, "# 无法编码(%s): measurement=%q tags=%v fields=%v time=%d\n",
+				oneLine(err.Error()), p.Measurement, p.Tags, p.Fields, p.Time.UnixNano())
+			continue
+		}
+		b = line
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := os.MkdirAll(d.dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(deadLetterPath(d.dir, target), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// 死信文件路径，目标库名转义后作为文件名
+func deadLetterPath(dir, target string) string {
+	return filepath.Join(dir, url.PathEscape(target)+deadLetterExt)
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// ReplayDeadLetters 把死信目录中的点重新写入目标端。每个文件对应一个目标库，
+// newTarget 按目标库名创建数据目标。全部写入成功的文件重命名为 .replayed-<时间戳>，
+// 失败的文件保持原样，可以再次重放。返回重放的点数
+func ReplayDeadLetters(ctx context.Context, dir string, batchSize int, newTarget func(name string) (DataTarget, error)) (int, error) {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"+deadLetterExt))
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(files)
+
+	total := 0
+	var errs []error
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		name, err := url.PathUnescape(strings.TrimSuffix(filepath.Base(file), deadLetterExt))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: 无法识别目标库: %v", file, err))
+			continue
+		}
+
+		target, err := newTarget(name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", file, err))
+			continue
+		}
+		n, err := replayFile(ctx, file, name, batchSize, target)
+		total += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", file, err))
+			continue
+		}
+		done := fmt.Sprintf("%s.replayed-%d", file, time.Now().Unix())
+		if err := os.Rename(file, done); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		logx.Info(fmt.Sprintf("重放 %s 完成，%d 个点写入 %s", file, n, name))
+	}
+	return total, errors.Join(errs...)
+}
+
+// 重放单个死信文件
+func replayFile(ctx context.Context, file, name string, batchSize int, target DataTarget) (int, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	parsed, err := lineprotocol.Parse(data)
+	if err != nil {
+		return 0, fmt.Errorf("解析 line protocol 失败: %v", err)
+	}
+
+	points := make([]DataPoint, 0, len(parsed))
+	for _, p := range parsed {
+		points = append(points, DataPoint{
+			Measurement: p.Measurement,
+			Tags:        p.Tags,
+			Fields:      p.Fields,
+			Time:        p.Time,
+		})
+	}
+
+	if err := target.Connect(); err != nil {
+		return 0, err
+	}
+	defer target.Close()
+
+	written := 0
+	for start := 0; start < len(points); start += batchSize {
+		batch := points[start:min(start+batchSize, len(points))]
+		if err := target.WritePoints(ctx, name, batch); err != nil {
+			return written, err
+		}
+		written += len(batch)
+	}
+	return written, nil
+}
@@ -0,0 +1,180 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeadLetterReplay(t *testing.T) {
+	dir := t.TempDir()
+	dl := newDeadLetter(dir)
+	ts := time.Unix(0, 1700000000000000000)
+
+	points := []DataPoint{
+		{Measurement: "cpu", Tags: map[string]string{"host": "a b"}, Fields: map[string]interface{}{"value": 1.5, "msg": `say "hi"`}, Time: ts},
+		{Measurement: "cpu", Fields: map[string]interface{}{"value": math.NaN()}, Time: ts},
+	}
+	if err := dl.write("db/rp", points, "field type conflict\nsecond line"); err != nil {
+		t.Fatalf("写入死信目录失败: %v", err)
+	}
+
+	data, err := os.ReadFile(deadLetterPath(dir, "db/rp"))
+	if err != nil {
+		t.Fatalf("读取死信文件失败: %v", err)
+	}
+	content := string(data)
+	if !strings.Contains(content, "field type conflict second line") {
+		t.Errorf("死信文件应记录单行的拒绝原因: %s", content)
+	}
+	if !strings.Contains(content, "# 无法编码") {
+		t.Errorf("无法编码的点应以注释保留: %s", content)
+	}
+
+	var targets []string
+	target := &mockDataTarget{}
+	n, err := ReplayDeadLetters(context.Background(), dir, 10, func(name string) (DataTarget, error) {
+		targets = append(targets, name)
+		return target, nil
+	})
+	if err != nil {
+		t.Fatalf("重放失败: %v", err)
+	}
+	if n != 1 || len(targets) != 1 || targets[0] != "db/rp" {
+		t.Fatalf("期望向 db/rp 重放 1 个点, 实际 %d 个点, 目标 %v", n, targets)
+	}
+	got := target.writtenData[0]
+	if got.Tags["host"] != "a b" || got.Fields["msg"] != `say "hi"` || got.Fields["value"] != 1.5 || !got.Time.Equal(ts) {
+		t.Errorf("重放的点不正确: %+v", got)
+	}
+
+	// 重放成功的文件不会再次重放
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.replayed-*")); len(matches) != 1 {
+		t.Errorf("重放成功的文件应被重命名, 实际为 %v", matches)
+	}
+	if n, _ := ReplayDeadLetters(context.Background(), dir, 10, func(string) (DataTarget, error) { return target, nil }); n != 0 {
+		t.Errorf("不应重复重放, 实际重放 %d 个点", n)
+	}
+}
+
+// 死信文件与写入目标端使用同一个编码器，特殊字符和字段类型重放后保持不变
+func TestDeadLetterRoundTripsEscaping(t *testing.T) {
+	dir := t.TempDir()
+	want := DataPoint{
+		Measurement: `disk io,total`,
+		Tags:        map[string]string{`path\to`: `C:\data dir`, "a=b": `x,y\`},
+		Fields: map[string]interface{}{
+			"msg":   "line1\nline2 \\ \"quoted\"",
+			"count": int64(-3),
+			"bytes": uint64(1 << 63),
+			"ok":    true,
+			"ratio": 0.25,
+		},
+		Time: time.Unix(0, 1700000000123456789),
+	}
+	if err := newDeadLetter(dir).write("db", []DataPoint{want}, "rejected"); err != nil {
+		t.Fatalf("写入死信目录失败: %v", err)
+	}
+
+	target := &mockDataTarget{}
+	n, err := ReplayDeadLetters(context.Background(), dir, 10, func(string) (DataTarget, error) { return target, nil })
+	if err != nil || n != 1 {
+		t.Fatalf("ReplayDeadLetters() = %d, %v", n, err)
+	}
+	got := target.writtenData[0]
+	if got.Measurement != want.Measurement || !reflect.DeepEqual(got.Tags, want.Tags) ||
+		!reflect.DeepEqual(got.Fields, want.Fields) || !got.Time.Equal(want.Time) {
+		t.Errorf("重放的点 = %+v, want %+v", got, want)
+	}
+}
+
+// 拒绝 value 为负数的点，其余点正常写入的目标
+type rejectingDataTarget struct {
+	mockDataTarget
+}
+
+func (m *rejectingDataTarget) WritePoints(ctx context.Context, db string, points []DataPoint) error {
+	var accepted []DataPoint
+	var rejected []RejectedPoint
+	for _, p := range points {
+		if v, _ := p.Fields["value"].(int); v < 0 {
+			rejected = append(rejected, RejectedPoint{Point: p, Reason: "negative value"})
+			continue
+		}
+		accepted = append(accepted, p)
+	}
+	if err := m.mockDataTarget.WritePoints(ctx, db, accepted); err != nil {
+		return err
+	}
+	return NewRejectedPointsError(rejected)
+}
+
+func TestSyncWritesRejectedPointsToDeadLetter(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := &seriesDataSource{mockDataSource: mockDataSource{measurements: []string{"cpu"}}}
+	for i := 0; i < 10; i++ {
+		value := i
+		if i%3 == 0 {
+			value = -i - 1
+		}
+		source.add(DataPoint{Measurement: "cpu", Fields: map[string]interface{}{"value": value}, Time: base.Add(time.Duration(i) * time.Second)})
+	}
+
+	dir := t.TempDir()
+	cfg := SyncConfig{SourceDB: "testdb", BatchSize: 4, DeadLetterDir: dir}
+	target := &rejectingDataTarget{}
+	syncer := NewSyncer(cfg, source, target)
+	if err := syncer.Sync(context.Background()); err != nil {
+		t.Fatalf("被拒绝的点不应导致同步失败: %v", err)
+	}
+	if got := target.GetWrittenDataCount(); got != 6 {
+		t.Errorf("期望写入 6 个点, 实际为 %d", got)
+	}
+	if got := syncer.rejected.Load(); got != 4 {
+		t.Errorf("期望 4 个点被拒绝, 实际为 %d", got)
+	}
+
+	data, err := os.ReadFile(deadLetterPath(dir, "testdb"))
+	if err != nil {
+		t.Fatalf("读取死信文件失败: %v", err)
+	}
+	if lines := strings.Count(string(data), "cpu value="); lines != 4 {
+		t.Errorf("死信文件应包含 4 个点, 实际为 %d:\n%s", lines, data)
+	}
+}
+
+func TestSyncDeadLettersPermanentlyFailedBatch(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newSource := func() *seriesDataSource {
+		source := &seriesDataSource{mockDataSource: mockDataSource{measurements: []string{"cpu"}}}
+		source.add(DataPoint{Measurement: "cpu", Fields: map[string]interface{}{"value": 1}, Time: base})
+		return source
+	}
+	badRequest := NewHTTPError(http.StatusBadRequest, 0, errors.New("unable to parse"))
+
+	// 未配置死信目录时永久错误导致同步失败
+	target := &flakyDataTarget{errs: []error{badRequest}}
+	if err := NewSyncer(SyncConfig{SourceDB: "testdb"}, newSource(), target).Sync(context.Background()); err == nil {
+		t.Error("未配置死信目录时应返回错误")
+	}
+
+	// 配置死信目录后批次写入死信目录并继续
+	dir := t.TempDir()
+	target = &flakyDataTarget{errs: []error{badRequest}}
+	if err := NewSyncer(SyncConfig{SourceDB: "testdb", DeadLetterDir: dir}, newSource(), target).Sync(context.Background()); err != nil {
+		t.Fatalf("配置死信目录时不应失败: %v", err)
+	}
+	if target.writes != 1 {
+		t.Errorf("永久错误不应重试, 实际写入 %d 次", target.writes)
+	}
+	if _, err := os.Stat(deadLetterPath(dir, "testdb")); err != nil {
+		t.Errorf("失败的批次应写入死信目录: %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrorClass 错误类别，决定同步引擎是否重试
+type ErrorClass int
+
+const (
+	ClassUnknown   ErrorClass = iota // 无法识别的错误，按可重试处理
+	ClassRetryable                   // 超时、5xx、429、连接被重置等临时错误
+	ClassPermanent                   // 认证失败、请求无法解析、字段类型冲突等重试无效的错误
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ClassRetryable:
+		return "可重试"
+	case ClassPermanent:
+		return "不可重试"
+	default:
+		return "未知"
+	}
+}
+
+// AdapterError 适配器返回的带分类的错误
+type AdapterError struct {
+	Class      ErrorClass
+	StatusCode int           // HTTP 状态码，未知时为 0
+	RetryAfter time.Duration // 服务端通过 Retry-After 要求的等待时间
+	Err        error
+}
+
+func (e *AdapterError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *AdapterError) Unwrap() error {
+	return e.Err
+}
+
+// NewHTTPError 按 HTTP 状态码对错误分类
+func NewHTTPError(status int, retryAfter time.Duration, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &AdapterError{Class: classOfStatus(status), StatusCode: status, RetryAfter: retryAfter, Err: err}
+}
+
+// ClassifyError 对没有结构化状态码的错误（1.x 客户端、网络错误等）按内容分类，
+// 已分类的错误原样返回
+func ClassifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var ae *AdapterError
+	if errors.As(err, &ae) {
+		return err
+	}
+	if m := statusPattern.FindStringSubmatch(err.Error()); m != nil {
+		status, _ := strconv.Atoi(m[1])
+		return NewHTTPError(status, 0, err)
+	}
+	return &AdapterError{Class: classOfError(err), Err: err}
+}
+
+// ErrorClassOf 返回错误的类别，未经分类的错误按内容判断
+func ErrorClassOf(err error) ErrorClass {
+	var rejected *RejectedPointsError
+	if errors.As(err, &rejected) {
+		return ClassPermanent
+	}
+	var ae *AdapterError
+	if errors.As(err, &ae) {
+		return ae.Class
+	}
+	return classOfError(err)
+}
+
+// IsPermanent 错误是否重试无效
+func IsPermanent(err error) bool {
+	return ErrorClassOf(err) == ClassPermanent
+}
+
+// RetryAfterOf 返回服务端要求的重试等待时间，没有时返回 0
+func RetryAfterOf(err error) time.Duration {
+	var ae *AdapterError
+	if errors.As(err, &ae) {
+		return ae.RetryAfter
+	}
+	return 0
+}
+
+// ParseRetryAfter 解析 Retry-After 响应头，支持秒数和 HTTP 日期两种格式
+func ParseRetryAfter(header string) time.Duration {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		return max(time.Duration(secs)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+// 错误信息中的 HTTP 状态码，如 "received status code 503" 或 "failed with status 429"
+var statusPattern = regexp.MustCompile(`status(?: code)?:? (\d{3})\b`)
+
+func classOfStatus(status int) ErrorClass {
+	switch {
+	case status == http.StatusTooManyRequests, status == http.StatusRequestTimeout, status >= 500:
+		return ClassRetryable
+	case status >= 400:
+		return ClassPermanent
+	default:
+		return ClassUnknown
+	}
+}
+
+// 没有状态码时可以识别的错误信息
+var (
+	retryableMessages = []string{
+		"timeout", "connection reset", "connection refused", "broken pipe", "eof",
+		"too many requests", "service unavailable", "bad gateway",
+	}
+	permanentMessages = []string{
+		"unauthorized", "authorization failed", "forbidden", "unable to parse",
+		"field type conflict", "bad request", "database not found", "bucket not found",
+	}
+)
+
+func classOfError(err error) ErrorClass {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return ClassRetryable
+	}
+	var t interface{ Timeout() bool }
+	if errors.As(err, &t) && t.Timeout() {
+		return ClassRetryable
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, s := range permanentMessages {
+		if strings.Contains(msg, s) {
+			return ClassPermanent
+		}
+	}
+	for _, s := range retryableMessages {
+		if strings.Contains(msg, s) {
+			return ClassRetryable
+		}
+	}
+	return ClassUnknown
+}
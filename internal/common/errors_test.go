@@ -0,0 +1,182 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	testCases := []struct {
+		name   string
+		err    error
+		class  ErrorClass
+		status int
+	}{
+		{"服务端 5xx", errors.New("received status code 503 from server"), ClassRetryable, 503},
+		{"限流 429", errors.New("write failed with status 429: slow down"), ClassRetryable, 429},
+		{"认证失败 401", errors.New("query failed with status 401: unauthorized"), ClassPermanent, 401},
+		{"请求体过大 413", errors.New("write failed with status 413: too large"), ClassPermanent, 413},
+		{"ctx 超时", fmt.Errorf("query: %w", context.DeadlineExceeded), ClassRetryable, 0},
+		{"连接被重置", fmt.Errorf("write: %w", syscall.ECONNRESET), ClassRetryable, 0},
+		{"1.x 认证失败", errors.New("authorization failed"), ClassPermanent, 0},
+		{"1.x 解析失败", errors.New(`unable to parse 'cpu value=': missing fields`), ClassPermanent, 0},
+		{"字段类型冲突", errors.New(`partial write: field type conflict: input field "value" on measurement "cpu" is type string, already exists as type float`), ClassPermanent, 0},
+		{"未知错误", errors.New("写入失败"), ClassUnknown, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ClassifyError(tc.err)
+			var ae *AdapterError
+			if !errors.As(err, &ae) {
+				t.Fatalf("期望返回 AdapterError, 实际为 %T", err)
+			}
+			if ae.Class != tc.class || ae.StatusCode != tc.status {
+				t.Errorf("期望类别 %s 状态码 %d, 实际为 %s %d", tc.class, tc.status, ae.Class, ae.StatusCode)
+			}
+			if !errors.Is(err, tc.err) {
+				t.Error("分类后应保留原始错误")
+			}
+		})
+	}
+
+	if ClassifyError(nil) != nil {
+		t.Error("nil 错误应返回 nil")
+	}
+
+	// 已分类的错误原样返回
+	typed := NewHTTPError(http.StatusTooManyRequests, time.Second, errors.New("slow down"))
+	if ClassifyError(typed) != typed {
+		t.Error("已分类的错误应原样返回")
+	}
+	if RetryAfterOf(fmt.Errorf("wrap: %w", typed)) != time.Second {
+		t.Error("应能从包装后的错误中读取 Retry-After")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if got := ParseRetryAfter("3"); got != 3*time.Second {
+		t.Errorf("ParseRetryAfter(\"3\") = %v", got)
+	}
+	if got := ParseRetryAfter(""); got != 0 {
+		t.Errorf("空值应返回 0, 实际为 %v", got)
+	}
+	date := time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat)
+	if got := ParseRetryAfter(date); got < 8*time.Second || got > 10*time.Second {
+		t.Errorf("HTTP 日期格式解析错误: %v", got)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	s := NewSyncer(SyncConfig{RetryInterval: 100}, &mockDataSource{}, &mockDataTarget{})
+	plain := errors.New("写入失败")
+
+	for attempt, upper := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 20: maxRetryDelay} {
+		for i := 0; i < 20; i++ {
+			if d := s.retryDelay(attempt, plain); d < upper/2 || d > upper {
+				t.Errorf("第 %d 次重试等待 %v, 期望在 [%v, %v] 之间", attempt, d, upper/2, upper)
+			}
+		}
+	}
+
+	// Retry-After 比退避时间长时按服务端要求等待
+	limited := NewHTTPError(http.StatusTooManyRequests, 5*time.Second, plain)
+	if d := s.retryDelay(1, limited); d != 5*time.Second {
+		t.Errorf("期望按 Retry-After 等待 5s, 实际为 %v", d)
+	}
+}
+
+func TestRetryReturnsContextErrorDuringBackoff(t *testing.T) {
+	s := NewSyncer(SyncConfig{RetryCount: 5, RetryInterval: 10000}, &mockDataSource{}, &mockDataTarget{})
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	err := s.retry(ctx, "写入", nil, func() error {
+		attempts++
+		// 第一次失败后进入退避等待，等待期间取消
+		time.AfterFunc(10*time.Millisecond, cancel)
+		return NewHTTPError(http.StatusServiceUnavailable, 0, errors.New("service unavailable"))
+	})
+	if attempts != 1 {
+		t.Errorf("取消后不应再重试, 实际执行 %d 次", attempts)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("期望返回 context.Canceled, 实际为 %v", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "service unavailable") {
+		t.Errorf("错误中应保留最后一次失败的原因, 实际为 %v", err)
+	}
+}
+
+// 按预设错误依次失败的目标，记录写入次数
+type flakyDataTarget struct {
+	mockDataTarget
+	errs   []error
+	writes int
+}
+
+func (m *flakyDataTarget) WritePoints(ctx context.Context, db string, points []DataPoint) error {
+	m.mu.Lock()
+	m.writes++
+	var err error
+	if len(m.errs) > 0 {
+		err, m.errs = m.errs[0], m.errs[1:]
+	}
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return m.mockDataTarget.WritePoints(ctx, db, points)
+}
+
+// 前几次查询失败的数据源
+type flakyDataSource struct {
+	seriesDataSource
+	failures int
+}
+
+func (m *flakyDataSource) QueryData(ctx context.Context, q Query) ([]DataPoint, Cursor, error) {
+	m.mu.Lock()
+	if m.failures > 0 {
+		m.failures--
+		m.mu.Unlock()
+		return nil, q.Cursor, NewHTTPError(http.StatusServiceUnavailable, 0, errors.New("service unavailable"))
+	}
+	m.mu.Unlock()
+	return m.seriesDataSource.QueryData(ctx, q)
+}
+
+func TestSyncRetriesByErrorClass(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newSource := func() *flakyDataSource {
+		source := &flakyDataSource{seriesDataSource: seriesDataSource{mockDataSource: mockDataSource{measurements: []string{"cpu"}}}}
+		source.add(DataPoint{Measurement: "cpu", Fields: map[string]interface{}{"value": 1}, Time: base})
+		return source
+	}
+	cfg := SyncConfig{SourceDB: "testdb", BatchSize: 10, RetryCount: 3, RetryInterval: 1}
+
+	// 可重试的查询和写入错误重试后成功
+	source := newSource()
+	source.failures = 2
+	target := &flakyDataTarget{errs: []error{NewHTTPError(http.StatusTooManyRequests, 0, errors.New("slow down"))}}
+	if err := NewSyncer(cfg, source, target).Sync(context.Background()); err != nil {
+		t.Fatalf("可重试的错误应在重试后成功: %v", err)
+	}
+	if target.GetWrittenDataCount() != 1 || target.writes != 2 {
+		t.Errorf("期望写入 2 次后成功, 实际写入 %d 次, %d 个点", target.writes, target.GetWrittenDataCount())
+	}
+
+	// 不可重试的错误只尝试一次
+	target = &flakyDataTarget{errs: []error{NewHTTPError(http.StatusUnauthorized, 0, errors.New("unauthorized"))}}
+	if err := NewSyncer(cfg, newSource(), target).Sync(context.Background()); err == nil {
+		t.Fatal("认证失败应返回错误")
+	}
+	if target.writes != 1 {
+		t.Errorf("不可重试的错误不应重试, 实际写入 %d 次", target.writes)
+	}
+}
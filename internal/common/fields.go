@@ -0,0 +1,163 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// FieldType 字段的数据类型，与 line protocol 的字段类型一一对应
+type FieldType string
+
+const (
+	FieldFloat    FieldType = "float"
+	FieldInteger  FieldType = "integer"
+	FieldUnsigned FieldType = "unsigned"
+	FieldString   FieldType = "string"
+	FieldBoolean  FieldType = "boolean"
+)
+
+// ParseFieldType 解析类型名称，如 1.x SHOW FIELD KEYS 返回的 fieldType
+func ParseFieldType(s string) (FieldType, bool) {
+	switch t := FieldType(s); t {
+	case FieldFloat, FieldInteger, FieldUnsigned, FieldString, FieldBoolean:
+		return t, true
+	}
+	return "", false
+}
+
+// FieldTypeOf 返回已按类型解码的值（如 2.x Flux 查询结果）的字段类型
+func FieldTypeOf(v interface{}) (FieldType, bool) {
+	switch v.(type) {
+	case float64:
+		return FieldFloat, true
+	case int64:
+		return FieldInteger, true
+	case uint64:
+		return FieldUnsigned, true
+	case string:
+		return FieldString, true
+	case bool:
+		return FieldBoolean, true
+	}
+	return "", false
+}
+
+// ConvertField 把解码得到的值（json.Number、float64 等）转换为字段类型对应的 Go 类型：
+// float64、int64、uint64、string 或 bool，整数类型的值不能带小数部分或超出范围
+func ConvertField(v interface{}, t FieldType) (interface{}, error) {
+	if n, ok := v.(json.Number); ok {
+		return convertNumber(n, t)
+	}
+	switch t {
+	case FieldFloat:
+		switch x := v.(type) {
+		case float64:
+			return x, nil
+		case float32:
+			return float64(x), nil
+		case int64:
+			return float64(x), nil
+		case int:
+			return float64(x), nil
+		case uint64:
+			return float64(x), nil
+		}
+	case FieldInteger:
+		switch x := v.(type) {
+		case int64:
+			return x, nil
+		case int:
+			return int64(x), nil
+		case uint64:
+			if x <= math.MaxInt64 {
+				return int64(x), nil
+			}
+		case float64:
+			if x == math.Trunc(x) && x >= math.MinInt64 && x < math.MaxInt64 {
+				return int64(x), nil
+			}
+		}
+	case FieldUnsigned:
+		switch x := v.(type) {
+		case uint64:
+			return x, nil
+		case int64:
+			if x >= 0 {
+				return uint64(x), nil
+			}
+		case int:
+			if x >= 0 {
+				return uint64(x), nil
+			}
+		case float64:
+			if x == math.Trunc(x) && x >= 0 && x < math.MaxUint64 {
+				return uint64(x), nil
+			}
+		}
+	case FieldString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case FieldBoolean:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("无法把 %T 类型的值 %v 转换为 %s", v, v, t)
+}
+
+func convertNumber(n json.Number, t FieldType) (interface{}, error) {
+	switch t {
+	case FieldFloat:
+		return n.Float64()
+	case FieldInteger:
+		if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+			return i, nil
+		}
+	case FieldUnsigned:
+		if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+			return u, nil
+		}
+	default:
+		return nil, fmt.Errorf("无法把数值 %s 转换为 %s", n, t)
+	}
+	// 以科学计数法等形式表示的整数
+	f, err := n.Float64()
+	if err != nil {
+		return nil, err
+	}
+	return ConvertField(f, t)
+}
+
+// NormalizeFields 按字段类型转换每个点的字段值，写入时保持源端的类型。
+// types 中没有的字段保持不变，有字段无法转换的点放入 invalid
+func NormalizeFields(points []DataPoint, types map[string]FieldType) (valid []DataPoint, invalid []RejectedPoint) {
+	if len(types) == 0 {
+		return points, nil
+	}
+	valid = points[:0:0]
+	for _, p := range points {
+		fields := make(map[string]interface{}, len(p.Fields))
+		var err error
+		for k, v := range p.Fields {
+			t, ok := types[k]
+			if !ok {
+				fields[k] = v
+				continue
+			}
+			if fields[k], err = ConvertField(v, t); err != nil {
+				err = fmt.Errorf("字段 %s: %v", k, err)
+				break
+			}
+		}
+		if err != nil {
+			invalid = append(invalid, RejectedPoint{Point: p, Reason: err.Error()})
+			continue
+		}
+		p.Fields = fields
+		valid = append(valid, p)
+	}
+	return valid, invalid
+}
@@ -0,0 +1,115 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConvertField(t *testing.T) {
+	tests := []struct {
+		value   interface{}
+		typ     FieldType
+		want    interface{}
+		wantErr bool
+	}{
+		{json.Number("1.5"), FieldFloat, 1.5, false},
+		{json.Number("3"), FieldFloat, float64(3), false},
+		{json.Number("42"), FieldInteger, int64(42), false},
+		{json.Number("-7"), FieldInteger, int64(-7), false},
+		{json.Number("1e3"), FieldInteger, int64(1000), false},
+		{json.Number("1.5"), FieldInteger, nil, true},
+		{json.Number("18446744073709551615"), FieldUnsigned, uint64(math.MaxUint64), false},
+		{json.Number("-1"), FieldUnsigned, nil, true},
+		{json.Number("1"), FieldString, nil, true},
+		{float64(2), FieldInteger, int64(2), false},
+		{float64(2.5), FieldInteger, nil, true},
+		{int64(5), FieldFloat, float64(5), false},
+		{int64(5), FieldUnsigned, uint64(5), false},
+		{uint64(math.MaxUint64), FieldInteger, nil, true},
+		{"on", FieldString, "on", false},
+		{"on", FieldBoolean, nil, true},
+		{true, FieldBoolean, true, false},
+	}
+	for _, tt := range tests {
+		got, err := ConvertField(tt.value, tt.typ)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ConvertField(%v(%T), %s) 错误 = %v, 期望错误 %v", tt.value, tt.value, tt.typ, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("ConvertField(%v(%T), %s) = %v(%T), 期望 %v(%T)", tt.value, tt.value, tt.typ, got, got, tt.want, tt.want)
+		}
+	}
+}
+
+func TestNormalizeFields(t *testing.T) {
+	types := map[string]FieldType{"count": FieldInteger, "usage": FieldFloat}
+	points := []DataPoint{
+		{Measurement: "cpu", Fields: map[string]interface{}{"count": json.Number("3"), "usage": json.Number("1"), "note": "x"}},
+		{Measurement: "cpu", Fields: map[string]interface{}{"count": json.Number("3.5")}},
+	}
+	valid, invalid := NormalizeFields(points, types)
+	if len(valid) != 1 || len(invalid) != 1 {
+		t.Fatalf("期望 1 个有效点和 1 个无效点, 实际为 %d 和 %d", len(valid), len(invalid))
+	}
+	fields := valid[0].Fields
+	if fields["count"] != int64(3) || fields["usage"] != float64(1) || fields["note"] != "x" {
+		t.Errorf("字段转换结果不正确: %#v", fields)
+	}
+	// 原始点不被修改
+	if _, ok := points[0].Fields["count"].(json.Number); !ok {
+		t.Errorf("NormalizeFields 不应修改原始点")
+	}
+	if !strings.Contains(invalid[0].Reason, "count") {
+		t.Errorf("拒绝原因应包含字段名: %s", invalid[0].Reason)
+	}
+
+	// 没有类型信息时原样返回
+	if valid, invalid := NormalizeFields(points, nil); len(valid) != 2 || invalid != nil {
+		t.Errorf("没有类型信息时应原样返回")
+	}
+}
+
+func TestSyncWritesOriginalFieldTypes(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := &seriesDataSource{mockDataSource: mockDataSource{
+		measurements: []string{"cpu"},
+		fieldTypes:   map[string]FieldType{"count": FieldInteger, "usage": FieldFloat},
+	}}
+	// 1.x 客户端把数值解码为 json.Number，整数字段不能被写成浮点数或字符串
+	for i := 0; i < 3; i++ {
+		source.add(DataPoint{Measurement: "cpu", Fields: map[string]interface{}{"count": json.Number("10"), "usage": json.Number("2")}, Time: base.Add(time.Duration(i) * time.Second)})
+	}
+	source.add(DataPoint{Measurement: "cpu", Fields: map[string]interface{}{"count": json.Number("1.5")}, Time: base.Add(time.Minute)})
+
+	dir := t.TempDir()
+	target := &mockDataTarget{}
+	syncer := NewSyncer(SyncConfig{SourceDB: "testdb", BatchSize: 10, DeadLetterDir: dir}, source, target)
+	if err := syncer.Sync(context.Background()); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if got := target.GetWrittenDataCount(); got != 3 {
+		t.Fatalf("期望写入 3 个点, 实际为 %d", got)
+	}
+	for _, p := range target.writtenData {
+		if _, ok := p.Fields["count"].(int64); !ok {
+			t.Errorf("count 应以 int64 写入, 实际为 %T", p.Fields["count"])
+		}
+		if _, ok := p.Fields["usage"].(float64); !ok {
+			t.Errorf("usage 应以 float64 写入, 实际为 %T", p.Fields["usage"])
+		}
+	}
+
+	// 无法转换的点写入死信目录
+	if got := syncer.rejected.Load(); got != 1 {
+		t.Errorf("期望 1 个点被拒绝, 实际为 %d", got)
+	}
+	if _, err := os.Stat(deadLetterPath(dir, "testdb")); err != nil {
+		t.Errorf("期望生成死信文件: %v", err)
+	}
+}
@@ -53,7 +53,7 @@ func TestSyncerWithRealConfiguration(t *testing.T) {
 	})
 
 	t.Run("测试数据库列表获取", func(t *testing.T) {
-		dbs, err := syncer.getDatabases()
+		dbs, err := syncer.getDatabases(context.Background())
 		if err != nil {
 			t.Errorf("获取数据库列表失败: %v", err)
 		}
@@ -213,7 +213,7 @@ func TestDataSourceInterface(t *testing.T) {
 	}
 
 	// 测试GetDatabases方法
-	dbs, err := source.GetDatabases()
+	dbs, err := source.GetDatabases(context.Background())
 	if err != nil {
 		t.Errorf("GetDatabases失败: %v", err)
 	}
@@ -222,7 +222,7 @@ func TestDataSourceInterface(t *testing.T) {
 	}
 
 	// 测试GetMeasurements方法
-	measurements, err := source.GetMeasurements("db1")
+	measurements, err := source.GetMeasurements(context.Background(), "db1")
 	if err != nil {
 		t.Errorf("GetMeasurements失败: %v", err)
 	}
@@ -231,7 +231,7 @@ func TestDataSourceInterface(t *testing.T) {
 	}
 
 	// 测试GetTagKeys方法
-	tagKeys, err := source.GetTagKeys("db1", "cpu")
+	tagKeys, err := source.GetTagKeys(context.Background(), "db1", "cpu")
 	if err != nil {
 		t.Errorf("GetTagKeys失败: %v", err)
 	}
@@ -240,15 +240,15 @@ func TestDataSourceInterface(t *testing.T) {
 	}
 
 	// 测试QueryData方法
-	points, maxTime, err := source.QueryData("db1", "cpu", time.Now().UnixNano(), 100)
+	points, cursor, err := source.QueryData(context.Background(), Query{DB: "db1", Measurement: "cpu", Cursor: Cursor{Time: time.Now().UnixNano()}, Limit: 100})
 	if err != nil {
 		t.Errorf("QueryData失败: %v", err)
 	}
 	if len(points) == 0 {
 		t.Error("期望有数据点返回")
 	}
-	if maxTime <= 0 {
-		t.Error("maxTime应该大于0")
+	if cursor.Time <= 0 {
+		t.Error("游标时间应该大于0")
 	}
 
 	// 测试Close方法
@@ -277,7 +277,7 @@ func TestDataTargetInterface(t *testing.T) {
 			Time:        time.Now(),
 		},
 	}
-	err = target.WritePoints("testdb", points)
+	err = target.WritePoints(context.Background(), "testdb", points)
 	if err != nil {
 		t.Errorf("WritePoints失败: %v", err)
 	}
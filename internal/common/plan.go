@@ -0,0 +1,218 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ygqygq2/influxdb-sync/internal/logx"
+)
+
+// 迁移计划文件格式版本
+const planVersion = 1
+
+// Plan 迁移计划：plan 命令连接源端生成，可编辑后由 apply 命令按计划执行。
+// 删除数据库、measurement 或时间窗口即跳过对应数据，修改 target 可改变写入的目标库
+type Plan struct {
+	Version   int            `json:"version"`
+	CreatedAt time.Time      `json:"created_at"`
+	Config    string         `json:"config"` // 配置文件路径，apply 从这里读取连接信息
+	Mode      string         `json:"mode"`
+	Start     string         `json:"start,omitempty"`
+	End       string         `json:"end,omitempty"`
+	Databases []PlanDatabase `json:"databases"`
+}
+
+// PlanDatabase 计划中的一个源数据库，Target 为默认保留策略的目标名称
+type PlanDatabase struct {
+	Name         string            `json:"name"`
+	Target       string            `json:"target"`
+	RPTargets    map[string]string `json:"rp_targets,omitempty"` // 其他保留策略的目标名称
+	Measurements []PlanMeasurement `json:"measurements"`
+}
+
+// PlanMeasurement 计划中的一个 measurement，RP 为空表示默认保留策略
+type PlanMeasurement struct {
+	Name          string       `json:"name"`
+	RP            string       `json:"rp,omitempty"`
+	EstimatedSize int64        `json:"estimated_size,omitempty"` // 预估点数或 series 数，0 表示未知
+	FirstTime     *time.Time   `json:"first_time,omitempty"`
+	LastTime      *time.Time   `json:"last_time,omitempty"`
+	Windows       []PlanWindow `json:"windows,omitempty"` // 拆分的时间窗口，为空表示整表作为一个任务
+}
+
+// PlanWindow 时间窗口，Start 对齐到窗口边界，与断点键对应
+type PlanWindow struct {
+	Start time.Time  `json:"start"`
+	End   *time.Time `json:"end,omitempty"` // 为空表示最后一个窗口，不设上限
+}
+
+// LoadPlan 读取迁移计划文件
+func LoadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("解析迁移计划失败: %v", err)
+	}
+	if plan.Version != planVersion {
+		return nil, fmt.Errorf("不支持的迁移计划版本: %d", plan.Version)
+	}
+	return &plan, nil
+}
+
+// Save 写入迁移计划文件
+func (p *Plan) Save(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// 数据库在计划中的目标名称
+func (p *Plan) target(db string) (string, bool) {
+	for _, d := range p.Databases {
+		if d.Name == db && d.Target != "" {
+			return d.Target, true
+		}
+	}
+	return "", false
+}
+
+// 保留策略在计划中的目标名称
+func (p *Plan) rpTarget(db, rp string) (string, bool) {
+	for _, d := range p.Databases {
+		if target, ok := d.RPTargets[rp]; d.Name == db && ok && target != "" {
+			return target, true
+		}
+	}
+	return "", false
+}
+
+// 把计划展开为同步任务，预估大小按窗口数平均分摊
+func (p *Plan) tasks(startTimeNano, endTimeNano int64) []syncTask {
+	var tasks []syncTask
+	for _, d := range p.Databases {
+		for _, m := range d.Measurements {
+			main := syncTask{key: CheckpointKey{DB: d.Name, RP: m.RP, Measurement: m.Name}, start: startTimeNano, end: endTimeNano}
+			if len(m.Windows) == 0 {
+				main.size = m.EstimatedSize
+				tasks = append(tasks, main)
+				continue
+			}
+			for _, w := range m.Windows {
+				t := main
+				t.start = max(w.Start.UnixNano(), startTimeNano)
+				if w.End != nil {
+					t.key = t.key.window(w.Start.UnixNano())
+					if end := w.End.UnixNano(); endTimeNano <= 0 || end < endTimeNano {
+						t.end = end
+					}
+				}
+				if t.end > 0 && t.start >= t.end {
+					continue
+				}
+				t.size = m.EstimatedSize / int64(len(m.Windows))
+				tasks = append(tasks, t)
+			}
+		}
+	}
+	return tasks
+}
+
+// Plan 连接源端生成迁移计划：列出每个数据库的 measurement、目标名称、
+// 预估大小、时间范围和时间窗口拆分，不写入目标端
+func (s *Syncer) Plan(ctx context.Context) (*Plan, error) {
+	if err := s.source.Connect(); err != nil {
+		logx.Error("源库连接失败:", err)
+		return nil, err
+	}
+	defer s.source.Close()
+
+	startTimeNano, err := s.getStartTime()
+	if err != nil {
+		return nil, err
+	}
+	endTimeNano, err := s.getEndTime()
+	if err != nil {
+		return nil, err
+	}
+
+	dbs, err := s.getDatabases(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{Version: planVersion, CreatedAt: time.Now().UTC(), Start: s.cfg.Start, End: s.cfg.End}
+	for _, db := range dbs {
+		measurements, err := s.getMeasurements(ctx, db)
+		if err != nil {
+			return nil, fmt.Errorf("获取数据库 %s 的 measurement 失败: %v", db, err)
+		}
+		rps, err := s.retentionPolicies(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+		pd := PlanDatabase{Name: db, Target: s.targetFor(db, ""), Measurements: []PlanMeasurement{}}
+		for _, rp := range rps {
+			if rp != "" {
+				if pd.RPTargets == nil {
+					pd.RPTargets = make(map[string]string)
+				}
+				pd.RPTargets[rp] = s.targetFor(db, rp)
+			}
+			for _, m := range measurements {
+				pd.Measurements = append(pd.Measurements, s.planMeasurement(ctx, db, rp, m, startTimeNano, endTimeNano))
+			}
+		}
+		logx.Info(fmt.Sprintf("数据库 %s -> %s: %d 个 measurement", db, pd.Target, len(pd.Measurements)))
+		plan.Databases = append(plan.Databases, pd)
+	}
+	return plan, nil
+}
+
+// 查询 measurement 的预估大小和时间范围，并按 ShardWindow 拆分时间窗口
+func (s *Syncer) planMeasurement(ctx context.Context, db, rp, measurement string, startTimeNano, endTimeNano int64) PlanMeasurement {
+	pm := PlanMeasurement{Name: measurement, RP: rp, EstimatedSize: s.estimateSize(ctx, db, rp, measurement)}
+	ranger, ok := s.source.(TimeRangeSource)
+	if !ok {
+		return pm
+	}
+	key := CheckpointKey{DB: db, RP: rp, Measurement: measurement}
+	first, last, err := s.timeRange(ctx, ranger, db, rp, measurement)
+	if err != nil {
+		logx.Warn(fmt.Sprintf("获取 %s 时间范围失败: %v", key, err))
+		return pm
+	}
+	if first == 0 && last == 0 {
+		return pm
+	}
+	pm.FirstTime, pm.LastTime = timePtr(first), timePtr(last)
+
+	if s.cfg.ShardWindow > 0 {
+		main := syncTask{key: key, start: startTimeNano, end: endTimeNano}
+		if tasks := splitWindows(main, first, last, s.cfg.ShardWindow.Nanoseconds()); len(tasks) > 1 {
+			for _, t := range tasks {
+				w := PlanWindow{Start: time.Unix(0, t.key.Shard).UTC()}
+				if !t.key.Sharded {
+					// 最后一个窗口沿用 measurement 的断点键
+					w.Start = time.Unix(0, t.start).UTC()
+				} else {
+					w.End = timePtr(t.end)
+				}
+				pm.Windows = append(pm.Windows, w)
+			}
+		}
+	}
+	return pm
+}
+
+func timePtr(nano int64) *time.Time {
+	t := time.Unix(0, nano).UTC()
+	return &t
+}
@@ -0,0 +1,128 @@
+package common
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 记录写入目标库名称的 mock 数据目标
+type namedDataTarget struct {
+	mockDataTarget
+	names map[string]int
+	mu    sync.Mutex
+}
+
+func (m *namedDataTarget) WritePoints(ctx context.Context, db string, points []DataPoint) error {
+	m.mu.Lock()
+	if m.names == nil {
+		m.names = map[string]int{}
+	}
+	m.names[db] += len(points)
+	m.mu.Unlock()
+	return m.mockDataTarget.WritePoints(ctx, db, points)
+}
+
+func TestPlanAndApply(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := &rangedDataSource{
+		seriesDataSource: seriesDataSource{mockDataSource: mockDataSource{measurements: []string{"cpu"}}},
+		ends:             map[int64]bool{},
+	}
+	// 5 天的数据，每小时一个点
+	for i := 0; i < 5*24; i++ {
+		source.add(DataPoint{
+			Measurement: "cpu",
+			Fields:      map[string]interface{}{"value": float64(i)},
+			Time:        base.Add(time.Duration(i) * time.Hour),
+		})
+	}
+
+	cfg := SyncConfig{SourceDB: "testdb", TargetDBPrefix: "bak_", BatchSize: 7, ShardWindow: 24 * time.Hour}
+	plan, err := NewSyncer(cfg, source, nil).Plan(context.Background())
+	if err != nil {
+		t.Fatalf("生成迁移计划失败: %v", err)
+	}
+	if len(plan.Databases) != 1 || plan.Databases[0].Target != "bak_testdb" {
+		t.Fatalf("期望 1 个数据库写入 bak_testdb, 实际为 %+v", plan.Databases)
+	}
+	m := plan.Databases[0].Measurements[0]
+	if m.Name != "cpu" || len(m.Windows) != 5 || m.Windows[4].End != nil {
+		t.Errorf("期望 cpu 拆分为 5 个窗口且最后一个不设上限, 实际为 %+v", m)
+	}
+	if m.FirstTime == nil || !m.FirstTime.Equal(base) || m.LastTime == nil || !m.LastTime.Equal(base.Add(119*time.Hour)) {
+		t.Errorf("时间范围不正确: %v - %v", m.FirstTime, m.LastTime)
+	}
+
+	// 计划文件可以保存后重新加载
+	path := filepath.Join(t.TempDir(), "plan.json")
+	if err := plan.Save(path); err != nil {
+		t.Fatalf("保存迁移计划失败: %v", err)
+	}
+	loaded, err := LoadPlan(path)
+	if err != nil {
+		t.Fatalf("加载迁移计划失败: %v", err)
+	}
+
+	// 按计划同步，目标名称和时间窗口以计划为准
+	loaded.Databases[0].Target = "edited"
+	cfg.Plan = loaded
+	cfg.ResumeFile = filepath.Join(t.TempDir(), "resume.state")
+	target := &namedDataTarget{}
+	if err := NewSyncer(cfg, source, target).Sync(context.Background()); err != nil {
+		t.Fatalf("按计划同步失败: %v", err)
+	}
+	if target.names["edited"] != 5*24 || len(target.names) != 1 {
+		t.Errorf("期望全部点写入计划中的目标库, 实际为 %v", target.names)
+	}
+	if len(source.ends) != 5 {
+		t.Errorf("期望按计划的 5 个时间窗口查询, 实际为 %d", len(source.ends))
+	}
+
+	// 断点键与自动规划一致
+	cps, err := NewFileCheckpointStore(cfg.ResumeFile, Fingerprint(cfg)).Load()
+	if err != nil {
+		t.Fatalf("加载断点失败: %v", err)
+	}
+	if len(cps) != 5 {
+		t.Errorf("期望每个时间窗口一个断点, 实际为 %+v", cps)
+	}
+}
+
+func TestApplySkipsRemovedMeasurements(t *testing.T) {
+	source := &failingQuerySource{
+		mockDataSource: mockDataSource{databases: []string{"db1", "db2"}, measurements: []string{"cpu", "mem"}},
+	}
+	plan := &Plan{Version: planVersion, Databases: []PlanDatabase{
+		{Name: "db1", Target: "db1", Measurements: []PlanMeasurement{{Name: "mem"}}},
+	}}
+	cfg := SyncConfig{Start: "2024-01-01T00:00:00Z", Plan: plan}
+	if err := NewSyncer(cfg, source, &mockDataTarget{}).Sync(context.Background()); err != nil {
+		t.Fatalf("按计划同步失败: %v", err)
+	}
+	if len(source.queried) != 1 || source.queried[0] != "db1/mem" {
+		t.Errorf("只应同步计划中的 measurement, 实际查询 %v", source.queried)
+	}
+}
+
+func TestPlanTasksClampToTimeRange(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	end := day(3)
+	plan := &Plan{Databases: []PlanDatabase{{Name: "db", Measurements: []PlanMeasurement{{
+		Name:          "cpu",
+		EstimatedSize: 300,
+		Windows:       []PlanWindow{{Start: day(1), End: &end}, {Start: day(3)}},
+	}}}}}
+
+	// 起始时间落在第一个窗口内，结束时间早于最后一个窗口
+	start, stop := day(1).Add(12*time.Hour).UnixNano(), day(2).Add(12*time.Hour).UnixNano()
+	tasks := plan.tasks(start, stop)
+	if len(tasks) != 1 {
+		t.Fatalf("期望 1 个任务, 实际为 %v", tasks)
+	}
+	if task := tasks[0]; task.start != start || task.end != stop || task.key != task.measurementKey().window(day(1).UnixNano()) || task.size != 150 {
+		t.Errorf("任务范围不正确: %+v", task)
+	}
+}
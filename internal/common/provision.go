@@ -0,0 +1,125 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ygqygq2/influxdb-sync/internal/logx"
+)
+
+// RetentionPolicy 保留策略，Duration 为 0 表示永久保留
+type RetentionPolicy struct {
+	Name     string
+	Duration time.Duration
+	Default  bool
+}
+
+// RetentionSource 可选接口：数据源支持查询数据库默认保留策略时实现，
+// 自动创建目标库时沿用源端的保留时长
+type RetentionSource interface {
+	DefaultRetention(ctx context.Context, db string) (RetentionPolicy, error)
+}
+
+// DatabaseCreator 可选接口：数据目标支持创建数据库/bucket 时实现，
+// 配置 create_missing 后在首次写入前调用
+type DatabaseCreator interface {
+	// EnsureDatabase 目标库不存在时按 rp 创建，已存在时不做任何修改
+	EnsureDatabase(ctx context.Context, name string, rp RetentionPolicy) error
+}
+
+// 每个目标库只创建一次，结果供所有 worker 共用
+type provisioner struct {
+	mu   sync.Mutex
+	done map[string]error
+}
+
+// 配置 create_missing 时确保源保留策略 rp 对应的目标库存在，同一目标库只检查一次
+func (s *Syncer) ensureTarget(ctx context.Context, db, rp string) error {
+	if !s.cfg.CreateMissing {
+		return nil
+	}
+	creator, ok := s.target.(DatabaseCreator)
+	if !ok {
+		return nil
+	}
+	// 先创建默认保留策略的目标库，1.x 新建的库才会以源库的默认保留策略为默认
+	if rp != "" {
+		if err := s.createTarget(ctx, creator, db, ""); err != nil {
+			return err
+		}
+	}
+	return s.createTarget(ctx, creator, db, rp)
+}
+
+func (s *Syncer) createTarget(ctx context.Context, creator DatabaseCreator, db, rp string) error {
+	targetName := s.targetFor(db, rp)
+
+	// 创建期间持有锁，其他 worker 等待结果，避免重复创建
+	s.provision.mu.Lock()
+	defer s.provision.mu.Unlock()
+	if err, ok := s.provision.done[targetName]; ok {
+		return err
+	}
+
+	policy := s.targetRetention(ctx, db, rp)
+	err := s.retry(ctx, "创建目标库 "+targetName, nil, func() error {
+		opCtx, cancel := s.opContext(ctx, s.writeTimeout())
+		defer cancel()
+		return creator.EnsureDatabase(opCtx, targetName, policy)
+	})
+	if err != nil {
+		err = fmt.Errorf("创建目标库 %s 失败: %w", targetName, err)
+		logx.Error(err)
+	} else {
+		logx.Info(fmt.Sprintf("目标库 %s 已就绪，保留时长: %s", targetName, retentionString(policy.Duration)))
+	}
+	// 被中断时不缓存，下次调用重新检查
+	if ctx.Err() == nil {
+		s.provision.done[targetName] = err
+	}
+	return err
+}
+
+// 新建目标库的保留策略：优先使用配置的保留时长，其次是源保留策略 rp 的保留时长
+func (s *Syncer) targetRetention(ctx context.Context, db, rp string) RetentionPolicy {
+	policy, ok := s.sourcePolicy(db, rp)
+	if s.cfg.CreateRetention > 0 {
+		policy.Duration = s.cfg.CreateRetention
+		return policy
+	}
+	if ok || rp != "" {
+		return policy
+	}
+	policy, err := s.defaultRetention(ctx, db)
+	if err != nil {
+		logx.Warn(fmt.Sprintf("获取 %s 的保留策略失败，目标库永久保留: %v", db, err))
+		return RetentionPolicy{}
+	}
+	return policy
+}
+
+// 通过 RetentionSource 查询源库的默认保留策略，数据源不支持时返回空的保留策略
+func (s *Syncer) defaultRetention(ctx context.Context, db string) (RetentionPolicy, error) {
+	src, ok := s.source.(RetentionSource)
+	if !ok {
+		return RetentionPolicy{}, nil
+	}
+	var policy RetentionPolicy
+	err := s.retry(ctx, "获取保留策略", nil, func() error {
+		opCtx, cancel := s.opContext(ctx, s.queryTimeout())
+		defer cancel()
+		var err error
+		policy, err = src.DefaultRetention(opCtx, db)
+		return err
+	})
+	return policy, err
+}
+
+func retentionString(d time.Duration) string {
+	if d <= 0 {
+		return "永久"
+	}
+	return d.String()
+}
@@ -0,0 +1,127 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// 带默认保留策略的 mock 数据源
+type retentionDataSource struct {
+	seriesDataSource
+	retention map[string]RetentionPolicy
+}
+
+func (m *retentionDataSource) DefaultRetention(ctx context.Context, db string) (RetentionPolicy, error) {
+	return m.retention[db], nil
+}
+
+// 记录创建过的目标库的 mock 数据目标，写入尚未创建的库时报错
+type creatorDataTarget struct {
+	mockDataTarget
+	created map[string]RetentionPolicy
+	calls   int
+	fail    map[string]bool
+}
+
+func (m *creatorDataTarget) EnsureDatabase(ctx context.Context, name string, rp RetentionPolicy) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	if m.fail[name] {
+		return NewHTTPError(403, 0, fmt.Errorf("没有创建 %s 的权限", name))
+	}
+	m.created[name] = rp
+	return nil
+}
+
+func (m *creatorDataTarget) WritePoints(ctx context.Context, db string, points []DataPoint) error {
+	m.mu.Lock()
+	_, ok := m.created[db]
+	m.mu.Unlock()
+	if !ok {
+		return NewHTTPError(404, 0, fmt.Errorf("database not found: %s", db))
+	}
+	return m.mockDataTarget.WritePoints(ctx, db, points)
+}
+
+func newRetentionSource() *retentionDataSource {
+	source := &retentionDataSource{
+		seriesDataSource: seriesDataSource{mockDataSource: mockDataSource{
+			databases: []string{"db1", "db2"}, measurements: []string{"cpu", "mem", "disk"},
+		}},
+		retention: map[string]RetentionPolicy{"db1": {Name: "one_week", Duration: 7 * 24 * time.Hour}},
+	}
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		source.add(DataPoint{Measurement: "cpu", Fields: map[string]interface{}{"value": float64(i)}, Time: base.Add(time.Duration(i) * time.Minute)})
+	}
+	return source
+}
+
+func TestSyncCreatesMissingTargets(t *testing.T) {
+	target := &creatorDataTarget{created: make(map[string]RetentionPolicy)}
+	cfg := SyncConfig{Start: "2024-01-01T00:00:00Z", TargetDBPrefix: "bak_", BatchSize: 3, Parallel: 4, CreateMissing: true}
+	if err := NewSyncer(cfg, newRetentionSource(), target).Sync(context.Background()); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	// 每个目标库只创建一次，保留策略沿用源库
+	if target.calls != 2 {
+		t.Errorf("期望创建 2 次, 实际为 %d", target.calls)
+	}
+	if rp := target.created["bak_db1"]; rp.Name != "one_week" || rp.Duration != 7*24*time.Hour {
+		t.Errorf("bak_db1 应沿用源库的保留策略, 实际为 %+v", rp)
+	}
+	if rp, ok := target.created["bak_db2"]; !ok || rp.Duration != 0 {
+		t.Errorf("bak_db2 应永久保留, 实际为 %+v, %v", rp, ok)
+	}
+	if got := target.GetWrittenDataCount(); got != 2*3*10 {
+		t.Errorf("期望写入 60 个点, 实际为 %d", got)
+	}
+
+	// 配置的保留时长优先于源库
+	target = &creatorDataTarget{created: make(map[string]RetentionPolicy)}
+	cfg.CreateRetention = 24 * time.Hour
+	if err := NewSyncer(cfg, newRetentionSource(), target).Sync(context.Background()); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if rp := target.created["bak_db1"]; rp.Duration != 24*time.Hour {
+		t.Errorf("期望使用配置的保留时长, 实际为 %+v", rp)
+	}
+
+	// 未开启时不创建
+	target = &creatorDataTarget{created: map[string]RetentionPolicy{"bak_db1": {}, "bak_db2": {}}}
+	cfg.CreateMissing = false
+	if err := NewSyncer(cfg, newRetentionSource(), target).Sync(context.Background()); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if target.calls != 0 {
+		t.Errorf("未开启 create_missing 时不应创建, 实际调用 %d 次", target.calls)
+	}
+}
+
+func TestSyncReportsCreateFailure(t *testing.T) {
+	target := &creatorDataTarget{created: make(map[string]RetentionPolicy), fail: map[string]bool{"bak_db2": true}}
+	cfg := SyncConfig{Start: "2024-01-01T00:00:00Z", TargetDBPrefix: "bak_", Parallel: 2, CreateMissing: true}
+	err := NewSyncer(cfg, newRetentionSource(), target).Sync(context.Background())
+
+	var syncErr *SyncError
+	if !errors.As(err, &syncErr) {
+		t.Fatalf("期望返回 SyncError, 实际为 %v", err)
+	}
+	// db2 的每个 measurement 都失败，创建失败的结果只尝试一次
+	if len(syncErr.Failures) != 3 || syncErr.Succeeded != 3 {
+		t.Errorf("期望 3 个失败、3 个成功, 实际为 %d 个失败、%d 个成功", len(syncErr.Failures), syncErr.Succeeded)
+	}
+	for _, f := range syncErr.Failures {
+		if f.Key.DB != "db2" {
+			t.Errorf("只有 db2 应失败, 实际为 %s", f.Key)
+		}
+	}
+	if target.calls != 2 {
+		t.Errorf("期望每个目标库只尝试创建一次, 实际为 %d", target.calls)
+	}
+}
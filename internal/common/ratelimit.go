@@ -0,0 +1,69 @@
+package common
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 令牌桶限速器，所有 worker 共享。每秒补充 rate 个令牌，最多积攒 1 秒的量。
+// 单次请求超过桶容量时先透支，由后续请求等待补足，因此长期平均速率不超过 rate
+type rateLimiter struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+}
+
+// 创建限速器，perSecond <= 0 时返回 nil，表示不限速
+func newRateLimiter(perSecond int64) *rateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: float64(perSecond), tokens: float64(perSecond), last: time.Now()}
+}
+
+// wait 消耗 n 个令牌，令牌不足时等待补足
+func (l *rateLimiter) wait(ctx context.Context, n int64) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 按点数和字节数同时限速
+type throttle struct {
+	points *rateLimiter
+	bytes  *rateLimiter
+}
+
+func newThrottle(pointsPerSec, bytesPerSec int64) throttle {
+	return throttle{points: newRateLimiter(pointsPerSec), bytes: newRateLimiter(bytesPerSec)}
+}
+
+// wait 为一批数据等待两个限速器的令牌
+func (t throttle) wait(ctx context.Context, points int, bytes int64) error {
+	if err := t.points.wait(ctx, int64(points)); err != nil {
+		return err
+	}
+	return t.bytes.wait(ctx, bytes)
+}
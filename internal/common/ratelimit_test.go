@@ -0,0 +1,89 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	ctx := context.Background()
+
+	// 未配置时不限速
+	unlimited := newRateLimiter(0)
+	if unlimited != nil || unlimited.wait(ctx, 1<<30) != nil {
+		t.Fatal("未配置速率时不应限速")
+	}
+
+	l := newRateLimiter(100)
+	start := time.Now()
+	if err := l.wait(ctx, 100); err != nil {
+		t.Fatalf("桶内令牌充足时应立即返回: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("桶内令牌充足时不应等待, 耗时 %v", elapsed)
+	}
+
+	// 令牌用完后按速率补充
+	if err := l.wait(ctx, 10); err != nil {
+		t.Fatalf("等待令牌失败: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("令牌不足时应等待约 100ms, 实际 %v", elapsed)
+	}
+
+	// 超过桶容量的请求先透支，ctx 结束时返回错误
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := l.wait(timeout, 1000); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ctx 结束时应返回错误, 实际为: %v", err)
+	}
+}
+
+func TestSyncLimitsTargetThroughput(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := &seriesDataSource{mockDataSource: mockDataSource{measurements: []string{"cpu"}}}
+	for i := 0; i < 150; i++ {
+		source.add(DataPoint{Measurement: "cpu", Fields: map[string]interface{}{"value": i}, Time: base.Add(time.Duration(i) * time.Second)})
+	}
+	target := &mockDataTarget{}
+
+	cfg := SyncConfig{SourceDB: "testdb", BatchSize: 50, TargetPointsPerSec: 100}
+	start := time.Now()
+	if err := NewSyncer(cfg, source, target).Sync(context.Background()); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	// 前 100 个点使用桶内令牌，剩余 50 个点需等待约 500ms
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("写入应受限速约束, 耗时 %v", elapsed)
+	}
+	if got := target.GetWrittenDataCount(); got != 150 {
+		t.Errorf("期望写入 150 个点, 实际为 %d", got)
+	}
+}
+
+// 写入字节限速按发送给目标端的 line protocol 请求体大小计算，而不是内存中的预估大小
+func TestSyncChargesEncodedBytesToTargetLimit(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := &seriesDataSource{mockDataSource: mockDataSource{measurements: []string{"cpu"}}}
+	for i := 0; i < 10; i++ {
+		source.add(DataPoint{Measurement: "cpu", Tags: map[string]string{"host": "a"}, Fields: map[string]interface{}{"value": i}, Time: base.Add(time.Duration(i) * time.Second)})
+	}
+	points := append([]DataPoint(nil), source.points...)
+
+	// 只有一批，首次消耗令牌时桶是满的，剩余令牌正好等于容量减去本批字节数
+	cfg := SyncConfig{SourceDB: "testdb", BatchSize: 100, TargetBytesPerSec: 100000}
+	s := NewSyncer(cfg, source, &mockDataTarget{})
+	if err := s.Sync(context.Background()); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	want := encodedSize(points)
+	if want == pointsSize(points) {
+		t.Fatalf("测试数据的编码大小应与内存预估不同")
+	}
+	if got := int64(100000 - s.writeLimit.bytes.tokens); got != want {
+		t.Errorf("写入限速消耗 %d 字节, want %d", got, want)
+	}
+}
@@ -0,0 +1,92 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ygqygq2/influxdb-sync/internal/logx"
+)
+
+// Repair 只重新同步 diffs 中不一致的时间窗口，然后重新校验这些窗口，
+// 返回仍不一致的窗口。写入沿用同步的流程（限速、重试、死信目录等），
+// 但不读取也不更新断点。reader 是读取目标端的数据源，用于重新校验。
+// 目标端多出的点无法通过复制修复，重新校验后仍会报告
+func (s *Syncer) Repair(ctx context.Context, reader DataSource, diffs []WindowDiff, opts VerifyOptions) ([]WindowDiff, error) {
+	if err := validateOnError(s.cfg.OnError); err != nil {
+		return nil, err
+	}
+	if len(diffs) == 0 {
+		logx.Info("没有需要修复的时间窗口")
+		return nil, nil
+	}
+
+	if err := s.source.Connect(); err != nil {
+		logx.Error("源库连接失败:", err)
+		return nil, err
+	}
+	defer s.source.Close()
+	if err := s.target.Connect(); err != nil {
+		logx.Error("目标库连接失败:", err)
+		return nil, err
+	}
+	defer s.target.Close()
+	if err := reader.Connect(); err != nil {
+		logx.Error("目标库连接失败:", err)
+		return nil, err
+	}
+	defer reader.Close()
+
+	// 查询涉及的源库的保留策略，目标名称与同步时一致
+	listed := make(map[string]bool)
+	for _, d := range diffs {
+		if d.RP != "" && !listed[d.DB] {
+			if _, err := s.retentionPolicies(ctx, d.DB); err != nil {
+				return nil, err
+			}
+			listed[d.DB] = true
+		}
+	}
+
+	// 每个窗口一个任务，断点键带窗口起点，同一 measurement 的多个窗口互不影响
+	diffs = append([]WindowDiff(nil), diffs...)
+	tasks := make([]syncTask, 0, len(diffs))
+	for i, d := range diffs {
+		if d.TargetCount > d.SourceCount {
+			logx.Warn(fmt.Sprintf("%s [%s, %s) 目标端多出 %d 个点，重新复制无法删除", d.key(),
+				d.Start.Format(time.RFC3339), d.End.Format(time.RFC3339), d.TargetCount-d.SourceCount))
+		}
+		diffs[i].Target = s.targetFor(d.DB, d.RP)
+		tasks = append(tasks, syncTask{
+			key:   CheckpointKey{DB: d.DB, RP: d.RP, Measurement: d.Measurement}.window(d.Start.UnixNano()),
+			start: d.Start.UnixNano(),
+			end:   d.End.UnixNano(),
+			size:  d.SourceCount,
+		})
+	}
+	logx.Info(fmt.Sprintf("重新同步 %d 个时间窗口", len(tasks)))
+
+	failures := newFailureTracker(s.cfg)
+	s.runTasks(ctx, tasks, failures)
+	if ctx.Err() != nil {
+		return nil, ErrInterrupted
+	}
+	if err := failures.err(); err != nil {
+		return nil, err
+	}
+
+	// 重新校验修复过的窗口
+	var remaining []WindowDiff
+	for _, d := range diffs {
+		diff, _, err := s.compareWindow(ctx, reader, d, opts.Checksum || len(d.Fields) > 0)
+		if err != nil {
+			return remaining, fmt.Errorf("重新校验 %s 失败: %v", d.key(), err)
+		}
+		if diff != nil {
+			logx.Warn("修复后仍不一致:", diff)
+			remaining = append(remaining, *diff)
+		}
+	}
+	logx.Info(fmt.Sprintf("修复完成，%d 个时间窗口一致，%d 个仍不一致", len(diffs)-len(remaining), len(remaining)))
+	return remaining, nil
+}
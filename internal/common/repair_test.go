@@ -0,0 +1,106 @@
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// 把写入的点保存到 seriesDataSource 的 mock 数据目标，与 InfluxDB 一样
+// 相同 series 和时间戳的点覆盖旧值
+type storeDataTarget struct {
+	mockDataTarget
+	store *seriesDataSource
+}
+
+func (m *storeDataTarget) WritePoints(ctx context.Context, db string, points []DataPoint) error {
+	m.store.mu.Lock()
+	var added []DataPoint
+	for _, p := range points {
+		replaced := false
+		for i, old := range m.store.points {
+			if old.Time.Equal(p.Time) && seriesKey(old) == seriesKey(p) {
+				m.store.points[i], replaced = p, true
+				break
+			}
+		}
+		if !replaced {
+			added = append(added, p)
+		}
+	}
+	m.store.mu.Unlock()
+	m.store.add(added...)
+	return m.mockDataTarget.WritePoints(ctx, db, points)
+}
+
+func TestRepairResyncsMismatchedWindows(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := &seriesDataSource{mockDataSource: mockDataSource{measurements: []string{"cpu"}}}
+	store := &seriesDataSource{}
+	// 3 天的数据，目标端缺少第 2 天的两个点，第 3 天多出一个源端没有的 series
+	for i := 0; i < 3*24; i++ {
+		p := DataPoint{
+			Measurement: "cpu",
+			Tags:        map[string]string{"host": "a"},
+			Fields:      map[string]interface{}{"value": float64(i)},
+			Time:        base.Add(time.Duration(i) * time.Hour),
+		}
+		source.add(p)
+		if i != 30 && i != 31 {
+			store.add(p)
+		}
+	}
+	store.add(DataPoint{Measurement: "cpu", Tags: map[string]string{"host": "b"}, Fields: map[string]interface{}{"value": 1.0}, Time: base.Add(50 * time.Hour)})
+
+	cfg := SyncConfig{SourceDB: "testdb", BatchSize: 10, Start: "2024-01-01T00:00:00Z", End: "2024-01-04T00:00:00Z"}
+	opts := VerifyOptions{Window: 24 * time.Hour}
+	diffs, err := NewSyncer(cfg, source, nil).Verify(context.Background(), store, opts)
+	if err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	if len(diffs) != 2 {
+		t.Fatalf("期望 2 个不一致窗口, 实际为 %v", diffs)
+	}
+
+	target := &storeDataTarget{store: store}
+	remaining, err := NewSyncer(cfg, source, target).Repair(context.Background(), store, diffs, opts)
+	if err != nil {
+		t.Fatalf("修复失败: %v", err)
+	}
+	// 只重新复制不一致的两个窗口
+	if got := target.GetWrittenDataCount(); got != 2*24 {
+		t.Errorf("期望重新写入 2 个窗口共 48 个点, 实际为 %d", got)
+	}
+	// 缺少的点已补齐，多出的点无法通过复制删除
+	if len(remaining) != 1 || !remaining[0].Start.Equal(base.Add(48*time.Hour)) || remaining[0].TargetCount != 25 {
+		t.Errorf("期望只有第 3 天仍不一致, 实际为 %v", remaining)
+	}
+}
+
+// 从 1970-01-01 开始的窗口使用独立的断点键，不读取也不改动 measurement 的同步进度
+func TestRepairEpochWindowKeepsMeasurementProgress(t *testing.T) {
+	epoch := time.Unix(0, 0).UTC()
+	source := &seriesDataSource{mockDataSource: mockDataSource{measurements: []string{"cpu"}}}
+	for i := 0; i < 3; i++ {
+		source.add(DataPoint{Measurement: "cpu", Fields: map[string]interface{}{"value": float64(i)}, Time: epoch.Add(time.Duration(i) * time.Minute)})
+	}
+	store := &seriesDataSource{}
+	target := &storeDataTarget{store: store}
+
+	s := NewSyncer(SyncConfig{SourceDB: "testdb", BatchSize: 10}, source, target)
+	main := CheckpointKey{DB: "testdb", Measurement: "cpu"}
+	progress := Cursor{Time: epoch.Add(24 * time.Hour).UnixNano()}
+	s.setProgress(main, progress)
+
+	diffs := []WindowDiff{{DB: "testdb", Measurement: "cpu", Start: epoch, End: epoch.Add(time.Hour), SourceCount: 3}}
+	remaining, err := s.Repair(context.Background(), store, diffs, VerifyOptions{Window: time.Hour})
+	if err != nil || len(remaining) != 0 {
+		t.Fatalf("修复失败: %v, 仍不一致 %v", err, remaining)
+	}
+	if got := target.GetWrittenDataCount(); got != 3 {
+		t.Errorf("期望重新写入 3 个点, 实际为 %d", got)
+	}
+	if s.progress[main] != progress {
+		t.Errorf("measurement 的同步进度被修改: %+v", s.progress[main])
+	}
+}
@@ -0,0 +1,95 @@
+package common
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ygqygq2/influxdb-sync/internal/logx"
+)
+
+// 出错后的处理策略
+const (
+	OnErrorContinue = "continue"  // 记录失败，继续同步其他 measurement 和数据库
+	OnErrorFailFast = "fail_fast" // 第一个失败后不再开始新的任务
+)
+
+// Failure 单个 measurement 或数据库的同步失败
+type Failure struct {
+	Key        CheckpointKey // Measurement 为空表示整个数据库失败，如无法获取 measurement 列表
+	Checkpoint int64         // 失败时已同步到的时间，0 表示尚未同步
+	Err        error
+}
+
+// SyncError 一轮同步中有失败，Succeeded 为同步完成的 measurement 数
+type SyncError struct {
+	Failures  []Failure
+	Succeeded int
+	Aborted   bool // 失败数达到上限，剩余任务未执行
+}
+
+func (e *SyncError) Error() string {
+	return fmt.Sprintf("同步失败，共%d个错误", len(e.Failures))
+}
+
+// Partial 是否有 measurement 同步完成
+func (e *SyncError) Partial() bool {
+	return e.Succeeded > 0
+}
+
+// 校验出错处理策略
+func validateOnError(policy string) error {
+	switch policy {
+	case "", OnErrorContinue, OnErrorFailFast:
+		return nil
+	default:
+		return fmt.Errorf("不支持的出错处理策略: %s，支持: %s, %s", policy, OnErrorContinue, OnErrorFailFast)
+	}
+}
+
+// 一轮同步的失败记录，只在收集结果的协程中使用
+type failureTracker struct {
+	limit     int // 失败数达到该值后停止，0 表示不限
+	failures  []Failure
+	succeeded int
+	aborted   bool
+}
+
+func newFailureTracker(cfg SyncConfig) *failureTracker {
+	t := &failureTracker{limit: max(cfg.MaxFailures, 0)}
+	if cfg.OnError == OnErrorFailFast {
+		t.limit = 1
+	}
+	return t
+}
+
+// add 记录一个失败，返回是否达到上限需要停止
+func (t *failureTracker) add(f Failure) bool {
+	t.failures = append(t.failures, f)
+	if t.limit > 0 && len(t.failures) >= t.limit && !t.aborted {
+		t.aborted = true
+		logx.Error(fmt.Sprintf("失败数达到上限 %d，不再开始新的任务", t.limit))
+	}
+	return t.aborted
+}
+
+// err 输出失败报告，没有失败时返回 nil
+func (t *failureTracker) err() error {
+	if len(t.failures) == 0 {
+		return nil
+	}
+	logx.Error(fmt.Sprintf("同步失败报告：%d 个失败，%d 个 measurement 同步完成", len(t.failures), t.succeeded))
+	for _, f := range t.failures {
+		measurement := f.Key.Measurement
+		if measurement == "" {
+			measurement = "(整个数据库)"
+		} else if f.Key.Sharded {
+			measurement = fmt.Sprintf("%s@%s", measurement, time.Unix(0, f.Key.Shard).UTC().Format(time.RFC3339))
+		}
+		checkpoint := "无"
+		if f.Checkpoint > 0 {
+			checkpoint = time.Unix(0, f.Checkpoint).UTC().Format(time.RFC3339Nano)
+		}
+		logx.Error(fmt.Sprintf("  数据库: %s  measurement: %s  断点: %s  错误: %v", f.Key.DB, measurement, checkpoint, f.Err))
+	}
+	return &SyncError{Failures: t.failures, Succeeded: t.succeeded, Aborted: t.aborted}
+}
@@ -0,0 +1,113 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// 指定的库无法获取 measurement、指定的 measurement 查询失败的 mock 数据源
+type failingQuerySource struct {
+	mockDataSource
+	badDB   string
+	fail    map[string]bool
+	queried []string
+	mu      sync.Mutex
+}
+
+func (m *failingQuerySource) GetMeasurements(ctx context.Context, db string) ([]string, error) {
+	if db == m.badDB {
+		return nil, NewHTTPError(403, 0, errors.New("forbidden"))
+	}
+	return m.measurements, nil
+}
+
+func (m *failingQuerySource) QueryData(ctx context.Context, q Query) ([]DataPoint, Cursor, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queried = append(m.queried, q.DB+"/"+q.Measurement)
+	if m.fail[q.DB+"/"+q.Measurement] {
+		return nil, q.Cursor, NewHTTPError(400, 0, errors.New("bad request"))
+	}
+	return nil, q.Cursor, nil
+}
+
+func TestSyncContinuesAcrossDatabases(t *testing.T) {
+	source := &failingQuerySource{
+		mockDataSource: mockDataSource{databases: []string{"db1", "db2", "db3"}, measurements: []string{"cpu", "mem"}},
+		badDB:          "db3",
+		fail:           map[string]bool{"db1/cpu": true, "db2/mem": true},
+	}
+	cfg := SyncConfig{Start: "2024-01-01T00:00:00Z", Parallel: 2}
+	err := NewSyncer(cfg, source, &mockDataTarget{}).Sync(context.Background())
+
+	var syncErr *SyncError
+	if !errors.As(err, &syncErr) {
+		t.Fatalf("期望返回 SyncError, 实际为 %v", err)
+	}
+	if len(syncErr.Failures) != 3 || syncErr.Succeeded != 2 || syncErr.Aborted {
+		t.Errorf("期望 3 个失败、2 个成功且未中止, 实际为 %d 个失败、%d 个成功、中止 %v",
+			len(syncErr.Failures), syncErr.Succeeded, syncErr.Aborted)
+	}
+	if !syncErr.Partial() {
+		t.Error("有 measurement 同步完成时应为部分成功")
+	}
+
+	failed := make(map[CheckpointKey]bool)
+	for _, f := range syncErr.Failures {
+		failed[f.Key] = true
+	}
+	for _, key := range []CheckpointKey{{DB: "db1", Measurement: "cpu"}, {DB: "db2", Measurement: "mem"}, {DB: "db3"}} {
+		if !failed[key] {
+			t.Errorf("失败报告中缺少 %s", key)
+		}
+	}
+}
+
+func TestSyncFailFastStopsDispatching(t *testing.T) {
+	source := &failingQuerySource{
+		mockDataSource: mockDataSource{databases: []string{"db1", "db2"}, measurements: []string{"cpu", "mem"}},
+		fail:           map[string]bool{"db1/cpu": true},
+	}
+	cfg := SyncConfig{Start: "2024-01-01T00:00:00Z", Parallel: 1, OnError: OnErrorFailFast}
+	err := NewSyncer(cfg, source, &mockDataTarget{}).Sync(context.Background())
+
+	var syncErr *SyncError
+	if !errors.As(err, &syncErr) {
+		t.Fatalf("期望返回 SyncError, 实际为 %v", err)
+	}
+	if len(syncErr.Failures) != 1 || !syncErr.Aborted || syncErr.Partial() {
+		t.Errorf("期望 1 个失败、中止且没有成功, 实际为 %+v", syncErr)
+	}
+	if len(source.queried) != 1 {
+		t.Errorf("第一个失败后不应开始新的任务, 实际查询 %v", source.queried)
+	}
+}
+
+func TestSyncStopsAtMaxFailures(t *testing.T) {
+	source := &failingQuerySource{
+		mockDataSource: mockDataSource{databases: []string{"db1", "db2"}, measurements: []string{"cpu", "mem"}},
+		fail:           map[string]bool{"db1/cpu": true, "db1/mem": true, "db2/cpu": true, "db2/mem": true},
+	}
+	cfg := SyncConfig{Start: "2024-01-01T00:00:00Z", Parallel: 1, MaxFailures: 2}
+	err := NewSyncer(cfg, source, &mockDataTarget{}).Sync(context.Background())
+
+	var syncErr *SyncError
+	if !errors.As(err, &syncErr) {
+		t.Fatalf("期望返回 SyncError, 实际为 %v", err)
+	}
+	if len(syncErr.Failures) != 2 || !syncErr.Aborted {
+		t.Errorf("期望失败 2 个后中止, 实际为 %d 个失败、中止 %v", len(syncErr.Failures), syncErr.Aborted)
+	}
+	if len(source.queried) != 2 {
+		t.Errorf("达到失败上限后不应开始新的任务, 实际查询 %v", source.queried)
+	}
+}
+
+func TestSyncRejectsUnknownErrorPolicy(t *testing.T) {
+	cfg := SyncConfig{SourceDB: "testdb", OnError: "ignore"}
+	if err := NewSyncer(cfg, &mockDataSource{}, &mockDataTarget{}).Sync(context.Background()); err == nil {
+		t.Error("不支持的出错处理策略应返回错误")
+	}
+}
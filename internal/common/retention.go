@@ -0,0 +1,88 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ygqygq2/influxdb-sync/internal/logx"
+)
+
+// RetentionPolicySource 可选接口：数据源有多个保留策略（1.x）时实现，开启 AllRetentionPolicies 后
+// 每个 (源库, 保留策略, measurement) 作为独立的同步单元，查询时通过 Query.RP 指定保留策略
+type RetentionPolicySource interface {
+	RetentionPolicies(ctx context.Context, db string) ([]RetentionPolicy, error)
+}
+
+// 数据库要同步的保留策略。默认保留策略以空字符串表示，断点和目标库
+// 与只同步默认保留策略时一致；未开启或数据源不支持时只有默认保留策略
+func (s *Syncer) retentionPolicies(ctx context.Context, db string) ([]string, error) {
+	src, ok := s.source.(RetentionPolicySource)
+	if !s.cfg.AllRetentionPolicies || !ok {
+		return []string{""}, nil
+	}
+
+	var policies []RetentionPolicy
+	err := s.retry(ctx, "获取保留策略", nil, func() error {
+		opCtx, cancel := s.opContext(ctx, s.queryTimeout())
+		defer cancel()
+		var err error
+		policies, err = src.RetentionPolicies(opCtx, db)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取数据库 %s 的保留策略失败: %w", db, err)
+	}
+	s.mu.Lock()
+	s.retention[db] = policies
+	s.mu.Unlock()
+
+	var rps []string
+	for _, p := range policies {
+		if p.Default {
+			rps = append([]string{""}, rps...)
+		} else {
+			rps = append(rps, p.Name)
+		}
+	}
+	logx.Info(fmt.Sprintf("数据库 %s 共 %d 个保留策略", db, len(policies)))
+	return rps, nil
+}
+
+// 已查询到的源保留策略，rp 为空时返回默认保留策略
+func (s *Syncer) sourcePolicy(db, rp string) (RetentionPolicy, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.retention[db] {
+		if p.Name == rp || (rp == "" && p.Default) {
+			return p, true
+		}
+	}
+	return RetentionPolicy{}, false
+}
+
+// 源保留策略对应的目标名称：按计划执行时使用计划中的名称，其次是 RetentionPolicyMap
+// 中的模板；未配置时默认保留策略写入目标库，其他保留策略写入 "目标库/保留策略"
+func (s *Syncer) targetFor(db, rp string) string {
+	if s.cfg.Plan != nil && rp != "" {
+		if target, ok := s.cfg.Plan.rpTarget(db, rp); ok {
+			return target
+		}
+	}
+	base := s.targetName(db)
+	// 计划中默认保留策略的目标已包含映射
+	if s.cfg.Plan == nil || rp != "" {
+		name := rp
+		if name == "" {
+			p, _ := s.sourcePolicy(db, "")
+			name = p.Name
+		}
+		if tmpl, ok := s.cfg.RetentionPolicyMap[name]; ok && name != "" {
+			return strings.NewReplacer("{db}", base, "{rp}", name).Replace(tmpl)
+		}
+	}
+	if rp == "" {
+		return base
+	}
+	return base + "/" + rp
+}
@@ -0,0 +1,149 @@
+package common
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 有多个保留策略的 mock 数据源，每个保留策略保存各自的点
+type multiRPDataSource struct {
+	mockDataSource
+	policies []RetentionPolicy
+	series   map[string]*seriesDataSource // 保留策略名 -> 数据，空字符串为默认保留策略
+}
+
+func (m *multiRPDataSource) RetentionPolicies(ctx context.Context, db string) ([]RetentionPolicy, error) {
+	return m.policies, nil
+}
+
+func (m *multiRPDataSource) QueryData(ctx context.Context, q Query) ([]DataPoint, Cursor, error) {
+	series, ok := m.series[q.RP]
+	if !ok {
+		return nil, q.Cursor, nil
+	}
+	return series.QueryData(ctx, q)
+}
+
+func newMultiRPSource() *multiRPDataSource {
+	source := &multiRPDataSource{
+		mockDataSource: mockDataSource{databases: []string{"db1"}, measurements: []string{"cpu"}},
+		policies: []RetentionPolicy{
+			{Name: "rp_1y", Duration: 365 * 24 * time.Hour},
+			{Name: "autogen", Default: true},
+			{Name: "rp_30d", Duration: 30 * 24 * time.Hour},
+		},
+		series: map[string]*seriesDataSource{"": {}, "rp_1y": {}, "rp_30d": {}},
+	}
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	counts := map[string]int{"": 5, "rp_1y": 3, "rp_30d": 2}
+	for rp, n := range counts {
+		for i := 0; i < n; i++ {
+			source.series[rp].add(DataPoint{Measurement: "cpu", Fields: map[string]interface{}{"value": float64(i)}, Time: base.Add(time.Duration(i) * time.Minute)})
+		}
+	}
+	return source
+}
+
+// 按目标名称统计写入点数的 mock 数据目标
+type dbDataTarget struct {
+	mockDataTarget
+	mu      sync.Mutex
+	written map[string]int
+}
+
+func (m *dbDataTarget) WritePoints(ctx context.Context, db string, points []DataPoint) error {
+	m.mu.Lock()
+	m.written[db] += len(points)
+	m.mu.Unlock()
+	return m.mockDataTarget.WritePoints(ctx, db, points)
+}
+
+func TestSyncAllRetentionPolicies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resume.state")
+	cfg := SyncConfig{
+		Start: "2024-01-01T00:00:00Z", TargetDBPrefix: "bak_", BatchSize: 2, Parallel: 2, ResumeFile: path,
+		AllRetentionPolicies: true,
+		RetentionPolicyMap:   map[string]string{"rp_30d": "{db}_{rp}"},
+	}
+	target := &dbDataTarget{written: make(map[string]int)}
+	if err := NewSyncer(cfg, newMultiRPSource(), target).Sync(context.Background()); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	// 默认保留策略写入目标库，其他保留策略按映射或 "目标库/保留策略"
+	expected := map[string]int{"bak_db1": 5, "bak_db1/rp_1y": 3, "bak_db1_rp_30d": 2}
+	for name, n := range expected {
+		if target.written[name] != n {
+			t.Errorf("期望 %s 写入 %d 个点, 实际为 %d", name, n, target.written[name])
+		}
+	}
+	if len(target.written) != len(expected) {
+		t.Errorf("期望写入 %d 个目标, 实际为 %v", len(expected), target.written)
+	}
+
+	// 每个保留策略单独记录断点，默认保留策略的断点键与只同步默认保留策略时一致
+	loaded, err := NewFileCheckpointStore(path, Fingerprint(cfg)).Load()
+	if err != nil {
+		t.Fatalf("加载断点失败: %v", err)
+	}
+	for _, rp := range []string{"", "rp_1y", "rp_30d"} {
+		key := CheckpointKey{DB: "db1", RP: rp, Measurement: "cpu"}
+		if _, ok := loaded[key]; !ok {
+			t.Errorf("缺少 %s 的断点", key)
+		}
+	}
+
+	// 未开启时只同步默认保留策略
+	cfg.AllRetentionPolicies, cfg.ResumeFile = false, ""
+	target = &dbDataTarget{written: make(map[string]int)}
+	if err := NewSyncer(cfg, newMultiRPSource(), target).Sync(context.Background()); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if len(target.written) != 1 || target.written["bak_db1"] != 5 {
+		t.Errorf("未开启时应只写入默认保留策略, 实际为 %v", target.written)
+	}
+}
+
+func TestPlanRetentionPolicyTargets(t *testing.T) {
+	cfg := SyncConfig{
+		TargetDBPrefix: "bak_", AllRetentionPolicies: true,
+		RetentionPolicyMap: map[string]string{"autogen": "{db}_main"},
+	}
+	plan, err := NewSyncer(cfg, newMultiRPSource(), &mockDataTarget{}).Plan(context.Background())
+	if err != nil {
+		t.Fatalf("生成计划失败: %v", err)
+	}
+	if len(plan.Databases) != 1 {
+		t.Fatalf("期望 1 个数据库, 实际为 %d", len(plan.Databases))
+	}
+	d := plan.Databases[0]
+	// 默认保留策略的映射写入 Target，默认保留策略排在最前
+	if d.Target != "bak_db1_main" {
+		t.Errorf("期望默认保留策略的目标为 bak_db1_main, 实际为 %s", d.Target)
+	}
+	if d.RPTargets["rp_1y"] != "bak_db1/rp_1y" || d.RPTargets["rp_30d"] != "bak_db1/rp_30d" {
+		t.Errorf("保留策略目标不正确: %v", d.RPTargets)
+	}
+	var rps []string
+	for _, m := range d.Measurements {
+		rps = append(rps, m.RP)
+	}
+	if len(rps) != 3 || rps[0] != "" || rps[1] != "rp_1y" || rps[2] != "rp_30d" {
+		t.Errorf("期望 measurement 依次属于默认、rp_1y、rp_30d, 实际为 %q", rps)
+	}
+
+	// 按计划执行时使用计划中的目标名称
+	d.RPTargets["rp_1y"] = "archive"
+	plan.Databases[0] = d
+	cfg.Plan = plan
+	s := NewSyncer(cfg, newMultiRPSource(), &mockDataTarget{})
+	if got := s.targetFor("db1", "rp_1y"); got != "archive" {
+		t.Errorf("期望使用计划中的目标 archive, 实际为 %s", got)
+	}
+	if got := s.targetFor("db1", ""); got != "bak_db1_main" {
+		t.Errorf("期望默认保留策略的目标为 bak_db1_main, 实际为 %s", got)
+	}
+}
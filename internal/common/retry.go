@@ -0,0 +1,65 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/ygqygq2/influxdb-sync/internal/logx"
+)
+
+// 单次重试等待的上限
+const maxRetryDelay = 30 * time.Second
+
+// retry 执行 op，失败时按错误类别重试：不可重试的错误立即返回，其余按指数退避加随机抖动等待，
+// 服务端返回 Retry-After 时至少等待该时间。最多执行 retry_count 次，ctx 在等待期间结束时
+// 停止重试，返回包装了 ctx.Err() 的错误，消息中保留最后一次失败的原因。
+// 重试次数计入 stats，不属于某个 measurement 的操作传 nil
+func (s *Syncer) retry(ctx context.Context, name string, stats *measurementStats, op func() error) error {
+	attempts := s.cfg.RetryCount
+	if attempts <= 0 {
+		attempts = 3
+	}
+
+	for i := 1; ; i++ {
+		err := op()
+		if err == nil {
+			return nil
+		}
+		class := ErrorClassOf(err)
+		if class == ClassPermanent || i >= attempts {
+			return err
+		}
+
+		delay := s.retryDelay(i, err)
+		logx.Warn(fmt.Sprintf("%s失败（%s错误），%v 后第%d次重试: %v", name, class, delay.Round(time.Millisecond), i, err))
+		stats.addRetry()
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%s停止重试: %w（最后一次错误: %v）", name, ctx.Err(), err)
+		}
+	}
+}
+
+// 第 attempt 次重试前的等待时间：retry_interval 按 2 的幂增长，取其一半到全部之间的随机值
+func (s *Syncer) retryDelay(attempt int, err error) time.Duration {
+	base := time.Duration(s.cfg.RetryInterval) * time.Millisecond
+	if base <= 0 {
+		base = 500 * time.Millisecond
+	}
+
+	delay := maxRetryDelay
+	if attempt <= 16 && base<<(attempt-1) < maxRetryDelay {
+		delay = base << (attempt - 1)
+	}
+	delay = delay/2 + rand.N(delay/2+1)
+
+	if after := RetryAfterOf(err); after > delay {
+		delay = after
+	}
+	return delay
+}
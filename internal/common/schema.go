@@ -0,0 +1,288 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ygqygq2/influxdb-sync/internal/logx"
+	"gopkg.in/yaml.v2"
+)
+
+// 2.x schema.tagKeys 和 3.x 兼容模式返回的系统列，不属于 tag
+var systemTagKeys = map[string]bool{"_field": true, "_measurement": true, "_start": true, "_stop": true, "time": true}
+
+// Schema 源端或目标端的结构：数据库、measurement、tag 和带类型的字段
+type Schema struct {
+	CreatedAt time.Time        `json:"created_at" yaml:"created_at"`
+	Databases []SchemaDatabase `json:"databases" yaml:"databases"`
+}
+
+// SchemaDatabase 一个数据库（2.x 为 bucket）的结构
+type SchemaDatabase struct {
+	Name         string              `json:"name" yaml:"name"`
+	Measurements []SchemaMeasurement `json:"measurements" yaml:"measurements"`
+}
+
+// SchemaMeasurement 一个 measurement 的 tag 和字段类型
+type SchemaMeasurement struct {
+	Name   string               `json:"name" yaml:"name"`
+	Tags   []string             `json:"tags" yaml:"tags"`
+	Fields map[string]FieldType `json:"fields" yaml:"fields"`
+}
+
+// Save 写入结构文件，扩展名为 .yaml 或 .yml 时使用 YAML，否则使用 JSON
+func (sc *Schema) Save(path string) error {
+	var data []byte
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		data, err = yaml.Marshal(sc)
+	default:
+		data, err = json.MarshalIndent(sc, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// 结构差异的类型
+const (
+	SchemaMissingMeasurement = "missing_measurement"
+	SchemaMissingTag         = "missing_tag"
+	SchemaMissingField       = "missing_field"
+	SchemaFieldTypeMismatch  = "field_type_mismatch"
+)
+
+// SchemaDiff 源端和目标端的一处结构差异，Key 为缺少的 tag 或字段名
+type SchemaDiff struct {
+	Kind        string    `json:"kind"`
+	DB          string    `json:"db"`
+	Target      string    `json:"target"`
+	Measurement string    `json:"measurement"`
+	Key         string    `json:"key,omitempty"`
+	SourceType  FieldType `json:"source_type,omitempty"`
+	TargetType  FieldType `json:"target_type,omitempty"`
+}
+
+func (d SchemaDiff) String() string {
+	name := fmt.Sprintf("%s/%s -> %s", d.DB, d.Measurement, d.Target)
+	switch d.Kind {
+	case SchemaMissingMeasurement:
+		return fmt.Sprintf("%s: 目标端缺少 measurement", name)
+	case SchemaMissingTag:
+		return fmt.Sprintf("%s: 目标端缺少 tag %s", name, d.Key)
+	case SchemaMissingField:
+		return fmt.Sprintf("%s: 目标端缺少字段 %s (%s)", name, d.Key, d.SourceType)
+	case SchemaFieldTypeMismatch:
+		return fmt.Sprintf("%s: 字段 %s 类型不一致，源 %s，目标 %s", name, d.Key, d.SourceType, d.TargetType)
+	}
+	return fmt.Sprintf("%s: %s %s", name, d.Kind, d.Key)
+}
+
+// SaveSchemaDiffs 以 JSON 格式写入结构差异列表
+func SaveSchemaDiffs(path string, diffs []SchemaDiff) error {
+	if diffs == nil {
+		diffs = []SchemaDiff{}
+	}
+	data, err := json.MarshalIndent(diffs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// ExportSchema 读取源端每个数据库的 measurement、tag 和字段类型，只读取默认保留策略
+func (s *Syncer) ExportSchema(ctx context.Context) (*Schema, error) {
+	if err := s.source.Connect(); err != nil {
+		logx.Error("源库连接失败:", err)
+		return nil, err
+	}
+	defer s.source.Close()
+
+	dbs, err := s.getDatabases(ctx)
+	if err != nil {
+		return nil, err
+	}
+	schema := &Schema{CreatedAt: time.Now().UTC(), Databases: []SchemaDatabase{}}
+	for _, db := range dbs {
+		measurements, err := s.getMeasurements(ctx, db)
+		if err != nil {
+			return nil, fmt.Errorf("获取数据库 %s 的 measurement 失败: %v", db, err)
+		}
+		sd, err := s.databaseSchema(ctx, s.source, db, measurements)
+		if err != nil {
+			return nil, err
+		}
+		logx.Info(fmt.Sprintf("数据库 %s: %d 个 measurement", db, len(sd.Measurements)))
+		schema.Databases = append(schema.Databases, sd)
+	}
+	return schema, nil
+}
+
+// DiffSchema 比较源端和目标端的结构，目标库名称与同步时一致（按前缀/后缀或 bucket 映射），
+// 返回目标端缺少的 measurement、tag、字段以及字段类型不一致
+func (s *Syncer) DiffSchema(ctx context.Context, target DataSource) ([]SchemaDiff, error) {
+	if err := s.source.Connect(); err != nil {
+		logx.Error("源库连接失败:", err)
+		return nil, err
+	}
+	defer s.source.Close()
+	if err := target.Connect(); err != nil {
+		logx.Error("目标库连接失败:", err)
+		return nil, err
+	}
+	defer target.Close()
+
+	dbs, err := s.getDatabases(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var diffs []SchemaDiff
+	for _, db := range dbs {
+		measurements, err := s.getMeasurements(ctx, db)
+		if err != nil {
+			return diffs, fmt.Errorf("获取数据库 %s 的 measurement 失败: %v", db, err)
+		}
+		src, err := s.databaseSchema(ctx, s.source, db, measurements)
+		if err != nil {
+			return diffs, err
+		}
+
+		targetName := s.targetFor(db, "")
+		var targetMeasurements []string
+		err = s.retry(ctx, "获取目标端 measurement 列表", nil, func() error {
+			opCtx, cancel := s.opContext(ctx, s.queryTimeout())
+			defer cancel()
+			var err error
+			targetMeasurements, err = target.GetMeasurements(opCtx, targetName)
+			return err
+		})
+		if err != nil {
+			return diffs, fmt.Errorf("获取目标库 %s 的 measurement 失败: %v", targetName, err)
+		}
+		// 只读取源端也有的 measurement
+		existing := make(map[string]bool, len(targetMeasurements))
+		for _, m := range targetMeasurements {
+			existing[m] = true
+		}
+		var shared []string
+		for _, m := range measurements {
+			if existing[m] {
+				shared = append(shared, m)
+			}
+		}
+		dst, err := s.databaseSchema(ctx, target, targetName, shared)
+		if err != nil {
+			return diffs, err
+		}
+		diffs = append(diffs, diffDatabaseSchema(db, targetName, src, dst)...)
+	}
+	return diffs, nil
+}
+
+// 读取一个数据库中各 measurement 的 tag 和字段类型
+func (s *Syncer) databaseSchema(ctx context.Context, source DataSource, db string, measurements []string) (SchemaDatabase, error) {
+	sd := SchemaDatabase{Name: db, Measurements: []SchemaMeasurement{}}
+	sorted := append([]string(nil), measurements...)
+	sort.Strings(sorted)
+	for _, m := range sorted {
+		if err := ctx.Err(); err != nil {
+			return sd, err
+		}
+		sm := SchemaMeasurement{Name: m, Tags: []string{}}
+		var tagKeys map[string]bool
+		err := s.retry(ctx, "获取标签字段", nil, func() error {
+			opCtx, cancel := s.opContext(ctx, s.queryTimeout())
+			defer cancel()
+			var err error
+			tagKeys, err = source.GetTagKeys(opCtx, db, m)
+			return err
+		})
+		if err != nil {
+			return sd, fmt.Errorf("获取 %s/%s 的 tag 失败: %v", db, m, err)
+		}
+		for tag := range tagKeys {
+			if !systemTagKeys[tag] {
+				sm.Tags = append(sm.Tags, tag)
+			}
+		}
+		sort.Strings(sm.Tags)
+
+		err = s.retry(ctx, "获取字段类型", nil, func() error {
+			opCtx, cancel := s.opContext(ctx, s.queryTimeout())
+			defer cancel()
+			var err error
+			sm.Fields, err = source.GetFieldKeys(opCtx, db, m)
+			return err
+		})
+		if err != nil {
+			return sd, fmt.Errorf("获取 %s/%s 的字段失败: %v", db, m, err)
+		}
+		if sm.Fields == nil {
+			sm.Fields = map[string]FieldType{}
+		}
+		sd.Measurements = append(sd.Measurements, sm)
+	}
+	return sd, nil
+}
+
+// 比较同一数据库在源端和目标端的结构，结果按 measurement、tag、字段名排序
+func diffDatabaseSchema(db, targetName string, src, dst SchemaDatabase) []SchemaDiff {
+	targets := make(map[string]SchemaMeasurement, len(dst.Measurements))
+	for _, m := range dst.Measurements {
+		targets[m.Name] = m
+	}
+
+	var diffs []SchemaDiff
+	for _, sm := range src.Measurements {
+		base := SchemaDiff{DB: db, Target: targetName, Measurement: sm.Name}
+		tm, ok := targets[sm.Name]
+		if !ok {
+			d := base
+			d.Kind = SchemaMissingMeasurement
+			diffs = append(diffs, d)
+			continue
+		}
+
+		tags := make(map[string]bool, len(tm.Tags))
+		for _, tag := range tm.Tags {
+			tags[tag] = true
+		}
+		for _, tag := range sm.Tags {
+			if !tags[tag] {
+				d := base
+				d.Kind, d.Key = SchemaMissingTag, tag
+				diffs = append(diffs, d)
+			}
+		}
+
+		fields := make([]string, 0, len(sm.Fields))
+		for name := range sm.Fields {
+			fields = append(fields, name)
+		}
+		sort.Strings(fields)
+		for _, name := range fields {
+			d := base
+			d.Key, d.SourceType = name, sm.Fields[name]
+			targetType, ok := tm.Fields[name]
+			switch {
+			case !ok:
+				d.Kind = SchemaMissingField
+			case targetType != d.SourceType:
+				d.Kind, d.TargetType = SchemaFieldTypeMismatch, targetType
+			default:
+				continue
+			}
+			diffs = append(diffs, d)
+		}
+	}
+	return diffs
+}
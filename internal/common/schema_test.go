@@ -0,0 +1,140 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+// 按数据库保存 measurement 结构的 mock 数据源
+type schemaDataSource struct {
+	mockDataSource
+	schemas map[string][]SchemaMeasurement
+}
+
+func (m *schemaDataSource) GetDatabases(ctx context.Context) ([]string, error) {
+	var dbs []string
+	for db := range m.schemas {
+		dbs = append(dbs, db)
+	}
+	return dbs, nil
+}
+
+func (m *schemaDataSource) GetMeasurements(ctx context.Context, db string) ([]string, error) {
+	var names []string
+	for _, sm := range m.schemas[db] {
+		names = append(names, sm.Name)
+	}
+	return names, nil
+}
+
+func (m *schemaDataSource) find(db, measurement string) SchemaMeasurement {
+	for _, sm := range m.schemas[db] {
+		if sm.Name == measurement {
+			return sm
+		}
+	}
+	return SchemaMeasurement{}
+}
+
+func (m *schemaDataSource) GetTagKeys(ctx context.Context, db, measurement string) (map[string]bool, error) {
+	// 与 2.x schema.tagKeys 一样返回系统列
+	tags := map[string]bool{"_measurement": true, "_field": true}
+	for _, tag := range m.find(db, measurement).Tags {
+		tags[tag] = true
+	}
+	return tags, nil
+}
+
+func (m *schemaDataSource) GetFieldKeys(ctx context.Context, db, measurement string) (map[string]FieldType, error) {
+	return m.find(db, measurement).Fields, nil
+}
+
+func TestExportSchema(t *testing.T) {
+	source := &schemaDataSource{schemas: map[string][]SchemaMeasurement{
+		"db1": {
+			{Name: "mem", Tags: []string{"host"}, Fields: map[string]FieldType{"used": FieldInteger}},
+			{Name: "cpu", Tags: []string{"region", "host"}, Fields: map[string]FieldType{"usage": FieldFloat, "up": FieldBoolean}},
+		},
+	}}
+	schema, err := NewSyncer(SyncConfig{SourceDB: "db1"}, source, nil).ExportSchema(context.Background())
+	if err != nil {
+		t.Fatalf("导出结构失败: %v", err)
+	}
+	if len(schema.Databases) != 1 || len(schema.Databases[0].Measurements) != 2 {
+		t.Fatalf("导出结构不正确: %+v", schema)
+	}
+	cpu := schema.Databases[0].Measurements[0]
+	if cpu.Name != "cpu" || strings.Join(cpu.Tags, ",") != "host,region" || cpu.Fields["usage"] != FieldFloat {
+		t.Errorf("measurement 应按名称排序、tag 排序并去掉系统列: %+v", cpu)
+	}
+
+	// 按扩展名写入 JSON 或 YAML
+	dir := t.TempDir()
+	for _, name := range []string{"schema.json", "schema.yaml"} {
+		path := filepath.Join(dir, name)
+		if err := schema.Save(path); err != nil {
+			t.Fatalf("写入 %s 失败: %v", name, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("读取 %s 失败: %v", name, err)
+		}
+		var loaded Schema
+		if strings.HasSuffix(name, ".yaml") {
+			err = yaml.Unmarshal(data, &loaded)
+		} else {
+			err = json.Unmarshal(data, &loaded)
+		}
+		if err != nil {
+			t.Fatalf("解析 %s 失败: %v", name, err)
+		}
+		if got := loaded.Databases[0].Measurements[1].Fields["used"]; got != FieldInteger {
+			t.Errorf("%s 中 mem.used 的类型应为 integer, 实际为 %q", name, got)
+		}
+	}
+}
+
+func TestDiffSchema(t *testing.T) {
+	source := &schemaDataSource{schemas: map[string][]SchemaMeasurement{
+		"db1": {
+			{Name: "cpu", Tags: []string{"host", "region"}, Fields: map[string]FieldType{"usage": FieldFloat, "count": FieldInteger, "note": FieldString}},
+			{Name: "disk", Tags: []string{"path"}, Fields: map[string]FieldType{"free": FieldInteger}},
+			{Name: "mem", Tags: []string{"host"}, Fields: map[string]FieldType{"used": FieldInteger}},
+		},
+	}}
+	target := &schemaDataSource{schemas: map[string][]SchemaMeasurement{
+		"bak_db1": {
+			{Name: "cpu", Tags: []string{"host"}, Fields: map[string]FieldType{"usage": FieldFloat, "count": FieldFloat}},
+			{Name: "mem", Tags: []string{"host"}, Fields: map[string]FieldType{"used": FieldInteger}},
+		},
+	}}
+
+	diffs, err := NewSyncer(SyncConfig{SourceDB: "db1", TargetDBPrefix: "bak_"}, source, nil).DiffSchema(context.Background(), target)
+	if err != nil {
+		t.Fatalf("比较结构失败: %v", err)
+	}
+	expected := []SchemaDiff{
+		{Kind: SchemaMissingTag, Measurement: "cpu", Key: "region"},
+		{Kind: SchemaFieldTypeMismatch, Measurement: "cpu", Key: "count", SourceType: FieldInteger, TargetType: FieldFloat},
+		{Kind: SchemaMissingField, Measurement: "cpu", Key: "note", SourceType: FieldString},
+		{Kind: SchemaMissingMeasurement, Measurement: "disk"},
+	}
+	if len(diffs) != len(expected) {
+		t.Fatalf("期望 %d 处差异, 实际为 %v", len(expected), diffs)
+	}
+	for i, want := range expected {
+		want.DB, want.Target = "db1", "bak_db1"
+		if diffs[i] != want {
+			t.Errorf("第 %d 处差异期望 %+v, 实际为 %+v", i, want, diffs[i])
+		}
+	}
+	if s := diffs[1].String(); !strings.Contains(s, "源 integer，目标 float") {
+		t.Errorf("差异描述不正确: %s", s)
+	}
+}
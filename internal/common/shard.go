@@ -0,0 +1,144 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ygqygq2/influxdb-sync/internal/logx"
+)
+
+// TimeRangeSource 可选接口：数据源支持查询 measurement 的时间范围时实现，
+// 用于把大表拆分为多个时间窗口并行同步
+type TimeRangeSource interface {
+	// TimeRange 返回最早和最晚一个点的时间戳，没有数据时返回 0；rp 为空表示默认保留策略
+	TimeRange(ctx context.Context, db, rp, measurement string) (first, last int64, err error)
+}
+
+// SizeEstimator 可选接口：数据源支持预估 measurement 大小（点数或 series 数）时实现，
+// 调度时最大的任务最先开始
+type SizeEstimator interface {
+	EstimateSize(ctx context.Context, db, rp, measurement string) (int64, error)
+}
+
+// 同步任务：整个 measurement 或其中的一个时间窗口
+type syncTask struct {
+	key   CheckpointKey
+	start int64
+	end   int64 // 0 表示不限制
+	size  int64 // 预估大小，用于调度排序
+}
+
+// 任务所属 measurement 的断点键
+func (t syncTask) measurementKey() CheckpointKey {
+	return CheckpointKey{DB: t.key.DB, RP: t.key.RP, Measurement: t.key.Measurement}
+}
+
+func (t syncTask) String() string {
+	name := t.measurementKey().String()
+	if !t.key.Sharded {
+		return name
+	}
+	return fmt.Sprintf("%s [%s, %s)", name,
+		time.Unix(0, t.start).UTC().Format(time.RFC3339), time.Unix(0, t.end).UTC().Format(time.RFC3339))
+}
+
+// 规划 measurement 的同步任务，时间跨度超过一个窗口的大表拆分为多个时间窗口
+func (s *Syncer) planTasks(ctx context.Context, db, rp, measurement string, startTimeNano, endTimeNano int64) []syncTask {
+	main := syncTask{key: CheckpointKey{DB: db, RP: rp, Measurement: measurement}, start: startTimeNano, end: endTimeNano}
+	ranger, ok := s.source.(TimeRangeSource)
+	if s.cfg.ShardWindow <= 0 || !ok {
+		return []syncTask{main}
+	}
+
+	// follow 模式的后续轮次只需从上次位置继续，上一轮有窗口失败时重新拆分
+	if s.caughtUp(main.key) {
+		return []syncTask{main}
+	}
+
+	first, last, err := s.timeRange(ctx, ranger, db, rp, measurement)
+	if err != nil {
+		logx.Warn(fmt.Sprintf("获取 %s 时间范围失败，不拆分时间窗口: %v", main.key, err))
+		return []syncTask{main}
+	}
+
+	tasks := splitWindows(main, first, last, s.cfg.ShardWindow.Nanoseconds())
+	if len(tasks) > 1 {
+		logx.Info(fmt.Sprintf("measurement %s 拆分为 %d 个时间窗口", main.key, len(tasks)))
+	}
+	return tasks
+}
+
+// 查询 measurement 最早和最晚一个点的时间
+func (s *Syncer) timeRange(ctx context.Context, ranger TimeRangeSource, db, rp, measurement string) (first, last int64, err error) {
+	opCtx, cancel := s.opContext(ctx, s.queryTimeout())
+	defer cancel()
+	return ranger.TimeRange(opCtx, db, rp, measurement)
+}
+
+// 预估 measurement 的大小，数据源不支持或查询失败时返回 0
+func (s *Syncer) estimateSize(ctx context.Context, db, rp, measurement string) int64 {
+	estimator, ok := s.source.(SizeEstimator)
+	key := CheckpointKey{DB: db, RP: rp, Measurement: measurement}
+	if !ok || s.caughtUp(key) {
+		return 0
+	}
+
+	opCtx, cancel := s.opContext(ctx, s.queryTimeout())
+	defer cancel()
+	size, err := estimator.EstimateSize(opCtx, db, rp, measurement)
+	if err != nil {
+		logx.Debug(fmt.Sprintf("预估 %s 大小失败: %v", key, err))
+		return 0
+	}
+	logx.Debug(fmt.Sprintf("measurement %s 预估大小: %d", key, size))
+	return size
+}
+
+// measurement 是否已在之前的轮次完整同步过，follow 模式下只需从上次位置继续
+func (s *Syncer) caughtUp(key CheckpointKey) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, synced := s.progress[key]
+	return synced && !s.incomplete[key]
+}
+
+// 按对齐到 window 整数倍的边界拆分 [first, last]，保证多次运行拆分结果一致，
+// 每个窗口的断点才能对应上。最后一个窗口不设上限并沿用 measurement 的断点键，
+// follow 模式和不拆分时都从这里继续
+func splitWindows(main syncTask, first, last, window int64) []syncTask {
+	if first < main.start {
+		first = main.start
+	}
+	if main.end > 0 && last >= main.end {
+		last = main.end - 1
+	}
+	if last < first {
+		return []syncTask{main}
+	}
+
+	firstWindow := floorDiv(first, window) * window
+	lastWindow := floorDiv(last, window) * window
+	if lastWindow <= firstWindow {
+		return []syncTask{main}
+	}
+
+	var tasks []syncTask
+	for ws := firstWindow; ws < lastWindow; ws += window {
+		t := syncTask{key: main.key.window(ws), start: max(ws, main.start), end: ws + window}
+		tasks = append(tasks, t)
+	}
+
+	tail := main
+	tail.start = lastWindow
+	return append(tasks, tail)
+}
+
+// 向下取整的整数除法，兼容 1970 年之前的负时间戳
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
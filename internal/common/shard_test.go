@@ -0,0 +1,172 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSplitWindows(t *testing.T) {
+	const hour = int64(time.Hour)
+	main := syncTask{key: CheckpointKey{DB: "db", Measurement: "cpu"}}
+
+	testCases := []struct {
+		name        string
+		task        syncTask
+		first, last int64
+		expected    []syncTask
+	}{
+		{"同一窗口内不拆分", main, 10, hour - 1, []syncTask{main}},
+		{"没有数据不拆分", main, 0, -1, []syncTask{main}},
+		{
+			"按对齐边界拆分，最后一个窗口沿用 measurement 断点键",
+			main, hour + 10, 3*hour + 5,
+			[]syncTask{
+				{key: main.key.window(hour), start: hour, end: 2 * hour},
+				{key: main.key.window(2 * hour), start: 2 * hour, end: 3 * hour},
+				{key: main.key, start: 3 * hour},
+			},
+		},
+		{
+			"受起止时间限制",
+			syncTask{key: main.key, start: hour + hour/2, end: 3 * hour}, 0, 10 * hour,
+			[]syncTask{
+				{key: main.key.window(hour), start: hour + hour/2, end: 2 * hour},
+				{key: main.key, start: 2 * hour, end: 3 * hour},
+			},
+		},
+		{
+			"从 1970-01-01 开始的窗口与 measurement 断点键不同",
+			main, 0, hour + 5,
+			[]syncTask{
+				{key: main.key.window(0), start: 0, end: hour},
+				{key: main.key, start: hour},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := splitWindows(tc.task, tc.first, tc.last, hour)
+			if fmt.Sprint(got) != fmt.Sprint(tc.expected) || len(got) != len(tc.expected) {
+				t.Fatalf("splitWindows() = %+v, 期望 %+v", got, tc.expected)
+			}
+			for i := range got {
+				if got[i] != tc.expected[i] {
+					t.Errorf("窗口 %d = %+v, 期望 %+v", i, got[i], tc.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFloorDiv(t *testing.T) {
+	if floorDiv(7, 3) != 2 || floorDiv(-7, 3) != -3 || floorDiv(-6, 3) != -2 {
+		t.Error("floorDiv 应向下取整")
+	}
+}
+
+// 支持查询时间范围的 mock 数据源
+type rangedDataSource struct {
+	seriesDataSource
+	ends map[int64]bool
+}
+
+func (m *rangedDataSource) TimeRange(ctx context.Context, db, rp, measurement string) (int64, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.points) == 0 {
+		return 0, 0, nil
+	}
+	return m.points[0].Time.UnixNano(), m.points[len(m.points)-1].Time.UnixNano(), nil
+}
+
+func (m *rangedDataSource) QueryData(ctx context.Context, q Query) ([]DataPoint, Cursor, error) {
+	m.mu.Lock()
+	m.ends[q.End] = true
+	m.mu.Unlock()
+	return m.seriesDataSource.QueryData(ctx, q)
+}
+
+func TestSyncShardsLargeMeasurement(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := &rangedDataSource{
+		seriesDataSource: seriesDataSource{mockDataSource: mockDataSource{measurements: []string{"cpu"}}},
+		ends:             map[int64]bool{},
+	}
+	// 5 天的数据，每小时一个点
+	for i := 0; i < 5*24; i++ {
+		source.add(DataPoint{
+			Measurement: "cpu",
+			Tags:        map[string]string{"host": "server1"},
+			Fields:      map[string]interface{}{"value": float64(i)},
+			Time:        base.Add(time.Duration(i) * time.Hour),
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "resume.state")
+	cfg := SyncConfig{
+		SourceDB:    "testdb",
+		BatchSize:   7,
+		Parallel:    4,
+		ResumeFile:  path,
+		ShardWindow: 24 * time.Hour,
+	}
+	target := &mockDataTarget{}
+	if err := NewSyncer(cfg, source, target).Sync(context.Background()); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	seen := map[int64]int{}
+	for _, p := range target.writtenData {
+		seen[p.Time.UnixNano()]++
+	}
+	if len(target.writtenData) != 5*24 || len(seen) != 5*24 {
+		t.Errorf("期望每个点写入一次, 实际写入 %d 个点, 不同时间戳 %d 个", len(target.writtenData), len(seen))
+	}
+	// 前 4 天各自一个窗口，最后一天为不设上限的窗口
+	if len(source.ends) != 5 {
+		t.Errorf("期望按 5 个时间窗口查询, 实际为 %d", len(source.ends))
+	}
+
+	loaded, err := NewFileCheckpointStore(path, Fingerprint(cfg)).Load()
+	if err != nil {
+		t.Fatalf("加载断点失败: %v", err)
+	}
+	if len(loaded) != 5 {
+		t.Errorf("期望每个时间窗口一个断点, 实际为 %+v", loaded)
+	}
+
+	// 再次运行时每个窗口从自己的断点继续，不再重复写入
+	again := &mockDataTarget{}
+	if err := NewSyncer(cfg, source, again).Sync(context.Background()); err != nil {
+		t.Fatalf("再次同步失败: %v", err)
+	}
+	if got := again.GetWrittenDataCount(); got != 0 {
+		t.Errorf("所有窗口已完成, 不应再写入, 实际写入 %d 个", got)
+	}
+}
+
+func TestTargetCheckpointStoreShardKey(t *testing.T) {
+	store, err := NewTargetCheckpointStore(&stateDataTarget{}, "sync_state", "job-a")
+	if err != nil {
+		t.Fatalf("创建目标库断点存储失败: %v", err)
+	}
+
+	whole := CheckpointKey{DB: "db1", Measurement: "cpu"}
+	window := whole.window(int64(time.Hour))
+	epoch := whole.window(0)
+	_ = store.Save(whole, Checkpoint{LastTime: 1, UpdatedAt: time.Now()})
+	_ = store.Save(window, Checkpoint{LastTime: 2, UpdatedAt: time.Now()})
+	_ = store.Save(epoch, Checkpoint{LastTime: 3, UpdatedAt: time.Now()})
+
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("加载断点失败: %v", err)
+	}
+	if loaded[whole].LastTime != 1 || loaded[window].LastTime != 2 || loaded[epoch].LastTime != 3 {
+		t.Errorf("时间窗口断点应独立保存: %+v", loaded)
+	}
+}
@@ -2,8 +2,11 @@ package common
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ygqygq2/influxdb-sync/internal/logx"
@@ -12,22 +15,84 @@ import (
 
 // 通用同步器
 type Syncer struct {
-	cfg    SyncConfig
-	source DataSource
-	target DataTarget
+	cfg         SyncConfig
+	source      DataSource
+	target      DataTarget
+	checkpoints CheckpointStore
+	resume      map[CheckpointKey]Checkpoint
+
+	// 每个 measurement 本进程内已同步到的游标，follow 模式下每轮从这里继续
+	progress map[CheckpointKey]Cursor
+	// 上一轮有时间窗口失败的 measurement，下一轮重新拆分
+	incomplete map[CheckpointKey]bool
+	mu         sync.Mutex
+	// 当前一轮写入的点数
+	written atomic.Int64
+	// 所有 worker 共享的在途字节上限
+	budget *byteBudget
+	// 每个 measurement 的自适应批次大小
+	sizers map[CheckpointKey]*batchSizer
+	// 所有 worker 共享的源端读取和目标端写入限速
+	readLimit  throttle
+	writeLimit throttle
+	// 目标端拒绝的点写入死信目录，未配置时为 nil
+	deadLetter *deadLetter
+	// 被目标端拒绝的点数
+	rejected atomic.Int64
+	// 每个 measurement 的运行统计，用于运行报告
+	stats map[CheckpointKey]*measurementStats
+	// 已检查过的目标库，配置 create_missing 时使用
+	provision provisioner
+	// 每个源库的保留策略，开启 AllRetentionPolicies 时使用
+	retention map[string][]RetentionPolicy
+	// 已创建的 DBRP 映射，配置 create_dbrp 时使用
+	dbrp dbrpMappings
+	// 连续查询的迁移结果，用于运行报告
+	cqReports []ContinuousQueryReport
 }
 
 // 创建新的同步器
 func NewSyncer(cfg SyncConfig, source DataSource, target DataTarget) *Syncer {
 	return &Syncer{
-		cfg:    cfg,
-		source: source,
-		target: target,
+		cfg:        cfg,
+		source:     source,
+		target:     target,
+		progress:   make(map[CheckpointKey]Cursor),
+		incomplete: make(map[CheckpointKey]bool),
+		budget:     newByteBudget(maxInflightBytes(cfg)),
+		sizers:     make(map[CheckpointKey]*batchSizer),
+		readLimit:  newThrottle(cfg.SourcePointsPerSec, cfg.SourceBytesPerSec),
+		writeLimit: newThrottle(cfg.TargetPointsPerSec, cfg.TargetBytesPerSec),
+		deadLetter: newDeadLetter(cfg.DeadLetterDir),
+		stats:      make(map[CheckpointKey]*measurementStats),
+		provision:  provisioner{done: make(map[string]error)},
+		retention:  make(map[string][]RetentionPolicy),
+		dbrp:       dbrpMappings{done: make(map[CheckpointKey]bool)},
 	}
 }
 
-// 执行同步
+// 执行同步，配置 ReportFile 时结束后写入运行报告
 func (s *Syncer) Sync(ctx context.Context) error {
+	started := time.Now()
+	err := s.run(ctx)
+	if s.cfg.ReportFile != "" {
+		if rerr := s.writeRunReport(started, err); rerr != nil {
+			logx.Error("写入运行报告失败:", rerr)
+		} else {
+			logx.Info("运行报告已写入", s.cfg.ReportFile)
+		}
+	}
+	return err
+}
+
+func (s *Syncer) run(ctx context.Context) error {
+	if err := validateOnError(s.cfg.OnError); err != nil {
+		return err
+	}
+	if s.cfg.RateLimit > 0 {
+		logx.Warn("rate_limit 已不再生效，请改用 throughput 配置按点数/字节数限速")
+	}
+
 	// 连接源和目标
 	if err := s.source.Connect(); err != nil {
 		logx.Error("源库连接失败:", err)
@@ -41,29 +106,137 @@ func (s *Syncer) Sync(ctx context.Context) error {
 	}
 	defer s.target.Close()
 
+	// 加载断点
+	if err := s.openCheckpoints(); err != nil {
+		return err
+	}
+	defer s.closeCheckpoints()
+
 	// 获取起始时间
 	startTimeNano, err := s.getStartTime()
 	if err != nil {
 		return err
 	}
 
-	// 获取数据库列表
-	dbs, err := s.getDatabases()
+	// 获取结束时间
+	endTimeNano, err := s.getEndTime()
 	if err != nil {
 		return err
 	}
+	if s.cfg.Follow && s.cfg.Plan != nil {
+		return fmt.Errorf("按迁移计划执行时不能使用 follow 模式")
+	}
+	if s.cfg.Follow && endTimeNano > 0 {
+		return fmt.Errorf("follow 模式持续同步新数据，不能同时配置结束时间")
+	}
 
-	// 同步每个数据库
-	for _, db := range dbs {
-		if err := s.syncDatabase(ctx, db, startTimeNano); err != nil {
+	// 迁移连续查询，失败不影响数据同步
+	s.migrateContinuousQueries(ctx)
+
+	if endTimeNano > 0 && startTimeNano >= endTimeNano {
+		logx.Info("起始时间不早于结束时间，无需同步")
+		return nil
+	}
+
+	defer s.logRejected()
+	if s.cfg.Follow {
+		return s.follow(ctx, startTimeNano)
+	}
+	err = s.syncOnce(ctx, startTimeNano, endTimeNano)
+	if ctx.Err() != nil {
+		logx.Warn("收到退出信号，已停止同步，断点已保存")
+		return ErrInterrupted
+	}
+	return err
+}
+
+// 同步结束时汇总被目标端拒绝的点
+func (s *Syncer) logRejected() {
+	n := s.rejected.Load()
+	switch {
+	case n == 0:
+	case s.deadLetter != nil:
+		logx.Warn(fmt.Sprintf("共 %d 个点被目标端拒绝，已写入死信目录 %s，可用 replay-dlq 命令重新写入", n, s.cfg.DeadLetterDir))
+	default:
+		logx.Warn(fmt.Sprintf("共 %d 个点被目标端拒绝并丢弃", n))
+	}
+}
+
+// 对所有数据库执行一轮同步：先规划全部任务，再由一个共享的 worker 池
+// 按预估大小从大到小执行，最耗时的任务最先开始，缩短整体耗时
+func (s *Syncer) syncOnce(ctx context.Context, startTimeNano, endTimeNano int64) error {
+	failures := newFailureTracker(s.cfg)
+	var tasks []syncTask
+	if s.cfg.Plan != nil {
+		// 按迁移计划执行
+		tasks = s.cfg.Plan.tasks(startTimeNano, endTimeNano)
+	} else {
+		// 获取数据库列表
+		dbs, err := s.getDatabases(ctx)
+		if err != nil {
 			return err
 		}
+
+		// 规划每个数据库的任务，continue 策略下一个库失败不影响其他库
+		for _, db := range dbs {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			planned, err := s.planDatabase(ctx, db, startTimeNano, endTimeNano)
+			if err != nil {
+				logx.Error(fmt.Sprintf("规划数据库 %s 失败: %v", db, err))
+				if failures.add(Failure{Key: CheckpointKey{DB: db}, Err: err}) {
+					return failures.err()
+				}
+				continue
+			}
+			tasks = append(tasks, planned...)
+		}
 	}
 
-	return nil
+	if len(tasks) > 0 {
+		sort.SliceStable(tasks, func(i, j int) bool { return tasks[i].size > tasks[j].size })
+		s.runTasks(ctx, tasks, failures)
+		s.createDBRPs(ctx, tasks)
+	}
+	return failures.err()
 }
 
-// 获取起始时间
+// follow 模式：按间隔轮询每个 measurement，持续同步新到达的数据，直到 ctx 取消
+func (s *Syncer) follow(ctx context.Context, startTimeNano int64) error {
+	interval := s.cfg.FollowInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	logx.Info(fmt.Sprintf("进入 follow 模式，轮询间隔: %v，回扫窗口: %v", interval, s.cfg.FollowLookback))
+
+	for cycle := 1; ; cycle++ {
+		s.written.Store(0)
+		start := time.Now()
+		err := s.syncOnce(ctx, startTimeNano, 0)
+		if ctx.Err() != nil {
+			logx.Warn("follow 模式收到退出信号，已停止同步，断点已保存")
+			return ErrInterrupted
+		}
+		if err != nil {
+			// 单轮失败不退出，下一轮从各 measurement 已同步的位置重试
+			logx.Warn(fmt.Sprintf("follow 第 %d 轮同步失败，耗时: %v，写入 %d 个点，错误: %v",
+				cycle, time.Since(start), s.written.Load(), err))
+		} else {
+			logx.Info(fmt.Sprintf("follow 第 %d 轮同步完成，耗时: %v，写入 %d 个点，%v 后开始下一轮",
+				cycle, time.Since(start), s.written.Load(), interval))
+		}
+
+		select {
+		case <-ctx.Done():
+			logx.Warn("follow 模式收到退出信号，已停止同步，断点已保存")
+			return ErrInterrupted
+		case <-time.After(interval):
+		}
+	}
+}
+
+// 获取起始时间，未配置时从 1970-01-01 开始；各 measurement 的断点由 startCursor 处理
 func (s *Syncer) getStartTime() (int64, error) {
 	startTime := s.cfg.Start
 	if startTime == "" {
@@ -71,38 +244,93 @@ func (s *Syncer) getStartTime() (int64, error) {
 	}
 
 	var startTimeNano int64 = 0
+	if t0, err0 := time.Parse(time.RFC3339Nano, startTime); err0 == nil {
+		startTimeNano = t0.UnixNano()
+	}
+	return startTimeNano, nil
+}
 
-	if s.cfg.ResumeFile != "" {
-		if data, err := os.ReadFile(s.cfg.ResumeFile); err == nil {
-			last := string(data)
-			// 取配置 start 与 resume 文件中时间的较大者
-			if t0, err0 := time.Parse(time.RFC3339Nano, startTime); err0 == nil {
-				startTimeNano = t0.UnixNano()
-				if t1, err1 := time.Parse(time.RFC3339Nano, last); err1 == nil && t1.After(t0) {
-					startTimeNano = t1.UnixNano()
-				}
-			}
-		} else {
-			if t0, err0 := time.Parse(time.RFC3339Nano, startTime); err0 == nil {
-				startTimeNano = t0.UnixNano()
-			}
+// 创建断点存储，未配置断点时返回 nil
+func (s *Syncer) newCheckpointStore() (CheckpointStore, error) {
+	fingerprint := Fingerprint(s.cfg)
+	switch s.cfg.CheckpointType {
+	case "", CheckpointTypeFile:
+		if s.cfg.ResumeFile == "" {
+			return nil, nil
 		}
-	} else {
-		if t0, err0 := time.Parse(time.RFC3339Nano, startTime); err0 == nil {
-			startTimeNano = t0.UnixNano()
+		return NewFileCheckpointStore(s.cfg.ResumeFile, fingerprint), nil
+	case CheckpointTypeTarget:
+		return NewTargetCheckpointStore(s.target, s.cfg.CheckpointDB, fingerprint)
+	default:
+		return nil, fmt.Errorf("不支持的断点存储类型: %s", s.cfg.CheckpointType)
+	}
+}
+
+// 打开断点存储：加锁并加载已有断点
+func (s *Syncer) openCheckpoints() error {
+	store, err := s.newCheckpointStore()
+	if err != nil || store == nil {
+		return err
+	}
+
+	if err := store.Lock(); err != nil {
+		return err
+	}
+	resume, err := store.Load()
+	if err != nil {
+		if uerr := store.Unlock(); uerr != nil {
+			logx.Warn("释放断点锁失败:", uerr)
 		}
+		return err
 	}
 
-	return startTimeNano, nil
+	logx.Info(fmt.Sprintf("已加载 %d 个 measurement 的断点", len(resume)))
+	s.checkpoints = store
+	s.resume = resume
+	return nil
+}
+
+// 保存各 measurement 最终的进度并释放断点锁
+func (s *Syncer) closeCheckpoints() {
+	if s.checkpoints == nil {
+		return
+	}
+
+	// 每批写入后已保存断点，这里补存之前保存失败的进度
+	s.mu.Lock()
+	for key, cursor := range s.progress {
+		if err := s.checkpoints.Save(key, NewCheckpoint(cursor)); err != nil {
+			logx.Warn(fmt.Sprintf("保存 %s 的断点失败: %v", key, err))
+		}
+	}
+	s.mu.Unlock()
+
+	if err := s.checkpoints.Unlock(); err != nil {
+		logx.Warn("释放断点锁失败:", err)
+	}
+}
+
+// 获取结束时间，未配置时返回 0 表示不限制
+func (s *Syncer) getEndTime() (int64, error) {
+	if s.cfg.End == "" {
+		return 0, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s.cfg.End)
+	if err != nil {
+		return 0, fmt.Errorf("结束时间格式错误: %v", err)
+	}
+	return t.UnixNano(), nil
 }
 
 // 获取数据库列表
-func (s *Syncer) getDatabases() ([]string, error) {
+func (s *Syncer) getDatabases(ctx context.Context) ([]string, error) {
 	if s.cfg.SourceDB != "" {
 		return []string{s.cfg.SourceDB}, nil
 	}
 
-	dbs, err := s.source.GetDatabases()
+	opCtx, cancel := s.opContext(ctx, s.queryTimeout())
+	defer cancel()
+	dbs, err := s.source.GetDatabases(opCtx)
 	if err != nil {
 		return nil, err
 	}
@@ -122,21 +350,57 @@ func (s *Syncer) getDatabases() ([]string, error) {
 	return filteredDBs, nil
 }
 
-// 同步单个数据库
-func (s *Syncer) syncDatabase(ctx context.Context, db string, startTimeNano int64) error {
+// 规划单个数据库的同步任务
+func (s *Syncer) planDatabase(ctx context.Context, db string, startTimeNano, endTimeNano int64) ([]syncTask, error) {
 	logx.Info("同步数据库:", db)
 
 	// 获取 measurements
-	measurements, err := s.source.GetMeasurements(db)
+	measurements, err := s.getMeasurements(ctx, db)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if len(measurements) == 0 {
 		logx.Warn("库", db, "无数据表")
-		return nil
+		return nil, nil
 	}
 
+	rps, err := s.retentionPolicies(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	// 每个保留策略的 measurement 独立同步，大表拆分为多个时间窗口，预估大小按窗口数平均分摊
+	var tasks []syncTask
+	for _, rp := range rps {
+		for _, m := range measurements {
+			planned := s.planTasks(ctx, db, rp, m, startTimeNano, endTimeNano)
+			size := s.estimateSize(ctx, db, rp, m)
+			for i := range planned {
+				planned[i].size = size / int64(len(planned))
+			}
+			tasks = append(tasks, planned...)
+		}
+	}
+	return tasks, nil
+}
+
+// 获取数据库的 measurement 列表
+func (s *Syncer) getMeasurements(ctx context.Context, db string) ([]string, error) {
+	var measurements []string
+	err := s.retry(ctx, "获取 measurement 列表", nil, func() error {
+		opCtx, cancel := s.opContext(ctx, s.queryTimeout())
+		defer cancel()
+		var err error
+		measurements, err = s.source.GetMeasurements(opCtx, db)
+		return err
+	})
+	return measurements, err
+}
+
+// 用共享的 worker 池执行全部任务，失败记录到 failures。失败数达到上限时
+// 不再开始新的任务，正在执行的任务在当前批次完成后停止
+func (s *Syncer) runTasks(ctx context.Context, tasks []syncTask, failures *failureTracker) {
 	// 设置默认值
 	batchSize := s.cfg.BatchSize
 	if batchSize <= 0 {
@@ -148,150 +412,504 @@ func (s *Syncer) syncDatabase(ctx context.Context, db string, startTimeNano int6
 	}
 
 	// 创建任务通道
-	jobs := make(chan string, len(measurements))
-	results := make(chan SyncResult, len(measurements))
+	jobs := make(chan syncTask, len(tasks))
+	results := make(chan taskResult, len(tasks))
 
 	// 启动 worker
+	runCtx, abort := context.WithCancel(ctx)
+	defer abort()
 	for i := 0; i < parallel; i++ {
-		go s.worker(ctx, db, startTimeNano, batchSize, jobs, results)
+		go s.worker(runCtx, batchSize, jobs, results)
 	}
 
-	// 分发任务
-	for _, m := range measurements {
-		logx.Info("分发 measurement:", m)
-		jobs <- m
+	// 先为每个 worker 分发一个任务，之后每完成一个再分发下一个，
+	// 达到失败上限后剩余任务不再分发
+	remaining := make(map[CheckpointKey]int)
+	for _, t := range tasks {
+		remaining[t.measurementKey()]++
+	}
+	next := 0
+	dispatch := func() {
+		if next < len(tasks) && !failures.aborted {
+			logx.Info("分发 measurement:", tasks[next])
+			jobs <- tasks[next]
+			next++
+		}
+	}
+	for i := 0; i < parallel; i++ {
+		dispatch()
 	}
-	close(jobs)
 
-	// 收集结果
-	var allErrors []error
-	for i := 0; i < len(measurements); i++ {
+	// 收集结果，measurement 的所有窗口都完成后才算完成
+	failed := make(map[CheckpointKey]bool)
+	skipped := 0
+	for done := 0; done < next; done++ {
 		r := <-results
-		if r.Error != nil {
-			allErrors = append(allErrors, fmt.Errorf("measurement %s: %v", r.Measurement, r.Error))
+		m := r.task.measurementKey()
+		switch {
+		case r.err == nil:
+		case errors.Is(r.err, context.Canceled) && (failures.aborted || ctx.Err() != nil):
+			// 达到失败上限或收到退出信号后被停止的任务，下次运行从断点继续
+			skipped++
+			failed[m] = true
+		default:
+			failed[m] = true
+			if failures.add(Failure{Key: r.task.key, Checkpoint: s.lastCheckpoint(r.task.key), Err: r.err}) {
+				abort()
+			}
 		}
+		remaining[m]--
+		if remaining[m] == 0 {
+			s.setIncomplete(m, failed[m])
+			if !failed[m] {
+				failures.succeeded++
+				logx.Info(fmt.Sprintf("measurement %s 同步完成", m))
+			}
+		}
+		dispatch()
 	}
+	close(jobs)
 
-	if len(allErrors) > 0 {
-		for _, err := range allErrors {
-			logx.Error("同步错误:", err)
-		}
-		return fmt.Errorf("同步失败，共%d个错误", len(allErrors))
+	// 未分发的任务所属的 measurement 下一轮重新规划
+	for _, t := range tasks[next:] {
+		s.setIncomplete(t.measurementKey(), true)
+	}
+	if skipped += len(tasks) - next; skipped > 0 && failures.aborted {
+		logx.Warn(fmt.Sprintf("达到失败上限，%d 个任务未完成", skipped))
 	}
+}
 
-	return nil
+// 单个同步任务的结果
+type taskResult struct {
+	task syncTask
+	err  error
 }
 
 // 工作协程
-func (s *Syncer) worker(ctx context.Context, db string, startTimeNano int64, batchSize int, jobs <-chan string, results chan<- SyncResult) {
-	for measurement := range jobs {
-		logx.Info(fmt.Sprintf("开始处理 measurement: %s", measurement))
+func (s *Syncer) worker(ctx context.Context, batchSize int, jobs <-chan syncTask, results chan<- taskResult) {
+	for task := range jobs {
+		// 收到退出信号后不再开始新的任务
+		if err := ctx.Err(); err != nil {
+			results <- taskResult{task: task, err: err}
+			continue
+		}
+		logx.Info(fmt.Sprintf("开始处理 measurement: %s", task))
 		start := time.Now()
-		if err := s.syncMeasurement(ctx, db, measurement, startTimeNano, batchSize); err != nil {
-			logx.Error(fmt.Sprintf("处理 measurement %s 失败，耗时: %v，错误: %v", measurement, time.Since(start), err))
-			results <- SyncResult{Measurement: measurement, Error: err}
+		err := s.syncMeasurement(ctx, task, batchSize)
+		s.statsFor(task.measurementKey()).track(start, time.Now())
+		if err != nil {
+			logx.Error(fmt.Sprintf("处理 measurement %s 失败，耗时: %v，错误: %v", task, time.Since(start), err))
+			results <- taskResult{task: task, err: err}
 		} else {
-			logx.Info(fmt.Sprintf("处理 measurement %s 成功，耗时: %v", measurement, time.Since(start)))
-			results <- SyncResult{Measurement: measurement, Error: nil}
+			logx.Info(fmt.Sprintf("处理 measurement %s 成功，耗时: %v", task, time.Since(start)))
+			results <- taskResult{task: task}
 		}
 	}
 }
 
-// 同步单个 measurement
-func (s *Syncer) syncMeasurement(ctx context.Context, db, measurement string, startTimeNano int64, batchSize int) error {
+// 同步单个 measurement：读取协程预取下一批数据，当前协程写入上一批，
+// 只有写入成功后才推进断点
+func (s *Syncer) syncMeasurement(ctx context.Context, task syncTask, batchSize int) error {
+	db, measurement, endTimeNano := task.key.DB, task.key.Measurement, task.end
+
 	// 获取标签字段
-	tagKeys, err := s.source.GetTagKeys(db, measurement)
+	var tagKeys map[string]bool
+	err := s.retry(ctx, "获取标签字段", s.statsFor(task.measurementKey()), func() error {
+		opCtx, cancel := s.opContext(ctx, s.queryTimeout())
+		defer cancel()
+		var err error
+		tagKeys, err = s.source.GetTagKeys(opCtx, db, measurement)
+		return err
+	})
 	if err != nil {
 		logx.Error("获取", measurement, "标签字段失败:", err)
 		return err
 	}
 	logx.Debug("获取到", measurement, "的标签字段:", tagKeys)
 
-	// 设置重试和限流参数
-	retryCount := s.cfg.RetryCount
-	if retryCount <= 0 {
-		retryCount = 3
+	// 获取字段类型，写入时按源端类型转换字段值，获取失败时按读取到的值原样写入
+	var fieldTypes map[string]FieldType
+	err = s.retry(ctx, "获取字段类型", s.statsFor(task.measurementKey()), func() error {
+		opCtx, cancel := s.opContext(ctx, s.queryTimeout())
+		defer cancel()
+		var err error
+		fieldTypes, err = s.source.GetFieldKeys(opCtx, db, measurement)
+		return err
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		logx.Warn("获取", measurement, "字段类型失败，字段值按读取结果写入:", err)
 	}
-	retryInterval := s.cfg.RetryInterval
-	if retryInterval <= 0 {
-		retryInterval = 500
+	logx.Debug("获取到", measurement, "的字段类型:", fieldTypes)
+
+	key := task.key
+	cursor := s.startCursor(key, task.start)
+	defer func() { s.setProgress(key, cursor) }()
+	if endTimeNano > 0 && cursor.Time >= endTimeNano {
+		logx.Info(fmt.Sprintf("measurement %s 已同步到结束时间", task))
+		return nil
 	}
-	rateLimit := s.cfg.RateLimit
-	if rateLimit < 0 {
-		rateLimit = 50
+
+	targetName := s.targetFor(db, key.RP)
+	if err := s.ensureTarget(ctx, db, key.RP); err != nil {
+		return err
 	}
 
-	var lastTime int64 = startTimeNano
+	// 读取协程不随 ctx 取消，收到退出信号后在两次查询之间停止，
+	// 已读取的批次仍会写入；写入失败时通过 stopReader 结束读取
+	pipeCtx, stopReader := context.WithCancel(context.WithoutCancel(ctx))
+	batches := make(chan readBatch)
+	defer func() {
+		stopReader()
+		// 等待读取协程退出，释放未写入批次占用的预算
+		for b := range batches {
+			s.budget.release(b.size)
+		}
+	}()
+	sizer := s.batchSizer(task.measurementKey(), batchSize)
+	stats := s.statsFor(task.measurementKey())
+	go s.readBatches(ctx, pipeCtx, Query{
+		DB:          db,
+		RP:          key.RP,
+		Measurement: measurement,
+		Cursor:      cursor,
+		End:         endTimeNano,
+	}, sizer, stats, batches)
+
+	for b := range batches {
+		if b.err != nil {
+			return b.err
+		}
 
-	// 确定目标数据库/bucket名称
-	var targetName string
-	if s.cfg.TargetBucket != "" {
-		// 如果明确配置了 TargetBucket，使用它（适用于固定 bucket 名称）
-		targetName = s.cfg.TargetBucket
-	} else {
-		// 否则使用前后缀拼接源数据库名（适用于动态命名）
-		// 对于 1x->1x: targetName = prefix + db + suffix
-		// 对于 1x->2x: targetName = prefix + db + suffix (作为 bucket 名)
-		targetName = s.cfg.TargetDBPrefix + db + s.cfg.TargetDBSuffix
+		logx.Debug(fmt.Sprintf("处理 %s: %d 个点，时间范围: %d -> %d", measurement, len(b.points), cursor.Time, b.next.Time))
+		points, invalid := NormalizeFields(b.points, fieldTypes)
+		if len(invalid) > 0 {
+			stats.addDropped(len(invalid))
+			if err := s.rejectPoints(targetName, invalid); err != nil {
+				s.budget.release(b.size)
+				return err
+			}
+		}
+		var err error
+		if len(points) > 0 {
+			err = s.writeBatch(ctx, targetName, points, sizer, stats)
+		}
+		s.budget.release(b.size)
+		if err != nil {
+			return err
+		}
+
+		logx.Debug(fmt.Sprintf("成功写入 %s: %d 个点", measurement, len(b.points)))
+		s.written.Add(int64(len(b.points)))
+
+		// 更新断点
+		if s.checkpoints != nil {
+			if err := s.checkpoints.Save(key, NewCheckpoint(b.next)); err != nil {
+				logx.Warn("更新断点失败:", err)
+			}
+		}
+
+		cursor = b.next
+	}
+
+	return nil
+}
+
+// 读取协程交给写入方的一批数据
+type readBatch struct {
+	points []DataPoint
+	next   Cursor
+	size   int64
+	err    error
+}
+
+// 按游标依次读取批次并发送到 batches，读完或出错后关闭通道。
+// 发送是无缓冲的，因此最多预取一批：写入方写当前批时，这里读取下一批
+func (s *Syncer) readBatches(ctx, pipeCtx context.Context, q Query, sizer *batchSizer, stats *measurementStats, batches chan<- readBatch) {
+	defer close(batches)
+
+	send := func(b readBatch) bool {
+		select {
+		case batches <- b:
+			return true
+		case <-pipeCtx.Done():
+			s.budget.release(b.size)
+			return false
+		}
 	}
 
 	for {
-		// 查询数据
-		logx.Info(fmt.Sprintf("开始查询 %s，起始时间: %d", measurement, lastTime))
+		// 写入方已退出
+		if pipeCtx.Err() != nil {
+			return
+		}
+		// 批次之间检查退出信号，已读取的批次会完成写入并保存断点
+		if err := ctx.Err(); err != nil {
+			send(readBatch{err: err})
+			return
+		}
+
+		// 查询数据，每批按当前的批次大小读取
+		q.Limit = sizer.current()
+		logx.Info(fmt.Sprintf("开始查询 %s，游标: %d (偏移 %d)", q.Measurement, q.Cursor.Time, q.Cursor.Offset))
 		queryStart := time.Now()
-		points, maxTime, err := s.source.QueryData(db, measurement, lastTime, batchSize)
+		var points []DataPoint
+		var next Cursor
+		err := s.retry(ctx, "查询 "+q.Measurement, stats, func() error {
+			queryCtx, cancel := s.opContext(ctx, s.queryTimeout())
+			defer cancel()
+			var err error
+			points, next, err = s.source.QueryData(queryCtx, q)
+			return err
+		})
 		queryDuration := time.Since(queryStart)
 		if err != nil {
-			logx.Error(fmt.Sprintf("查询 %s 失败，耗时: %v，错误: %v", measurement, queryDuration, err))
-			return err
+			logx.Error(fmt.Sprintf("查询 %s 失败，耗时: %v，错误: %v", q.Measurement, queryDuration, err))
+			send(readBatch{err: err})
+			return
 		}
-		logx.Info(fmt.Sprintf("查询 %s 完成，耗时: %v，返回 %d 个点", measurement, queryDuration, len(points)))
+		logx.Info(fmt.Sprintf("查询 %s 完成，耗时: %v，返回 %d 个点", q.Measurement, queryDuration, len(points)))
+		stats.addRead(len(points))
 
 		if len(points) == 0 {
-			logx.Info(fmt.Sprintf("measurement %s 没有更多数据", measurement))
-			break // 没有更多数据
+			logx.Info(fmt.Sprintf("measurement %s 没有更多数据", q.Measurement))
+			return // 没有更多数据
 		}
 
-		logx.Debug(fmt.Sprintf("处理 %s: %d 个点，时间范围: %d -> %d", measurement, len(points), lastTime, maxTime))
+		// 读取限速，等待在途数据量低于上限
+		size := pointsSize(points)
+		if err := s.readLimit.wait(pipeCtx, len(points), size); err != nil {
+			return
+		}
+		if err := s.budget.acquire(pipeCtx, size); err != nil {
+			return
+		}
+		rows := PageRows(points, next)
+		next.Rows = 0
+		if !send(readBatch{points: points, next: next, size: size}) {
+			return
+		}
+		q.Cursor = next
 
-		// 写入目标库，重试机制
-		var writeErr error
-		for i := 0; i < retryCount; i++ {
-			writeErr = s.target.WritePoints(targetName, points)
-			if writeErr == nil {
-				break
+		// 如果本批不足batchSize，说明拉完了
+		if rows < q.Limit {
+			return
+		}
+	}
+}
+
+// 写入一批数据，可重试的错误按退避策略重试。写入耗时和编码后的请求体大小反馈给 sizer
+// 调整后续批次大小，目标端拒绝过大的请求体时把本批拆成两半分别写入
+func (s *Syncer) writeBatch(ctx context.Context, targetName string, points []DataPoint, sizer *batchSizer, stats *measurementStats) error {
+	// 自适应批次和写入字节限速都按实际发送的 line protocol 请求体大小计算
+	var size int64
+	if sizer.adaptive || s.writeLimit.bytes != nil {
+		size = encodedSize(points)
+	}
+	// 写入限速，已读取的批次收到退出信号后仍要写完
+	_ = s.writeLimit.wait(context.WithoutCancel(ctx), len(points), size)
+	err := s.retry(ctx, "写入目标库", stats, func() error {
+		writeStart := time.Now()
+		writeCtx, cancel := s.opContext(ctx, s.writeTimeout())
+		err := s.target.WritePoints(writeCtx, targetName, points)
+		cancel()
+		if err == nil {
+			sizer.observe(len(points), size, time.Since(writeStart))
+		} else if isTimeout(err) {
+			sizer.backoff("写入超时")
+		}
+		return err
+	})
+	if err == nil {
+		stats.addWrite(points, 0)
+		return nil
+	}
+	if isEntityTooLarge(err) {
+		sizer.backoff("目标端拒绝过大的请求体")
+		if len(points) > 1 {
+			half := len(points) / 2
+			logx.Warn(fmt.Sprintf("请求体过大，拆分为 %d + %d 个点重新写入", half, len(points)-half))
+			if err := s.writeBatch(ctx, targetName, points[:half], sizer, stats); err != nil {
+				return err
 			}
-			logx.Warn(fmt.Sprintf("写入目标库失败，第%d次重试: %v", i+1, writeErr))
-			time.Sleep(time.Duration(retryInterval) * time.Millisecond)
+			return s.writeBatch(ctx, targetName, points[half:], sizer, stats)
 		}
+	}
+	var rejected *RejectedPointsError
+	if errors.As(err, &rejected) {
+		stats.addWrite(points, len(rejected.Rejected))
+		return s.rejectPoints(targetName, rejected.Rejected)
+	}
+	// 配置了死信目录时，永久失败的批次写入死信目录后继续同步
+	if IsPermanent(err) && s.deadLetter != nil {
+		logx.Error("写入目标库失败，批次写入死信目录:", err)
+		stats.addWrite(points, len(points))
+		return s.rejectPoints(targetName, rejectAll(points, err.Error()))
+	}
+	logx.Error("写入目标库失败:", err)
+	return err
+}
 
-		if writeErr != nil {
-			logx.Error("写入目标库失败，重试失败:", writeErr)
-			return writeErr
+// 处理目标端拒绝的点：写入死信目录，未配置死信目录时只记录日志
+func (s *Syncer) rejectPoints(targetName string, rejected []RejectedPoint) error {
+	s.rejected.Add(int64(len(rejected)))
+
+	// 相同原因的点写在同一组
+	var reasons []string
+	groups := make(map[string][]DataPoint)
+	for _, r := range rejected {
+		if _, ok := groups[r.Reason]; !ok {
+			reasons = append(reasons, r.Reason)
 		}
+		groups[r.Reason] = append(groups[r.Reason], r.Point)
+	}
 
-		logx.Debug(fmt.Sprintf("成功写入 %s: %d 个点", measurement, len(points)))
+	for _, reason := range reasons {
+		points := groups[reason]
+		if s.deadLetter == nil {
+			logx.Warn(fmt.Sprintf("目标库 %s 拒绝 %d 个点，未配置 dead_letter_dir，已丢弃: %s", targetName, len(points), reason))
+			continue
+		}
+		if err := s.deadLetter.write(targetName, points, reason); err != nil {
+			return fmt.Errorf("写入死信目录失败: %v", err)
+		}
+		logx.Warn(fmt.Sprintf("目标库 %s 拒绝 %d 个点，已写入死信目录: %s", targetName, len(points), reason))
+	}
+	return nil
+}
 
-		// 更新断点续传文件
-		if s.cfg.ResumeFile != "" && maxTime > lastTime {
-			resumeTime := time.Unix(0, maxTime).Format(time.RFC3339Nano)
-			if err := os.WriteFile(s.cfg.ResumeFile, []byte(resumeTime), 0644); err != nil {
-				logx.Warn("更新断点续传文件失败:", err)
-			}
+func rejectAll(points []DataPoint, reason string) []RejectedPoint {
+	rejected := make([]RejectedPoint, len(points))
+	for i, p := range points {
+		rejected[i] = RejectedPoint{Point: p, Reason: reason}
+	}
+	return rejected
+}
+
+// 确定目标数据库/bucket名称
+func (s *Syncer) targetName(db string) string {
+	// 按计划执行时使用计划中的目标名称
+	if s.cfg.Plan != nil {
+		if target, ok := s.cfg.Plan.target(db); ok {
+			return target
 		}
+	}
+	if s.cfg.TargetBucket != "" {
+		// 如果明确配置了 TargetBucket，使用它（适用于固定 bucket 名称）
+		return s.cfg.TargetBucket
+	}
+	// 否则使用前后缀拼接源数据库名（适用于动态命名）
+	// 对于 1x->1x: targetName = prefix + db + suffix
+	// 对于 1x->2x: targetName = prefix + db + suffix (作为 bucket 名)
+	return s.cfg.TargetDBPrefix + db + s.cfg.TargetDBSuffix
+}
 
-		lastTime = maxTime
+// 计算 measurement 的起始游标：优先使用本进程已同步到的位置，其次是断点，最后是配置的起始时间
+func (s *Syncer) startCursor(key CheckpointKey, startTimeNano int64) Cursor {
+	cursor := Cursor{Time: startTimeNano}
 
-		// 限流控制
-		if rateLimit > 0 {
-			time.Sleep(time.Duration(rateLimit) * time.Millisecond)
+	s.mu.Lock()
+	last, ok := s.progress[key]
+	s.mu.Unlock()
+	if ok {
+		if s.cfg.FollowLookback <= 0 {
+			return last
 		}
+		// 回扫 lookback 窗口，补齐迟到的数据，重复写入的点会覆盖目标端的同一个点
+		rescan := Cursor{Time: last.Time - s.cfg.FollowLookback.Nanoseconds()}
+		if rescan.After(cursor) {
+			return rescan
+		}
+		return cursor
+	}
 
-		// 如果本批不足batchSize，说明拉完了
-		if len(points) < batchSize {
-			break
+	// 从该 measurement 自己的断点继续
+	if cp, ok := s.resumeCheckpoint(key); ok {
+		if resumed := cp.Cursor(); resumed.After(cursor) {
+			logx.Info(fmt.Sprintf("measurement %s 从断点 %s (偏移 %d) 继续", key.Measurement,
+				time.Unix(0, resumed.Time).UTC().Format(time.RFC3339Nano), resumed.Offset))
+			return resumed
 		}
 	}
+	return cursor
+}
 
-	return nil
+// 任务已同步到的时间，优先使用本进程的进度，其次是断点
+func (s *Syncer) lastCheckpoint(key CheckpointKey) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cur, ok := s.progress[key]; ok {
+		return cur.Time
+	}
+	cp, _ := s.resumeCheckpoint(key)
+	return cp.LastTime
+}
+
+// 加载的断点，measurement 没有自己的断点时使用旧版本断点文件迁移来的断点
+func (s *Syncer) resumeCheckpoint(key CheckpointKey) (Checkpoint, bool) {
+	if cp, ok := s.resume[key]; ok {
+		return cp, true
+	}
+	cp, ok := s.resume[legacyCheckpointKey]
+	return cp, ok
+}
+
+// 记录 measurement 是否有时间窗口未完成
+func (s *Syncer) setIncomplete(key CheckpointKey, incomplete bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if incomplete {
+		s.incomplete[key] = true
+	} else {
+		delete(s.incomplete, key)
+	}
+}
+
+// 记录 measurement 已同步到的游标
+func (s *Syncer) setProgress(key CheckpointKey, cursor Cursor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.progress[key] = cursor
+}
+
+// 为单次查询或写入创建带超时的 ctx。它不随 ctx 取消，
+// 保证收到退出信号时正在执行的批次能完成写入，worker 在批次之间退出
+func (s *Syncer) opContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), timeout)
+}
+
+// 获取 measurement 的批次大小调节器，同一 measurement 的所有任务共用
+func (s *Syncer) batchSizer(key CheckpointKey, initial int) *batchSizer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sizer, ok := s.sizers[key]
+	if !ok {
+		sizer = newBatchSizer(key.String(), s.cfg, initial)
+		s.sizers[key] = sizer
+	}
+	return sizer
+}
+
+func (s *Syncer) queryTimeout() time.Duration {
+	if s.cfg.QueryTimeout > 0 {
+		return s.cfg.QueryTimeout
+	}
+	return 60 * time.Second
+}
+
+func (s *Syncer) writeTimeout() time.Duration {
+	if s.cfg.WriteTimeout > 0 {
+		return s.cfg.WriteTimeout
+	}
+	return 60 * time.Second
+}
+
+// 在途字节上限，默认 256MB
+func maxInflightBytes(cfg SyncConfig) int64 {
+	if cfg.MaxInflightBytes > 0 {
+		return cfg.MaxInflightBytes
+	}
+	return 256 << 20
 }
@@ -2,9 +2,12 @@ package common
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -15,6 +18,7 @@ type mockDataSource struct {
 	measurements []string
 	connected    bool
 	shouldError  bool
+	fieldTypes   map[string]FieldType
 }
 
 func (m *mockDataSource) Connect() error {
@@ -30,39 +34,43 @@ func (m *mockDataSource) Close() error {
 	return nil
 }
 
-func (m *mockDataSource) GetDatabases() ([]string, error) {
+func (m *mockDataSource) GetDatabases(ctx context.Context) ([]string, error) {
 	if m.shouldError {
 		return nil, &mockError{"获取数据库失败"}
 	}
 	return m.databases, nil
 }
 
-func (m *mockDataSource) GetMeasurements(db string) ([]string, error) {
+func (m *mockDataSource) GetMeasurements(ctx context.Context, db string) ([]string, error) {
 	if m.shouldError {
 		return nil, &mockError{"获取测量失败"}
 	}
 	return m.measurements, nil
 }
 
-func (m *mockDataSource) GetTagKeys(db, measurement string) (map[string]bool, error) {
+func (m *mockDataSource) GetTagKeys(ctx context.Context, db, measurement string) (map[string]bool, error) {
 	return map[string]bool{"host": true, "region": true}, nil
 }
 
-func (m *mockDataSource) QueryData(db, measurement string, startTime int64, batchSize int) ([]DataPoint, int64, error) {
+func (m *mockDataSource) GetFieldKeys(ctx context.Context, db, measurement string) (map[string]FieldType, error) {
+	return m.fieldTypes, nil
+}
+
+func (m *mockDataSource) QueryData(ctx context.Context, q Query) ([]DataPoint, Cursor, error) {
 	if m.shouldError {
-		return nil, 0, &mockError{"查询数据失败"}
+		return nil, q.Cursor, &mockError{"查询数据失败"}
 	}
 
 	// 返回模拟数据
 	points := []DataPoint{
 		{
-			Measurement: measurement,
+			Measurement: q.Measurement,
 			Tags:        map[string]string{"host": "server1", "region": "us-east"},
 			Fields:      map[string]interface{}{"value": 100, "status": "ok"},
 			Time:        time.Now(),
 		},
 	}
-	return points, time.Now().UnixNano(), nil
+	return points, NextCursor(q.Cursor, points), nil
 }
 
 // Mock数据目标用于测试
@@ -86,7 +94,7 @@ func (m *mockDataTarget) Close() error {
 	return nil
 }
 
-func (m *mockDataTarget) WritePoints(db string, points []DataPoint) error {
+func (m *mockDataTarget) WritePoints(ctx context.Context, db string, points []DataPoint) error {
 	if m.shouldError {
 		return &mockError{"写入失败"}
 	}
@@ -141,16 +149,10 @@ func TestNewSyncer(t *testing.T) {
 }
 
 func TestSyncerGetStartTime(t *testing.T) {
-	tmpDir := t.TempDir()
-	resumeFile := filepath.Join(tmpDir, "resume.state")
-
 	testCases := []struct {
-		name         string
-		startTime    string
-		resumeFile   string
-		resumeData   string
-		createResume bool
-		expectError  bool
+		name        string
+		startTime   string
+		expectError bool
 	}{
 		{
 			name:        "默认起始时间",
@@ -162,38 +164,11 @@ func TestSyncerGetStartTime(t *testing.T) {
 			startTime:   "2024-01-01T00:00:00Z",
 			expectError: false,
 		},
-		{
-			name:         "恢复文件存在且时间更新",
-			startTime:    "2024-01-01T00:00:00Z",
-			resumeFile:   resumeFile,
-			resumeData:   "2024-06-01T00:00:00Z",
-			createResume: true,
-			expectError:  false,
-		},
-		{
-			name:         "恢复文件存在但时间较早",
-			startTime:    "2024-06-01T00:00:00Z",
-			resumeFile:   resumeFile,
-			resumeData:   "2024-01-01T00:00:00Z",
-			createResume: true,
-			expectError:  false,
-		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			// 创建恢复文件
-			if tc.createResume && tc.resumeFile != "" {
-				err := os.WriteFile(tc.resumeFile, []byte(tc.resumeData), 0644)
-				if err != nil {
-					t.Fatalf("无法创建恢复文件: %v", err)
-				}
-			}
-
-			cfg := SyncConfig{
-				Start:      tc.startTime,
-				ResumeFile: tc.resumeFile,
-			}
+			cfg := SyncConfig{Start: tc.startTime}
 
 			syncer := NewSyncer(cfg, &mockDataSource{}, &mockDataTarget{})
 			startTimeNano, err := syncer.getStartTime()
@@ -257,7 +232,7 @@ func TestSyncerGetDatabases(t *testing.T) {
 			}
 
 			syncer := NewSyncer(cfg, source, &mockDataTarget{})
-			dbs, err := syncer.getDatabases()
+			dbs, err := syncer.getDatabases(context.Background())
 
 			if tc.shouldError {
 				if err == nil {
@@ -396,3 +371,439 @@ func TestSyncResultStruct(t *testing.T) {
 		t.Errorf("期望无错误，但得到 %v", result2.Error)
 	}
 }
+
+// 按时间排序保存数据的 mock 数据源，与真实数据源一样按
+// time >= 游标时间、time < End、OFFSET 游标偏移、LIMIT 的语义分页返回
+type seriesDataSource struct {
+	mockDataSource
+	points  []DataPoint
+	queries int
+	mu      sync.Mutex
+}
+
+func (m *seriesDataSource) QueryData(ctx context.Context, q Query) ([]DataPoint, Cursor, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queries++
+
+	var points []DataPoint
+	skipped := 0
+	for _, p := range m.points {
+		ts := p.Time.UnixNano()
+		if ts < q.Cursor.Time || (q.End > 0 && ts >= q.End) {
+			continue
+		}
+		if skipped < q.Cursor.Offset {
+			skipped++
+			continue
+		}
+		if len(points) >= q.Limit {
+			break
+		}
+		points = append(points, p)
+	}
+	return points, NextCursor(q.Cursor, points), nil
+}
+
+func (m *seriesDataSource) add(points ...DataPoint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.points = append(m.points, points...)
+	sort.SliceStable(m.points, func(i, j int) bool { return m.points[i].Time.Before(m.points[j].Time) })
+}
+
+func TestSyncStopsAtEndTime(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := &seriesDataSource{
+		mockDataSource: mockDataSource{measurements: []string{"cpu"}},
+	}
+	for i := 0; i < 10; i++ {
+		source.points = append(source.points, DataPoint{
+			Measurement: "cpu",
+			Tags:        map[string]string{"host": "server1"},
+			Fields:      map[string]interface{}{"value": float64(i)},
+			Time:        base.Add(time.Duration(i) * time.Hour),
+		})
+	}
+
+	cfg := SyncConfig{
+		SourceDB:  "testdb",
+		BatchSize: 3,
+		Start:     "2023-12-31T00:00:00Z",
+		// 结束时间不含边界，只包含前 5 个点
+		End:       base.Add(5 * time.Hour).Format(time.RFC3339Nano),
+		Parallel:  1,
+		RateLimit: 0,
+	}
+	target := &mockDataTarget{}
+	syncer := NewSyncer(cfg, source, target)
+
+	if err := syncer.Sync(context.Background()); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	if got := target.GetWrittenDataCount(); got != 5 {
+		t.Errorf("期望写入 5 个点, 实际为 %d", got)
+	}
+	for _, p := range target.writtenData {
+		if p.Time.After(base.Add(4 * time.Hour)) {
+			t.Errorf("写入了结束时间之后的点: %v", p.Time)
+		}
+	}
+	// 到达结束时间后应直接停止，而不是继续查询直到返回空批次
+	if source.queries != 2 {
+		t.Errorf("期望查询 2 次, 实际为 %d", source.queries)
+	}
+}
+
+// 部分行无法解析的 mock 数据源：跳过的行不返回，但计入游标偏移和本页行数
+type skippingDataSource struct {
+	seriesDataSource
+	bad map[int64]bool
+}
+
+func (m *skippingDataSource) QueryData(ctx context.Context, q Query) ([]DataPoint, Cursor, error) {
+	page, next, err := m.seriesDataSource.QueryData(ctx, q)
+	var points []DataPoint
+	for _, p := range page {
+		if !m.bad[p.Time.UnixNano()] {
+			points = append(points, p)
+		}
+	}
+	next.Rows = len(page)
+	return points, next, err
+}
+
+func TestSyncContinuesPastSkippedRows(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := &skippingDataSource{
+		seriesDataSource: seriesDataSource{mockDataSource: mockDataSource{measurements: []string{"cpu"}}},
+		bad:              map[int64]bool{base.Add(time.Hour).UnixNano(): true},
+	}
+	for i := 0; i < 10; i++ {
+		source.points = append(source.points, DataPoint{
+			Measurement: "cpu",
+			Tags:        map[string]string{"host": "server1"},
+			Fields:      map[string]interface{}{"value": float64(i)},
+			Time:        base.Add(time.Duration(i) * time.Hour),
+		})
+	}
+
+	cfg := SyncConfig{SourceDB: "testdb", BatchSize: 3, Start: "2024-01-01T00:00:00Z", Parallel: 1}
+	target := &mockDataTarget{}
+	if err := NewSyncer(cfg, source, target).Sync(context.Background()); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	// 第一页只返回 2 个点，但读取了 3 行，不应被当作最后一页
+	if got := target.GetWrittenDataCount(); got != 9 {
+		t.Errorf("期望写入 9 个点, 实际为 %d", got)
+	}
+}
+
+func TestSyncerGetEndTime(t *testing.T) {
+	syncer := NewSyncer(SyncConfig{}, &mockDataSource{}, &mockDataTarget{})
+	if end, err := syncer.getEndTime(); err != nil || end != 0 {
+		t.Errorf("未配置结束时间应返回 0, 实际为 %d, 错误: %v", end, err)
+	}
+
+	syncer = NewSyncer(SyncConfig{End: "2024-03-31T00:00:00Z"}, &mockDataSource{}, &mockDataTarget{})
+	end, err := syncer.getEndTime()
+	if err != nil {
+		t.Fatalf("不期望错误，但得到: %v", err)
+	}
+	if want := time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC).UnixNano(); end != want {
+		t.Errorf("期望结束时间为 %d, 实际为 %d", want, end)
+	}
+
+	syncer = NewSyncer(SyncConfig{End: "2024-03-31"}, &mockDataSource{}, &mockDataTarget{})
+	if _, err := syncer.getEndTime(); err == nil {
+		t.Error("无效的结束时间格式应返回错误")
+	}
+}
+
+func TestSyncFollowCopiesNewAndLatePoints(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	point := func(offset time.Duration, host string) DataPoint {
+		return DataPoint{
+			Measurement: "cpu",
+			Tags:        map[string]string{"host": host},
+			Fields:      map[string]interface{}{"value": 1.0},
+			Time:        base.Add(offset),
+		}
+	}
+
+	source := &seriesDataSource{mockDataSource: mockDataSource{measurements: []string{"cpu"}}}
+	source.add(point(0, "a"), point(time.Minute, "a"))
+	target := &mockDataTarget{}
+
+	cfg := SyncConfig{
+		SourceDB:       "testdb",
+		BatchSize:      10,
+		Parallel:       1,
+		Follow:         true,
+		FollowInterval: 10 * time.Millisecond,
+		FollowLookback: 5 * time.Minute,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- NewSyncer(cfg, source, target).Sync(ctx) }()
+
+	waitFor := func(n int) {
+		deadline := time.Now().Add(5 * time.Second)
+		for target.GetWrittenDataCount() < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("等待写入 %d 个点超时，实际为 %d", n, target.GetWrittenDataCount())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitFor(2)
+
+	// 新到达的点和落在回扫窗口内的迟到点都应被同步
+	source.add(point(2*time.Minute, "a"), point(30*time.Second, "late"))
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		target.mu.Lock()
+		var gotNew, gotLate bool
+		for _, p := range target.writtenData {
+			gotNew = gotNew || p.Time.Equal(base.Add(2*time.Minute))
+			gotLate = gotLate || p.Tags["host"] == "late"
+		}
+		target.mu.Unlock()
+		if gotNew && gotLate {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("follow 模式未同步新数据 (%v) 或迟到数据 (%v)", gotNew, gotLate)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrInterrupted) {
+			t.Errorf("follow 模式取消后应返回 ErrInterrupted, 实际为: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("follow 模式取消后未退出")
+	}
+}
+
+func TestSyncFollowRejectsEndTime(t *testing.T) {
+	cfg := SyncConfig{SourceDB: "testdb", End: "2024-01-01T00:00:00Z", Follow: true}
+	source := &mockDataSource{measurements: []string{"cpu"}}
+	if err := NewSyncer(cfg, source, &mockDataTarget{}).Sync(context.Background()); err == nil {
+		t.Error("follow 模式配置结束时间时应返回错误")
+	}
+}
+
+// 第一次查询时模拟收到退出信号的数据源
+type interruptingDataSource struct {
+	seriesDataSource
+	interrupt context.CancelFunc
+	opErr     error
+	deadline  bool
+}
+
+func (m *interruptingDataSource) QueryData(ctx context.Context, q Query) ([]DataPoint, Cursor, error) {
+	m.interrupt()
+	m.opErr = ctx.Err()
+	_, m.deadline = ctx.Deadline()
+	return m.seriesDataSource.QueryData(ctx, q)
+}
+
+func TestSyncInterruptedFinishesCurrentBatch(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	source := &interruptingDataSource{
+		seriesDataSource: seriesDataSource{mockDataSource: mockDataSource{measurements: []string{"cpu", "mem"}}},
+		interrupt:        cancel,
+	}
+	for i := 0; i < 10; i++ {
+		source.add(DataPoint{
+			Measurement: "cpu",
+			Tags:        map[string]string{"host": "server1"},
+			Fields:      map[string]interface{}{"value": float64(i)},
+			Time:        base.Add(time.Duration(i) * time.Second),
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "resume.state")
+	cfg := SyncConfig{SourceDB: "testdb", BatchSize: 4, Parallel: 1, ResumeFile: path}
+	target := &mockDataTarget{}
+
+	err := NewSyncer(cfg, source, target).Sync(ctx)
+	if !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("期望返回 ErrInterrupted, 实际为: %v", err)
+	}
+
+	// 正在执行的批次不受取消影响，且带有超时
+	if source.opErr != nil || !source.deadline {
+		t.Errorf("批次内的操作应使用独立的带超时 ctx, err=%v deadline=%v", source.opErr, source.deadline)
+	}
+	if source.queries != 1 {
+		t.Errorf("收到退出信号后不应继续查询, 实际查询 %d 次", source.queries)
+	}
+	if got := target.GetWrittenDataCount(); got != 4 {
+		t.Errorf("期望写完当前批次的 4 个点, 实际为 %d", got)
+	}
+
+	loaded, err := NewFileCheckpointStore(path, Fingerprint(cfg)).Load()
+	if err != nil {
+		t.Fatalf("加载断点失败: %v", err)
+	}
+	want := base.Add(3 * time.Second).UnixNano()
+	if cp := loaded[CheckpointKey{DB: "testdb", Measurement: "cpu"}]; cp.LastTime != want {
+		t.Errorf("期望断点保存到 %d, 实际为 %+v", want, cp)
+	}
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Error("中断后锁文件应被删除")
+	}
+}
+
+// 查询有延迟并记录是否有查询正在进行的数据源
+type slowDataSource struct {
+	seriesDataSource
+	active atomic.Int32
+}
+
+func (m *slowDataSource) QueryData(ctx context.Context, q Query) ([]DataPoint, Cursor, error) {
+	m.active.Add(1)
+	defer m.active.Add(-1)
+	time.Sleep(20 * time.Millisecond)
+	return m.seriesDataSource.QueryData(ctx, q)
+}
+
+// 写入有延迟并记录写入期间是否有查询在进行的目标
+type slowDataTarget struct {
+	mockDataTarget
+	source     *slowDataSource
+	overlapped atomic.Bool
+}
+
+func (m *slowDataTarget) WritePoints(ctx context.Context, db string, points []DataPoint) error {
+	time.Sleep(20 * time.Millisecond)
+	if m.source.active.Load() > 0 {
+		m.overlapped.Store(true)
+	}
+	return m.mockDataTarget.WritePoints(ctx, db, points)
+}
+
+func TestSyncPipelinesReadsAndWrites(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := &slowDataSource{seriesDataSource: seriesDataSource{mockDataSource: mockDataSource{measurements: []string{"cpu"}}}}
+	for i := 0; i < 20; i++ {
+		source.add(DataPoint{
+			Measurement: "cpu",
+			Fields:      map[string]interface{}{"value": float64(i)},
+			Time:        base.Add(time.Duration(i) * time.Second),
+		})
+	}
+	target := &slowDataTarget{source: source}
+
+	path := filepath.Join(t.TempDir(), "resume.state")
+	cfg := SyncConfig{SourceDB: "testdb", BatchSize: 4, Parallel: 1, ResumeFile: path}
+	if err := NewSyncer(cfg, source, target).Sync(context.Background()); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	if got := target.GetWrittenDataCount(); got != 20 {
+		t.Errorf("期望写入 20 个点, 实际为 %d", got)
+	}
+	if !target.overlapped.Load() {
+		t.Error("写入期间应同时预取下一批数据")
+	}
+
+	loaded, err := NewFileCheckpointStore(path, Fingerprint(cfg)).Load()
+	if err != nil {
+		t.Fatalf("加载断点失败: %v", err)
+	}
+	want := base.Add(19 * time.Second).UnixNano()
+	if cp := loaded[CheckpointKey{DB: "testdb", Measurement: "cpu"}]; cp.LastTime != want {
+		t.Errorf("期望断点为最后写入的点 %d, 实际为 %+v", want, cp)
+	}
+}
+
+func TestSyncStopsReadingWhenWriteFails(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := &seriesDataSource{mockDataSource: mockDataSource{measurements: []string{"cpu"}}}
+	for i := 0; i < 100; i++ {
+		source.add(DataPoint{
+			Measurement: "cpu",
+			Fields:      map[string]interface{}{"value": float64(i)},
+			Time:        base.Add(time.Duration(i) * time.Second),
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "resume.state")
+	cfg := SyncConfig{SourceDB: "testdb", BatchSize: 10, Parallel: 1, ResumeFile: path, RetryCount: 1, RetryInterval: 1}
+	syncer := NewSyncer(cfg, source, &failingDataTarget{})
+	if err := syncer.Sync(context.Background()); err == nil {
+		t.Fatal("写入失败时同步应返回错误")
+	}
+
+	// 写入失败后读取协程应停止，最多预取一批
+	if source.queries > 2 {
+		t.Errorf("写入失败后不应继续读取, 实际查询 %d 次", source.queries)
+	}
+	loaded, _ := NewFileCheckpointStore(path, Fingerprint(cfg)).Load()
+	if cp := loaded[CheckpointKey{DB: "testdb", Measurement: "cpu"}]; cp.LastTime != 0 {
+		t.Error("写入未成功时不应推进断点")
+	}
+	if syncer.budget.used != 0 {
+		t.Errorf("结束后应释放全部在途字节, 剩余 %d", syncer.budget.used)
+	}
+}
+
+// 连接成功但写入总是失败的目标
+type failingDataTarget struct {
+	mockDataTarget
+}
+
+func (m *failingDataTarget) WritePoints(ctx context.Context, db string, points []DataPoint) error {
+	return &mockError{"写入失败"}
+}
+
+// 支持预估大小并记录任务执行顺序的 mock 数据源
+type sizedDataSource struct {
+	mockDataSource
+	sizes map[string]int64
+	order []string
+	mu    sync.Mutex
+}
+
+func (m *sizedDataSource) EstimateSize(ctx context.Context, db, rp, measurement string) (int64, error) {
+	return m.sizes[db+"/"+measurement], nil
+}
+
+func (m *sizedDataSource) QueryData(ctx context.Context, q Query) ([]DataPoint, Cursor, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.order = append(m.order, q.DB+"/"+q.Measurement)
+	return nil, q.Cursor, nil
+}
+
+func TestSyncSchedulesLargestFirstAcrossDatabases(t *testing.T) {
+	source := &sizedDataSource{
+		mockDataSource: mockDataSource{databases: []string{"db1", "db2"}, measurements: []string{"cpu", "mem"}},
+		sizes:          map[string]int64{"db1/cpu": 10, "db1/mem": 300, "db2/cpu": 2000, "db2/mem": 50},
+	}
+	cfg := SyncConfig{Start: "2024-01-01T00:00:00Z", Parallel: 1}
+	if err := NewSyncer(cfg, source, &mockDataTarget{}).Sync(context.Background()); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+
+	// 两个库的任务共用一个 worker 池，按预估大小从大到小执行
+	expected := []string{"db2/cpu", "db1/mem", "db2/mem", "db1/cpu"}
+	if len(source.order) != len(expected) {
+		t.Fatalf("期望执行 %d 个任务, 实际为 %v", len(expected), source.order)
+	}
+	for i, want := range expected {
+		if source.order[i] != want {
+			t.Errorf("第 %d 个任务期望为 %s, 实际为 %s", i, want, source.order[i])
+		}
+	}
+}
@@ -1,35 +1,76 @@
 package common
 
-import "time"
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrInterrupted 同步因收到退出信号而提前结束，已完成批次的断点均已保存
+var ErrInterrupted = errors.New("同步已中断")
 
 // 通用同步配置
 type SyncConfig struct {
-	SourceAddr      string
-	SourceUser      string
-	SourcePass      string
-	SourceDB        string
-	SourceDBExclude []string
-	SourceToken     string
-	SourceOrg       string
-	SourceBucket    string
-	TargetAddr      string
-	TargetUser      string
-	TargetPass      string
-	TargetDB        string
-	TargetDBPrefix  string
-	TargetDBSuffix  string
-	TargetToken     string
-	TargetOrg       string
-	TargetBucket    string
-	BatchSize       int
-	Start           string
-	End             string
-	ResumeFile      string
-	Parallel        int
-	RetryCount      int
-	RetryInterval   int
-	RateLimit       int
-	LogLevel        string
+	SourceAddr               string
+	SourceUser               string
+	SourcePass               string
+	SourceDB                 string
+	SourceDBExclude          []string
+	SourceToken              string
+	SourceOrg                string
+	SourceBucket             string
+	SourceCompatMode         string // 3.x 源端兼容模式：v1（默认）、v2 或 native
+	SourceNamespace          string // 3.x 原生模式的命名空间
+	TargetAddr               string
+	TargetUser               string
+	TargetPass               string
+	TargetDB                 string
+	TargetDBPrefix           string
+	TargetDBSuffix           string
+	TargetToken              string
+	TargetOrg                string
+	TargetBucket             string
+	TargetCompatMode         string // 3.x 目标端兼容模式：v1、v2（默认）或 native
+	TargetNamespace          string
+	BatchSize                int
+	Start                    string
+	End                      string
+	ResumeFile               string
+	CheckpointType           string // 断点存储类型: file（默认，使用 ResumeFile）或 target
+	CheckpointDB             string // target 类型时保存断点的目标库/bucket
+	Parallel                 int
+	RetryCount               int
+	RetryInterval            int
+	RateLimit                int               // 已废弃，由 Source/Target 的点数和字节数限速代替
+	Follow                   bool              // 持续同步模式，完成首轮后按间隔轮询新数据
+	FollowInterval           time.Duration     // follow 模式轮询间隔，默认 10 秒
+	FollowLookback           time.Duration     // follow 模式每轮回扫的窗口，用于补齐迟到数据
+	QueryTimeout             time.Duration     // 单次查询的超时时间，默认 60 秒
+	WriteTimeout             time.Duration     // 单次写入的超时时间，默认 60 秒
+	MaxInflightBytes         int64             // 所有 worker 已读取未写入数据的字节上限，默认 256MB
+	ShardWindow              time.Duration     // 大表按该时间窗口拆分并行同步，0 表示不拆分
+	AdaptiveBatch            bool              // 根据写入耗时和请求体大小自动调整每个 measurement 的批次大小
+	MinBatchSize             int               // 自适应批次大小下限，默认 100
+	MaxBatchSize             int               // 自适应批次大小上限，默认 50000
+	TargetWriteLatency       time.Duration     // 自适应时单次写入的目标耗时，默认 2 秒
+	TargetBatchBytes         int64             // 自适应时单次写入的目标请求体大小，默认 4MB
+	SourcePointsPerSec       int64             // 所有 worker 从源端读取的点数/秒上限，0 表示不限
+	SourceBytesPerSec        int64             // 所有 worker 从源端读取的字节/秒上限，0 表示不限
+	TargetPointsPerSec       int64             // 所有 worker 向目标端写入的点数/秒上限，0 表示不限
+	TargetBytesPerSec        int64             // 所有 worker 向目标端写入的字节/秒上限，0 表示不限
+	DeadLetterDir            string            // 目标端拒绝的点以 line protocol 格式写入该目录，为空时丢弃并记录日志
+	OnError                  string            // 出错后的处理策略: continue（默认，继续同步其他 measurement）或 fail_fast
+	MaxFailures              int               // continue 策略下失败数达到该值后停止，0 表示不限
+	Plan                     *Plan             // 按迁移计划执行，不再自动发现数据库和 measurement
+	ReportFile               string            // 同步结束后以 JSON 格式写入运行报告的路径，为空时不写入
+	Version                  string            // 工具版本，记录在运行报告中
+	CreateMissing            bool              // 首次写入前自动创建不存在的目标库/bucket
+	CreateRetention          time.Duration     // 自动创建目标库的保留时长，0 表示沿用源库的默认保留策略
+	AllRetentionPolicies     bool              // 同步 1.x 源库的全部保留策略，默认只同步默认保留策略
+	RetentionPolicyMap       map[string]string // 源保留策略名 -> 目标名称模板，支持 {db}（目标库名）和 {rp}（源保留策略名）
+	CreateDBRP               bool              // 每轮同步完成后在 2.x 目标端创建 DBRP 映射，供 InfluxQL 查询使用
+	MigrateContinuousQueries bool              // 同步前把 1.x 源库的连续查询迁移为 2.x 目标端的降采样任务
+	LogLevel                 string
 }
 
 // 数据点结构
@@ -50,15 +91,18 @@ type SyncResult struct {
 type DataSource interface {
 	Connect() error
 	Close() error
-	GetDatabases() ([]string, error)
-	GetMeasurements(db string) ([]string, error)
-	GetTagKeys(db, measurement string) (map[string]bool, error)
-	QueryData(db, measurement string, startTime int64, batchSize int) ([]DataPoint, int64, error)
+	GetDatabases(ctx context.Context) ([]string, error)
+	GetMeasurements(ctx context.Context, db string) ([]string, error)
+	GetTagKeys(ctx context.Context, db, measurement string) (map[string]bool, error)
+	// GetFieldKeys 返回 measurement 的字段名及其数据类型
+	GetFieldKeys(ctx context.Context, db, measurement string) (map[string]FieldType, error)
+	// QueryData 从游标位置开始按时间升序读取最多 Limit 个点，返回下一页游标
+	QueryData(ctx context.Context, q Query) ([]DataPoint, Cursor, error)
 }
 
 // 数据目标接口
 type DataTarget interface {
 	Connect() error
 	Close() error
-	WritePoints(db string, points []DataPoint) error
+	WritePoints(ctx context.Context, db string, points []DataPoint) error
 }
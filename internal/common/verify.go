@@ -0,0 +1,407 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ygqygq2/influxdb-sync/internal/logx"
+)
+
+// VerifyOptions 校验参数
+type VerifyOptions struct {
+	Window   time.Duration // 按该时间窗口分别比较，默认 1 天
+	Checksum bool          // 除点数外同时比较每个字段的校验和
+}
+
+// WindowDiff 源端和目标端不一致的时间窗口
+type WindowDiff struct {
+	DB          string    `json:"db"`
+	RP          string    `json:"rp,omitempty"` // 源保留策略，为空表示默认保留策略
+	Measurement string    `json:"measurement"`
+	Target      string    `json:"target"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"` // 不含
+	SourceCount int64     `json:"source_count"`
+	TargetCount int64     `json:"target_count"`
+	Fields      []string  `json:"fields,omitempty"` // 值个数或校验和不一致的字段
+}
+
+// FieldCounter 可选接口：数据源能在服务端统计每个字段的非空值个数时实现
+// （InfluxQL COUNT(*)、Flux count()、SQL COUNT），只比较点数时不需要读取全部点。
+// q 的 Cursor.Time 为起点（含），End 为终点（不含）
+type FieldCounter interface {
+	CountFields(ctx context.Context, q Query) (map[string]int64, error)
+}
+
+func (d WindowDiff) String() string {
+	s := fmt.Sprintf("%s -> %s [%s, %s) 源 %d 个点，目标 %d 个点", d.key(), d.Target,
+		d.Start.Format(time.RFC3339), d.End.Format(time.RFC3339), d.SourceCount, d.TargetCount)
+	if len(d.Fields) > 0 {
+		s += "，字段不一致: " + strings.Join(d.Fields, ", ")
+	}
+	return s
+}
+
+// 窗口所属 measurement 的断点键
+func (d WindowDiff) key() CheckpointKey {
+	return CheckpointKey{DB: d.DB, RP: d.RP, Measurement: d.Measurement}
+}
+
+// LoadWindowDiffs 读取 verify 输出的不一致窗口列表
+func LoadWindowDiffs(path string) ([]WindowDiff, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var diffs []WindowDiff
+	if err := json.Unmarshal(data, &diffs); err != nil {
+		return nil, fmt.Errorf("解析不一致窗口列表失败: %v", err)
+	}
+	return diffs, nil
+}
+
+// SaveWindowDiffs 以 JSON 格式写入不一致窗口列表
+func SaveWindowDiffs(path string, diffs []WindowDiff) error {
+	if diffs == nil {
+		diffs = []WindowDiff{}
+	}
+	data, err := json.MarshalIndent(diffs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Verify 按时间窗口比较每个数据库、每个 measurement 在源端和目标端的点数，
+// 可选比较字段校验和，返回不一致的窗口。target 是读取目标端的数据源，
+// 目标库名称与同步时一致。只比较点数且两端都实现 FieldCounter 时在服务端计数，
+// 此时点数为各字段非空值个数的最大值
+func (s *Syncer) Verify(ctx context.Context, target DataSource, opts VerifyOptions) ([]WindowDiff, error) {
+	if opts.Window <= 0 {
+		opts.Window = 24 * time.Hour
+	}
+
+	if err := s.source.Connect(); err != nil {
+		logx.Error("源库连接失败:", err)
+		return nil, err
+	}
+	defer s.source.Close()
+	if err := target.Connect(); err != nil {
+		logx.Error("目标库连接失败:", err)
+		return nil, err
+	}
+	defer target.Close()
+
+	startTimeNano, err := s.getStartTime()
+	if err != nil {
+		return nil, err
+	}
+	endTimeNano, err := s.getEndTime()
+	if err != nil {
+		return nil, err
+	}
+	if endTimeNano <= 0 {
+		endTimeNano = time.Now().UnixNano()
+	}
+
+	dbs, err := s.getDatabases(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []WindowDiff
+	for _, db := range dbs {
+		measurements, err := s.getMeasurements(ctx, db)
+		if err != nil {
+			return diffs, fmt.Errorf("获取数据库 %s 的 measurement 失败: %v", db, err)
+		}
+		rps, err := s.retentionPolicies(ctx, db)
+		if err != nil {
+			return diffs, err
+		}
+		for _, rp := range rps {
+			for _, m := range measurements {
+				if err := ctx.Err(); err != nil {
+					return diffs, err
+				}
+				w := WindowDiff{DB: db, RP: rp, Measurement: m, Target: s.targetFor(db, rp)}
+				found, err := s.verifyMeasurement(ctx, target, w, startTimeNano, endTimeNano, opts)
+				if err != nil {
+					return diffs, fmt.Errorf("校验 %s 失败: %v", w.key(), err)
+				}
+				diffs = append(diffs, found...)
+			}
+		}
+	}
+	return diffs, nil
+}
+
+// 校验 m 指定的 measurement 的所有时间窗口
+func (s *Syncer) verifyMeasurement(ctx context.Context, target DataSource, m WindowDiff,
+	startTimeNano, endTimeNano int64, opts VerifyOptions) ([]WindowDiff, error) {
+	// 两端中最早的点决定第一个窗口，避免从 1970 年开始逐个窗口查询
+	first, ok, err := s.nextTime(ctx, target, m, startTimeNano, endTimeNano)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		logx.Debug(fmt.Sprintf("measurement %s 两端均无数据", m.key()))
+		return nil, nil
+	}
+
+	var diffs []WindowDiff
+	window := opts.Window.Nanoseconds()
+	for ws := floorDiv(first, window) * window; ws < endTimeNano; {
+		w := m
+		w.Start, w.End = time.Unix(0, max(ws, startTimeNano)).UTC(), time.Unix(0, min(ws+window, endTimeNano)).UTC()
+		diff, empty, err := s.compareWindow(ctx, target, w, opts.Checksum)
+		if err != nil {
+			return diffs, err
+		}
+		if diff != nil {
+			logx.Warn("时间窗口不一致:", diff)
+			diffs = append(diffs, *diff)
+		}
+		ws += window
+		if !empty {
+			continue
+		}
+		// 两端都没有数据的窗口之后跳到下一个有数据的窗口，最后一个点之后不再逐个窗口查询
+		next, ok, err := s.nextTime(ctx, target, m, ws, endTimeNano)
+		if err != nil {
+			return diffs, err
+		}
+		if !ok {
+			break
+		}
+		ws = floorDiv(next, window) * window
+	}
+	return diffs, nil
+}
+
+// 比较 w 指定的时间窗口，一致时返回 nil，否则返回填好点数和不一致字段的 w；
+// empty 表示两端在该窗口内都没有数据
+func (s *Syncer) compareWindow(ctx context.Context, target DataSource, w WindowDiff, checksum bool) (diff *WindowDiff, empty bool, err error) {
+	start, end := w.Start.UnixNano(), w.End.UnixNano()
+	// 两端都能在服务端计数时才使用，计数方式不同时点数无法比较
+	_, srcCounter := s.source.(FieldCounter)
+	_, dstCounter := target.(FieldCounter)
+	count := !checksum && srcCounter && dstCounter
+
+	src, err := s.summarize(ctx, s.source, Query{DB: w.DB, RP: w.RP, Measurement: w.Measurement}, start, end, checksum, count)
+	if err != nil {
+		return nil, false, err
+	}
+	dst, err := s.summarize(ctx, target, Query{DB: w.Target, Measurement: w.Measurement}, start, end, checksum, count)
+	if err != nil {
+		return nil, false, err
+	}
+	empty = src.count == 0 && dst.count == 0
+	fields := src.mismatchedFields(dst)
+	if src.count == dst.count && len(fields) == 0 {
+		return nil, empty, nil
+	}
+	w.SourceCount, w.TargetCount, w.Fields = src.count, dst.count, fields
+	return &w, empty, nil
+}
+
+// 两端中 m 指定的 measurement 在时间范围内最早一个点的时间
+func (s *Syncer) nextTime(ctx context.Context, target DataSource, m WindowDiff, startTimeNano, endTimeNano int64) (int64, bool, error) {
+	next, found := int64(0), false
+	for _, side := range []struct {
+		source DataSource
+		q      Query
+	}{{s.source, Query{DB: m.DB, RP: m.RP}}, {target, Query{DB: m.Target}}} {
+		side.q.Measurement = m.Measurement
+		t, ok, err := s.firstTime(ctx, side.source, side.q, startTimeNano, endTimeNano)
+		if err != nil {
+			return 0, false, err
+		}
+		if ok && (!found || t < next) {
+			next, found = t, true
+		}
+	}
+	return next, found, nil
+}
+
+// 查询 q 指定的 measurement 在时间范围内最早一个点的时间
+func (s *Syncer) firstTime(ctx context.Context, source DataSource, q Query, startTimeNano, endTimeNano int64) (int64, bool, error) {
+	var points []DataPoint
+	q.Cursor, q.End, q.Limit = Cursor{Time: startTimeNano}, endTimeNano, 1
+	err := s.retry(ctx, "查询 "+q.Measurement, nil, func() error {
+		opCtx, cancel := s.opContext(ctx, s.queryTimeout())
+		defer cancel()
+		var err error
+		points, _, err = source.QueryData(opCtx, q)
+		return err
+	})
+	if err != nil || len(points) == 0 {
+		return 0, false, err
+	}
+	return points[0].Time.UnixNano(), true, nil
+}
+
+// 一个时间窗口的点数、每个字段的校验和（比较校验和时）和非空值个数（服务端计数时）
+type windowSummary struct {
+	count  int64
+	sums   map[string]uint64
+	counts map[string]int64
+}
+
+// 汇总 q 指定的 measurement 在时间窗口内的数据：count 为 true 时由数据源在服务端
+// 按字段计数，否则分页读取全部点
+func (s *Syncer) summarize(ctx context.Context, source DataSource, q Query, start, end int64, checksum, count bool) (windowSummary, error) {
+	if count {
+		return s.countFields(ctx, source.(FieldCounter), q, start, end)
+	}
+
+	batchSize := s.cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	sum := windowSummary{sums: make(map[string]uint64)}
+	q.Cursor, q.End, q.Limit = Cursor{Time: start}, end, batchSize
+	for {
+		var points []DataPoint
+		var next Cursor
+		err := s.retry(ctx, "查询 "+q.Measurement, nil, func() error {
+			opCtx, cancel := s.opContext(ctx, s.queryTimeout())
+			defer cancel()
+			var err error
+			points, next, err = source.QueryData(opCtx, q)
+			return err
+		})
+		if err != nil {
+			return sum, err
+		}
+
+		sum.count += int64(len(points))
+		if checksum {
+			for _, p := range points {
+				series := seriesKey(p)
+				for field, v := range p.Fields {
+					// 求和与点的顺序无关，两端返回顺序不同也能比较
+					sum.sums[field] += pointHash(series, p.Time.UnixNano(), v)
+				}
+			}
+		}
+		if PageRows(points, next) < q.Limit {
+			return sum, nil
+		}
+		q.Cursor = next
+		q.Cursor.Rows = 0
+	}
+}
+
+// 由数据源统计每个字段的非空值个数，点数取最大值
+func (s *Syncer) countFields(ctx context.Context, counter FieldCounter, q Query, start, end int64) (windowSummary, error) {
+	sum := windowSummary{}
+	q.Cursor, q.End = Cursor{Time: start}, end
+	err := s.retry(ctx, "统计 "+q.Measurement, nil, func() error {
+		opCtx, cancel := s.opContext(ctx, s.queryTimeout())
+		defer cancel()
+		var err error
+		sum.counts, err = counter.CountFields(opCtx, q)
+		return err
+	})
+	if err != nil {
+		return sum, err
+	}
+	for _, n := range sum.counts {
+		sum.count = max(sum.count, n)
+	}
+	return sum, nil
+}
+
+// 值个数或校验和不一致的字段，按名称排序
+func (w windowSummary) mismatchedFields(other windowSummary) []string {
+	mismatched := make(map[string]bool)
+	for field, sum := range w.sums {
+		if other.sums[field] != sum {
+			mismatched[field] = true
+		}
+	}
+	for field := range other.sums {
+		if _, ok := w.sums[field]; !ok {
+			mismatched[field] = true
+		}
+	}
+	for field, n := range w.counts {
+		if other.counts[field] != n {
+			mismatched[field] = true
+		}
+	}
+	for field, n := range other.counts {
+		if w.counts[field] != n {
+			mismatched[field] = true
+		}
+	}
+
+	fields := make([]string, 0, len(mismatched))
+	for field := range mismatched {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// 按 tag 名称排序的 series 标识
+func seriesKey(p DataPoint) string {
+	keys := make([]string, 0, len(p.Tags))
+	for k := range p.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(p.Tags[k])
+		b.WriteByte(',')
+	}
+	return b.String()
+}
+
+// 单个字段值的哈希。各版本客户端返回的数值类型不同（int64、float64、json.Number），
+// 数值统一按 float64 格式化后再计算
+func pointHash(series string, t int64, v interface{}) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(series))
+	h.Write([]byte(strconv.FormatInt(t, 10)))
+	h.Write([]byte{0})
+	h.Write([]byte(normalizeValue(v)))
+	return h.Sum64()
+}
+
+func normalizeValue(v interface{}) string {
+	switch n := v.(type) {
+	case float64:
+		return strconv.FormatFloat(n, 'g', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(n), 'g', -1, 64)
+	case int:
+		return strconv.FormatFloat(float64(n), 'g', -1, 64)
+	case int64:
+		return strconv.FormatFloat(float64(n), 'g', -1, 64)
+	case int32:
+		return strconv.FormatFloat(float64(n), 'g', -1, 64)
+	case uint64:
+		return strconv.FormatFloat(float64(n), 'g', -1, 64)
+	case json.Number:
+		if f, err := n.Float64(); err == nil {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		return n.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
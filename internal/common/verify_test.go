@@ -0,0 +1,137 @@
+package common
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVerifyReportsMismatchedWindows(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := &seriesDataSource{mockDataSource: mockDataSource{measurements: []string{"cpu"}}}
+	target := &seriesDataSource{}
+	// 3 天的数据，每小时一个点；目标端缺少第 2 天的一个点，第 3 天有一个值不同
+	for i := 0; i < 3*24; i++ {
+		ts := base.Add(time.Duration(i) * time.Hour)
+		source.add(DataPoint{
+			Measurement: "cpu",
+			Tags:        map[string]string{"host": "a"},
+			Fields:      map[string]interface{}{"value": float64(i)},
+			Time:        ts,
+		})
+		switch i {
+		case 30:
+			continue
+		case 60:
+			target.add(DataPoint{Measurement: "cpu", Tags: map[string]string{"host": "a"}, Fields: map[string]interface{}{"value": int64(-1)}, Time: ts})
+		default:
+			// 目标端返回整数类型，校验和按数值比较
+			target.add(DataPoint{Measurement: "cpu", Tags: map[string]string{"host": "a"}, Fields: map[string]interface{}{"value": int64(i)}, Time: ts})
+		}
+	}
+
+	cfg := SyncConfig{SourceDB: "testdb", TargetDBPrefix: "bak_", BatchSize: 7, Start: "2024-01-01T00:00:00Z", End: "2024-01-04T00:00:00Z"}
+	diffs, err := NewSyncer(cfg, source, nil).Verify(context.Background(), target, VerifyOptions{Window: 24 * time.Hour, Checksum: true})
+	if err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	if len(diffs) != 2 {
+		t.Fatalf("期望 2 个不一致窗口, 实际为 %v", diffs)
+	}
+	if d := diffs[0]; !d.Start.Equal(base.Add(24*time.Hour)) || d.SourceCount != 24 || d.TargetCount != 23 || d.Target != "bak_testdb" {
+		t.Errorf("第 2 天应点数不一致, 实际为 %v", d)
+	}
+	if d := diffs[1]; !d.Start.Equal(base.Add(48*time.Hour)) || d.SourceCount != d.TargetCount || len(d.Fields) != 1 || d.Fields[0] != "value" {
+		t.Errorf("第 3 天应字段校验和不一致, 实际为 %v", d)
+	}
+
+	// 只比较点数时不报告值不同的窗口
+	diffs, err = NewSyncer(cfg, source, nil).Verify(context.Background(), target, VerifyOptions{Window: 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	if len(diffs) != 1 {
+		t.Errorf("期望 1 个点数不一致的窗口, 实际为 %v", diffs)
+	}
+
+	// 不一致窗口列表可以保存后重新加载
+	path := filepath.Join(t.TempDir(), "diffs.json")
+	if err := SaveWindowDiffs(path, diffs); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+	loaded, err := LoadWindowDiffs(path)
+	if err != nil || len(loaded) != 1 || !loaded[0].End.Equal(diffs[0].End) {
+		t.Errorf("重新加载结果不一致: %v, %v", loaded, err)
+	}
+}
+
+// 能在服务端按字段计数的数据源
+type countingDataSource struct {
+	seriesDataSource
+	counts int
+}
+
+func (m *countingDataSource) CountFields(ctx context.Context, q Query) (map[string]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counts++
+
+	counts := make(map[string]int64)
+	for _, p := range m.points {
+		if ts := p.Time.UnixNano(); ts >= q.Cursor.Time && ts < q.End {
+			for field := range p.Fields {
+				counts[field]++
+			}
+		}
+	}
+	return counts, nil
+}
+
+func TestVerifyCountsFieldsAndStopsAfterLastPoint(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := &countingDataSource{seriesDataSource: seriesDataSource{mockDataSource: mockDataSource{measurements: []string{"cpu"}}}}
+	target := &countingDataSource{}
+	// 第 1 天和第 3 天各 3 个点；目标端第 3 天的一个点缺少 idle 字段，点数相同
+	for _, day := range []int{0, 2} {
+		for i := 0; i < 3; i++ {
+			ts := base.Add(time.Duration(day)*24*time.Hour + time.Duration(i)*time.Hour)
+			fields := map[string]interface{}{"value": float64(i), "idle": float64(i)}
+			source.add(DataPoint{Measurement: "cpu", Tags: map[string]string{"host": "a"}, Fields: fields, Time: ts})
+			if day == 2 && i == 1 {
+				fields = map[string]interface{}{"value": float64(i)}
+			}
+			target.add(DataPoint{Measurement: "cpu", Tags: map[string]string{"host": "a"}, Fields: fields, Time: ts})
+		}
+	}
+
+	// 未设置结束时间，窗口不应一直查询到当前时间
+	cfg := SyncConfig{SourceDB: "testdb", TargetDBPrefix: "bak_", BatchSize: 2, Start: "2024-01-01T00:00:00Z"}
+	diffs, err := NewSyncer(cfg, source, nil).Verify(context.Background(), target, VerifyOptions{Window: 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	if len(diffs) != 1 {
+		t.Fatalf("期望 1 个不一致窗口, 实际为 %v", diffs)
+	}
+	if d := diffs[0]; !d.Start.Equal(base.Add(48*time.Hour)) || d.SourceCount != 3 || d.TargetCount != 3 || len(d.Fields) != 1 || d.Fields[0] != "idle" {
+		t.Errorf("第 3 天应 idle 字段个数不一致, 实际为 %v", d)
+	}
+
+	// 第 1、2、3、4 天各计数一次，第 2、4 天为空窗口后各查询一次下一个点，
+	// 加上最早一个点的查询，点数不通过 QueryData 读取
+	for name, m := range map[string]*countingDataSource{"源端": source, "目标端": target} {
+		if m.counts != 4 || m.queries != 3 {
+			t.Errorf("%s期望计数 4 次、查询 3 次, 实际为 %d 次、%d 次", name, m.counts, m.queries)
+		}
+	}
+}
+
+func TestNormalizeValue(t *testing.T) {
+	if normalizeValue(int64(3)) != normalizeValue(float64(3)) {
+		t.Error("相同数值的整数和浮点数应得到相同结果")
+	}
+	if normalizeValue("3") == normalizeValue(true) {
+		t.Error("不同类型的值不应相同")
+	}
+}
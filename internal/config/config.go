@@ -26,14 +26,77 @@ type DBConfig struct {
 }
 
 type SyncConfig struct {
-	Start         string `yaml:"start"`
-	End           string `yaml:"end"`
-	BatchSize     int    `yaml:"batch_size"`
-	ResumeFile    string `yaml:"resume_file"`
-	Parallel      int    `yaml:"parallel"`
-	RetryCount    int    `yaml:"retry_count"`
-	RetryInterval int    `yaml:"retry_interval"`
-	RateLimit     int    `yaml:"rate_limit"`
+	Start             string                  `yaml:"start"`
+	End               string                  `yaml:"end"`
+	BatchSize         int                     `yaml:"batch_size"`
+	ResumeFile        string                  `yaml:"resume_file"`
+	Checkpoint        CheckpointConfig        `yaml:"checkpoint"`
+	Parallel          int                     `yaml:"parallel"`
+	RetryCount        int                     `yaml:"retry_count"`
+	RetryInterval     int                     `yaml:"retry_interval"`
+	RateLimit         int                     `yaml:"rate_limit"`
+	QueryTimeout      int                     `yaml:"query_timeout"`   // 单次查询超时秒数，默认 60 秒
+	WriteTimeout      int                     `yaml:"write_timeout"`   // 单次写入超时秒数，默认 60 秒
+	MaxInflightMB     int                     `yaml:"max_inflight_mb"` // 已读取未写入数据的内存上限（MB），默认 256
+	ShardHours        int                     `yaml:"shard_hours"`     // 大表按该小时数拆分为时间窗口并行同步，0 表示不拆分
+	Follow            FollowConfig            `yaml:"follow"`
+	AdaptiveBatch     AdaptiveBatchConfig     `yaml:"adaptive_batch"`
+	Throughput        ThroughputConfig        `yaml:"throughput"`
+	DeadLetterDir     string                  `yaml:"dead_letter_dir"` // 目标端拒绝的点写入该目录，可用 replay-dlq 命令重新写入
+	OnError           string                  `yaml:"on_error"`        // continue（默认）或 fail_fast
+	MaxFailures       int                     `yaml:"max_failures"`    // 失败数达到该值后停止，0 表示不限
+	ReportFile        string                  `yaml:"report_file"`     // 同步结束后以 JSON 格式写入运行报告
+	CreateMissing     CreateMissingConfig     `yaml:"create_missing"`
+	RetentionPolicies RetentionPoliciesConfig `yaml:"retention_policies"`
+	CreateDBRP        bool                    `yaml:"create_dbrp"` // 同步完成后在 2.x 目标端创建 DBRP 映射
+	// 同步前把 1.x 源库的连续查询迁移为 2.x 目标端的任务
+	MigrateContinuousQueries bool `yaml:"migrate_continuous_queries"`
+}
+
+type CheckpointConfig struct {
+	Type     string `yaml:"type"`     // file（默认，使用 resume_file）或 target（保存在目标库中）
+	Database string `yaml:"database"` // target 类型时保存断点的库/bucket
+}
+
+type CreateMissingConfig struct {
+	Enabled        bool `yaml:"enabled"`         // 首次写入前自动创建不存在的目标库/bucket
+	RetentionHours int  `yaml:"retention_hours"` // 新建目标库的保留小时数，0 表示沿用源库的默认保留策略
+}
+
+type RetentionPoliciesConfig struct {
+	All     bool              `yaml:"all"`     // 同步 1.x 源库的全部保留策略，而不只是默认保留策略
+	Mapping map[string]string `yaml:"mapping"` // 源保留策略到目标名称的映射，支持 {db} 和 {rp} 占位符
+}
+
+type FollowConfig struct {
+	Enabled  bool `yaml:"enabled"`  // 首轮同步完成后持续轮询新数据，直到收到退出信号
+	Interval int  `yaml:"interval"` // 轮询间隔秒数，默认 10 秒
+	Lookback int  `yaml:"lookback"` // 每轮回扫的秒数，用于补齐迟到数据，0 表示不回扫
+}
+
+type AdaptiveBatchConfig struct {
+	Enabled         bool `yaml:"enabled"`           // 根据写入耗时和请求体大小自动调整批次大小，batch_size 作为初始值
+	Min             int  `yaml:"min"`               // 批次大小下限，默认 100
+	Max             int  `yaml:"max"`               // 批次大小上限，默认 50000
+	TargetLatencyMs int  `yaml:"target_latency_ms"` // 单次写入的目标耗时毫秒数，默认 2000
+	TargetBodyKB    int  `yaml:"target_body_kb"`    // 单次写入的目标请求体大小（KB），默认 4096
+}
+
+// 所有 worker 共享的吞吐上限，0 表示不限
+type ThroughputConfig struct {
+	Source RateConfig `yaml:"source"` // 源端读取
+	Target RateConfig `yaml:"target"` // 目标端写入
+}
+
+type RateConfig struct {
+	PointsPerSec int64 `yaml:"points_per_sec"`
+	BytesPerSec  int64 `yaml:"bytes_per_sec"`
+}
+
+// verify 命令的校验参数
+type VerifyConfig struct {
+	WindowHours int  `yaml:"window_hours"` // 按该小时数的时间窗口分别比较，默认 24
+	Checksum    bool `yaml:"checksum"`     // 除点数外同时比较每个字段的校验和
 }
 
 type LogConfig struct {
@@ -41,10 +104,11 @@ type LogConfig struct {
 }
 
 type Config struct {
-	Source DBConfig   `yaml:"source"`
-	Target DBConfig   `yaml:"target"`
-	Sync   SyncConfig `yaml:"sync"`
-	Log    LogConfig  `yaml:"log"`
+	Source DBConfig     `yaml:"source"`
+	Target DBConfig     `yaml:"target"`
+	Sync   SyncConfig   `yaml:"sync"`
+	Verify VerifyConfig `yaml:"verify"`
+	Log    LogConfig    `yaml:"log"`
 }
 
 func LoadConfig(path string) (*Config, error) {
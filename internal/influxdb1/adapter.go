@@ -1,8 +1,10 @@
 package influxdb1
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -63,13 +65,13 @@ func (ds *DataSource) Close() error {
 	return nil
 }
 
-func (ds *DataSource) GetDatabases() ([]string, error) {
-	dbRes, err := ds.cli.Query(client.NewQuery("SHOW DATABASES", "", ""))
+func (ds *DataSource) GetDatabases(ctx context.Context) ([]string, error) {
+	dbRes, err := QueryContext(ctx, ds.cli, client.NewQuery("SHOW DATABASES", "", ""))
 	if err != nil {
 		return nil, err
 	}
 	if dbRes.Error() != nil {
-		return nil, dbRes.Error()
+		return nil, common.ClassifyError(dbRes.Error())
 	}
 
 	var dbs []string
@@ -87,13 +89,13 @@ func (ds *DataSource) GetDatabases() ([]string, error) {
 	return dbs, nil
 }
 
-func (ds *DataSource) GetMeasurements(db string) ([]string, error) {
-	showRes, err := ds.cli.Query(client.NewQuery("SHOW MEASUREMENTS", db, ""))
+func (ds *DataSource) GetMeasurements(ctx context.Context, db string) ([]string, error) {
+	showRes, err := QueryContext(ctx, ds.cli, client.NewQuery("SHOW MEASUREMENTS", db, ""))
 	if err != nil {
 		return nil, err
 	}
 	if showRes.Error() != nil {
-		return nil, showRes.Error()
+		return nil, common.ClassifyError(showRes.Error())
 	}
 
 	var measurements []string
@@ -111,15 +113,15 @@ func (ds *DataSource) GetMeasurements(db string) ([]string, error) {
 	return measurements, nil
 }
 
-func (ds *DataSource) GetTagKeys(db, measurement string) (map[string]bool, error) {
+func (ds *DataSource) GetTagKeys(ctx context.Context, db, measurement string) (map[string]bool, error) {
 	tagKeys := make(map[string]bool)
 	q := fmt.Sprintf("SHOW TAG KEYS FROM %s", escapeMeasurement(measurement))
-	res, err := ds.cli.Query(client.NewQuery(q, db, ""))
+	res, err := QueryContext(ctx, ds.cli, client.NewQuery(q, db, ""))
 	if err != nil {
 		return tagKeys, err
 	}
 	if res.Error() != nil {
-		return tagKeys, res.Error()
+		return tagKeys, common.ClassifyError(res.Error())
 	}
 
 	for _, result := range res.Results {
@@ -136,31 +138,72 @@ func (ds *DataSource) GetTagKeys(db, measurement string) (map[string]bool, error
 	return tagKeys, nil
 }
 
-func (ds *DataSource) QueryData(db, measurement string, startTime int64, batchSize int) ([]common.DataPoint, int64, error) {
-	em := escapeMeasurement(measurement)
-	var q string
-	if startTime == 0 {
-		q = fmt.Sprintf("SELECT * FROM %s ORDER BY time ASC LIMIT %d", em, batchSize)
-	} else {
-		q = fmt.Sprintf("SELECT * FROM %s WHERE time > %d ORDER BY time ASC LIMIT %d", em, startTime, batchSize)
+func (ds *DataSource) GetFieldKeys(ctx context.Context, db, measurement string) (map[string]common.FieldType, error) {
+	res, err := QueryContext(ctx, ds.cli, client.NewQuery(FieldKeysQuery(measurement), db, ""))
+	if err != nil {
+		return nil, err
+	}
+	if res.Error() != nil {
+		return nil, common.ClassifyError(res.Error())
 	}
+	return ParseFieldKeys(res), nil
+}
+
+// FieldKeysQuery 查询 measurement 字段名和类型的 InfluxQL
+func FieldKeysQuery(measurement string) string {
+	return fmt.Sprintf("SHOW FIELD KEYS FROM %s", escapeMeasurement(measurement))
+}
+
+// ParseFieldKeys 解析 SHOW FIELD KEYS 的结果。同一字段在不同分片中类型不同时
+// 会返回多行，此时保留第一个类型
+func ParseFieldKeys(res *client.Response) map[string]common.FieldType {
+	fields := make(map[string]common.FieldType)
+	for _, result := range res.Results {
+		for _, series := range result.Series {
+			for _, row := range series.Values {
+				if len(row) < 2 {
+					continue
+				}
+				name, _ := row[0].(string)
+				typ, _ := row[1].(string)
+				t, ok := common.ParseFieldType(typ)
+				if name == "" || !ok {
+					continue
+				}
+				if prev, exists := fields[name]; exists && prev != t {
+					logx.Warn(fmt.Sprintf("字段 %s 在不同分片中的类型不同: %s 和 %s，按 %s 写入", name, prev, t, prev))
+					continue
+				}
+				fields[name] = t
+			}
+		}
+	}
+	return fields
+}
+
+func (ds *DataSource) QueryData(ctx context.Context, query common.Query) ([]common.DataPoint, common.Cursor, error) {
+	// 读取目标端时 DB 可能是 "库/保留策略" 形式的目标名称
+	if query.RP == "" {
+		query.DB, query.RP = SplitDBRP(query.DB)
+	}
+	db, measurement := query.DB, query.Measurement
+	q := BuildSelectQuery(query)
 
 	logx.Debug(fmt.Sprintf("执行查询: %s", q))
 	queryStart := time.Now()
-	res, err := ds.cli.Query(client.NewQuery(q, db, "ns"))
+	res, err := QueryContext(ctx, ds.cli, client.NewQuery(q, db, "ns"))
 	logx.Debug(fmt.Sprintf("查询耗时: %v", time.Since(queryStart)))
 	if err != nil {
-		return nil, 0, err
+		return nil, query.Cursor, err
 	}
 	if res.Error() != nil {
-		return nil, 0, res.Error()
+		return nil, query.Cursor, common.ClassifyError(res.Error())
 	}
 
 	var points []common.DataPoint
-	var maxTime int64 = startTime
 
 	// 获取标签字段
-	tagKeys, err := ds.GetTagKeys(db, measurement)
+	tagKeys, err := ds.GetTagKeys(ctx, db, measurement)
 	if err != nil {
 		logx.Warn("获取标签字段失败，使用默认:", err)
 		tagKeys = map[string]bool{"host": true, "region": true}
@@ -177,7 +220,6 @@ func (ds *DataSource) QueryData(db, measurement string, startTime int64, batchSi
 				tags := map[string]string{}
 				fields := map[string]interface{}{}
 				var t time.Time
-				var tUnix int64 = 0
 				skip := false
 
 				for col, idx := range colIdx {
@@ -186,20 +228,15 @@ func (ds *DataSource) QueryData(db, measurement string, startTime int64, batchSi
 						switch v := row[idx].(type) {
 						case string:
 							t, _ = time.Parse(time.RFC3339Nano, v)
-							tUnix = t.UnixNano()
 						case time.Time:
 							t = v
-							tUnix = t.UnixNano()
 						case int64:
 							t = time.Unix(0, v)
-							tUnix = v
 						case float64:
 							t = time.Unix(0, int64(v))
-							tUnix = int64(v)
 						case json.Number:
 							if ns, err := v.Int64(); err == nil {
 								t = time.Unix(0, ns)
-								tUnix = ns
 							}
 						default:
 							logx.Warn(fmt.Sprintf("未知time类型: %T, value: %v, measurement: %s, db: %s, 跳过该点", v, v, series.Name, db))
@@ -227,10 +264,6 @@ func (ds *DataSource) QueryData(db, measurement string, startTime int64, batchSi
 					continue
 				}
 
-				if tUnix > maxTime {
-					maxTime = tUnix
-				}
-
 				points = append(points, common.DataPoint{
 					Measurement: series.Name,
 					Tags:        tags,
@@ -241,7 +274,206 @@ func (ds *DataSource) QueryData(db, measurement string, startTime int64, batchSi
 		}
 	}
 
-	return points, maxTime, nil
+	return points, common.NextCursor(query.Cursor, points), nil
+}
+
+// TimeRange 返回 measurement 最早和最晚一个点的时间戳，没有数据时返回 0
+func (ds *DataSource) TimeRange(ctx context.Context, db, rp, measurement string) (int64, int64, error) {
+	var bounds [2]int64
+	for i, desc := range []bool{false, true} {
+		res, err := QueryContext(ctx, ds.cli, client.NewQuery(BoundaryQuery(rp, measurement, desc), db, "ns"))
+		if err != nil {
+			return 0, 0, err
+		}
+		if res.Error() != nil {
+			return 0, 0, res.Error()
+		}
+		ts, ok := FirstRowTime(res)
+		if !ok {
+			return 0, 0, nil
+		}
+		bounds[i] = ts
+	}
+	return bounds[0], bounds[1], nil
+}
+
+// BoundaryQuery 构建查询 measurement 第一个（desc 为 true 时最后一个）点的 InfluxQL，rp 为空时查询默认保留策略
+func BoundaryQuery(rp, measurement string, desc bool) string {
+	order := "ASC"
+	if desc {
+		order = "DESC"
+	}
+	return fmt.Sprintf("SELECT * FROM %s ORDER BY time %s LIMIT 1", fromClause(rp, measurement), order)
+}
+
+// FirstRowTime 返回查询结果第一行的时间戳（精度为 ns）
+func FirstRowTime(res *client.Response) (int64, bool) {
+	for _, result := range res.Results {
+		for _, series := range result.Series {
+			for i, col := range series.Columns {
+				if col != "time" || len(series.Values) == 0 {
+					continue
+				}
+				if n, ok := series.Values[0][i].(json.Number); ok {
+					if ts, err := n.Int64(); err == nil {
+						return ts, true
+					}
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+// CountFields 统计时间范围内每个字段的非空值个数，用于校验时比较点数
+func (ds *DataSource) CountFields(ctx context.Context, query common.Query) (map[string]int64, error) {
+	// 读取目标端时 DB 可能是 "库/保留策略" 形式的目标名称
+	if query.RP == "" {
+		query.DB, query.RP = SplitDBRP(query.DB)
+	}
+	res, err := QueryContext(ctx, ds.cli, client.NewQuery(CountQuery(query), query.DB, "ns"))
+	if err != nil {
+		return nil, err
+	}
+	if res.Error() != nil {
+		return nil, common.ClassifyError(res.Error())
+	}
+	return ParseFieldCounts(res), nil
+}
+
+// CountQuery 构建统计时间范围内每个字段非空值个数的 InfluxQL
+func CountQuery(q common.Query) string {
+	return fmt.Sprintf("SELECT COUNT(*) FROM %s%s", fromClause(q.RP, q.Measurement), timeWhereClause(q))
+}
+
+// ParseFieldCounts 解析 COUNT(*) 的结果，列名为 count_字段名
+func ParseFieldCounts(res *client.Response) map[string]int64 {
+	counts := make(map[string]int64)
+	for _, result := range res.Results {
+		for _, series := range result.Series {
+			if len(series.Values) == 0 {
+				continue
+			}
+			for i, col := range series.Columns {
+				field, ok := strings.CutPrefix(col, "count_")
+				if !ok {
+					continue
+				}
+				if n, ok := series.Values[0][i].(json.Number); ok {
+					if count, err := n.Int64(); err == nil {
+						counts[field] += count
+					}
+				}
+			}
+		}
+	}
+	return counts
+}
+
+// EstimateSize 以 series 数预估 measurement 的大小，用于调度排序。
+// series 索引不区分保留策略，各保留策略的预估值相同
+func (ds *DataSource) EstimateSize(ctx context.Context, db, rp, measurement string) (int64, error) {
+	res, err := QueryContext(ctx, ds.cli, client.NewQuery(CardinalityQuery(measurement), db, ""))
+	if err != nil {
+		return 0, err
+	}
+	if res.Error() != nil {
+		return 0, res.Error()
+	}
+	n, _ := FirstCount(res)
+	return n, nil
+}
+
+// CardinalityQuery 构建查询 measurement series 数的 InfluxQL
+func CardinalityQuery(measurement string) string {
+	return fmt.Sprintf("SHOW SERIES CARDINALITY FROM %s", escapeMeasurement(measurement))
+}
+
+// FirstCount 返回查询结果第一行 count 列的值
+func FirstCount(res *client.Response) (int64, bool) {
+	for _, result := range res.Results {
+		for _, series := range result.Series {
+			for i, col := range series.Columns {
+				if col != "count" || len(series.Values) == 0 {
+					continue
+				}
+				if n, ok := series.Values[0][i].(json.Number); ok {
+					if count, err := n.Int64(); err == nil {
+						return count, true
+					}
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+// DefaultRetention 返回数据库的默认保留策略，用于在目标端创建相同保留时长的库
+func (ds *DataSource) DefaultRetention(ctx context.Context, db string) (common.RetentionPolicy, error) {
+	policies, err := showRetentionPolicies(ctx, ds.cli, db)
+	if err != nil {
+		return common.RetentionPolicy{}, err
+	}
+	for _, rp := range policies {
+		if rp.Default {
+			return rp, nil
+		}
+	}
+	return common.RetentionPolicy{}, fmt.Errorf("数据库 %s 没有默认保留策略", db)
+}
+
+// RetentionPolicies 返回数据库的全部保留策略，每个保留策略的数据分别同步
+func (ds *DataSource) RetentionPolicies(ctx context.Context, db string) ([]common.RetentionPolicy, error) {
+	return showRetentionPolicies(ctx, ds.cli, db)
+}
+
+func showRetentionPolicies(ctx context.Context, cli InfluxClient, db string) ([]common.RetentionPolicy, error) {
+	res, err := QueryContext(ctx, cli, client.NewQuery("SHOW RETENTION POLICIES ON "+escapeMeasurement(db), "", ""))
+	if err != nil {
+		return nil, err
+	}
+	if res.Error() != nil {
+		return nil, common.ClassifyError(res.Error())
+	}
+	return ParseRetentionPolicies(res), nil
+}
+
+// ParseRetentionPolicies 解析 SHOW RETENTION POLICIES 结果
+func ParseRetentionPolicies(res *client.Response) []common.RetentionPolicy {
+	var policies []common.RetentionPolicy
+	for _, result := range res.Results {
+		for _, series := range result.Series {
+			for _, row := range series.Values {
+				var rp common.RetentionPolicy
+				for i, col := range series.Columns {
+					if i >= len(row) {
+						break
+					}
+					switch col {
+					case "name":
+						rp.Name, _ = row[i].(string)
+					case "duration":
+						// 0s 表示永久保留
+						if v, ok := row[i].(string); ok {
+							rp.Duration, _ = time.ParseDuration(v)
+						}
+					case "default":
+						rp.Default, _ = row[i].(bool)
+					}
+				}
+				if rp.Name != "" {
+					policies = append(policies, rp)
+				}
+			}
+		}
+	}
+	return policies
+}
+
+// SplitDBRP 拆分 "库/保留策略" 形式的目标名称，没有 "/" 时保留策略为空（默认保留策略）
+func SplitDBRP(name string) (db, rp string) {
+	db, rp, _ = strings.Cut(name, "/")
+	return db, rp
 }
 
 // 数据目标接口实现
@@ -262,24 +494,243 @@ func (dt *DataTarget) Close() error {
 	return nil
 }
 
-func (dt *DataTarget) WritePoints(db string, points []common.DataPoint) error {
-	bp, err := client.NewBatchPoints(client.BatchPointsConfig{Database: db, Precision: "ns"})
+// WritePoints 写入 db，db 为 "库/保留策略" 时写入指定的保留策略
+func (dt *DataTarget) WritePoints(ctx context.Context, db string, points []common.DataPoint) error {
+	db, rp := SplitDBRP(db)
+	bp, err := client.NewBatchPoints(client.BatchPointsConfig{Database: db, RetentionPolicy: rp, Precision: "ns"})
 	if err != nil {
 		return err
 	}
 
+	// 无法编码的点跳过，其余点写入后交给同步引擎写入死信目录
+	var rejected []common.RejectedPoint
 	for _, point := range points {
 		pt, err := client.NewPoint(point.Measurement, point.Tags, point.Fields, point.Time)
 		if err != nil {
-			continue // 跳过有问题的点
+			rejected = append(rejected, common.RejectedPoint{Point: point, Reason: err.Error()})
+			continue
 		}
 		bp.AddPoint(pt)
 	}
 
-	return dt.cli.Write(bp)
+	if len(bp.Points()) > 0 {
+		if err := WriteContext(ctx, dt.cli, bp); err != nil {
+			return err
+		}
+	}
+	return common.NewRejectedPointsError(rejected)
+}
+
+// EnsureDatabase 数据库不存在时创建，并以 rp 作为默认保留策略
+// name 为 "库/保留策略" 时库不存在则创建，保留策略不存在时按 rp 的保留时长创建
+func (dt *DataTarget) EnsureDatabase(ctx context.Context, name string, rp common.RetentionPolicy) error {
+	db, rpName := SplitDBRP(name)
+	res, err := QueryContext(ctx, dt.cli, client.NewQuery("SHOW DATABASES", "", ""))
+	if err != nil {
+		return err
+	}
+	if res.Error() != nil {
+		return common.ClassifyError(res.Error())
+	}
+	exists := false
+	for _, result := range res.Results {
+		for _, series := range result.Series {
+			for _, v := range series.Values {
+				if len(v) > 0 && v[0] == db {
+					exists = true
+				}
+			}
+		}
+	}
+
+	var stmt string
+	switch {
+	case !exists && rpName == "":
+		stmt = CreateDatabaseQuery(db, rp)
+	case !exists:
+		stmt = "CREATE DATABASE " + escapeMeasurement(db)
+	}
+	if stmt != "" {
+		logx.Info("创建目标库", db)
+		if err := dt.exec(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if rpName == "" {
+		return nil
+	}
+
+	policies, err := showRetentionPolicies(ctx, dt.cli, db)
+	if err != nil {
+		return err
+	}
+	for _, p := range policies {
+		if p.Name == rpName {
+			return nil
+		}
+	}
+	logx.Info("创建目标保留策略", name)
+	return dt.exec(ctx, CreateRetentionPolicyQuery(db, rpName, rp.Duration))
+}
+
+// 执行不返回数据的 InfluxQL 语句
+func (dt *DataTarget) exec(ctx context.Context, stmt string) error {
+	res, err := QueryContext(ctx, dt.cli, client.NewQuery(stmt, "", ""))
+	if err != nil {
+		return err
+	}
+	if res.Error() != nil {
+		return common.ClassifyError(res.Error())
+	}
+	return nil
+}
+
+// CreateRetentionPolicyQuery 构建在已有数据库中创建保留策略的 InfluxQL
+func CreateRetentionPolicyQuery(db, rp string, duration time.Duration) string {
+	return fmt.Sprintf("CREATE RETENTION POLICY %s ON %s DURATION %s REPLICATION 1",
+		escapeMeasurement(rp), escapeMeasurement(db), durationLiteral(duration))
+}
+
+// CreateDatabaseQuery 构建创建数据库及其默认保留策略的 InfluxQL
+func CreateDatabaseQuery(name string, rp common.RetentionPolicy) string {
+	stmt := "CREATE DATABASE " + escapeMeasurement(name) + " WITH DURATION " + durationLiteral(rp.Duration)
+	if rp.Name != "" {
+		stmt += " NAME " + escapeMeasurement(rp.Name)
+	}
+	return stmt
+}
+
+// InfluxQL 时长字面量只能使用单个单位，0 表示永久保留
+func durationLiteral(d time.Duration) string {
+	switch {
+	case d <= 0:
+		return "INF"
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", (d+time.Second-1)/time.Second)
+	}
+}
+
+// QueryLatest 查询匹配 tags 的每个 series 的最新一个点，用于在目标库中读取断点
+func (dt *DataTarget) QueryLatest(ctx context.Context, db, measurement string, tags map[string]string) ([]common.DataPoint, error) {
+	res, err := QueryContext(ctx, dt.cli, client.NewQuery(LatestQuery(measurement, tags), db, "ns"))
+	if err != nil {
+		return nil, err
+	}
+	if res.Error() != nil {
+		// 库或 measurement 尚不存在时视为没有状态
+		if strings.Contains(res.Error().Error(), "database not found") {
+			return nil, nil
+		}
+		return nil, res.Error()
+	}
+
+	return ParseLatest(res), nil
+}
+
+// ParseLatest 解析 GROUP BY * 查询结果，每行转换为一个数据点
+func ParseLatest(res *client.Response) []common.DataPoint {
+	var points []common.DataPoint
+	for _, result := range res.Results {
+		for _, series := range result.Series {
+			for _, row := range series.Values {
+				p := common.DataPoint{
+					Measurement: series.Name,
+					Tags:        map[string]string{},
+					Fields:      map[string]interface{}{},
+				}
+				for k, v := range series.Tags {
+					p.Tags[k] = v
+				}
+				for i, col := range series.Columns {
+					if col == "time" {
+						if n, ok := row[i].(json.Number); ok {
+							if ns, err := n.Int64(); err == nil {
+								p.Time = time.Unix(0, ns)
+							}
+						}
+						continue
+					}
+					if row[i] != nil {
+						p.Fields[col] = row[i]
+					}
+				}
+				points = append(points, p)
+			}
+		}
+	}
+	return points
+}
+
+// LatestQuery 构建查询每个 series 最新一个点的 InfluxQL
+func LatestQuery(measurement string, tags map[string]string) string {
+	return fmt.Sprintf("SELECT * FROM %s%s GROUP BY * ORDER BY time DESC LIMIT 1",
+		escapeMeasurement(measurement), tagWhereClause(tags))
+}
+
+// 构建 tag 等值过滤条件
+func tagWhereClause(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var conds []string
+	for _, k := range keys {
+		conds = append(conds, fmt.Sprintf("%s = '%s'", escapeMeasurement(k), strings.ReplaceAll(tags[k], "'", "\\'")))
+	}
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
+
+// BuildSelectQuery 构建分页查询语句：从游标时间开始（含）按时间升序读取，
+// 并跳过游标时间上已读取的点。1.x 的 TSM 引擎在 SELECT * 不带 GROUP BY 时，
+// 同一时间戳的点按 series key 排序返回，顺序稳定，因此可以用 OFFSET 续读
+func BuildSelectQuery(q common.Query) string {
+	stmt := fmt.Sprintf("SELECT * FROM %s%s ORDER BY time ASC LIMIT %d", fromClause(q.RP, q.Measurement), timeWhereClause(q), q.Limit)
+	if q.Cursor.Offset > 0 {
+		stmt += fmt.Sprintf(" OFFSET %d", q.Cursor.Offset)
+	}
+	return stmt
+}
+
+// 从游标时间（含）到 End（不含）的时间条件，都未指定时为空
+func timeWhereClause(q common.Query) string {
+	var conds []string
+	if q.Cursor.Time != 0 {
+		conds = append(conds, fmt.Sprintf("time >= %d", q.Cursor.Time))
+	}
+	if q.End > 0 {
+		conds = append(conds, fmt.Sprintf("time < %d", q.End))
+	}
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
+
+// TimestampQuery 构建读取 measurement 在 ts 时刻全部点的查询语句
+func TimestampQuery(rp, measurement string, ts int64) string {
+	return fmt.Sprintf("SELECT * FROM %s WHERE time = %d", fromClause(rp, measurement), ts)
 }
 
 // measurement 名称转义，双引号包裹并转义内部双引号
 func escapeMeasurement(m string) string {
 	return "\"" + strings.ReplaceAll(m, "\"", "\\\"") + "\""
 }
+
+// FROM 子句，指定保留策略时为 "rp"."measurement"
+func fromClause(rp, measurement string) string {
+	if rp == "" {
+		return escapeMeasurement(measurement)
+	}
+	return escapeMeasurement(rp) + "." + escapeMeasurement(measurement)
+}
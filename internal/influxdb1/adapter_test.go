@@ -1,9 +1,12 @@
 package influxdb1
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	"github.com/influxdata/influxdb1-client/models"
+	client "github.com/influxdata/influxdb1-client/v2"
 	"github.com/ygqygq2/influxdb-sync/internal/common"
 	"github.com/ygqygq2/influxdb-sync/internal/testutil"
 )
@@ -170,7 +173,7 @@ func TestDataSource_GetTagKeys(t *testing.T) {
 	}
 	defer ds.Close()
 	
-	tagKeys, err := ds.GetTagKeys("testdb", "cpu")
+	tagKeys, err := ds.GetTagKeys(context.Background(), "testdb", "cpu")
 	if err != nil {
 		t.Logf("GetTagKeys 错误: %v", err)
 	}
@@ -196,12 +199,12 @@ func TestDataSource_QueryData(t *testing.T) {
 	}
 	defer ds.Close()
 	
-	points, maxTime, err := ds.QueryData("testdb", "cpu", 0, 1000)
+	points, cursor, err := ds.QueryData(context.Background(), common.Query{DB: "testdb", Measurement: "cpu", Limit: 1000})
 	if err != nil {
 		t.Logf("QueryData 错误: %v", err)
 	}
 	
-	t.Logf("查询到 %d 个数据点，最大时间戳 %d", len(points), maxTime)
+	t.Logf("查询到 %d 个数据点，游标 %+v", len(points), cursor)
 }
 
 func TestDataTarget_WritePoints(t *testing.T) {
@@ -237,10 +240,38 @@ func TestDataTarget_WritePoints(t *testing.T) {
 		},
 	}
 	
-	err = dt.WritePoints("testdb", points)
+	err = dt.WritePoints(context.Background(), "testdb", points)
 	if err != nil {
 		t.Logf("WritePoints 错误: %v", err)
 	} else {
 		t.Logf("成功写入 %d 个数据点到 testdb.test_measurement", len(points))
 	}
 }
+
+func TestParseFieldKeys(t *testing.T) {
+	res := &client.Response{Results: []client.Result{{
+		Series: []models.Row{{Name: "cpu", Columns: []string{"fieldKey", "fieldType"}, Values: [][]interface{}{
+			{"usage", "float"},
+			{"count", "integer"},
+			{"bytes", "unsigned"},
+			{"status", "string"},
+			{"up", "boolean"},
+			// 不同分片中类型不同时保留第一个
+			{"count", "float"},
+			{"bad", "unknown"},
+		}}},
+	}}}
+	expected := map[string]common.FieldType{
+		"usage": common.FieldFloat, "count": common.FieldInteger, "bytes": common.FieldUnsigned,
+		"status": common.FieldString, "up": common.FieldBoolean,
+	}
+	got := ParseFieldKeys(res)
+	if len(got) != len(expected) {
+		t.Fatalf("期望 %v, 实际为 %v", expected, got)
+	}
+	for name, typ := range expected {
+		if got[name] != typ {
+			t.Errorf("字段 %s 期望类型 %s, 实际为 %s", name, typ, got[name])
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package influxdb1
 
 import (
+	"context"
 	"time"
 
 	client "github.com/influxdata/influxdb1-client/v2"
+	"github.com/ygqygq2/influxdb-sync/internal/common"
 )
 
 type Client struct {
@@ -26,3 +28,45 @@ func NewClient(addr, user, pass string, timeout time.Duration) (*Client, error)
 func (c *Client) Close() error {
 	return c.cli.Close()
 }
+
+// QueryContext 执行查询，ctx 结束时立即返回。1.x 客户端不支持 context，
+// 被放弃的请求会在后台继续执行，直到 HTTP 超时。返回的错误已按 common.ClassifyError 分类
+func QueryContext(ctx context.Context, cli InfluxClient, q client.Query) (*client.Response, error) {
+	res, err := runContext(ctx, func() (*client.Response, error) {
+		return cli.Query(q)
+	})
+	return res, common.ClassifyError(err)
+}
+
+// WriteContext 执行写入，ctx 结束时立即返回
+func WriteContext(ctx context.Context, cli InfluxClient, bp client.BatchPoints) error {
+	_, err := runContext(ctx, func() (struct{}, error) {
+		return struct{}{}, cli.Write(bp)
+	})
+	return common.ClassifyError(err)
+}
+
+func runContext[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	type result struct {
+		v   T
+		err error
+	}
+	if err := ctx.Err(); err != nil {
+		var zero T
+		return zero, err
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		v, err := fn()
+		done <- result{v, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.v, r.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
@@ -1,8 +1,13 @@
 package influxdb1
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
+
+	client "github.com/influxdata/influxdb1-client/v2"
+	"github.com/ygqygq2/influxdb-sync/internal/common"
 )
 
 func TestNewClient(t *testing.T) {
@@ -107,3 +112,76 @@ func TestClientCredentials(t *testing.T) {
 		})
 	}
 }
+
+// 阻塞直到 release 关闭的 mock 客户端
+type blockingClient struct {
+	release chan struct{}
+}
+
+func (b *blockingClient) Query(q client.Query) (*client.Response, error) {
+	<-b.release
+	return &client.Response{}, nil
+}
+
+func (b *blockingClient) Write(bp client.BatchPoints) error {
+	<-b.release
+	return nil
+}
+
+func (b *blockingClient) Close() error {
+	return nil
+}
+
+func TestQueryContextReturnsOnDeadline(t *testing.T) {
+	cli := &blockingClient{release: make(chan struct{})}
+	defer close(cli.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := QueryContext(ctx, cli, client.NewQuery("SHOW DATABASES", "", "")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("期望超时错误, 实际为: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("超时后应立即返回, 实际耗时 %v", elapsed)
+	}
+
+	bp, _ := client.NewBatchPoints(client.BatchPointsConfig{Database: "db"})
+	if err := WriteContext(ctx, cli, bp); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ctx 已结束时写入应返回错误, 实际为: %v", err)
+	}
+}
+
+// 记录写入点数的 mock 客户端
+type recordingClient struct {
+	blockingClient
+	written int
+}
+
+func (r *recordingClient) Write(bp client.BatchPoints) error {
+	r.written += len(bp.Points())
+	return nil
+}
+
+func TestWritePointsReportsRejectedPoints(t *testing.T) {
+	cli := &recordingClient{}
+	target := &DataTarget{cli: cli}
+
+	points := []common.DataPoint{
+		{Measurement: "cpu", Fields: map[string]interface{}{"value": 1.0}, Time: time.Unix(1, 0)},
+		{Measurement: "cpu", Fields: map[string]interface{}{}, Time: time.Unix(2, 0)},
+	}
+	err := target.WritePoints(context.Background(), "db", points)
+
+	var rejected *common.RejectedPointsError
+	if !errors.As(err, &rejected) || len(rejected.Rejected) != 1 {
+		t.Fatalf("期望报告 1 个被拒绝的点, 实际为: %v", err)
+	}
+	if rejected.Rejected[0].Point.Time != points[1].Time {
+		t.Errorf("被拒绝的点不正确: %+v", rejected.Rejected[0].Point)
+	}
+	if cli.written != 1 {
+		t.Errorf("其余点应正常写入, 实际写入 %d 个", cli.written)
+	}
+}
@@ -0,0 +1,486 @@
+package influxdb1
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	client "github.com/influxdata/influxdb1-client/v2"
+	"github.com/ygqygq2/influxdb-sync/internal/common"
+)
+
+// 能迁移为降采样任务的聚合函数
+var downsampleFuncs = map[string]bool{
+	"mean": true, "median": true, "sum": true, "count": true, "min": true,
+	"max": true, "first": true, "last": true, "spread": true, "stddev": true,
+}
+
+// ContinuousQueries 读取数据库 db 的连续查询，能解析为降采样规则的附带 Downsample
+func (ds *DataSource) ContinuousQueries(ctx context.Context, db string) ([]common.ContinuousQuery, error) {
+	res, err := QueryContext(ctx, ds.cli, client.NewQuery("SHOW CONTINUOUS QUERIES", "", ""))
+	if err != nil {
+		return nil, err
+	}
+	if res.Error() != nil {
+		return nil, common.ClassifyError(res.Error())
+	}
+	return ParseContinuousQueries(res, db), nil
+}
+
+// ParseContinuousQueries 从 SHOW CONTINUOUS QUERIES 的结果中取出数据库 db 的连续查询，
+// 结果按数据库分为多个 series
+func ParseContinuousQueries(res *client.Response, db string) []common.ContinuousQuery {
+	var cqs []common.ContinuousQuery
+	for _, result := range res.Results {
+		for _, series := range result.Series {
+			if series.Name != db {
+				continue
+			}
+			for _, row := range series.Values {
+				cq := common.ContinuousQuery{DB: db}
+				for i, col := range series.Columns {
+					if i >= len(row) {
+						break
+					}
+					switch col {
+					case "name":
+						cq.Name, _ = row[i].(string)
+					case "query":
+						cq.Query, _ = row[i].(string)
+					}
+				}
+				if cq.Name == "" {
+					continue
+				}
+				d, err := ParseContinuousQuery(db, cq.Query)
+				if err != nil {
+					cq.Reason = err.Error()
+				} else {
+					cq.Downsample = d
+				}
+				cqs = append(cqs, cq)
+			}
+		}
+	}
+	return cqs
+}
+
+// ParseContinuousQuery 解析简单的降采样连续查询：
+//
+//	CREATE CONTINUOUS QUERY "cq" ON "db" [RESAMPLE [EVERY d] [FOR d]] BEGIN
+//	  SELECT agg("field") [AS "alias"], ... INTO [["db".]"rp".]"m" FROM [["db".]"rp".]"m"
+//	  GROUP BY time(d)[, "tag" | *]... [fill(null | none)]
+//	END
+//
+// 其他形式（WHERE 条件、嵌套函数、正则、反向引用、时间偏移等）返回说明原因的错误
+func ParseContinuousQuery(db, query string) (*common.Downsample, error) {
+	tokens, err := tokenizeInfluxQL(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &cqParser{tokens: tokens}
+	d, err := p.parse(db)
+	if err != nil {
+		return nil, err
+	}
+	if d.Every == 0 {
+		d.Every = d.Interval
+	}
+	if d.For == 0 {
+		d.For = d.Interval
+	}
+	return d, nil
+}
+
+type cqParser struct {
+	tokens []cqToken
+	pos    int
+}
+
+func (p *cqParser) parse(db string) (*common.Downsample, error) {
+	if err := p.keywords("CREATE", "CONTINUOUS", "QUERY"); err != nil {
+		return nil, err
+	}
+	if _, err := p.ident(); err != nil {
+		return nil, err
+	}
+	if err := p.keywords("ON"); err != nil {
+		return nil, err
+	}
+	on, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	d := &common.Downsample{SourceDB: on, TargetDB: on}
+	if on != db {
+		return nil, fmt.Errorf("连续查询属于数据库 %s 而不是 %s", on, db)
+	}
+
+	if p.keyword("RESAMPLE") {
+		for {
+			if p.keyword("EVERY") {
+				if d.Every, err = p.duration(); err != nil {
+					return nil, err
+				}
+			} else if p.keyword("FOR") {
+				if d.For, err = p.duration(); err != nil {
+					return nil, err
+				}
+			} else {
+				break
+			}
+		}
+	}
+	if err := p.keywords("BEGIN", "SELECT"); err != nil {
+		return nil, err
+	}
+
+	for {
+		f, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		d.Fields = append(d.Fields, f)
+		if !p.punct(",") {
+			break
+		}
+	}
+
+	if err := p.keywords("INTO"); err != nil {
+		return nil, err
+	}
+	if err := p.measurement(&d.TargetDB, &d.TargetRP, &d.TargetMeasurement); err != nil {
+		return nil, err
+	}
+	if err := p.keywords("FROM"); err != nil {
+		return nil, err
+	}
+	if err := p.measurement(&d.SourceDB, &d.SourceRP, &d.SourceMeasurement); err != nil {
+		return nil, err
+	}
+	if p.punct(",") {
+		return nil, fmt.Errorf("不支持从多个 measurement 查询")
+	}
+	if p.keyword("WHERE") {
+		return nil, fmt.Errorf("不支持 WHERE 条件")
+	}
+	if err := p.keywords("GROUP", "BY"); err != nil {
+		return nil, err
+	}
+	if err := p.groupBy(d); err != nil {
+		return nil, err
+	}
+	if p.keyword("fill") {
+		if err := p.fill(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.keywords("END"); err != nil {
+		return nil, err
+	}
+	p.punct(";")
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("不支持的子句: %s", t.text)
+	}
+	return d, nil
+}
+
+// 聚合字段 agg("field") [AS "alias"]
+func (p *cqParser) field() (common.DownsampleField, error) {
+	var f common.DownsampleField
+	fn, err := p.ident()
+	if err != nil {
+		return f, err
+	}
+	if !p.punct("(") {
+		return f, fmt.Errorf("字段 %s 没有使用聚合函数", fn)
+	}
+	f.Func = strings.ToLower(fn)
+	if !downsampleFuncs[f.Func] {
+		return f, fmt.Errorf("不支持的函数 %s()", fn)
+	}
+	arg := p.next()
+	switch {
+	case arg.kind == tokenPunct && arg.text == "*":
+		return f, fmt.Errorf("不支持 %s(*)", f.Func)
+	case arg.kind != tokenIdent:
+		return f, fmt.Errorf("%s() 的参数不是字段名: %s", f.Func, arg.text)
+	}
+	f.Field = arg.text
+	if p.punct("(") {
+		return f, fmt.Errorf("不支持嵌套函数 %s(%s())", f.Func, f.Field)
+	}
+	if !p.punct(")") {
+		return f, fmt.Errorf("%s() 只支持一个参数", f.Func)
+	}
+	f.As = f.Func
+	if p.keyword("AS") {
+		if f.As, err = p.ident(); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// [["db".]"rp".]"measurement"，"db".."measurement" 表示默认保留策略
+func (p *cqParser) measurement(db, rp, measurement *string) error {
+	var parts []string
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tokenIdent:
+			p.next()
+			parts = append(parts, t.text)
+		case t.kind == tokenPunct && t.text == ".":
+			// 省略的部分
+			parts = append(parts, "")
+		case t.kind == tokenPunct && t.text == ":":
+			return fmt.Errorf("不支持反向引用 :MEASUREMENT")
+		case t.kind == tokenPunct && t.text == "/":
+			return fmt.Errorf("不支持正则表达式")
+		default:
+			return fmt.Errorf("期望 measurement，实际为 %s", t.text)
+		}
+		if !p.punct(".") {
+			break
+		}
+	}
+	switch len(parts) {
+	case 1:
+		*measurement = parts[0]
+	case 2:
+		*rp, *measurement = parts[0], parts[1]
+	case 3:
+		if parts[0] != "" {
+			*db = parts[0]
+		}
+		*rp, *measurement = parts[1], parts[2]
+	default:
+		return fmt.Errorf("无法解析 measurement 名称")
+	}
+	if *measurement == "" {
+		return fmt.Errorf("measurement 名称为空")
+	}
+	return nil
+}
+
+// GROUP BY time(d)[, "tag" | *]...
+func (p *cqParser) groupBy(d *common.Downsample) error {
+	for {
+		switch t := p.peek(); {
+		case t.kind == tokenIdent && !t.quoted && strings.EqualFold(t.text, "time"):
+			p.next()
+			if !p.punct("(") {
+				return fmt.Errorf("期望 time(")
+			}
+			interval, err := p.duration()
+			if err != nil {
+				return err
+			}
+			if p.punct(",") {
+				return fmt.Errorf("不支持 GROUP BY time() 的时间偏移")
+			}
+			if !p.punct(")") {
+				return fmt.Errorf("期望 )")
+			}
+			d.Interval = interval
+		case t.kind == tokenPunct && t.text == "*":
+			p.next()
+			d.AllTags = true
+		case t.kind == tokenPunct && t.text == "/":
+			return fmt.Errorf("不支持按正则表达式分组")
+		case t.kind == tokenIdent:
+			p.next()
+			d.Tags = append(d.Tags, t.text)
+		default:
+			return fmt.Errorf("无法解析 GROUP BY: %s", t.text)
+		}
+		if !p.punct(",") {
+			break
+		}
+	}
+	if d.Interval <= 0 {
+		return fmt.Errorf("缺少 GROUP BY time()")
+	}
+	return nil
+}
+
+// fill(null) 和 fill(none) 与不写入空窗口等价，其他填充方式不支持
+func (p *cqParser) fill() error {
+	if !p.punct("(") {
+		return fmt.Errorf("期望 fill(")
+	}
+	t := p.next()
+	if t.kind != tokenIdent || t.quoted || (!strings.EqualFold(t.text, "null") && !strings.EqualFold(t.text, "none")) {
+		return fmt.Errorf("不支持 fill(%s)", t.text)
+	}
+	if !p.punct(")") {
+		return fmt.Errorf("期望 )")
+	}
+	return nil
+}
+
+func (p *cqParser) peek() cqToken {
+	if p.pos >= len(p.tokens) {
+		return cqToken{kind: tokenEOF, text: "结尾"}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *cqParser) next() cqToken {
+	t := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return t
+}
+
+// 下一个 token 是关键字 kw 时消耗它
+func (p *cqParser) keyword(kw string) bool {
+	if t := p.peek(); t.kind == tokenIdent && !t.quoted && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *cqParser) keywords(kws ...string) error {
+	for _, kw := range kws {
+		if !p.keyword(kw) {
+			return fmt.Errorf("期望 %s，实际为 %s", kw, p.peek().text)
+		}
+	}
+	return nil
+}
+
+func (p *cqParser) punct(s string) bool {
+	if t := p.peek(); t.kind == tokenPunct && t.text == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *cqParser) ident() (string, error) {
+	t := p.next()
+	if t.kind != tokenIdent {
+		return "", fmt.Errorf("期望标识符，实际为 %s", t.text)
+	}
+	return t.text, nil
+}
+
+func (p *cqParser) duration() (time.Duration, error) {
+	t := p.next()
+	if t.kind != tokenNumber {
+		return 0, fmt.Errorf("期望时间长度，实际为 %s", t.text)
+	}
+	return ParseInfluxDuration(t.text)
+}
+
+// ParseInfluxDuration 解析 InfluxQL 的时间长度，如 5m、1h30m、1d、2w
+func ParseInfluxDuration(s string) (time.Duration, error) {
+	units := []struct {
+		suffix string
+		unit   time.Duration
+	}{
+		// 较长的后缀在前，ms 不会被当作 m
+		{"ns", time.Nanosecond}, {"ms", time.Millisecond}, {"µ", time.Microsecond}, {"u", time.Microsecond},
+		{"s", time.Second}, {"m", time.Minute}, {"h", time.Hour}, {"d", 24 * time.Hour}, {"w", 7 * 24 * time.Hour},
+	}
+	var total time.Duration
+	rest := s
+	for rest != "" {
+		i := strings.IndexFunc(rest, func(r rune) bool { return !unicode.IsDigit(r) })
+		if i <= 0 {
+			return 0, fmt.Errorf("无效的时间长度: %s", s)
+		}
+		n, err := strconv.ParseInt(rest[:i], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("无效的时间长度: %s", s)
+		}
+		rest = rest[i:]
+		matched := false
+		for _, u := range units {
+			if strings.HasPrefix(rest, u.suffix) {
+				total += time.Duration(n) * u.unit
+				rest, matched = rest[len(u.suffix):], true
+				break
+			}
+		}
+		if !matched {
+			return 0, fmt.Errorf("无效的时间长度: %s", s)
+		}
+	}
+	if total <= 0 {
+		return 0, fmt.Errorf("无效的时间长度: %s", s)
+	}
+	return total, nil
+}
+
+type cqTokenKind int
+
+const (
+	tokenEOF cqTokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenPunct
+)
+
+type cqToken struct {
+	kind   cqTokenKind
+	text   string
+	quoted bool // 双引号标识符，不作为关键字
+}
+
+// 把 InfluxQL 切分为标识符、数字/时间长度、字符串和符号
+func tokenizeInfluxQL(s string) ([]cqToken, error) {
+	var tokens []cqToken
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"' || r == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != r; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				b.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("引号不匹配")
+			}
+			if r == '"' {
+				tokens = append(tokens, cqToken{kind: tokenIdent, text: b.String(), quoted: true})
+			} else {
+				tokens = append(tokens, cqToken{kind: tokenString, text: b.String()})
+			}
+			i = j + 1
+		case unicode.IsDigit(r):
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || unicode.IsLetter(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, cqToken{kind: tokenNumber, text: string(runes[i:j])})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, cqToken{kind: tokenIdent, text: string(runes[i:j])})
+			i = j
+		default:
+			tokens = append(tokens, cqToken{kind: tokenPunct, text: string(r)})
+			i++
+		}
+	}
+	return tokens, nil
+}
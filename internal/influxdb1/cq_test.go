@@ -0,0 +1,127 @@
+package influxdb1
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb1-client/models"
+	client "github.com/influxdata/influxdb1-client/v2"
+	"github.com/ygqygq2/influxdb-sync/internal/common"
+)
+
+func TestParseContinuousQuery(t *testing.T) {
+	testCases := []struct {
+		name     string
+		query    string
+		expected common.Downsample
+	}{
+		{
+			name:  "基本降采样",
+			query: `CREATE CONTINUOUS QUERY cq_30m ON telegraf BEGIN SELECT mean(value) INTO cpu_30m FROM cpu GROUP BY time(30m) END`,
+			expected: common.Downsample{
+				SourceDB: "telegraf", SourceMeasurement: "cpu", TargetDB: "telegraf", TargetMeasurement: "cpu_30m",
+				Fields:   []common.DownsampleField{{Func: "mean", Field: "value", As: "mean"}},
+				Interval: 30 * time.Minute, Every: 30 * time.Minute, For: 30 * time.Minute,
+			},
+		},
+		{
+			name: "带保留策略、别名、tag 和 RESAMPLE",
+			query: `CREATE CONTINUOUS QUERY "cq_1h" ON "telegraf" RESAMPLE EVERY 30m FOR 2h BEGIN ` +
+				`SELECT MAX("usage") AS "usage_max", min("usage") INTO "telegraf"."rp_1y"."cpu_1h" FROM "telegraf"."autogen"."cpu" ` +
+				`GROUP BY time(1h), "host", * fill(none) END;`,
+			expected: common.Downsample{
+				SourceDB: "telegraf", SourceRP: "autogen", SourceMeasurement: "cpu",
+				TargetDB: "telegraf", TargetRP: "rp_1y", TargetMeasurement: "cpu_1h",
+				Fields: []common.DownsampleField{
+					{Func: "max", Field: "usage", As: "usage_max"}, {Func: "min", Field: "usage", As: "min"},
+				},
+				Interval: time.Hour, Every: 30 * time.Minute, For: 2 * time.Hour, Tags: []string{"host"}, AllTags: true,
+			},
+		},
+		{
+			name:  "写入其他数据库的默认保留策略",
+			query: `CREATE CONTINUOUS QUERY cq ON db1 BEGIN SELECT sum(bytes) AS bytes INTO archive.."net_1d" FROM "rp_7d".net GROUP BY time(1d) END`,
+			expected: common.Downsample{
+				SourceDB: "db1", SourceRP: "rp_7d", SourceMeasurement: "net", TargetDB: "archive", TargetMeasurement: "net_1d",
+				Fields:   []common.DownsampleField{{Func: "sum", Field: "bytes", As: "bytes"}},
+				Interval: 24 * time.Hour, Every: 24 * time.Hour, For: 24 * time.Hour,
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := ParseContinuousQuery(tc.expected.SourceDB, tc.query)
+			if err != nil {
+				t.Fatalf("解析失败: %v", err)
+			}
+			if !reflect.DeepEqual(*d, tc.expected) {
+				t.Errorf("期望 %+v\n实际 %+v", tc.expected, *d)
+			}
+		})
+	}
+}
+
+func TestParseContinuousQueryUnsupported(t *testing.T) {
+	testCases := map[string]string{
+		"WHERE":     `CREATE CONTINUOUS QUERY cq ON db BEGIN SELECT mean(value) INTO m2 FROM m WHERE host = 'a' GROUP BY time(5m) END`,
+		"函数":        `CREATE CONTINUOUS QUERY cq ON db BEGIN SELECT percentile(value, 95) INTO m2 FROM m GROUP BY time(5m) END`,
+		"嵌套":        `CREATE CONTINUOUS QUERY cq ON db BEGIN SELECT count(distinct(value)) INTO m2 FROM m GROUP BY time(5m) END`,
+		"通配符":       `CREATE CONTINUOUS QUERY cq ON db BEGIN SELECT mean(*) INTO m2 FROM m GROUP BY time(5m) END`,
+		"反向引用":      `CREATE CONTINUOUS QUERY cq ON db BEGIN SELECT mean(value) INTO db.rp.:MEASUREMENT FROM /.*/ GROUP BY time(5m) END`,
+		"正则":        `CREATE CONTINUOUS QUERY cq ON db BEGIN SELECT mean(value) INTO m2 FROM /cpu.*/ GROUP BY time(5m) END`,
+		"时间偏移":      `CREATE CONTINUOUS QUERY cq ON db BEGIN SELECT mean(value) INTO m2 FROM m GROUP BY time(1h, 15m) END`,
+		"缺少 time()": `CREATE CONTINUOUS QUERY cq ON db BEGIN SELECT mean(value) INTO m2 FROM m GROUP BY host END`,
+		"fill":      `CREATE CONTINUOUS QUERY cq ON db BEGIN SELECT mean(value) INTO m2 FROM m GROUP BY time(5m) fill(0) END`,
+		"原始字段":      `CREATE CONTINUOUS QUERY cq ON db BEGIN SELECT value INTO m2 FROM m GROUP BY time(5m) END`,
+		"引号不匹配":     `CREATE CONTINUOUS QUERY "cq ON db`,
+	}
+	for name, query := range testCases {
+		if d, err := ParseContinuousQuery("db", query); err == nil {
+			t.Errorf("%s: 期望无法解析, 实际为 %+v", name, d)
+		}
+	}
+}
+
+func TestParseContinuousQueries(t *testing.T) {
+	res := &client.Response{Results: []client.Result{{
+		Series: []models.Row{
+			{Name: "_internal", Columns: []string{"name", "query"}},
+			{Name: "telegraf", Columns: []string{"name", "query"}, Values: [][]interface{}{
+				{"cq_ok", `CREATE CONTINUOUS QUERY cq_ok ON telegraf BEGIN SELECT mean(value) INTO cpu_5m FROM cpu GROUP BY time(5m) END`},
+				{"cq_where", `CREATE CONTINUOUS QUERY cq_where ON telegraf BEGIN SELECT mean(value) INTO cpu_5m FROM cpu WHERE host = 'a' GROUP BY time(5m) END`},
+			}},
+		},
+	}}}
+	cqs := ParseContinuousQueries(res, "telegraf")
+	if len(cqs) != 2 {
+		t.Fatalf("期望 2 个连续查询, 实际为 %+v", cqs)
+	}
+	if cqs[0].Name != "cq_ok" || cqs[0].Downsample == nil || cqs[0].Reason != "" {
+		t.Errorf("cq_ok 应能解析, 实际为 %+v", cqs[0])
+	}
+	if cqs[1].Downsample != nil || !strings.Contains(cqs[1].Reason, "WHERE") {
+		t.Errorf("cq_where 应说明不支持 WHERE, 实际为 %+v", cqs[1])
+	}
+	if cqs := ParseContinuousQueries(res, "other"); len(cqs) != 0 {
+		t.Errorf("其他数据库不应有连续查询, 实际为 %+v", cqs)
+	}
+}
+
+func TestParseInfluxDuration(t *testing.T) {
+	testCases := map[string]time.Duration{
+		"5m": 5 * time.Minute, "1h30m": 90 * time.Minute, "1d": 24 * time.Hour, "2w": 14 * 24 * time.Hour,
+		"500ms": 500 * time.Millisecond, "10u": 10 * time.Microsecond, "15s": 15 * time.Second,
+	}
+	for s, expected := range testCases {
+		if d, err := ParseInfluxDuration(s); err != nil || d != expected {
+			t.Errorf("ParseInfluxDuration(%q) = %v, %v, 期望 %v", s, d, err, expected)
+		}
+	}
+	for _, s := range []string{"", "m", "5x", "0s"} {
+		if _, err := ParseInfluxDuration(s); err == nil {
+			t.Errorf("ParseInfluxDuration(%q) 应返回错误", s)
+		}
+	}
+}
@@ -1,7 +1,13 @@
 package influxdb1
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb1-client/models"
+	client "github.com/influxdata/influxdb1-client/v2"
+	"github.com/ygqygq2/influxdb-sync/internal/common"
 )
 
 func TestFilterLogic(t *testing.T) {
@@ -150,3 +156,153 @@ func TestEmptyConfigHandling(t *testing.T) {
 		t.Error("空配置的密码应该为空字符串")
 	}
 }
+
+func TestBuildSelectQuery(t *testing.T) {
+	testCases := []struct {
+		name     string
+		cursor   common.Cursor
+		end      int64
+		expected string
+	}{
+		{"无时间限制", common.Cursor{}, 0, `SELECT * FROM "cpu" ORDER BY time ASC LIMIT 100`},
+		{"只有游标时间", common.Cursor{Time: 10}, 0, `SELECT * FROM "cpu" WHERE time >= 10 ORDER BY time ASC LIMIT 100`},
+		{"只有结束时间", common.Cursor{}, 20, `SELECT * FROM "cpu" WHERE time < 20 ORDER BY time ASC LIMIT 100`},
+		{"起止时间", common.Cursor{Time: 10}, 20, `SELECT * FROM "cpu" WHERE time >= 10 AND time < 20 ORDER BY time ASC LIMIT 100`},
+		{"同一时间戳内续读", common.Cursor{Time: 10, Offset: 3}, 20, `SELECT * FROM "cpu" WHERE time >= 10 AND time < 20 ORDER BY time ASC LIMIT 100 OFFSET 3`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := BuildSelectQuery(common.Query{Measurement: "cpu", Cursor: tc.cursor, End: tc.end, Limit: 100})
+			if result != tc.expected {
+				t.Errorf("BuildSelectQuery() = %q, 期望 %q", result, tc.expected)
+			}
+		})
+	}
+
+	// 指定保留策略
+	result := BuildSelectQuery(common.Query{RP: "rp_1y", Measurement: "cpu", Limit: 100})
+	if expected := `SELECT * FROM "rp_1y"."cpu" ORDER BY time ASC LIMIT 100`; result != expected {
+		t.Errorf("BuildSelectQuery() = %q, 期望 %q", result, expected)
+	}
+}
+
+func TestBoundaryQueryAndFirstRowTime(t *testing.T) {
+	if got := BoundaryQuery("", "cpu", false); got != `SELECT * FROM "cpu" ORDER BY time ASC LIMIT 1` {
+		t.Errorf("BoundaryQuery(asc) = %q", got)
+	}
+	if got := BoundaryQuery("", "cpu", true); got != `SELECT * FROM "cpu" ORDER BY time DESC LIMIT 1` {
+		t.Errorf("BoundaryQuery(desc) = %q", got)
+	}
+	if got := BoundaryQuery("rp_1y", "cpu", false); got != `SELECT * FROM "rp_1y"."cpu" ORDER BY time ASC LIMIT 1` {
+		t.Errorf("BoundaryQuery(rp) = %q", got)
+	}
+
+	res := &client.Response{Results: []client.Result{{
+		Series: []models.Row{{
+			Name:    "cpu",
+			Columns: []string{"time", "value"},
+			Values:  [][]interface{}{{json.Number("1700000000000000000"), json.Number("1")}},
+		}},
+	}}}
+	if ts, ok := FirstRowTime(res); !ok || ts != 1700000000000000000 {
+		t.Errorf("FirstRowTime() = %d, %v", ts, ok)
+	}
+	if _, ok := FirstRowTime(&client.Response{}); ok {
+		t.Error("没有数据时应返回 false")
+	}
+}
+
+func TestCardinalityQueryAndFirstCount(t *testing.T) {
+	if got := CardinalityQuery("cpu"); got != `SHOW SERIES CARDINALITY FROM "cpu"` {
+		t.Errorf("CardinalityQuery() = %q", got)
+	}
+
+	res := &client.Response{Results: []client.Result{{
+		Series: []models.Row{{
+			Columns: []string{"count"},
+			Values:  [][]interface{}{{json.Number("42")}},
+		}},
+	}}}
+	if n, ok := FirstCount(res); !ok || n != 42 {
+		t.Errorf("FirstCount() = %d, %v", n, ok)
+	}
+	if _, ok := FirstCount(&client.Response{}); ok {
+		t.Error("没有数据时应返回 false")
+	}
+}
+
+func TestCountQueryAndParseFieldCounts(t *testing.T) {
+	q := common.Query{RP: "rp_1y", Measurement: "cpu", Cursor: common.Cursor{Time: 100}, End: 200}
+	if got := CountQuery(q); got != `SELECT COUNT(*) FROM "rp_1y"."cpu" WHERE time >= 100 AND time < 200` {
+		t.Errorf("CountQuery() = %q", got)
+	}
+
+	res := &client.Response{Results: []client.Result{{
+		Series: []models.Row{{
+			Name:    "cpu",
+			Columns: []string{"time", "count_idle", "count_value"},
+			Values:  [][]interface{}{{json.Number("100"), json.Number("2"), json.Number("3")}},
+		}},
+	}}}
+	counts := ParseFieldCounts(res)
+	if len(counts) != 2 || counts["idle"] != 2 || counts["value"] != 3 {
+		t.Errorf("ParseFieldCounts() = %v", counts)
+	}
+	if counts := ParseFieldCounts(&client.Response{}); len(counts) != 0 {
+		t.Errorf("没有数据时应返回空结果, 实际为 %v", counts)
+	}
+}
+
+func TestParseRetentionPolicies(t *testing.T) {
+	res := &client.Response{Results: []client.Result{{
+		Series: []models.Row{{
+			Columns: []string{"name", "duration", "shardGroupDuration", "replicaN", "default"},
+			Values: [][]interface{}{
+				{"autogen", "0s", "168h0m0s", json.Number("1"), false},
+				{"one_week", "168h0m0s", "24h0m0s", json.Number("1"), true},
+			},
+		}},
+	}}}
+	policies := ParseRetentionPolicies(res)
+	if len(policies) != 2 {
+		t.Fatalf("期望 2 个保留策略, 实际为 %+v", policies)
+	}
+	if rp := policies[0]; rp.Name != "autogen" || rp.Duration != 0 || rp.Default {
+		t.Errorf("autogen 应永久保留且不是默认, 实际为 %+v", rp)
+	}
+	if rp := policies[1]; rp.Name != "one_week" || rp.Duration != 168*time.Hour || !rp.Default {
+		t.Errorf("one_week 应为默认保留策略, 实际为 %+v", rp)
+	}
+	if policies := ParseRetentionPolicies(&client.Response{}); len(policies) != 0 {
+		t.Errorf("没有保留策略时应返回空, 实际为 %+v", policies)
+	}
+}
+
+func TestSplitDBRP(t *testing.T) {
+	if db, rp := SplitDBRP("telegraf/rp_1y"); db != "telegraf" || rp != "rp_1y" {
+		t.Errorf("SplitDBRP() = %q, %q", db, rp)
+	}
+	if db, rp := SplitDBRP("telegraf"); db != "telegraf" || rp != "" {
+		t.Errorf("没有保留策略时应为默认保留策略, 实际为 %q, %q", db, rp)
+	}
+	if got := CreateRetentionPolicyQuery("telegraf", "rp_1y", 365*24*time.Hour); got != `CREATE RETENTION POLICY "rp_1y" ON "telegraf" DURATION 365d REPLICATION 1` {
+		t.Errorf("CreateRetentionPolicyQuery() = %q", got)
+	}
+}
+
+func TestCreateDatabaseQuery(t *testing.T) {
+	tests := []struct {
+		rp   common.RetentionPolicy
+		want string
+	}{
+		{common.RetentionPolicy{}, `CREATE DATABASE "bak_db" WITH DURATION INF`},
+		{common.RetentionPolicy{Name: "one_week", Duration: 168 * time.Hour}, `CREATE DATABASE "bak_db" WITH DURATION 7d NAME "one_week"`},
+		{common.RetentionPolicy{Duration: 90 * time.Minute}, `CREATE DATABASE "bak_db" WITH DURATION 90m`},
+	}
+	for _, tt := range tests {
+		if got := CreateDatabaseQuery("bak_db", tt.rp); got != tt.want {
+			t.Errorf("CreateDatabaseQuery(%+v) = %q, 期望 %q", tt.rp, got, tt.want)
+		}
+	}
+}
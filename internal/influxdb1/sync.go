@@ -32,26 +32,56 @@ func Sync1x1x(ctx context.Context, cfg common.SyncConfig) error {
 func Sync(ctx context.Context, cfg SyncConfig) error {
 	// 转换为新的配置格式
 	newCfg := common.SyncConfig{
-		SourceAddr:      cfg.SourceAddr,
-		SourceUser:      cfg.SourceUser,
-		SourcePass:      cfg.SourcePass,
-		SourceDB:        cfg.SourceDB,
-		SourceDBExclude: cfg.SourceDBExclude,
-		TargetAddr:      cfg.TargetAddr,
-		TargetUser:      cfg.TargetUser,
-		TargetPass:      cfg.TargetPass,
-		TargetDB:        cfg.TargetDB,
-		TargetDBPrefix:  cfg.TargetDBPrefix,
-		TargetDBSuffix:  cfg.TargetDBSuffix,
-		BatchSize:       cfg.BatchSize,
-		Start:           cfg.Start,
-		End:             cfg.End,
-		ResumeFile:      cfg.ResumeFile,
-		Parallel:        cfg.Parallel,
-		RetryCount:      cfg.RetryCount,
-		RetryInterval:   cfg.RetryInterval,
-		RateLimit:       cfg.RateLimit,
-		LogLevel:        cfg.LogLevel,
+		SourceAddr:               cfg.SourceAddr,
+		SourceUser:               cfg.SourceUser,
+		SourcePass:               cfg.SourcePass,
+		SourceDB:                 cfg.SourceDB,
+		SourceDBExclude:          cfg.SourceDBExclude,
+		TargetAddr:               cfg.TargetAddr,
+		TargetUser:               cfg.TargetUser,
+		TargetPass:               cfg.TargetPass,
+		TargetDB:                 cfg.TargetDB,
+		TargetDBPrefix:           cfg.TargetDBPrefix,
+		TargetDBSuffix:           cfg.TargetDBSuffix,
+		BatchSize:                cfg.BatchSize,
+		Start:                    cfg.Start,
+		End:                      cfg.End,
+		ResumeFile:               cfg.ResumeFile,
+		CheckpointType:           cfg.CheckpointType,
+		CheckpointDB:             cfg.CheckpointDB,
+		Parallel:                 cfg.Parallel,
+		RetryCount:               cfg.RetryCount,
+		RetryInterval:            cfg.RetryInterval,
+		RateLimit:                cfg.RateLimit,
+		Follow:                   cfg.Follow,
+		FollowInterval:           cfg.FollowInterval,
+		FollowLookback:           cfg.FollowLookback,
+		QueryTimeout:             cfg.QueryTimeout,
+		WriteTimeout:             cfg.WriteTimeout,
+		MaxInflightBytes:         cfg.MaxInflightBytes,
+		ShardWindow:              cfg.ShardWindow,
+		AdaptiveBatch:            cfg.AdaptiveBatch,
+		MinBatchSize:             cfg.MinBatchSize,
+		MaxBatchSize:             cfg.MaxBatchSize,
+		TargetWriteLatency:       cfg.TargetWriteLatency,
+		TargetBatchBytes:         cfg.TargetBatchBytes,
+		SourcePointsPerSec:       cfg.SourcePointsPerSec,
+		SourceBytesPerSec:        cfg.SourceBytesPerSec,
+		TargetPointsPerSec:       cfg.TargetPointsPerSec,
+		TargetBytesPerSec:        cfg.TargetBytesPerSec,
+		DeadLetterDir:            cfg.DeadLetterDir,
+		OnError:                  cfg.OnError,
+		MaxFailures:              cfg.MaxFailures,
+		Plan:                     cfg.Plan,
+		ReportFile:               cfg.ReportFile,
+		Version:                  cfg.Version,
+		CreateMissing:            cfg.CreateMissing,
+		CreateRetention:          cfg.CreateRetention,
+		AllRetentionPolicies:     cfg.AllRetentionPolicies,
+		RetentionPolicyMap:       cfg.RetentionPolicyMap,
+		CreateDBRP:               cfg.CreateDBRP,
+		MigrateContinuousQueries: cfg.MigrateContinuousQueries,
+		LogLevel:                 cfg.LogLevel,
 	}
 
 	return Sync1x1x(ctx, newCfg)
@@ -2,11 +2,19 @@ package influxdb2
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/domain"
+	ihttp "github.com/influxdata/influxdb-client-go/v2/api/http"
 	"github.com/ygqygq2/influxdb-sync/internal/common"
+	"github.com/ygqygq2/influxdb-sync/internal/logx"
 )
 
 // 通用适配器，可同时作为数据源和数据目标
@@ -32,7 +40,7 @@ func (a *Adapter) Close() error {
 	return nil
 }
 
-func (a *Adapter) GetDatabases() ([]string, error) {
+func (a *Adapter) GetDatabases(ctx context.Context) ([]string, error) {
 	// InfluxDB 2.x 使用 bucket，这里返回指定的 bucket
 	if a.Bucket != "" {
 		return []string{a.Bucket}, nil
@@ -40,9 +48,9 @@ func (a *Adapter) GetDatabases() ([]string, error) {
 
 	// 如果没有指定 bucket，查询所有 buckets
 	bucketsAPI := a.client.BucketsAPI()
-	buckets, err := bucketsAPI.GetBuckets(context.Background())
+	buckets, err := bucketsAPI.GetBuckets(ctx)
 	if err != nil {
-		return nil, err
+		return nil, ClassifyError(err)
 	}
 
 	var bucketNames []string
@@ -53,7 +61,7 @@ func (a *Adapter) GetDatabases() ([]string, error) {
 	return bucketNames, nil
 }
 
-func (a *Adapter) GetMeasurements(bucket string) ([]string, error) {
+func (a *Adapter) GetMeasurements(ctx context.Context, bucket string) ([]string, error) {
 	queryAPI := a.client.QueryAPI(a.Org)
 
 	// 查询所有 measurement
@@ -62,9 +70,9 @@ func (a *Adapter) GetMeasurements(bucket string) ([]string, error) {
 		schema.measurements(bucket: "%s")
 	`, bucket)
 
-	result, err := queryAPI.Query(context.Background(), query)
+	result, err := queryAPI.Query(ctx, query)
 	if err != nil {
-		return nil, err
+		return nil, ClassifyError(err)
 	}
 
 	var measurements []string
@@ -77,24 +85,19 @@ func (a *Adapter) GetMeasurements(bucket string) ([]string, error) {
 	}
 
 	if result.Err() != nil {
-		return nil, result.Err()
+		return nil, ClassifyError(result.Err())
 	}
 
 	return measurements, nil
 }
 
-func (a *Adapter) GetTagKeys(bucket, measurement string) (map[string]bool, error) {
+func (a *Adapter) GetTagKeys(ctx context.Context, bucket, measurement string) (map[string]bool, error) {
 	queryAPI := a.client.QueryAPI(a.Org)
 
 	// 查询指定 measurement 的所有 tag keys
-	query := fmt.Sprintf(`
-		import "influxdata/influxdb/schema"
-		schema.tagKeys(bucket: "%s", predicate: (r) => r._measurement == "%s")
-	`, bucket, measurement)
-
-	result, err := queryAPI.Query(context.Background(), query)
+	result, err := queryAPI.Query(ctx, TagKeysQuery(bucket, measurement))
 	if err != nil {
-		return nil, err
+		return nil, ClassifyError(err)
 	}
 
 	tagKeys := make(map[string]bool)
@@ -107,101 +110,514 @@ func (a *Adapter) GetTagKeys(bucket, measurement string) (map[string]bool, error
 	}
 
 	if result.Err() != nil {
-		return nil, result.Err()
+		return nil, ClassifyError(result.Err())
 	}
 
 	return tagKeys, nil
 }
 
-func (a *Adapter) QueryData(bucket, measurement string, startTime int64, batchSize int) ([]common.DataPoint, int64, error) {
+// TagKeysQuery 查询 measurement 全部 tag 名的 Flux。schema.tagKeys 默认只查最近 30 天，
+// 需要显式指定 start，否则更早的 series 的 tag 会被当作字段
+func TagKeysQuery(bucket, measurement string) string {
+	return fmt.Sprintf(`
+		import "influxdata/influxdb/schema"
+		schema.tagKeys(bucket: "%s", predicate: (r) => r._measurement == "%s", start: -100y)
+	`, bucket, measurement)
+}
+
+// GetFieldKeys 用 schema.fieldKeys 获取字段名，再对每个字段取一个值推断类型
+func (a *Adapter) GetFieldKeys(ctx context.Context, bucket, measurement string) (map[string]common.FieldType, error) {
 	queryAPI := a.client.QueryAPI(a.Org)
+	result, err := queryAPI.Query(ctx, FieldKeysQuery(bucket, measurement))
+	if err != nil {
+		return nil, ClassifyError(err)
+	}
+	names, err := ParseFieldKeys(result)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return map[string]common.FieldType{}, nil
+	}
+	result, err = queryAPI.Query(ctx, FieldTypesQuery(bucket, measurement))
+	if err != nil {
+		return nil, ClassifyError(err)
+	}
+	return ParseFieldTypes(result, names)
+}
+
+// FieldKeysQuery 查询 measurement 全部字段名的 Flux
+func FieldKeysQuery(bucket, measurement string) string {
+	return fmt.Sprintf(`
+		import "influxdata/influxdb/schema"
+		schema.fieldKeys(bucket: "%s", predicate: (r) => r._measurement == "%s", start: -100y)
+	`, bucket, measurement)
+}
+
+// FieldTypesQuery 每个字段取一个值的 Flux，first() 先按序列下推，再按字段合并
+func FieldTypesQuery(bucket, measurement string) string {
+	return fmt.Sprintf(`from(bucket: "%s")
+  |> range(start: -100y)
+  |> filter(fn: (r) => r._measurement == "%s")
+  |> first()
+  |> keep(columns: ["_field", "_value"])
+  |> group(columns: ["_field"])
+  |> first()`, bucket, measurement)
+}
 
-	// 构建查询
-	var startFilter string
-	if startTime > 0 {
-		startTimeRFC := time.Unix(0, startTime).UTC().Format(time.RFC3339Nano)
-		startFilter = fmt.Sprintf(`|> filter(fn: (r) => r._time > time(v: "%s"))`, startTimeRFC)
-	} else {
-		startFilter = ""
+// ParseFieldKeys 读取 schema.fieldKeys 返回的字段名
+func ParseFieldKeys(result *api.QueryTableResult) ([]string, error) {
+	var names []string
+	for result.Next() {
+		if name, ok := result.Record().Value().(string); ok {
+			names = append(names, name)
+		}
 	}
+	if result.Err() != nil {
+		return nil, ClassifyError(result.Err())
+	}
+	return names, nil
+}
 
-	query := fmt.Sprintf(`
+// ParseFieldTypes 根据 FieldTypesQuery 返回值的 Go 类型确定字段类型，只保留 names 中的字段
+func ParseFieldTypes(result *api.QueryTableResult, names []string) (map[string]common.FieldType, error) {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+	fields := make(map[string]common.FieldType, len(names))
+	for result.Next() {
+		record := result.Record()
+		if !wanted[record.Field()] {
+			continue
+		}
+		if t, ok := common.FieldTypeOf(record.Value()); ok {
+			if _, exists := fields[record.Field()]; !exists {
+				fields[record.Field()] = t
+			}
+		}
+	}
+	if result.Err() != nil {
+		return nil, ClassifyError(result.Err())
+	}
+	return fields, nil
+}
+
+func (a *Adapter) QueryData(ctx context.Context, q common.Query) ([]common.DataPoint, common.Cursor, error) {
+	// pivot 之后 tag 和 field 都是普通列，需要标签列表来区分，同时用于同一时间戳内排序
+	tagKeys, err := a.GetTagKeys(ctx, q.DB, q.Measurement)
+	if err != nil {
+		return nil, q.Cursor, err
+	}
+
+	result, err := a.client.QueryAPI(a.Org).Query(ctx, BuildFluxQuery(q, tagKeys))
+	if err != nil {
+		return nil, q.Cursor, ClassifyError(err)
+	}
+
+	points, err := ParsePivotedRows(result, q.Measurement, tagKeys)
+	if err != nil {
+		return nil, q.Cursor, ClassifyError(err)
+	}
+	return points, common.NextCursor(q.Cursor, points), nil
+}
+
+// TimeRange 返回 measurement 最早和最晚一个点的时间戳，没有数据时返回 0。bucket 没有保留策略之分，忽略 rp
+func (a *Adapter) TimeRange(ctx context.Context, bucket, rp, measurement string) (int64, int64, error) {
+	var bounds [2]int64
+	for i, last := range []bool{false, true} {
+		result, err := a.client.QueryAPI(a.Org).Query(ctx, BoundaryQuery(bucket, measurement, last))
+		if err != nil {
+			return 0, 0, ClassifyError(err)
+		}
+		ts, ok, err := ParseBoundary(result)
+		if err != nil || !ok {
+			return 0, 0, err
+		}
+		bounds[i] = ts
+	}
+	return bounds[0], bounds[1], nil
+}
+
+// BoundaryQuery 构建查询 measurement 最早（last 为 true 时最晚）时间戳的 Flux
+func BoundaryQuery(bucket, measurement string, last bool) string {
+	fn := "min"
+	if last {
+		fn = "max"
+	}
+	return fmt.Sprintf(`
 		from(bucket: "%s")
 		|> range(start: -100y)
 		|> filter(fn: (r) => r._measurement == "%s")
-		%s
-		|> sort(columns: ["_time"])
-		|> limit(n: %d)
-	`, bucket, measurement, startFilter, batchSize)
+		|> keep(columns: ["_time"])
+		|> group()
+		|> %s(column: "_time")
+	`, bucket, measurement, fn)
+}
+
+// ParseBoundary 读取 BoundaryQuery 结果中的时间戳
+func ParseBoundary(result *api.QueryTableResult) (int64, bool, error) {
+	var ts int64
+	found := false
+	for result.Next() {
+		if !found {
+			ts = result.Record().Time().UnixNano()
+			found = true
+		}
+	}
+	if result.Err() != nil {
+		return 0, false, result.Err()
+	}
+	return ts, found, nil
+}
 
-	result, err := queryAPI.Query(context.Background(), query)
+// CountFields 统计时间范围内每个字段的非空值个数，用于校验时比较点数
+func (a *Adapter) CountFields(ctx context.Context, q common.Query) (map[string]int64, error) {
+	result, err := a.client.QueryAPI(a.Org).Query(ctx, CountQuery(q))
 	if err != nil {
-		return nil, 0, err
+		return nil, ClassifyError(err)
 	}
+	counts, err := ParseFieldCounts(result)
+	if err != nil {
+		return nil, ClassifyError(err)
+	}
+	return counts, nil
+}
 
-	var points []common.DataPoint
-	var maxTime int64 = startTime
-	pointsMap := make(map[string]*common.DataPoint) // 按时间戳分组
+// CountQuery 构建统计时间范围内每个字段非空值个数的 Flux
+func CountQuery(q common.Query) string {
+	return fmt.Sprintf(`
+		from(bucket: "%s")
+		|> range(%s)
+		|> filter(fn: (r) => r._measurement == "%s")
+		|> group(columns: ["_field"])
+		|> count()
+	`, q.DB, rangeArgs(q), q.Measurement)
+}
 
+// ParseFieldCounts 读取 CountQuery 结果中每个字段的个数
+func ParseFieldCounts(result *api.QueryTableResult) (map[string]int64, error) {
+	counts := make(map[string]int64)
 	for result.Next() {
 		record := result.Record()
-		timeKey := record.Time().Format(time.RFC3339Nano)
+		if n, ok := record.Value().(int64); ok {
+			counts[record.Field()] += n
+		}
+	}
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+	return counts, nil
+}
 
-		// 获取或创建数据点
-		if _, exists := pointsMap[timeKey]; !exists {
-			pointsMap[timeKey] = &common.DataPoint{
-				Measurement: measurement,
-				Tags:        make(map[string]string),
-				Fields:      make(map[string]interface{}),
-				Time:        record.Time(),
+// EstimateSize 以 series 数预估 measurement 的大小，用于调度排序
+func (a *Adapter) EstimateSize(ctx context.Context, bucket, rp, measurement string) (int64, error) {
+	result, err := a.client.QueryAPI(a.Org).Query(ctx, CardinalityQuery(bucket, measurement))
+	if err != nil {
+		return 0, ClassifyError(err)
+	}
+	return ParseCount(result)
+}
+
+// CardinalityQuery 构建查询 measurement series 数的 Flux
+func CardinalityQuery(bucket, measurement string) string {
+	return fmt.Sprintf(`
+		import "influxdata/influxdb"
+		influxdb.cardinality(bucket: "%s", start: -100y, predicate: (r) => r._measurement == "%s")
+	`, bucket, measurement)
+}
+
+// ParseCount 读取结果中第一条记录的整数值
+func ParseCount(result *api.QueryTableResult) (int64, error) {
+	var count int64
+	found := false
+	for result.Next() {
+		if !found {
+			if n, ok := result.Record().Value().(int64); ok {
+				count = n
+				found = true
 			}
 		}
+	}
+	return count, result.Err()
+}
 
-		point := pointsMap[timeKey]
+// BuildFluxQuery 构建分页查询：按 series 把字段 pivot 成一行一个点，
+// 再按时间和全部 tag 排序，保证同一时间戳内顺序稳定，从而可以用 offset 续读
+func BuildFluxQuery(q common.Query, tagKeys map[string]bool) string {
+	sortColumns := []string{`"_time"`}
+	for _, k := range sortedKeys(tagKeys) {
+		if k == "" || k[0] == '_' || k == "time" {
+			continue
+		}
+		sortColumns = append(sortColumns, strconv.Quote(k))
+	}
+
+	return fmt.Sprintf(`
+		from(bucket: "%s")
+		|> range(%s)
+		|> filter(fn: (r) => r._measurement == "%s")
+		|> pivot(rowKey: ["_time"], columnKey: ["_field"], valueColumn: "_value")
+		|> group()
+		|> sort(columns: [%s])
+		|> limit(n: %d, offset: %d)
+	`, q.DB, rangeArgs(q), q.Measurement, strings.Join(sortColumns, ", "), q.Limit, q.Cursor.Offset)
+}
+
+// range() 的参数：从游标时间（含）到 End（不含），未指定起点时从 100 年前开始
+func rangeArgs(q common.Query) string {
+	start := "-100y"
+	if q.Cursor.Time != 0 {
+		start = fmt.Sprintf(`time(v: "%s")`, time.Unix(0, q.Cursor.Time).UTC().Format(time.RFC3339Nano))
+	}
+	args := "start: " + start
+	if q.End > 0 {
+		args += fmt.Sprintf(`, stop: time(v: "%s")`, time.Unix(0, q.End).UTC().Format(time.RFC3339Nano))
+	}
+	return args
+}
+
+// ParsePivotedRows 解析 pivot 之后的查询结果，每行一个数据点，保持返回顺序
+func ParsePivotedRows(result *api.QueryTableResult, measurement string, tagKeys map[string]bool) ([]common.DataPoint, error) {
+	var points []common.DataPoint
+	for result.Next() {
+		record := result.Record()
+		point := common.DataPoint{
+			Measurement: measurement,
+			Tags:        make(map[string]string),
+			Fields:      make(map[string]interface{}),
+			Time:        record.Time(),
+		}
 
-		// 复制所有 tags
 		for key, value := range record.Values() {
-			if key[0] != '_' && key != "result" && key != "table" {
-				// 这是 tag
+			if value == nil || key == "" || key[0] == '_' || key == "result" || key == "table" {
+				continue
+			}
+			if tagKeys[key] {
 				if strVal, ok := value.(string); ok {
 					point.Tags[key] = strVal
 				}
+			} else {
+				point.Fields[key] = value
 			}
 		}
 
-		// 设置 field
-		if record.Field() != "" && record.Value() != nil {
-			point.Fields[record.Field()] = record.Value()
-		}
-
-		// 更新最大时间
-		if record.Time().UnixNano() > maxTime {
-			maxTime = record.Time().UnixNano()
-		}
+		points = append(points, point)
 	}
 
 	if result.Err() != nil {
-		return nil, 0, result.Err()
+		return nil, result.Err()
 	}
+	return points, nil
+}
 
-	// 转换为切片
-	for _, point := range pointsMap {
-		points = append(points, *point)
+// ClassifyError 把 2.x 客户端返回的错误转换为带分类的 common.AdapterError，
+// 服务端响应错误按状态码和 Retry-After 分类，其余按错误内容分类
+func ClassifyError(err error) error {
+	var herr *ihttp.Error
+	if errors.As(err, &herr) && herr.StatusCode != 0 {
+		return common.NewHTTPError(herr.StatusCode, time.Duration(herr.RetryAfter)*time.Second, err)
 	}
-
-	return points, maxTime, nil
+	return common.ClassifyError(err)
 }
 
 // 数据目标接口实现
-func (a *Adapter) WritePoints(bucket string, points []common.DataPoint) error {
+func (a *Adapter) WritePoints(ctx context.Context, bucket string, points []common.DataPoint) error {
 	writeAPI := a.client.WriteAPIBlocking(a.Org, bucket)
 
 	for _, point := range points {
 		p := influxdb2.NewPoint(point.Measurement, point.Tags, point.Fields, point.Time)
-		if err := writeAPI.WritePoint(context.Background(), p); err != nil {
-			return err
+		if err := writeAPI.WritePoint(ctx, p); err != nil {
+			return ClassifyError(err)
 		}
 	}
 
 	return nil
 }
+
+// DefaultRetention 返回 bucket 的保留时长，用于在目标端创建相同保留时长的库
+func (a *Adapter) DefaultRetention(ctx context.Context, bucket string) (common.RetentionPolicy, error) {
+	b, err := a.client.BucketsAPI().FindBucketByName(ctx, bucket)
+	if err != nil {
+		return common.RetentionPolicy{}, ClassifyError(err)
+	}
+	return BucketRetention(b.RetentionRules), nil
+}
+
+// EnsureDatabase bucket 不存在时在配置的 org 下创建，保留时长取 rp
+func (a *Adapter) EnsureDatabase(ctx context.Context, bucket string, rp common.RetentionPolicy) error {
+	bucketsAPI := a.client.BucketsAPI()
+	_, err := bucketsAPI.FindBucketByName(ctx, bucket)
+	if err == nil {
+		return nil
+	}
+	// 服务端错误直接返回，否则说明 bucket 不存在
+	var herr *ihttp.Error
+	if errors.As(err, &herr) {
+		return ClassifyError(err)
+	}
+
+	org, err := a.client.OrganizationsAPI().FindOrganizationByName(ctx, a.Org)
+	if err != nil {
+		return ClassifyError(err)
+	}
+	logx.Info("创建目标 bucket", bucket)
+	_, err = bucketsAPI.CreateBucket(ctx, &domain.Bucket{
+		Name:           bucket,
+		OrgID:          org.Id,
+		RetentionRules: RetentionRules(rp),
+	})
+	if err != nil {
+		return ClassifyError(err)
+	}
+	return nil
+}
+
+// EnsureDBRP 在配置的 org 下创建 InfluxQL 查询使用的 DBRP 映射。已存在相同 db/rp 的映射时
+// 不做修改，自动生成的虚拟映射不算已存在
+func (a *Adapter) EnsureDBRP(ctx context.Context, m common.DBRPMapping) (bool, error) {
+	client := a.client.APIClient()
+	existing, err := client.GetDBRPs(ctx, &domain.GetDBRPsParams{Org: &a.Org, Db: &m.Database, Rp: &m.RetentionPolicy})
+	if err != nil {
+		return false, ClassifyError(err)
+	}
+	bucket, err := a.client.BucketsAPI().FindBucketByName(ctx, m.Bucket)
+	if err != nil {
+		return false, ClassifyError(err)
+	}
+	if existing.Content != nil {
+		for _, d := range *existing.Content {
+			if d.Virtual != nil && *d.Virtual {
+				continue
+			}
+			if d.BucketID != *bucket.Id {
+				logx.Warn(fmt.Sprintf("DBRP 映射 %s/%s 已指向其他 bucket（%s），未修改", m.Database, m.RetentionPolicy, d.BucketID))
+			}
+			return false, nil
+		}
+	}
+
+	_, err = client.PostDBRP(ctx, &domain.PostDBRPAllParams{Body: domain.PostDBRPJSONRequestBody{
+		BucketID:        *bucket.Id,
+		Database:        m.Database,
+		RetentionPolicy: m.RetentionPolicy,
+		Default:         &m.Default,
+		Org:             &a.Org,
+	}})
+	if err != nil {
+		return false, ClassifyError(err)
+	}
+	return true, nil
+}
+
+// BucketRetention 从 bucket 的保留规则中取出过期时长，没有规则时为永久保留
+func BucketRetention(rules domain.RetentionRules) common.RetentionPolicy {
+	for _, r := range rules {
+		if r.Type == nil || *r.Type == domain.RetentionRuleTypeExpire {
+			return common.RetentionPolicy{Duration: time.Duration(r.EverySeconds) * time.Second}
+		}
+	}
+	return common.RetentionPolicy{}
+}
+
+// RetentionRules 把保留策略转换为 bucket 的保留规则，EverySeconds 为 0 表示永久保留
+func RetentionRules(rp common.RetentionPolicy) domain.RetentionRules {
+	expire := domain.RetentionRuleTypeExpire
+	// 保留时长按秒计算，不足 1 秒的部分向上取整
+	seconds := int64((rp.Duration + time.Second - 1) / time.Second)
+	return domain.RetentionRules{{EverySeconds: max(seconds, 0), Type: &expire}}
+}
+
+// QueryLatest 查询匹配 tags 的每个 series 的最新一个点，用于在目标库中读取断点
+func (a *Adapter) QueryLatest(ctx context.Context, bucket, measurement string, tags map[string]string) ([]common.DataPoint, error) {
+	result, err := a.client.QueryAPI(a.Org).Query(ctx, LatestQuery(bucket, measurement, tags))
+	if err != nil {
+		return nil, err
+	}
+	return CollectLatest(result)
+}
+
+// LatestQuery 构建查询每个 series 最新值的 Flux
+func LatestQuery(bucket, measurement string, tags map[string]string) string {
+	return fmt.Sprintf(`
+		from(bucket: "%s")
+		|> range(start: -100y)
+		|> filter(fn: (r) => r._measurement == "%s"%s)
+		|> last()
+	`, bucket, measurement, FluxTagFilter(tags))
+}
+
+// CollectLatest 将 last() 的结果按 series 合并为数据点
+func CollectLatest(result *api.QueryTableResult) ([]common.DataPoint, error) {
+	var points []*common.DataPoint
+	bySeries := make(map[string]*common.DataPoint)
+	for result.Next() {
+		record := result.Record()
+		tags := make(map[string]string)
+		for key, value := range record.Values() {
+			if key[0] != '_' && key != "result" && key != "table" {
+				if strVal, ok := value.(string); ok {
+					tags[key] = strVal
+				}
+			}
+		}
+
+		seriesKey := seriesKeyOf(record.Measurement(), tags)
+		point, exists := bySeries[seriesKey]
+		if !exists {
+			point = &common.DataPoint{
+				Measurement: record.Measurement(),
+				Tags:        tags,
+				Fields:      make(map[string]interface{}),
+				Time:        record.Time(),
+			}
+			bySeries[seriesKey] = point
+			points = append(points, point)
+		}
+		if record.Time().After(point.Time) {
+			point.Time = record.Time()
+		}
+		point.Fields[record.Field()] = record.Value()
+	}
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	latest := make([]common.DataPoint, 0, len(points))
+	for _, p := range points {
+		latest = append(latest, *p)
+	}
+	return latest, nil
+}
+
+// FluxTagFilter 构建 Flux tag 等值过滤条件，结果可直接拼接在 filter 条件之后
+func FluxTagFilter(tags map[string]string) string {
+	var b strings.Builder
+	for _, k := range sortedKeys(tags) {
+		fmt.Fprintf(&b, ` and r[%s] == %s`, strconv.Quote(k), strconv.Quote(tags[k]))
+	}
+	return b.String()
+}
+
+// series 键：measurement 加排序后的 tags
+func seriesKeyOf(measurement string, tags map[string]string) string {
+	var b strings.Builder
+	b.WriteString(measurement)
+	for _, k := range sortedKeys(tags) {
+		b.WriteString(",")
+		b.WriteString(k)
+		b.WriteString("=")
+		b.WriteString(tags[k])
+	}
+	return b.String()
+}
+
+// 返回排序后的键列表
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,8 +1,10 @@
 package influxdb2
 
 import (
+	"context"
 	"testing"
 
+	"github.com/ygqygq2/influxdb-sync/internal/common"
 	"github.com/ygqygq2/influxdb-sync/internal/testutil"
 )
 
@@ -203,7 +205,7 @@ func TestAdapter_GetDatabases(t *testing.T) {
 	}
 	defer adapter.Close()
 	
-	buckets, err := adapter.GetDatabases()
+	buckets, err := adapter.GetDatabases(context.Background())
 	if err != nil {
 		t.Logf("GetDatabases 错误: %v", err)
 	}
@@ -228,7 +230,7 @@ func TestAdapter_GetMeasurements(t *testing.T) {
 	}
 	defer adapter.Close()
 	
-	measurements, err := adapter.GetMeasurements("test-bucket")
+	measurements, err := adapter.GetMeasurements(context.Background(), "test-bucket")
 	if err != nil {
 		t.Logf("GetMeasurements 错误: %v", err)
 	}
@@ -294,7 +296,7 @@ func TestAdapter_GetMeasurements_Integration(t *testing.T) {
 	}
 	defer adapter.Close()
 
-	measurements, err := adapter.GetMeasurements("testbucket")
+	measurements, err := adapter.GetMeasurements(context.Background(), "testbucket")
 	if err != nil {
 		t.Fatalf("GetMeasurements 失败: %v", err)
 	}
@@ -322,13 +324,13 @@ func TestAdapter_GetTagKeys_Integration(t *testing.T) {
 	defer adapter.Close()
 
 	// 先获取 measurements
-	measurements, err := adapter.GetMeasurements("testbucket")
+	measurements, err := adapter.GetMeasurements(context.Background(), "testbucket")
 	if err != nil || len(measurements) == 0 {
 		t.Skip("没有可用的 measurements 进行测试")
 	}
 
 	// 测试获取第一个 measurement 的 tag keys
-	tagKeys, err := adapter.GetTagKeys("testbucket", measurements[0])
+	tagKeys, err := adapter.GetTagKeys(context.Background(), "testbucket", measurements[0])
 	if err != nil {
 		t.Fatalf("GetTagKeys 失败: %v", err)
 	}
@@ -356,18 +358,18 @@ func TestAdapter_QueryData_Integration(t *testing.T) {
 	defer adapter.Close()
 
 	// 先获取 measurements
-	measurements, err := adapter.GetMeasurements("testbucket")
+	measurements, err := adapter.GetMeasurements(context.Background(), "testbucket")
 	if err != nil || len(measurements) == 0 {
 		t.Skip("没有可用的 measurements 进行测试")
 	}
 
 	// 查询数据
-	points, lastTime, err := adapter.QueryData("testbucket", measurements[0], 0, 100)
+	points, cursor, err := adapter.QueryData(context.Background(), common.Query{DB: "testbucket", Measurement: measurements[0], Limit: 100})
 	if err != nil {
 		t.Fatalf("QueryData 失败: %v", err)
 	}
 
-	t.Logf("成功查询 %d 个数据点, lastTime=%d", len(points), lastTime)
+	t.Logf("成功查询 %d 个数据点, cursor=%+v", len(points), cursor)
 	if len(points) > 0 {
 		t.Logf("第一个点: measurement=%s, time=%v, tags=%v, fields=%v",
 			points[0].Measurement, points[0].Time, points[0].Tags, points[0].Fields)
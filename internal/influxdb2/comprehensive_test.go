@@ -243,7 +243,7 @@ func TestAdapterAdvancedMethods(t *testing.T) {
 	defer adapter.Close()
 
 	// 测试GetDatabases（带bucket）
-	buckets, err := adapter.GetDatabases()
+	buckets, err := adapter.GetDatabases(context.Background())
 	if err != nil {
 		t.Logf("GetDatabases预期错误: %v", err)
 	} else {
@@ -253,19 +253,19 @@ func TestAdapterAdvancedMethods(t *testing.T) {
 	}
 
 	// 测试GetMeasurements
-	_, err = adapter.GetMeasurements("test-bucket-advanced")
+	_, err = adapter.GetMeasurements(context.Background(), "test-bucket-advanced")
 	if err != nil {
 		t.Logf("GetMeasurements预期错误: %v", err)
 	}
 
 	// 测试GetTagKeys
-	_, err = adapter.GetTagKeys("test-bucket-advanced", "test-measurement")
+	_, err = adapter.GetTagKeys(context.Background(), "test-bucket-advanced", "test-measurement")
 	if err != nil {
 		t.Logf("GetTagKeys预期错误: %v", err)
 	}
 
 	// 测试QueryData
-	_, _, err = adapter.QueryData("test-bucket-advanced", "test-measurement", 0, 100)
+	_, _, err = adapter.QueryData(context.Background(), common.Query{DB: "test-bucket-advanced", Measurement: "test-measurement", Limit: 100})
 	if err != nil {
 		t.Logf("QueryData预期错误: %v", err)
 	}
@@ -279,7 +279,7 @@ func TestAdapterAdvancedMethods(t *testing.T) {
 			Time:        time.Now(),
 		},
 	}
-	err = adapter.WritePoints("test-bucket-advanced", points)
+	err = adapter.WritePoints(context.Background(), "test-bucket-advanced", points)
 	if err != nil {
 		t.Logf("WritePoints预期错误: %v", err)
 	}
@@ -301,7 +301,7 @@ func TestAdapterEmptyBucketScenario(t *testing.T) {
 	defer adapter.Close()
 
 	// 当没有指定bucket时，应该查询所有buckets
-	_, err = adapter.GetDatabases()
+	_, err = adapter.GetDatabases(context.Background())
 	if err != nil {
 		t.Logf("GetDatabases（无bucket）预期错误: %v", err)
 	}
@@ -323,7 +323,7 @@ func TestAdapterLargeDataSet(t *testing.T) {
 	defer adapter.Close()
 
 	// 测试大批次查询
-	_, _, err = adapter.QueryData("test-bucket-large", "large-measurement", 0, 10000)
+	_, _, err = adapter.QueryData(context.Background(), common.Query{DB: "test-bucket-large", Measurement: "large-measurement", Limit: 10000})
 	if err != nil {
 		t.Logf("大批次QueryData预期错误: %v", err)
 	}
@@ -340,7 +340,7 @@ func TestAdapterLargeDataSet(t *testing.T) {
 		largePoints = append(largePoints, point)
 	}
 
-	err = adapter.WritePoints("test-bucket-large", largePoints)
+	err = adapter.WritePoints(context.Background(), "test-bucket-large", largePoints)
 	if err != nil {
 		t.Logf("大量WritePoints预期错误: %v", err)
 	}
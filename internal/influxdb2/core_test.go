@@ -1,9 +1,16 @@
 package influxdb2
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	ihttp "github.com/influxdata/influxdb-client-go/v2/api/http"
 	"github.com/ygqygq2/influxdb-sync/internal/common"
 )
 
@@ -246,3 +253,183 @@ func TestTimePrecision(t *testing.T) {
 		})
 	}
 }
+
+func TestClassifyError(t *testing.T) {
+	err := ClassifyError(&ihttp.Error{StatusCode: 429, Code: "too many requests", Message: "slow down", RetryAfter: 3})
+	var ae *common.AdapterError
+	if !errors.As(err, &ae) {
+		t.Fatalf("期望返回 AdapterError, 实际为 %T", err)
+	}
+	if ae.Class != common.ClassRetryable || ae.RetryAfter != 3*time.Second {
+		t.Errorf("429 应可重试并带 Retry-After, 实际为 %s %v", ae.Class, ae.RetryAfter)
+	}
+
+	if !common.IsPermanent(ClassifyError(&ihttp.Error{StatusCode: 401, Code: "unauthorized", Message: "unauthorized access"})) {
+		t.Error("401 应不可重试")
+	}
+	if ClassifyError(nil) != nil {
+		t.Error("nil 错误应返回 nil")
+	}
+}
+
+func TestRetentionRules(t *testing.T) {
+	rules := RetentionRules(common.RetentionPolicy{Duration: 7 * 24 * time.Hour})
+	if len(rules) != 1 || rules[0].EverySeconds != 604800 {
+		t.Errorf("期望保留 604800 秒, 实际为 %+v", rules)
+	}
+	if got := BucketRetention(rules); got.Duration != 7*24*time.Hour {
+		t.Errorf("BucketRetention() = %v", got.Duration)
+	}
+
+	// 永久保留
+	if rules := RetentionRules(common.RetentionPolicy{}); rules[0].EverySeconds != 0 {
+		t.Errorf("永久保留应为 0 秒, 实际为 %d", rules[0].EverySeconds)
+	}
+	if got := BucketRetention(nil); got.Duration != 0 {
+		t.Errorf("没有保留规则时应永久保留, 实际为 %v", got.Duration)
+	}
+}
+
+func TestEnsureDBRP(t *testing.T) {
+	var created []map[string]interface{}
+	existing := `{"content":[{"id":"v1","bucketID":"b0","database":"db1","retention_policy":"autogen","default":true,"orgID":"o1","virtual":true}]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v2/dbrps":
+			if r.URL.Query().Get("org") != "my-org" || r.URL.Query().Get("db") != "db1" {
+				t.Errorf("查询参数不正确: %s", r.URL.RawQuery)
+			}
+			w.Write([]byte(existing))
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v2/buckets":
+			w.Write([]byte(`{"buckets":[{"id":"b1","name":"` + r.URL.Query().Get("name") + `","retentionRules":[]}]}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v2/dbrps":
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			created = append(created, body)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id":"m1","bucketID":"b1","database":"db1","retention_policy":"autogen","default":true,"orgID":"o1"}`))
+		default:
+			t.Errorf("未预期的请求: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	a := &Adapter{URL: server.URL, Token: "token", Org: "my-org"}
+	a.Connect()
+	defer a.Close()
+	m := common.DBRPMapping{Database: "db1", RetentionPolicy: "autogen", Bucket: "bak_db1", Default: true}
+
+	// 只有虚拟映射时创建
+	ok, err := a.EnsureDBRP(context.Background(), m)
+	if err != nil || !ok {
+		t.Fatalf("期望新建映射, 实际为 %v, %v", ok, err)
+	}
+	if len(created) != 1 || created[0]["bucketID"] != "b1" || created[0]["default"] != true ||
+		created[0]["database"] != "db1" || created[0]["retention_policy"] != "autogen" || created[0]["org"] != "my-org" {
+		t.Errorf("创建请求不正确: %v", created)
+	}
+
+	// 已存在时不修改
+	existing = `{"content":[{"id":"m1","bucketID":"b1","database":"db1","retention_policy":"autogen","default":true,"orgID":"o1"}]}`
+	ok, err = a.EnsureDBRP(context.Background(), m)
+	if err != nil || ok {
+		t.Errorf("已存在的映射不应重复创建, 实际为 %v, %v", ok, err)
+	}
+	if len(created) != 1 {
+		t.Errorf("期望只创建 1 次, 实际为 %d", len(created))
+	}
+}
+
+// 模拟 /api/v2/query：schema.tagKeys 未指定 start 时与服务端一样只查最近 30 天，
+// 数据都早于 30 天，因此只有指定了 start 才能返回 tag
+func newOldDataQueryServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/query" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var body struct {
+			Query string `json:"query"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("解析查询失败: %v", err)
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		switch {
+		case strings.Contains(body.Query, "schema.tagKeys"):
+			w.Write([]byte("#datatype,string,long,string\n#group,false,false,false\n#default,_result,,\n,result,table,_value\n"))
+			if strings.Contains(body.Query, "start: -100y") {
+				w.Write([]byte(",,0,host\n"))
+			}
+		default:
+			w.Write([]byte("#datatype,string,long,dateTime:RFC3339,string,string,double\n" +
+				"#group,false,false,false,false,false,false\n" +
+				"#default,_result,,,,,\n" +
+				",result,table,_time,_measurement,host,usage\n" +
+				",,0,2020-01-01T00:00:00Z,cpu,a,1.5\n"))
+		}
+	}))
+}
+
+func TestQueryDataOldSeriesKeepsTags(t *testing.T) {
+	server := newOldDataQueryServer(t)
+	defer server.Close()
+
+	a := &Adapter{URL: server.URL, Token: "token", Org: "my-org"}
+	a.Connect()
+	defer a.Close()
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano()
+	q := common.Query{DB: "db1", Measurement: "cpu", Cursor: common.Cursor{Time: start}, Limit: 10}
+	points, _, err := a.QueryData(context.Background(), q)
+	if err != nil {
+		t.Fatalf("QueryData() error = %v", err)
+	}
+	if len(points) != 1 {
+		t.Fatalf("期望 1 个点, 实际为 %d", len(points))
+	}
+	if points[0].Tags["host"] != "a" || points[0].Fields["host"] != nil || points[0].Fields["usage"] != 1.5 {
+		t.Errorf("30 天前的 series 的 tag 不应被当作字段: %+v", points[0])
+	}
+}
+
+func TestCountFields(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query string `json:"query"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("解析查询失败: %v", err)
+		}
+		query = body.Query
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Write([]byte("#datatype,string,long,string,long\n" +
+			"#group,false,false,true,false\n" +
+			"#default,_result,,,\n" +
+			",result,table,_field,_value\n" +
+			",,0,idle,2\n" +
+			",,1,value,3\n"))
+	}))
+	defer server.Close()
+
+	a := &Adapter{URL: server.URL, Token: "token", Org: "my-org"}
+	a.Connect()
+	defer a.Close()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	q := common.Query{DB: "db1", Measurement: "cpu", Cursor: common.Cursor{Time: start.UnixNano()}, End: start.Add(24 * time.Hour).UnixNano()}
+	counts, err := a.CountFields(context.Background(), q)
+	if err != nil {
+		t.Fatalf("CountFields() error = %v", err)
+	}
+	if len(counts) != 2 || counts["idle"] != 2 || counts["value"] != 3 {
+		t.Errorf("CountFields() = %v", counts)
+	}
+	if !strings.Contains(query, `range(start: time(v: "2024-01-01T00:00:00Z"), stop: time(v: "2024-01-02T00:00:00Z"))`) ||
+		!strings.Contains(query, "count()") {
+		t.Errorf("计数查询不正确: %s", query)
+	}
+}
@@ -32,15 +32,51 @@ func Sync2x2x(ctx context.Context, cfg common.SyncConfig) error {
 
 	// 创建同步器
 	syncCfg := common.SyncConfig{
-		BatchSize:     cfg.BatchSize,
-		Start:         cfg.Start,
-		End:           cfg.End,
-		ResumeFile:    cfg.ResumeFile,
-		Parallel:      cfg.Parallel,
-		RetryCount:    cfg.RetryCount,
-		RetryInterval: cfg.RetryInterval,
-		RateLimit:     cfg.RateLimit,
-		LogLevel:      cfg.LogLevel,
+		SourceAddr:               cfg.SourceAddr,
+		SourceOrg:                cfg.SourceOrg,
+		SourceBucket:             cfg.SourceBucket,
+		TargetAddr:               cfg.TargetAddr,
+		TargetOrg:                cfg.TargetOrg,
+		TargetBucket:             target.Bucket,
+		BatchSize:                cfg.BatchSize,
+		Start:                    cfg.Start,
+		End:                      cfg.End,
+		ResumeFile:               cfg.ResumeFile,
+		CheckpointType:           cfg.CheckpointType,
+		CheckpointDB:             cfg.CheckpointDB,
+		Parallel:                 cfg.Parallel,
+		RetryCount:               cfg.RetryCount,
+		RetryInterval:            cfg.RetryInterval,
+		RateLimit:                cfg.RateLimit,
+		Follow:                   cfg.Follow,
+		FollowInterval:           cfg.FollowInterval,
+		FollowLookback:           cfg.FollowLookback,
+		QueryTimeout:             cfg.QueryTimeout,
+		WriteTimeout:             cfg.WriteTimeout,
+		MaxInflightBytes:         cfg.MaxInflightBytes,
+		ShardWindow:              cfg.ShardWindow,
+		AdaptiveBatch:            cfg.AdaptiveBatch,
+		MinBatchSize:             cfg.MinBatchSize,
+		MaxBatchSize:             cfg.MaxBatchSize,
+		TargetWriteLatency:       cfg.TargetWriteLatency,
+		TargetBatchBytes:         cfg.TargetBatchBytes,
+		SourcePointsPerSec:       cfg.SourcePointsPerSec,
+		SourceBytesPerSec:        cfg.SourceBytesPerSec,
+		TargetPointsPerSec:       cfg.TargetPointsPerSec,
+		TargetBytesPerSec:        cfg.TargetBytesPerSec,
+		DeadLetterDir:            cfg.DeadLetterDir,
+		OnError:                  cfg.OnError,
+		MaxFailures:              cfg.MaxFailures,
+		Plan:                     cfg.Plan,
+		ReportFile:               cfg.ReportFile,
+		Version:                  cfg.Version,
+		CreateMissing:            cfg.CreateMissing,
+		CreateRetention:          cfg.CreateRetention,
+		AllRetentionPolicies:     cfg.AllRetentionPolicies,
+		RetentionPolicyMap:       cfg.RetentionPolicyMap,
+		CreateDBRP:               cfg.CreateDBRP,
+		MigrateContinuousQueries: cfg.MigrateContinuousQueries,
+		LogLevel:                 cfg.LogLevel,
 	}
 	syncer := common.NewSyncer(syncCfg, source, target)
 
@@ -0,0 +1,82 @@
+package influxdb2
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/ygqygq2/influxdb-sync/internal/common"
+)
+
+// CreateDownsampleTask 在配置的 org 下创建降采样任务，已存在同名任务时不做修改
+func (a *Adapter) CreateDownsampleTask(ctx context.Context, task common.DownsampleTask) (bool, error) {
+	tasksAPI := a.client.TasksAPI()
+	existing, err := tasksAPI.FindTasks(ctx, &api.TaskFilter{Name: task.Name, OrgName: a.Org})
+	if err != nil {
+		return false, ClassifyError(err)
+	}
+	if len(existing) > 0 {
+		return false, nil
+	}
+
+	org, err := a.client.OrganizationsAPI().FindOrganizationByName(ctx, a.Org)
+	if err != nil {
+		return false, ClassifyError(err)
+	}
+	if _, err := tasksAPI.CreateTaskByFlux(ctx, DownsampleFlux(task, a.Org), *org.Id); err != nil {
+		return false, ClassifyError(err)
+	}
+	return true, nil
+}
+
+// DownsampleFlux 生成与连续查询等价的 Flux 任务脚本：每个聚合字段一个查询，
+// 按窗口起点记录时间并跳过空窗口，与 1.x 连续查询的写入结果一致
+func DownsampleFlux(task common.DownsampleTask, org string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "option task = {name: %s, every: %s}\n", strconv.Quote(task.Name), FluxDuration(task.Every))
+
+	// 不保留所有 tag 时只按指定的 tag 分组，其余 tag 的 series 合并聚合
+	var group string
+	if !task.AllTags {
+		columns := []string{strconv.Quote("_measurement"), strconv.Quote("_field")}
+		for _, tag := range task.Tags {
+			columns = append(columns, strconv.Quote(tag))
+		}
+		group = fmt.Sprintf("    |> group(columns: [%s])\n", strings.Join(columns, ", "))
+	}
+
+	for _, f := range task.Fields {
+		b.WriteString("\n")
+		fmt.Fprintf(&b, "from(bucket: %s)\n", strconv.Quote(task.SourceBucket))
+		fmt.Fprintf(&b, "    |> range(start: -%s)\n", FluxDuration(task.For))
+		fmt.Fprintf(&b, "    |> filter(fn: (r) => r._measurement == %s and r._field == %s)\n",
+			strconv.Quote(task.SourceMeasurement), strconv.Quote(f.Field))
+		b.WriteString(group)
+		fmt.Fprintf(&b, "    |> aggregateWindow(every: %s, fn: %s, timeSrc: \"_start\", createEmpty: false)\n",
+			FluxDuration(task.Interval), f.Func)
+		fmt.Fprintf(&b, "    |> set(key: \"_measurement\", value: %s)\n", strconv.Quote(task.TargetMeasurement))
+		fmt.Fprintf(&b, "    |> set(key: \"_field\", value: %s)\n", strconv.Quote(f.As))
+		fmt.Fprintf(&b, "    |> to(bucket: %s, org: %s)\n", strconv.Quote(task.TargetBucket), strconv.Quote(org))
+	}
+	return b.String()
+}
+
+// FluxDuration 把时间长度转换为 Flux 的时间长度字面量，使用能整除的最大单位
+func FluxDuration(d time.Duration) string {
+	units := []struct {
+		suffix string
+		unit   time.Duration
+	}{
+		{"w", 7 * 24 * time.Hour}, {"d", 24 * time.Hour}, {"h", time.Hour}, {"m", time.Minute},
+		{"s", time.Second}, {"ms", time.Millisecond}, {"us", time.Microsecond},
+	}
+	for _, u := range units {
+		if d%u.unit == 0 {
+			return fmt.Sprintf("%d%s", d/u.unit, u.suffix)
+		}
+	}
+	return fmt.Sprintf("%dns", d)
+}
@@ -0,0 +1,61 @@
+package influxdb2
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ygqygq2/influxdb-sync/internal/common"
+)
+
+func TestDownsampleFlux(t *testing.T) {
+	task := common.DownsampleTask{
+		Name: "bak_telegraf_cq_1h", SourceBucket: "bak_telegraf", TargetBucket: "bak_telegraf/rp_1y",
+		Downsample: common.Downsample{
+			SourceMeasurement: "cpu", TargetMeasurement: "cpu_1h",
+			Fields:   []common.DownsampleField{{Func: "mean", Field: "usage", As: "usage_mean"}, {Func: "max", Field: "usage", As: "max"}},
+			Interval: time.Hour, Every: 30 * time.Minute, For: 2 * time.Hour, Tags: []string{"host"},
+		},
+	}
+	expected := `option task = {name: "bak_telegraf_cq_1h", every: 30m}
+
+from(bucket: "bak_telegraf")
+    |> range(start: -2h)
+    |> filter(fn: (r) => r._measurement == "cpu" and r._field == "usage")
+    |> group(columns: ["_measurement", "_field", "host"])
+    |> aggregateWindow(every: 1h, fn: mean, timeSrc: "_start", createEmpty: false)
+    |> set(key: "_measurement", value: "cpu_1h")
+    |> set(key: "_field", value: "usage_mean")
+    |> to(bucket: "bak_telegraf/rp_1y", org: "my-org")
+
+from(bucket: "bak_telegraf")
+    |> range(start: -2h)
+    |> filter(fn: (r) => r._measurement == "cpu" and r._field == "usage")
+    |> group(columns: ["_measurement", "_field", "host"])
+    |> aggregateWindow(every: 1h, fn: max, timeSrc: "_start", createEmpty: false)
+    |> set(key: "_measurement", value: "cpu_1h")
+    |> set(key: "_field", value: "max")
+    |> to(bucket: "bak_telegraf/rp_1y", org: "my-org")
+`
+	if got := DownsampleFlux(task, "my-org"); got != expected {
+		t.Errorf("Flux 脚本不正确:\n%s", got)
+	}
+
+	// GROUP BY * 保留所有 tag，不重新分组
+	task.AllTags, task.Fields = true, task.Fields[:1]
+	if got := DownsampleFlux(task, "my-org"); strings.Contains(got, "group(") {
+		t.Errorf("保留所有 tag 时不应重新分组:\n%s", got)
+	}
+}
+
+func TestFluxDuration(t *testing.T) {
+	testCases := map[time.Duration]string{
+		14 * 24 * time.Hour: "2w", 24 * time.Hour: "1d", 90 * time.Minute: "90m", time.Hour: "1h",
+		1500 * time.Millisecond: "1500ms", 10 * time.Microsecond: "10us", 5: "5ns",
+	}
+	for d, expected := range testCases {
+		if got := FluxDuration(d); got != expected {
+			t.Errorf("FluxDuration(%v) = %s, 期望 %s", d, got, expected)
+		}
+	}
+}
@@ -1,14 +1,18 @@
 package influxdb3
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/influxdata/influxdb-client-go/v2/api"
 	client "github.com/influxdata/influxdb1-client/v2"
 	"github.com/ygqygq2/influxdb-sync/internal/common"
+	"github.com/ygqygq2/influxdb-sync/internal/influxdb1"
+	"github.com/ygqygq2/influxdb-sync/internal/influxdb2"
+	"github.com/ygqygq2/influxdb-sync/internal/lineprotocol"
 	"github.com/ygqygq2/influxdb-sync/internal/logx"
 )
 
@@ -52,6 +56,61 @@ func NewDataTarget3x(config interface{}) (*DataTarget3x, error) {
 	}
 }
 
+// 按兼容模式选择 V1CompatConfig、V2CompatConfig 或 NativeConfig，mode 为空时使用 defaultMode
+func compatConfig(mode, defaultMode, addr, user, pass, token, org, database, namespace string) (interface{}, error) {
+	if mode == "" {
+		mode = defaultMode
+	}
+	switch strings.ToLower(mode) {
+	case "v1":
+		return V1CompatConfig{Addr: addr, User: user, Pass: pass, Database: database}, nil
+	case "v2":
+		return V2CompatConfig{URL: addr, Token: token, Org: org, Database: database}, nil
+	case "native":
+		return NativeConfig{URL: addr, Token: token, Database: database, Namespace: namespace}, nil
+	default:
+		return nil, fmt.Errorf("不支持的 3.x 兼容模式: %s，支持的模式: v1, v2, native", mode)
+	}
+}
+
+// NewSource 按源端兼容模式（默认 v1）创建读取 database 的 3.x 数据源
+func NewSource(cfg common.SyncConfig, database string) (*DataSource3x, error) {
+	config, err := compatConfig(cfg.SourceCompatMode, "v1", cfg.SourceAddr, cfg.SourceUser, cfg.SourcePass,
+		cfg.SourceToken, cfg.SourceOrg, database, cfg.SourceNamespace)
+	if err != nil {
+		return nil, err
+	}
+	return NewDataSource3x(config)
+}
+
+// NewTarget 按目标端兼容模式（默认 v2）创建写入 database 的 3.x 数据目标
+func NewTarget(cfg common.SyncConfig, database string) (*DataTarget3x, error) {
+	config, err := compatConfig(cfg.TargetCompatMode, "v2", cfg.TargetAddr, cfg.TargetUser, cfg.TargetPass,
+		cfg.TargetToken, cfg.TargetOrg, database, cfg.TargetNamespace)
+	if err != nil {
+		return nil, err
+	}
+	return NewDataTarget3x(config)
+}
+
+// NewTargetSource 按目标端兼容模式（默认 v2）创建读取目标端的 3.x 数据源，用于校验和结构比较
+func NewTargetSource(cfg common.SyncConfig, database string) (*DataSource3x, error) {
+	config, err := compatConfig(cfg.TargetCompatMode, "v2", cfg.TargetAddr, cfg.TargetUser, cfg.TargetPass,
+		cfg.TargetToken, cfg.TargetOrg, database, cfg.TargetNamespace)
+	if err != nil {
+		return nil, err
+	}
+	return NewDataSource3x(config)
+}
+
+// TargetDatabase 3.x 目标库名称：配置了 target bucket 时使用它，否则为前缀+源库+后缀
+func TargetDatabase(cfg common.SyncConfig, sourceDB string) string {
+	if cfg.TargetBucket != "" {
+		return cfg.TargetBucket
+	}
+	return cfg.TargetDBPrefix + sourceDB + cfg.TargetDBSuffix
+}
+
 // NewV1CompatDataSource 创建 v1 兼容模式数据源
 func NewV1CompatDataSource(config V1CompatConfig) *DataSource3x {
 	return &DataSource3x{
@@ -124,14 +183,14 @@ func (ds *DataSource3x) Close() error {
 	return nil
 }
 
-func (ds *DataSource3x) GetDatabases() ([]string, error) {
+func (ds *DataSource3x) GetDatabases(ctx context.Context) ([]string, error) {
 	if ds.client == nil {
 		return nil, fmt.Errorf("client not connected")
 	}
-	return ds.client.GetDatabases()
+	return ds.client.GetDatabases(ctx)
 }
 
-func (ds *DataSource3x) GetMeasurements(database string) ([]string, error) {
+func (ds *DataSource3x) GetMeasurements(ctx context.Context, database string) ([]string, error) {
 	if ds.client == nil {
 		return nil, fmt.Errorf("client not connected")
 	}
@@ -139,12 +198,12 @@ func (ds *DataSource3x) GetMeasurements(database string) ([]string, error) {
 	switch ds.client.compatMode {
 	case "v1":
 		q := client.NewQuery("SHOW MEASUREMENTS", database, "")
-		resp, err := ds.client.QueryInfluxQL(q.Command, database)
+		resp, err := ds.client.QueryInfluxQL(ctx, q.Command, database)
 		if err != nil {
 			return nil, err
 		}
 		if resp.Error() != nil {
-			return nil, resp.Error()
+			return nil, common.ClassifyError(resp.Error())
 		}
 
 		var measurements []string
@@ -171,7 +230,7 @@ func (ds *DataSource3x) GetMeasurements(database string) ([]string, error) {
 			org = v2cfg.Org
 		}
 		
-		result, err := ds.client.QueryFlux(query, org)
+		result, err := ds.client.QueryFlux(ctx, query, org)
 		if err != nil {
 			return nil, err
 		}
@@ -188,37 +247,22 @@ func (ds *DataSource3x) GetMeasurements(database string) ([]string, error) {
 		return measurements, nil
 
 	case "native":
-		// 使用 SQL 查询 measurements
-		query := fmt.Sprintf("SHOW MEASUREMENTS FROM \"%s\"", database)
-		data, err := ds.client.QuerySQL(query)
-		if err != nil {
-			return nil, err
-		}
-
-		// 解析 JSON 响应
-		var result map[string]interface{}
-		if err := json.Unmarshal(data, &result); err != nil {
-			return nil, err
-		}
-
-		// 提取 measurements (这个实现可能需要根据实际的 3.x API 响应格式调整)
+		// 原生模式下 measurement 即 iox schema 中的表
+		query := "SELECT table_name FROM information_schema.tables WHERE table_schema = 'iox' ORDER BY table_name"
 		var measurements []string
-		if data, ok := result["data"].([]interface{}); ok {
-			for _, row := range data {
-				if rowMap, ok := row.(map[string]interface{}); ok {
-					if measurement, ok := rowMap["measurement"].(string); ok {
-						measurements = append(measurements, measurement)
-					}
-				}
+		err := ds.client.QuerySQLRows(ctx, database, query, func(row map[string]interface{}) error {
+			if name, ok := row["table_name"].(string); ok {
+				measurements = append(measurements, name)
 			}
-		}
-		return measurements, nil
+			return nil
+		})
+		return measurements, err
 	}
 
 	return []string{}, nil
 }
 
-func (ds *DataSource3x) GetTagKeys(database, measurement string) (map[string]bool, error) {
+func (ds *DataSource3x) GetTagKeys(ctx context.Context, database, measurement string) (map[string]bool, error) {
 	if ds.client == nil {
 		return nil, fmt.Errorf("client not connected")
 	}
@@ -228,12 +272,12 @@ func (ds *DataSource3x) GetTagKeys(database, measurement string) (map[string]boo
 	switch ds.client.compatMode {
 	case "v1":
 		query := fmt.Sprintf("SHOW TAG KEYS FROM \"%s\"", escapeMeasurement(measurement))
-		resp, err := ds.client.QueryInfluxQL(query, database)
+		resp, err := ds.client.QueryInfluxQL(ctx, query, database)
 		if err != nil {
 			return nil, err
 		}
 		if resp.Error() != nil {
-			return nil, resp.Error()
+			return nil, common.ClassifyError(resp.Error())
 		}
 
 		if len(resp.Results) > 0 && len(resp.Results[0].Series) > 0 {
@@ -247,21 +291,13 @@ func (ds *DataSource3x) GetTagKeys(database, measurement string) (map[string]boo
 		}
 
 	case "v2":
-		query := fmt.Sprintf(`
-			import "influxdata/influxdb/schema"
-			schema.tagKeys(
-				bucket: "%s",
-				predicate: (r) => r._measurement == "%s"
-			)
-		`, database, measurement)
-
 		// 从 config 获取 org
 		org := ""
 		if v2cfg, ok := ds.config.(V2CompatConfig); ok {
 			org = v2cfg.Org
 		}
-		
-		result, err := ds.client.QueryFlux(query, org)
+
+		result, err := ds.client.QueryFlux(ctx, influxdb2.TagKeysQuery(database, measurement), org)
 		if err != nil {
 			return nil, err
 		}
@@ -276,18 +312,12 @@ func (ds *DataSource3x) GetTagKeys(database, measurement string) (map[string]boo
 		}
 
 	case "native":
-		// 对于原生 3.x，我们可以查询一小批数据来确定 tag keys
-		query := fmt.Sprintf("SELECT * FROM \"%s\" LIMIT 1", measurement)
-		data, err := ds.client.QuerySQL(query)
+		columns, err := ds.tableColumns(ctx, database, measurement)
 		if err != nil {
-			logx.Debug(fmt.Sprintf("获取标签字段失败，使用默认字段: %v", err))
-		} else {
-			// 解析响应来确定哪些是 tag fields
-			var result map[string]interface{}
-			if err := json.Unmarshal(data, &result); err == nil {
-				// 这里需要根据实际的 3.x API 响应格式来实现
-				// 暂时返回一些常见的系统字段
-			}
+			return nil, err
+		}
+		for tag := range columns.tags {
+			tagKeys[tag] = true
 		}
 	}
 
@@ -300,94 +330,433 @@ func (ds *DataSource3x) GetTagKeys(database, measurement string) (map[string]boo
 	return tagKeys, nil
 }
 
-func (ds *DataSource3x) QueryData(database, measurement string, startTime int64, batchSize int) ([]common.DataPoint, int64, error) {
+// GetFieldKeys 返回 measurement 的字段名和类型，原生模式从 information_schema.columns 读取
+func (ds *DataSource3x) GetFieldKeys(ctx context.Context, database, measurement string) (map[string]common.FieldType, error) {
 	if ds.client == nil {
-		return nil, 0, fmt.Errorf("client not connected")
+		return nil, fmt.Errorf("client not connected")
 	}
 
 	switch ds.client.compatMode {
 	case "v1":
-		return ds.queryDataV1(database, measurement, startTime, batchSize)
+		resp, err := ds.client.QueryInfluxQL(ctx, influxdb1.FieldKeysQuery(measurement), database)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Error() != nil {
+			return nil, common.ClassifyError(resp.Error())
+		}
+		return influxdb1.ParseFieldKeys(resp), nil
+
 	case "v2":
-		return ds.queryDataV2(database, measurement, startTime, batchSize)
+		org := ""
+		if v2cfg, ok := ds.config.(V2CompatConfig); ok {
+			org = v2cfg.Org
+		}
+		result, err := ds.client.QueryFlux(ctx, influxdb2.FieldKeysQuery(database, measurement), org)
+		if err != nil {
+			return nil, err
+		}
+		names, err := influxdb2.ParseFieldKeys(result)
+		if err != nil || len(names) == 0 {
+			return map[string]common.FieldType{}, err
+		}
+		result, err = ds.client.QueryFlux(ctx, influxdb2.FieldTypesQuery(database, measurement), org)
+		if err != nil {
+			return nil, err
+		}
+		return influxdb2.ParseFieldTypes(result, names)
+
 	case "native":
-		return ds.queryDataNative(database, measurement, startTime, batchSize)
+		columns, err := ds.tableColumns(ctx, database, measurement)
+		if err != nil {
+			return nil, err
+		}
+		return columns.fields, nil
 	}
+	return nil, fmt.Errorf("unsupported compatibility mode: %s", ds.client.compatMode)
+}
+
+// 原生模式下表的列信息：tag 列是 Dictionary 类型，字段列按 Arrow 类型确定字段类型，
+// time 列是 Timestamp 类型，不属于 tag 或字段
+type tableColumns struct {
+	tags   map[string]bool
+	fields map[string]common.FieldType
+}
 
-	return nil, 0, fmt.Errorf("unsupported compatibility mode: %s", ds.client.compatMode)
+func newTableColumns() *tableColumns {
+	return &tableColumns{tags: make(map[string]bool), fields: make(map[string]common.FieldType)}
 }
 
-// v1 兼容模式查询数据
-func (ds *DataSource3x) queryDataV1(database, measurement string, startTime int64, batchSize int) ([]common.DataPoint, int64, error) {
-	em := escapeMeasurement(measurement)
-	var query string
-	if startTime == 0 {
-		query = fmt.Sprintf("SELECT * FROM %s ORDER BY time ASC LIMIT %d", em, batchSize)
-	} else {
-		query = fmt.Sprintf("SELECT * FROM %s WHERE time > %d ORDER BY time ASC LIMIT %d", em, startTime, batchSize)
+// 从 information_schema.columns 读取表的列信息
+func (ds *DataSource3x) tableColumns(ctx context.Context, database, measurement string) (*tableColumns, error) {
+	query := fmt.Sprintf("SELECT column_name, data_type FROM information_schema.columns WHERE table_schema = 'iox' AND table_name = '%s'",
+		strings.ReplaceAll(measurement, "'", "''"))
+	columns := newTableColumns()
+	err := ds.client.QuerySQLRows(ctx, database, query, func(row map[string]interface{}) error {
+		columns.add(row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return columns, nil
+}
 
+// 记录 information_schema.columns 的一行
+func (tc *tableColumns) add(row map[string]interface{}) {
+	name, _ := row["column_name"].(string)
+	typ, _ := row["data_type"].(string)
+	if name == "" {
+		return
+	}
+	if strings.HasPrefix(typ, "Dictionary(") {
+		tc.tags[name] = true
+	} else if t, ok := arrowFieldType(typ); ok {
+		tc.fields[name] = t
+	}
+}
+
+// 把一行查询结果转换为点：tag 列写入 Tags，字段列按列类型转换，值为 null 的列跳过。
+// 没有列信息或无法转换的值原样保留，由同步引擎按字段类型处理
+func (tc *tableColumns) point(measurement string, row map[string]interface{}) (common.DataPoint, error) {
+	p := common.DataPoint{Measurement: measurement, Tags: make(map[string]string), Fields: make(map[string]interface{})}
+	for name, v := range row {
+		if v == nil {
+			continue
+		}
+		switch {
+		case name == "time":
+			t, err := parseSQLTime(v)
+			if err != nil {
+				return p, err
+			}
+			p.Time = t
+		case tc.tags[name]:
+			p.Tags[name] = fmt.Sprint(v)
+		default:
+			if t, ok := tc.fields[name]; ok {
+				if converted, err := common.ConvertField(v, t); err == nil {
+					v = converted
+				}
+			}
+			p.Fields[name] = v
+		}
+	}
+	if p.Time.IsZero() {
+		return p, fmt.Errorf("SQL 查询结果缺少 time 列")
+	}
+	return p, nil
+}
+
+// 解析 time 列：JSONL 中为不带时区的 UTC 时间字符串，同时接受 RFC3339 和纳秒时间戳
+func parseSQLTime(v interface{}) (time.Time, error) {
+	switch x := v.(type) {
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999"} {
+			if t, err := time.Parse(layout, x); err == nil {
+				return t.UTC(), nil
+			}
+		}
+	case json.Number:
+		if ns, err := x.Int64(); err == nil {
+			return time.Unix(0, ns).UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("无法解析 time 列的值 %v", v)
+}
+
+// Arrow 数据类型对应的字段类型
+func arrowFieldType(typ string) (common.FieldType, bool) {
+	switch typ {
+	case "Float64":
+		return common.FieldFloat, true
+	case "Int64":
+		return common.FieldInteger, true
+	case "UInt64":
+		return common.FieldUnsigned, true
+	case "Utf8", "LargeUtf8", "Utf8View":
+		return common.FieldString, true
+	case "Boolean":
+		return common.FieldBoolean, true
+	}
+	return "", false
+}
+
+func (ds *DataSource3x) QueryData(ctx context.Context, q common.Query) ([]common.DataPoint, common.Cursor, error) {
+	if ds.client == nil {
+		return nil, q.Cursor, fmt.Errorf("client not connected")
+	}
+
+	var points []common.DataPoint
+	var err error
+	switch ds.client.compatMode {
+	case "v1":
+		return ds.queryDataV1(ctx, q)
+	case "v2":
+		points, err = ds.queryDataV2(ctx, q)
+	case "native":
+		points, err = ds.queryDataNative(ctx, q)
+	default:
+		return nil, q.Cursor, fmt.Errorf("unsupported compatibility mode: %s", ds.client.compatMode)
+	}
+	if err != nil {
+		return nil, q.Cursor, err
+	}
+
+	return points, common.NextCursor(q.Cursor, points), nil
+}
+
+// TimeRange 返回 measurement 最早和最晚一个点的时间戳，没有数据时返回 0，rp 只在 v1 兼容模式下使用
+func (ds *DataSource3x) TimeRange(ctx context.Context, database, rp, measurement string) (int64, int64, error) {
+	if ds.client == nil {
+		return 0, 0, fmt.Errorf("client not connected")
+	}
+
+	var bounds [2]int64
+	for i, last := range []bool{false, true} {
+		var ts int64
+		var ok bool
+		switch ds.client.compatMode {
+		case "v1":
+			resp, err := ds.client.QueryInfluxQL(ctx, influxdb1.BoundaryQuery(rp, measurement, last), database)
+			if err != nil {
+				return 0, 0, err
+			}
+			if resp.Error() != nil {
+				return 0, 0, common.ClassifyError(resp.Error())
+			}
+			ts, ok = influxdb1.FirstRowTime(resp)
+		case "v2":
+			org := ""
+			if v2cfg, isV2 := ds.config.(V2CompatConfig); isV2 {
+				org = v2cfg.Org
+			}
+			result, err := ds.client.QueryFlux(ctx, influxdb2.BoundaryQuery(database, measurement, last), org)
+			if err != nil {
+				return 0, 0, err
+			}
+			if ts, ok, err = influxdb2.ParseBoundary(result); err != nil {
+				return 0, 0, err
+			}
+		case "native":
+			agg := "min"
+			if last {
+				agg = "max"
+			}
+			query := fmt.Sprintf("SELECT %s(time) AS time FROM %s", agg, escapeMeasurement(measurement))
+			err := ds.client.QuerySQLRows(ctx, database, query, func(row map[string]interface{}) error {
+				// 表为空时返回一行 null
+				if v := row["time"]; v != nil {
+					t, err := parseSQLTime(v)
+					if err != nil {
+						return err
+					}
+					ts, ok = t.UnixNano(), true
+				}
+				return nil
+			})
+			if err != nil {
+				return 0, 0, err
+			}
+		default:
+			return 0, 0, fmt.Errorf("compatibility mode %s does not support time range queries", ds.client.compatMode)
+		}
+		if !ok {
+			return 0, 0, nil
+		}
+		bounds[i] = ts
+	}
+	return bounds[0], bounds[1], nil
+}
+
+// CountFields 统计时间范围内每个字段的非空值个数，用于校验时比较点数
+func (ds *DataSource3x) CountFields(ctx context.Context, q common.Query) (map[string]int64, error) {
+	if ds.client == nil {
+		return nil, fmt.Errorf("client not connected")
+	}
+
+	switch ds.client.compatMode {
+	case "v1":
+		resp, err := ds.client.QueryInfluxQL(ctx, influxdb1.CountQuery(q), q.DB)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Error() != nil {
+			return nil, common.ClassifyError(resp.Error())
+		}
+		return influxdb1.ParseFieldCounts(resp), nil
+	case "v2":
+		org := ""
+		if v2cfg, isV2 := ds.config.(V2CompatConfig); isV2 {
+			org = v2cfg.Org
+		}
+		result, err := ds.client.QueryFlux(ctx, influxdb2.CountQuery(q), org)
+		if err != nil {
+			return nil, err
+		}
+		return influxdb2.ParseFieldCounts(result)
+	case "native":
+		columns, err := ds.tableColumns(ctx, q.DB, q.Measurement)
+		if err != nil {
+			return nil, err
+		}
+		counts := make(map[string]int64)
+		if len(columns.fields) == 0 {
+			return counts, nil
+		}
+		query := buildSQLCountQuery(q, columns.fields)
+		logx.Debug(fmt.Sprintf("执行 SQL 查询: %s", query))
+		err = ds.client.QuerySQLRows(ctx, q.DB, query, func(row map[string]interface{}) error {
+			for name := range columns.fields {
+				if n, ok := row[name].(json.Number); ok {
+					count, err := n.Int64()
+					if err != nil {
+						return err
+					}
+					counts[name] = count
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return counts, nil
+	default:
+		return nil, fmt.Errorf("compatibility mode %s does not support field counts", ds.client.compatMode)
+	}
+}
+
+// EstimateSize 以 series 数预估 measurement 的大小，用于调度排序
+func (ds *DataSource3x) EstimateSize(ctx context.Context, database, rp, measurement string) (int64, error) {
+	if ds.client == nil {
+		return 0, fmt.Errorf("client not connected")
+	}
+
+	switch ds.client.compatMode {
+	case "v1":
+		resp, err := ds.client.QueryInfluxQL(ctx, influxdb1.CardinalityQuery(measurement), database)
+		if err != nil {
+			return 0, err
+		}
+		if resp.Error() != nil {
+			return 0, common.ClassifyError(resp.Error())
+		}
+		n, _ := influxdb1.FirstCount(resp)
+		return n, nil
+	case "v2":
+		org := ""
+		if v2cfg, isV2 := ds.config.(V2CompatConfig); isV2 {
+			org = v2cfg.Org
+		}
+		result, err := ds.client.QueryFlux(ctx, influxdb2.CardinalityQuery(database, measurement), org)
+		if err != nil {
+			return 0, err
+		}
+		return influxdb2.ParseCount(result)
+	default:
+		return 0, fmt.Errorf("compatibility mode %s does not support size estimation", ds.client.compatMode)
+	}
+}
+
+// v1 兼容模式查询数据。3.x 的 InfluxQL 不保证同一时间戳内的行顺序，不能用 OFFSET 续读：
+// 每页只保留完整的时间戳，页中最后一个时间戳的点单独全部读取，下一页从其后开始。
+// 旧断点中的偏移无法对应到稳定的顺序，从该时间戳重新读取，重复写入的点会覆盖目标端的同一个点
+func (ds *DataSource3x) queryDataV1(ctx context.Context, q common.Query) ([]common.DataPoint, common.Cursor, error) {
+	page := q
+	page.Cursor = common.Cursor{Time: q.Cursor.Time}
+	points, skipped, err := ds.queryInfluxQL(ctx, influxdb1.BuildSelectQuery(page), q.DB)
+	if err != nil {
+		return nil, q.Cursor, err
+	}
+	rows := len(points) + skipped
+	if len(points) == 0 {
+		if rows >= q.Limit {
+			return nil, q.Cursor, fmt.Errorf("measurement %s 从 %d 开始的 %d 行都无法解析时间", q.Measurement, q.Cursor.Time, rows)
+		}
+		return nil, common.Cursor{Time: q.Cursor.Time, Rows: rows}, nil
+	}
+
+	last := points[len(points)-1].Time.UnixNano()
+	if rows >= q.Limit {
+		// 页满时最后一个时间戳可能只读到一部分，去掉后单独读取该时间戳的全部点
+		n := len(points)
+		for n > 0 && points[n-1].Time.UnixNano() == last {
+			n--
+		}
+		tied, tiedSkipped, err := ds.queryInfluxQL(ctx, influxdb1.TimestampQuery(q.RP, q.Measurement, last), q.DB)
+		if err != nil {
+			return nil, q.Cursor, err
+		}
+		points = append(points[:n], tied...)
+		if len(points)+tiedSkipped > rows {
+			rows = len(points) + tiedSkipped
+		}
+	}
+	return points, common.Cursor{Time: last + 1, Rows: rows}, nil
+}
+
+// 执行 InfluxQL 查询并解析结果，返回点和无法解析而跳过的行数
+func (ds *DataSource3x) queryInfluxQL(ctx context.Context, query, database string) ([]common.DataPoint, int, error) {
 	logx.Debug(fmt.Sprintf("执行查询: %s", query))
-	resp, err := ds.client.QueryInfluxQL(query, database)
+	resp, err := ds.client.QueryInfluxQL(ctx, query, database)
 	if err != nil {
 		return nil, 0, err
 	}
 	if resp.Error() != nil {
-		return nil, 0, resp.Error()
+		return nil, 0, common.ClassifyError(resp.Error())
 	}
-
-	return ds.parseInfluxQLResponse(resp, startTime)
+	points, skipped := ds.parseInfluxQLResponse(resp)
+	return points, skipped, nil
 }
 
 // v2 兼容模式查询数据
-func (ds *DataSource3x) queryDataV2(database, measurement string, startTime int64, batchSize int) ([]common.DataPoint, int64, error) {
-	var startFilter string
-	if startTime > 0 {
-		startTimeRFC := time.Unix(0, startTime).UTC().Format(time.RFC3339Nano)
-		startFilter = fmt.Sprintf(`|> filter(fn: (r) => r._time > time(v: "%s"))`, startTimeRFC)
-	}
-
-	query := fmt.Sprintf(`
-		from(bucket: "%s")
-		|> range(start: -100y)
-		|> filter(fn: (r) => r._measurement == "%s")
-		%s
-		|> sort(columns: ["_time"])
-		|> limit(n: %d)
-	`, database, measurement, startFilter, batchSize)
+func (ds *DataSource3x) queryDataV2(ctx context.Context, q common.Query) ([]common.DataPoint, error) {
+	tagKeys, err := ds.GetTagKeys(ctx, q.DB, q.Measurement)
+	if err != nil {
+		return nil, err
+	}
 
+	query := influxdb2.BuildFluxQuery(q, tagKeys)
 	logx.Debug(fmt.Sprintf("执行 Flux 查询: %s", query))
-	
+
 	// 从 config 获取 org
 	org := ""
 	if v2cfg, ok := ds.config.(V2CompatConfig); ok {
 		org = v2cfg.Org
 	}
-	
-	result, err := ds.client.QueryFlux(query, org)
+
+	result, err := ds.client.QueryFlux(ctx, query, org)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 
-	return ds.parseFluxResponse(result, startTime)
+	return influxdb2.ParsePivotedRows(result, q.Measurement, tagKeys)
 }
 
-// 原生 3.x 模式查询数据
-func (ds *DataSource3x) queryDataNative(database, measurement string, startTime int64, batchSize int) ([]common.DataPoint, int64, error) {
-	var whereClause string
-	if startTime > 0 {
-		whereClause = fmt.Sprintf(" WHERE time > %d", startTime)
+// 原生 3.x 模式查询数据，按列信息区分 tag 和字段，逐行转换查询结果
+func (ds *DataSource3x) queryDataNative(ctx context.Context, q common.Query) ([]common.DataPoint, error) {
+	columns, err := ds.tableColumns(ctx, q.DB, q.Measurement)
+	if err != nil {
+		return nil, err
 	}
 
-	query := fmt.Sprintf("SELECT * FROM \"%s\"%s ORDER BY time ASC LIMIT %d", measurement, whereClause, batchSize)
+	query := buildSQLQuery(q, columns.tags)
 
 	logx.Debug(fmt.Sprintf("执行 SQL 查询: %s", query))
-	data, err := ds.client.QuerySQL(query)
+	var points []common.DataPoint
+	err = ds.client.QuerySQLRows(ctx, q.DB, query, func(row map[string]interface{}) error {
+		p, err := columns.point(q.Measurement, row)
+		if err != nil {
+			return err
+		}
+		points = append(points, p)
+		return nil
+	})
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
-
-	return ds.parseSQLResponse(data, startTime)
+	return points, nil
 }
 
 // DataTarget 接口实现
@@ -420,26 +789,68 @@ func (dt *DataTarget3x) Close() error {
 	return nil
 }
 
-func (dt *DataTarget3x) WritePoints(database string, points []common.DataPoint) error {
+func (dt *DataTarget3x) WritePoints(ctx context.Context, database string, points []common.DataPoint) error {
 	if dt.client == nil {
 		return fmt.Errorf("client not connected")
 	}
 
-	// 转换为 Line Protocol 格式
-	var lines []string
+	// 转换为 Line Protocol 格式，无法编码的点交给同步引擎写入死信目录
+	var enc lineprotocol.Encoder
+	var rejected []common.RejectedPoint
 	for _, point := range points {
-		line := formatLineProtocol(point)
-		if line != "" {
-			lines = append(lines, line)
+		if err := enc.AppendPoint(point.Measurement, writableTags(point.Tags), point.Fields, point.Time); err != nil {
+			rejected = append(rejected, common.RejectedPoint{Point: point, Reason: fmt.Sprintf("无法编码为 line protocol: %v", err)})
 		}
 	}
 
-	if len(lines) == 0 {
-		return nil
+	if enc.Len() > 0 {
+		// 未指定数据库时写入配置的数据库
+		if database == "" {
+			database = dt.client.database
+		}
+		if err := dt.client.WriteLineProtocolTo(ctx, database, string(enc.Bytes())); err != nil {
+			return err
+		}
+	}
+	return common.NewRejectedPointsError(rejected)
+}
+
+// EnsureDatabase 通过 configure API 创建数据库，database 为空时创建配置的数据库
+func (dt *DataTarget3x) EnsureDatabase(ctx context.Context, database string, rp common.RetentionPolicy) error {
+	if dt.client == nil {
+		return fmt.Errorf("client not connected")
+	}
+	if database == "" {
+		database = dt.client.database
+	}
+	return dt.client.CreateDatabase(ctx, database, rp.Duration)
+}
+
+// QueryLatest 查询匹配 tags 的每个 series 的最新一个点，用于在目标库中读取断点
+func (dt *DataTarget3x) QueryLatest(ctx context.Context, database, measurement string, tags map[string]string) ([]common.DataPoint, error) {
+	if dt.client == nil {
+		return nil, fmt.Errorf("client not connected")
+	}
+
+	switch dt.client.compatMode {
+	case "v1":
+		resp, err := dt.client.QueryInfluxQL(ctx, influxdb1.LatestQuery(measurement, tags), database)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Error() != nil {
+			return nil, common.ClassifyError(resp.Error())
+		}
+		return influxdb1.ParseLatest(resp), nil
+	case "v2":
+		result, err := dt.client.QueryFlux(ctx, influxdb2.LatestQuery(database, measurement, tags), dt.client.org)
+		if err != nil {
+			return nil, err
+		}
+		return influxdb2.CollectLatest(result)
 	}
 
-	data := strings.Join(lines, "\n")
-	return dt.client.WriteLineProtocol(data)
+	return nil, fmt.Errorf("compatibility mode %s does not support checkpoint storage", dt.client.compatMode)
 }
 
 // 工具函数
@@ -447,57 +858,94 @@ func escapeMeasurement(m string) string {
 	return fmt.Sprintf("\"%s\"", strings.ReplaceAll(m, "\"", "\\\""))
 }
 
-func formatLineProtocol(point common.DataPoint) string {
-	if len(point.Fields) == 0 {
-		return ""
+// 构建原生 SQL 分页查询：按时间和全部 tag 列排序，保证同一时间戳内顺序稳定，
+// 从而可以用 OFFSET 续读
+func buildSQLQuery(q common.Query, tagKeys map[string]bool) string {
+	orderBy := []string{"time"}
+	var keys []string
+	for k := range tagKeys {
+		if k != "" && k[0] != '_' && k != "time" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		orderBy = append(orderBy, escapeMeasurement(k))
 	}
 
-	// 构建 measurement 和 tags
-	var tagParts []string
-	for key, value := range point.Tags {
-		if key != "_field" && key != "_measurement" && key != "_start" && key != "_stop" && key != "time" {
-			tagParts = append(tagParts, fmt.Sprintf("%s=%s", key, value))
-		}
+	query := fmt.Sprintf("SELECT * FROM %s%s ORDER BY %s LIMIT %d",
+		escapeMeasurement(q.Measurement), sqlTimeWhere(q), strings.Join(orderBy, ", "), q.Limit)
+	if q.Cursor.Offset > 0 {
+		query += fmt.Sprintf(" OFFSET %d", q.Cursor.Offset)
 	}
+	return query
+}
 
-	measurement := point.Measurement
-	if len(tagParts) > 0 {
-		measurement += "," + strings.Join(tagParts, ",")
+// 构建原生 SQL 计数查询：每个字段一列，列名为字段名
+func buildSQLCountQuery(q common.Query, fields map[string]common.FieldType) string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	columns := make([]string, len(names))
+	for i, name := range names {
+		columns[i] = fmt.Sprintf("COUNT(%s) AS %s", escapeMeasurement(name), escapeMeasurement(name))
 	}
+	return fmt.Sprintf("SELECT %s FROM %s%s", strings.Join(columns, ", "), escapeMeasurement(q.Measurement), sqlTimeWhere(q))
+}
 
-	// 构建 fields
-	var fieldParts []string
-	for key, value := range point.Fields {
-		switch v := value.(type) {
-		case string:
-			fieldParts = append(fieldParts, fmt.Sprintf("%s=\"%s\"", key, strings.ReplaceAll(v, "\"", "\\\"")))
-		case float64:
-			fieldParts = append(fieldParts, fmt.Sprintf("%s=%g", key, v))
-		case int64:
-			fieldParts = append(fieldParts, fmt.Sprintf("%s=%di", key, v))
-		case bool:
-			fieldParts = append(fieldParts, fmt.Sprintf("%s=%t", key, v))
-		default:
-			fieldParts = append(fieldParts, fmt.Sprintf("%s=%v", key, v))
-		}
+// 从游标时间（含）到 End（不含）的 SQL 时间条件，都未指定时为空
+func sqlTimeWhere(q common.Query) string {
+	var conds []string
+	if q.Cursor.Time != 0 {
+		conds = append(conds, fmt.Sprintf("time >= '%s'", time.Unix(0, q.Cursor.Time).UTC().Format(time.RFC3339Nano)))
+	}
+	if q.End > 0 {
+		conds = append(conds, fmt.Sprintf("time < '%s'", time.Unix(0, q.End).UTC().Format(time.RFC3339Nano)))
+	}
+	if len(conds) == 0 {
+		return ""
 	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
 
-	if len(fieldParts) == 0 {
+// 把一个点编码为一行 line protocol，无法编码时返回空字符串
+func formatLineProtocol(point common.DataPoint) string {
+	line, err := lineprotocol.AppendPoint(nil, point.Measurement, writableTags(point.Tags), point.Fields, point.Time)
+	if err != nil {
 		return ""
 	}
+	return strings.TrimSuffix(string(line), "\n")
+}
 
-	// 构建完整的 line protocol
-	timestamp := point.Time.UnixNano()
-	return fmt.Sprintf("%s %s %d", measurement, strings.Join(fieldParts, ","), timestamp)
+// 2.x 和 3.x 查询结果中的系统列，写入时不作为 tag
+var systemTags = map[string]bool{"_field": true, "_measurement": true, "_start": true, "_stop": true, "time": true}
+
+// 去掉系统列后的 tag，没有系统列时直接返回原 map
+func writableTags(tags map[string]string) map[string]string {
+	for key := range tags {
+		if !systemTags[key] {
+			continue
+		}
+		filtered := make(map[string]string, len(tags))
+		for k, v := range tags {
+			if !systemTags[k] {
+				filtered[k] = v
+			}
+		}
+		return filtered
+	}
+	return tags
 }
 
-// 响应解析函数 - 解析 InfluxQL 响应
-func (ds *DataSource3x) parseInfluxQLResponse(resp *client.Response, startTime int64) ([]common.DataPoint, int64, error) {
+// 响应解析函数 - 解析 InfluxQL 响应，返回点和无法解析时间而跳过的行数
+func (ds *DataSource3x) parseInfluxQLResponse(resp *client.Response) ([]common.DataPoint, int) {
 	var points []common.DataPoint
-	var maxTime int64 = startTime
+	skipped := 0
 
 	if len(resp.Results) == 0 || len(resp.Results[0].Series) == 0 {
-		return points, maxTime, nil
+		return points, skipped
 	}
 
 	for _, series := range resp.Results[0].Series {
@@ -505,7 +953,6 @@ func (ds *DataSource3x) parseInfluxQLResponse(resp *client.Response, startTime i
 			tags := make(map[string]string)
 			fields := make(map[string]interface{})
 			var t time.Time
-			var tUnix int64
 			skip := false
 
 			// 复制 series tags
@@ -518,19 +965,19 @@ func (ds *DataSource3x) parseInfluxQLResponse(resp *client.Response, startTime i
 				switch col {
 				case "time":
 					v := row[idx]
+					var err error
 					switch val := v.(type) {
 					case string:
-						if parsedTime, err := time.Parse(time.RFC3339, val); err == nil {
-							t = parsedTime
-							tUnix = t.UnixNano()
-						}
+						t, err = time.Parse(time.RFC3339Nano, val)
 					case json.Number:
-						if ns, err := val.Int64(); err == nil {
-							t = time.Unix(0, ns)
-							tUnix = ns
-						}
+						var ns int64
+						ns, err = val.Int64()
+						t = time.Unix(0, ns)
 					default:
-						logx.Warn(fmt.Sprintf("未知time类型: %T, measurement: %s", val, series.Name))
+						err = fmt.Errorf("未知time类型: %T", val)
+					}
+					if err != nil {
+						logx.Warn(fmt.Sprintf("跳过无法解析时间的行，measurement: %s，错误: %v", series.Name, err))
 						skip = true
 					}
 				default:
@@ -543,13 +990,10 @@ func (ds *DataSource3x) parseInfluxQLResponse(resp *client.Response, startTime i
 			}
 
 			if skip {
+				skipped++
 				continue
 			}
 
-			if tUnix > maxTime {
-				maxTime = tUnix
-			}
-
 			points = append(points, common.DataPoint{
 				Measurement: series.Name,
 				Tags:        tags,
@@ -559,72 +1003,5 @@ func (ds *DataSource3x) parseInfluxQLResponse(resp *client.Response, startTime i
 		}
 	}
 
-	return points, maxTime, nil
-}
-
-func (ds *DataSource3x) parseFluxResponse(result *api.QueryTableResult, startTime int64) ([]common.DataPoint, int64, error) {
-	var points []common.DataPoint
-	var maxTime int64 = startTime
-	pointsMap := make(map[string]*common.DataPoint) // 按时间戳分组
-
-	for result.Next() {
-		record := result.Record()
-		timeKey := record.Time().Format(time.RFC3339Nano)
-		measurement := record.Measurement()
-
-		// 获取或创建数据点
-		if _, exists := pointsMap[timeKey]; !exists {
-			pointsMap[timeKey] = &common.DataPoint{
-				Measurement: measurement,
-				Tags:        make(map[string]string),
-				Fields:      make(map[string]interface{}),
-				Time:        record.Time(),
-			}
-		}
-
-		point := pointsMap[timeKey]
-
-		// 复制所有 tags
-		for key, value := range record.Values() {
-			if key[0] != '_' && key != "result" && key != "table" {
-				// 这是 tag
-				if strVal, ok := value.(string); ok {
-					point.Tags[key] = strVal
-				}
-			}
-		}
-
-		// 设置 field
-		if record.Field() != "" && record.Value() != nil {
-			point.Fields[record.Field()] = record.Value()
-		}
-
-		// 更新最大时间
-		if record.Time().UnixNano() > maxTime {
-			maxTime = record.Time().UnixNano()
-		}
-	}
-
-	if result.Err() != nil {
-		return nil, 0, result.Err()
-	}
-
-	// 转换为切片
-	for _, point := range pointsMap {
-		points = append(points, *point)
-	}
-
-	return points, maxTime, nil
-}
-
-func (ds *DataSource3x) parseSQLResponse(data []byte, startTime int64) ([]common.DataPoint, int64, error) {
-	// 解析 SQL 查询的 JSON 响应
-	var result map[string]interface{}
-	if err := json.Unmarshal(data, &result); err != nil {
-		return nil, 0, err
-	}
-
-	// 这里需要根据实际的 3.x SQL API 响应格式来实现
-	// 目前返回空结果
-	return []common.DataPoint{}, startTime, nil
+	return points, skipped
 }
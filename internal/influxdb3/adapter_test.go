@@ -1,6 +1,14 @@
 package influxdb3
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -139,7 +147,7 @@ func TestDataSource3x_GetMeasurements(t *testing.T) {
 		t.Fatalf("Connect() error = %v", err)
 	}
 
-	measurements, err := ds.GetMeasurements("test-db")
+	measurements, err := ds.GetMeasurements(context.Background(), "test-db")
 	if err != nil {
 		t.Errorf("GetMeasurements() error = %v", err)
 	}
@@ -285,7 +293,7 @@ func TestDataTarget3x_WritePoints(t *testing.T) {
 		},
 	}
 
-	err = dt.WritePoints("test-db", points)
+	err = dt.WritePoints(context.Background(), "test-db", points)
 	if err != nil {
 		t.Errorf("WritePoints() error = %v", err)
 	}
@@ -343,7 +351,7 @@ func TestDataSource3x_GetDatabasesNotConnected(t *testing.T) {
 
 	ds := NewV1CompatDataSource(config)
 	
-	_, err := ds.GetDatabases()
+	_, err := ds.GetDatabases(context.Background())
 	if err == nil {
 		t.Error("未连接时应该返回错误")
 	}
@@ -359,7 +367,7 @@ func TestDataSource3x_GetMeasurementsNotConnected(t *testing.T) {
 
 	ds := NewV1CompatDataSource(config)
 	
-	_, err := ds.GetMeasurements("test-db")
+	_, err := ds.GetMeasurements(context.Background(), "test-db")
 	if err == nil {
 		t.Error("未连接时应该返回错误")
 	}
@@ -375,7 +383,7 @@ func TestDataSource3x_QueryDataNotConnected(t *testing.T) {
 
 	ds := NewV1CompatDataSource(config)
 	
-	_, _, err := ds.QueryData("test-db", "test_measurement", 0, 1000)
+	_, _, err := ds.QueryData(context.Background(), common.Query{DB: "test-db", Measurement: "test_measurement", Limit: 1000})
 	if err == nil {
 		t.Error("未连接时应该返回错误")
 	}
@@ -400,7 +408,7 @@ func TestDataTarget3x_WritePointsNotConnected(t *testing.T) {
 		},
 	}
 	
-	err := dt.WritePoints("test-db", points)
+	err := dt.WritePoints(context.Background(), "test-db", points)
 	if err == nil {
 		t.Error("未连接时应该返回错误")
 	}
@@ -488,7 +496,7 @@ func TestDataTarget3x_WriteLineProtocol_Integration(t *testing.T) {
 		},
 	}
 
-	err = dt.WritePoints("testbucket", points)
+	err = dt.WritePoints(context.Background(), "testbucket", points)
 	if err != nil {
 		t.Fatalf("WritePoints() error = %v", err)
 	}
@@ -528,14 +536,14 @@ func TestDataSource3x_QueryData_V2Compat_Integration(t *testing.T) {
 			Time:        time.Now(),
 		},
 	}
-	_ = dt.WritePoints("testbucket", testPoints)
+	_ = dt.WritePoints(context.Background(), "testbucket", testPoints)
 	dt.Close()
 
 	// 等待数据写入
 	time.Sleep(2 * time.Second)
 
-	// 测试查询 (startTime 使用 0 表示从最早开始，batchSize 使用 1000)
-	points, lastTime, err := ds.QueryData("testbucket", "query_test_3x", 0, 1000)
+	// 测试查询 (游标为零值表示从最早开始，batchSize 使用 1000)
+	points, cursor, err := ds.QueryData(context.Background(), common.Query{DB: "testbucket", Measurement: "query_test_3x", Limit: 1000})
 	if err != nil {
 		t.Fatalf("QueryData() error = %v", err)
 	}
@@ -543,7 +551,7 @@ func TestDataSource3x_QueryData_V2Compat_Integration(t *testing.T) {
 	if len(points) == 0 {
 		t.Log("Warning: No points returned, but no error")
 	} else {
-		t.Logf("Successfully queried %d points from InfluxDB 3.x (v2 compat), lastTime=%d", len(points), lastTime)
+		t.Logf("Successfully queried %d points from InfluxDB 3.x (v2 compat), cursor=%+v", len(points), cursor)
 	}
 }
 
@@ -581,13 +589,13 @@ func TestDataSource3x_GetTagKeys_V2Compat_Integration(t *testing.T) {
 			Time:   time.Now(),
 		},
 	}
-	_ = dt.WritePoints("testbucket", testPoints)
+	_ = dt.WritePoints(context.Background(), "testbucket", testPoints)
 	dt.Close()
 
 	time.Sleep(2 * time.Second)
 
 	// 测试获取 tag keys
-	tagKeys, err := ds.GetTagKeys("testbucket", "tagkeys_test_3x")
+	tagKeys, err := ds.GetTagKeys(context.Background(), "testbucket", "tagkeys_test_3x")
 	if err != nil {
 		t.Fatalf("GetTagKeys() error = %v", err)
 	}
@@ -620,7 +628,7 @@ func TestDataSource3x_GetMeasurements_V2Compat_Integration(t *testing.T) {
 	defer ds.Close()
 
 	// 测试获取 measurements
-	measurements, err := ds.GetMeasurements("testbucket")
+	measurements, err := ds.GetMeasurements(context.Background(), "testbucket")
 	if err != nil {
 		t.Fatalf("GetMeasurements() error = %v", err)
 	}
@@ -652,7 +660,7 @@ func TestDataSource3x_GetDatabases_V2Compat_Integration(t *testing.T) {
 	defer ds.Close()
 
 	// 测试获取 databases（在 v2 compat 模式下返回 buckets）
-	databases, err := ds.GetDatabases()
+	databases, err := ds.GetDatabases(context.Background())
 	if err != nil {
 		t.Fatalf("GetDatabases() error = %v", err)
 	}
@@ -662,3 +670,283 @@ func TestDataSource3x_GetDatabases_V2Compat_Integration(t *testing.T) {
 		t.Logf("  - %s", db)
 	}
 }
+
+func TestFormatLineProtocolFieldTypes(t *testing.T) {
+	ts := time.Unix(0, 1609459200000000000)
+	tests := map[interface{}]string{
+		int64(-3):  "m v=-3i 1609459200000000000",
+		uint64(42): "m v=42u 1609459200000000000",
+		1.5:        "m v=1.5 1609459200000000000",
+		true:       "m v=true 1609459200000000000",
+		"ok":       `m v="ok" 1609459200000000000`,
+	}
+	for value, want := range tests {
+		point := common.DataPoint{Measurement: "m", Fields: map[string]interface{}{"v": value}, Time: ts}
+		if got := formatLineProtocol(point); got != want {
+			t.Errorf("formatLineProtocol(%T) = %s, want %s", value, got, want)
+		}
+	}
+}
+
+func TestTableColumns(t *testing.T) {
+	rows := []map[string]interface{}{
+		{"column_name": "host", "data_type": "Dictionary(Int32, Utf8)"},
+		{"column_name": "time", "data_type": "Timestamp(Nanosecond, None)"},
+		{"column_name": "usage", "data_type": "Float64"},
+		{"column_name": "count", "data_type": "Int64"},
+		{"column_name": "bytes", "data_type": "UInt64"},
+		{"column_name": "status", "data_type": "Utf8"},
+		{"column_name": "up", "data_type": "Boolean"},
+	}
+	columns := newTableColumns()
+	for _, row := range rows {
+		columns.add(row)
+	}
+	expected := map[string]common.FieldType{
+		"usage": common.FieldFloat, "count": common.FieldInteger, "bytes": common.FieldUnsigned,
+		"status": common.FieldString, "up": common.FieldBoolean,
+	}
+	if len(columns.fields) != len(expected) {
+		t.Fatalf("fields = %v, want %v", columns.fields, expected)
+	}
+	for name, typ := range expected {
+		if columns.fields[name] != typ {
+			t.Errorf("column %s type = %s, want %s", name, columns.fields[name], typ)
+		}
+	}
+	if len(columns.tags) != 1 || !columns.tags["host"] {
+		t.Errorf("tags = %v, want [host]", columns.tags)
+	}
+
+	// 按列类型转换一行查询结果，null 列跳过
+	p, err := columns.point("cpu", map[string]interface{}{
+		"time": "2024-01-01T00:00:00.5", "host": "a", "usage": json.Number("1"), "count": json.Number("3"),
+		"bytes": json.Number("18446744073709551615"), "status": nil, "up": true,
+	})
+	if err != nil {
+		t.Fatalf("point() error = %v", err)
+	}
+	want := common.DataPoint{
+		Measurement: "cpu",
+		Tags:        map[string]string{"host": "a"},
+		Fields:      map[string]interface{}{"usage": 1.0, "count": int64(3), "bytes": uint64(math.MaxUint64), "up": true},
+		Time:        time.Date(2024, 1, 1, 0, 0, 0, 5e8, time.UTC),
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("point() = %#v, want %#v", p, want)
+	}
+	if _, err := columns.point("cpu", map[string]interface{}{"usage": 1.0}); err == nil {
+		t.Error("point() should fail without time column")
+	}
+}
+
+func TestParseSQLTime(t *testing.T) {
+	want := time.Date(2024, 1, 1, 0, 0, 0, 123456789, time.UTC)
+	for _, v := range []interface{}{"2024-01-01T00:00:00.123456789", "2024-01-01T00:00:00.123456789Z", "2024-01-01 00:00:00.123456789", json.Number("1704067200123456789")} {
+		got, err := parseSQLTime(v)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("parseSQLTime(%v) = %v, %v, want %v", v, got, err, want)
+		}
+	}
+	if _, err := parseSQLTime("yesterday"); err == nil {
+		t.Error("parseSQLTime() should fail for invalid time")
+	}
+}
+
+// 模拟 /api/v3/query_sql，按查询内容返回 JSONL
+func newQuerySQLServer(queries *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			return
+		}
+		if r.URL.Path != "/api/v3/query_sql" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body["format"] != "jsonl" || body["db"] != "metrics" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		q := body["q"]
+		*queries = append(*queries, q)
+		switch {
+		case strings.Contains(q, "information_schema.tables"):
+			fmt.Fprintln(w, `{"table_name":"cpu"}`)
+			fmt.Fprintln(w, `{"table_name":"mem"}`)
+		case strings.Contains(q, "information_schema.columns"):
+			fmt.Fprintln(w, `{"column_name":"host","data_type":"Dictionary(Int32, Utf8)"}`)
+			fmt.Fprintln(w, `{"column_name":"time","data_type":"Timestamp(Nanosecond, None)"}`)
+			fmt.Fprintln(w, `{"column_name":"count","data_type":"Int64"}`)
+		case strings.Contains(q, "min(time)"):
+			fmt.Fprintln(w, `{"time":"2024-01-01T00:00:00"}`)
+		case strings.Contains(q, "max(time)"):
+			fmt.Fprintln(w, `{"time":"2024-01-01T00:00:01"}`)
+		case strings.Contains(q, "COUNT("):
+			fmt.Fprintln(w, `{"count":2}`)
+		default:
+			fmt.Fprintln(w, `{"count":1,"host":"a","time":"2024-01-01T00:00:00"}`)
+			fmt.Fprintln(w, `{"count":2,"host":"b","time":"2024-01-01T00:00:00"}`)
+		}
+	}))
+}
+
+func TestDataSource3x_Native(t *testing.T) {
+	var queries []string
+	server := newQuerySQLServer(&queries)
+	defer server.Close()
+
+	ds := NewNativeDataSource(NativeConfig{URL: server.URL, Database: "metrics"})
+	if err := ds.Connect(); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer ds.Close()
+	ctx := context.Background()
+
+	measurements, err := ds.GetMeasurements(ctx, "metrics")
+	if err != nil || !reflect.DeepEqual(measurements, []string{"cpu", "mem"}) {
+		t.Errorf("GetMeasurements() = %v, %v", measurements, err)
+	}
+	fields, err := ds.GetFieldKeys(ctx, "metrics", "cpu")
+	if err != nil || len(fields) != 1 || fields["count"] != common.FieldInteger {
+		t.Errorf("GetFieldKeys() = %v, %v", fields, err)
+	}
+	tags, err := ds.GetTagKeys(ctx, "metrics", "cpu")
+	if err != nil || !tags["host"] || tags["count"] {
+		t.Errorf("GetTagKeys() = %v, %v", tags, err)
+	}
+	first, last, err := ds.TimeRange(ctx, "metrics", "", "cpu")
+	if err != nil || first != 1704067200000000000 || last != 1704067201000000000 {
+		t.Errorf("TimeRange() = %d, %d, %v", first, last, err)
+	}
+	queries = nil
+	counts, err := ds.CountFields(ctx, common.Query{DB: "metrics", Measurement: "cpu", Cursor: common.Cursor{Time: first}, End: last})
+	if err != nil || len(counts) != 1 || counts["count"] != 2 {
+		t.Errorf("CountFields() = %v, %v", counts, err)
+	}
+	wantCount := `SELECT COUNT("count") AS "count" FROM "cpu" WHERE time >= '2024-01-01T00:00:00Z' AND time < '2024-01-01T00:00:01Z'`
+	if got := queries[len(queries)-1]; got != wantCount {
+		t.Errorf("count query = %s\nwant %s", got, wantCount)
+	}
+
+	// 第二页从上一页最后一个时间戳续读，同一时间戳内按 OFFSET 跳过已读的点
+	queries = nil
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano()
+	q := common.Query{DB: "metrics", Measurement: "cpu", Cursor: common.Cursor{Time: start}, End: start + int64(time.Hour), Limit: 2}
+	points, cursor, err := ds.QueryData(ctx, q)
+	if err != nil {
+		t.Fatalf("QueryData() error = %v", err)
+	}
+	if len(points) != 2 || points[0].Fields["count"] != int64(1) || points[1].Tags["host"] != "b" {
+		t.Errorf("QueryData() points = %+v", points)
+	}
+	if cursor.Time != start || cursor.Offset != 2 {
+		t.Errorf("QueryData() cursor = %+v, want offset 2 at %d", cursor, start)
+	}
+	q.Cursor = cursor
+	if _, _, err := ds.QueryData(ctx, q); err != nil {
+		t.Fatalf("QueryData() error = %v", err)
+	}
+	want := `SELECT * FROM "cpu" WHERE time >= '2024-01-01T00:00:00Z' AND time < '2024-01-01T01:00:00Z' ORDER BY time, "host" LIMIT 2 OFFSET 2`
+	if got := queries[len(queries)-1]; got != want {
+		t.Errorf("query = %s\nwant %s", got, want)
+	}
+}
+
+func TestFormatLineProtocolEscaping(t *testing.T) {
+	point := common.DataPoint{
+		Measurement: "cpu load",
+		Tags:        map[string]string{"region": "us west", "host": "a,b", "_measurement": "cpu load", "_field": "v"},
+		Fields:      map[string]interface{}{"v": 1.5, "note": `x="y"`},
+		Time:        time.Unix(0, 1609459200000000000),
+	}
+	want := `cpu\ load,host=a\,b,region=us\ west note="x=\"y\"",v=1.5 1609459200000000000`
+	if got := formatLineProtocol(point); got != want {
+		t.Errorf("formatLineProtocol() = %s, want %s", got, want)
+	}
+
+	// NaN 无法编码
+	point.Fields = map[string]interface{}{"v": math.NaN()}
+	if got := formatLineProtocol(point); got != "" {
+		t.Errorf("formatLineProtocol() = %s, want empty string for NaN", got)
+	}
+}
+
+// 模拟 v1 兼容模式的 /query：分页查询返回的同一时间戳内的行顺序不固定，
+// 按时间戳查询返回该时刻的全部点
+func newInfluxQLServer(queries *[]string, page string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ping" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		q := r.FormValue("q")
+		*queries = append(*queries, q)
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(q, "WHERE time = ") {
+			fmt.Fprint(w, `{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["time","host","v"],"values":[[2000,"a",1],[2000,"b",2],[2000,"c",3]]}]}]}`)
+			return
+		}
+		fmt.Fprintf(w, `{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["time","host","v"],"values":%s}]}]}`, page)
+	}))
+}
+
+func TestDataSource3x_QueryDataV1WholeTimestamps(t *testing.T) {
+	var queries []string
+	// 页满，最后一个时间戳 2000 只返回了部分点，另有一行时间无法解析
+	server := newInfluxQLServer(&queries, `[[1000,"x",0],["bad",null,9],[2000,"c",3],[2000,"a",1]]`)
+	defer server.Close()
+
+	ds := NewV1CompatDataSource(V1CompatConfig{Addr: server.URL, Database: "metrics"})
+	if err := ds.Connect(); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer ds.Close()
+
+	// 旧断点中的偏移不再用于 OFFSET
+	q := common.Query{DB: "metrics", Measurement: "cpu", Cursor: common.Cursor{Time: 1000, Offset: 1}, Limit: 4}
+	points, cursor, err := ds.QueryData(context.Background(), q)
+	if err != nil {
+		t.Fatalf("QueryData() error = %v", err)
+	}
+	if strings.Contains(queries[0], "OFFSET") {
+		t.Errorf("3.x InfluxQL 分页不应使用 OFFSET: %s", queries[0])
+	}
+	var got []string
+	for _, p := range points {
+		got = append(got, fmt.Sprintf("%d/%v", p.Time.UnixNano(), p.Fields["host"]))
+	}
+	if want := []string{"1000/x", "2000/a", "2000/b", "2000/c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("QueryData() points = %v, want %v", got, want)
+	}
+	// 时间戳 2000 已全部读取，跳过的行计入本页行数
+	if cursor.Time != 2001 || cursor.Offset != 0 || common.PageRows(points, cursor) != 4 {
+		t.Errorf("QueryData() cursor = %+v", cursor)
+	}
+}
+
+func TestDataSource3x_QueryDataV1ShortPageCountsSkippedRows(t *testing.T) {
+	var queries []string
+	server := newInfluxQLServer(&queries, `[[1000,"x",0],["bad",null,9]]`)
+	defer server.Close()
+
+	ds := NewV1CompatDataSource(V1CompatConfig{Addr: server.URL, Database: "metrics"})
+	if err := ds.Connect(); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer ds.Close()
+
+	q := common.Query{DB: "metrics", Measurement: "cpu", Cursor: common.Cursor{Time: 1000}, Limit: 3}
+	points, cursor, err := ds.QueryData(context.Background(), q)
+	if err != nil {
+		t.Fatalf("QueryData() error = %v", err)
+	}
+	// 返回 1 个点，但读取了 2 行
+	if len(points) != 1 || common.PageRows(points, cursor) != 2 || cursor.Time != 1001 {
+		t.Errorf("QueryData() = %d points, cursor %+v", len(points), cursor)
+	}
+	// 不足一页时已读到末尾，不需要单独读取最后一个时间戳
+	if len(queries) != 1 {
+		t.Errorf("期望查询 1 次, 实际为 %d: %v", len(queries), queries)
+	}
+}
@@ -14,6 +14,9 @@ import (
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api"
 	client "github.com/influxdata/influxdb1-client/v2"
+	"github.com/ygqygq2/influxdb-sync/internal/common"
+	"github.com/ygqygq2/influxdb-sync/internal/influxdb1"
+	syncv2 "github.com/ygqygq2/influxdb-sync/internal/influxdb2"
 )
 
 // Client3x InfluxDB 3.x 客户端，支持多种兼容模式
@@ -31,9 +34,8 @@ type Client3x struct {
 
 // NewClient3x 创建新的 3.x 客户端
 func NewClient3x(config NativeConfig) (*Client3x, error) {
-	httpClient := &http.Client{
-		Timeout: 30 * time.Second,
-	}
+	// 不设置整体超时，由每次操作的 context 控制，避免截断流式读取的查询结果
+	httpClient := &http.Client{}
 
 	c := &Client3x{
 		baseURL:    strings.TrimSuffix(config.URL, "/"),
@@ -60,9 +62,7 @@ func NewV1CompatClient(config V1CompatConfig) (*Client3x, error) {
 		return nil, fmt.Errorf("failed to create v1 client: %w", err)
 	}
 
-	httpClient := &http.Client{
-		Timeout: 30 * time.Second,
-	}
+	httpClient := &http.Client{}
 
 	c := &Client3x{
 		baseURL:    strings.TrimSuffix(config.Addr, "/"),
@@ -80,9 +80,7 @@ func NewV2CompatClient(config V2CompatConfig) (*Client3x, error) {
 	// 创建 v2 客户端
 	v2Client := influxdb2.NewClient(config.URL, config.Token)
 
-	httpClient := &http.Client{
-		Timeout: 30 * time.Second,
-	}
+	httpClient := &http.Client{}
 
 	c := &Client3x{
 		baseURL:    strings.TrimSuffix(config.URL, "/"),
@@ -151,33 +149,30 @@ func (c *Client3x) Ping(timeout time.Duration) error {
 	return nil
 }
 
-// QuerySQL 执行 SQL 查询 (原生 3.x 功能)
-func (c *Client3x) QuerySQL(query string) ([]byte, error) {
+// QuerySQLRows 通过 /api/v3/query_sql 以 JSONL 格式执行 SQL 查询（原生 3.x 功能），
+// 边读取响应边解码，每解码一行调用一次 fn，不缓存整个响应。数值以 json.Number 返回，
+// database 为空时查询配置的数据库
+func (c *Client3x) QuerySQLRows(ctx context.Context, database, query string, fn func(row map[string]interface{}) error) error {
 	if c.compatMode != "native" {
-		return nil, fmt.Errorf("SQL queries only supported in native mode")
-	}
-
-	queryURL := c.baseURL + "/v1/sql"
-
-	// 构建请求体
-	reqBody := map[string]interface{}{
-		"query":    query,
-		"database": c.database,
+		return fmt.Errorf("SQL queries only supported in native mode")
 	}
-	if c.namespace != "" {
-		reqBody["namespace"] = c.namespace
+	if database == "" {
+		database = c.database
 	}
 
-	jsonData, err := json.Marshal(reqBody)
+	jsonData, err := json.Marshal(map[string]string{
+		"db":     database,
+		"q":      query,
+		"format": "jsonl",
+	})
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	req, err := http.NewRequest("POST", queryURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/v3/query_sql", bytes.NewBuffer(jsonData))
 	if err != nil {
-		return nil, err
+		return err
 	}
-
 	req.Header.Set("Content-Type", "application/json")
 	if c.token != "" {
 		req.Header.Set("Authorization", "Bearer "+c.token)
@@ -185,41 +180,66 @@ func (c *Client3x) QuerySQL(query string) ([]byte, error) {
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return common.ClassifyError(err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("SQL query failed with status %d: %s", resp.StatusCode, string(body))
+		return responseError(resp, "SQL query failed")
 	}
 
-	return io.ReadAll(resp.Body)
+	// JSONL 每行一个对象，json.Decoder 可以依次解码连续的 JSON 值
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	for {
+		var row map[string]interface{}
+		if err := decoder.Decode(&row); err == io.EOF {
+			return nil
+		} else if err != nil {
+			// 读取响应时连接中断等错误按类别重试
+			return common.ClassifyError(fmt.Errorf("读取 SQL 查询结果失败: %w", err))
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
 }
 
 // QueryInfluxQL 执行 InfluxQL 查询 (v1 兼容)
-func (c *Client3x) QueryInfluxQL(query, database string) (*client.Response, error) {
+func (c *Client3x) QueryInfluxQL(ctx context.Context, query, database string) (*client.Response, error) {
 	if c.compatMode != "v1" || c.v1Client == nil {
 		return nil, fmt.Errorf("InfluxQL queries only supported in v1 compatibility mode")
 	}
 
 	q := client.NewQuery(query, database, "ns")
-	return c.v1Client.Query(q)
+	return influxdb1.QueryContext(ctx, c.v1Client, q)
 }
 
 // QueryFlux 执行 Flux 查询 (v2 兼容)
-func (c *Client3x) QueryFlux(query, org string) (*api.QueryTableResult, error) {
+func (c *Client3x) QueryFlux(ctx context.Context, query, org string) (*api.QueryTableResult, error) {
 	if c.compatMode != "v2" || c.v2Client == nil {
 		return nil, fmt.Errorf("Flux queries only supported in v2 compatibility mode")
 	}
 
 	queryAPI := c.v2Client.QueryAPI(org)
-	result, err := queryAPI.Query(context.Background(), query)
-	return result, err
+	result, err := queryAPI.Query(ctx, query)
+	return result, syncv2.ClassifyError(err)
+}
+
+// 把非 2xx 响应转换为按状态码和 Retry-After 分类的错误
+func responseError(resp *http.Response, msg string) error {
+	body, _ := io.ReadAll(resp.Body)
+	err := fmt.Errorf("%s with status %d: %s", msg, resp.StatusCode, string(body))
+	return common.NewHTTPError(resp.StatusCode, common.ParseRetryAfter(resp.Header.Get("Retry-After")), err)
 }
 
 // WriteLineProtocol 写入 Line Protocol 数据
-func (c *Client3x) WriteLineProtocol(data string) error {
+func (c *Client3x) WriteLineProtocol(ctx context.Context, data string) error {
+	return c.WriteLineProtocolTo(ctx, c.database, data)
+}
+
+// WriteLineProtocolTo 写入 Line Protocol 数据到指定的数据库
+func (c *Client3x) WriteLineProtocolTo(ctx context.Context, database, data string) error {
 	var writeURL string
 
 	switch c.compatMode {
@@ -227,14 +247,14 @@ func (c *Client3x) WriteLineProtocol(data string) error {
 		// v1 兼容模式
 		writeURL = c.baseURL + "/write"
 		params := url.Values{}
-		params.Set("db", c.database)
+		params.Set("db", database)
 		writeURL += "?" + params.Encode()
 
 	case "v2":
 		// v2 兼容模式
 		writeURL = c.baseURL + "/api/v2/write"
 		params := url.Values{}
-		params.Set("bucket", c.database)
+		params.Set("bucket", database)
 		params.Set("org", c.org) // 添加 org 参数
 		params.Set("precision", "ns")
 		writeURL += "?" + params.Encode()
@@ -243,7 +263,7 @@ func (c *Client3x) WriteLineProtocol(data string) error {
 		// 原生 3.x 模式
 		writeURL = c.baseURL + "/v1/write"
 		params := url.Values{}
-		params.Set("database", c.database)
+		params.Set("database", database)
 		if c.namespace != "" {
 			params.Set("namespace", c.namespace)
 		}
@@ -251,7 +271,7 @@ func (c *Client3x) WriteLineProtocol(data string) error {
 		writeURL += "?" + params.Encode()
 	}
 
-	req, err := http.NewRequest("POST", writeURL, strings.NewReader(data))
+	req, err := http.NewRequestWithContext(ctx, "POST", writeURL, strings.NewReader(data))
 	if err != nil {
 		return err
 	}
@@ -268,27 +288,26 @@ func (c *Client3x) WriteLineProtocol(data string) error {
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return err
+		return common.ClassifyError(err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("write failed with status %d: %s", resp.StatusCode, string(body))
+		return responseError(resp, "write failed")
 	}
 
 	return nil
 }
 
 // GetDatabases 获取数据库列表
-func (c *Client3x) GetDatabases() ([]string, error) {
+func (c *Client3x) GetDatabases(ctx context.Context) ([]string, error) {
 	switch c.compatMode {
 	case "v1":
 		if c.v1Client == nil {
 			return nil, fmt.Errorf("v1 client not available")
 		}
 		q := client.NewQuery("SHOW DATABASES", "", "")
-		resp, err := c.v1Client.Query(q)
+		resp, err := influxdb1.QueryContext(ctx, c.v1Client, q)
 		if err != nil {
 			return nil, err
 		}
@@ -325,3 +344,52 @@ func (c *Client3x) GetDatabases() ([]string, error) {
 
 	return []string{}, nil
 }
+
+// CreateDatabase 通过 configure API 创建数据库，已存在时不做任何修改。
+// retention 为 0 时不设置保留时长（永久保留）
+func (c *Client3x) CreateDatabase(ctx context.Context, database string, retention time.Duration) error {
+	reqBody := map[string]interface{}{"db": database}
+	if retention > 0 {
+		reqBody["retention_period"] = retentionPeriod(retention)
+	}
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/v3/configure/database", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return common.ClassifyError(err)
+	}
+	defer resp.Body.Close()
+
+	// 409 表示数据库已存在
+	if resp.StatusCode == http.StatusConflict {
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return responseError(resp, "create database failed")
+	}
+	return nil
+}
+
+// 保留时长格式化为 3.x 接受的单个单位形式，如 7d、36h
+func retentionPeriod(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	default:
+		return fmt.Sprintf("%ds", (d+time.Second-1)/time.Second)
+	}
+}
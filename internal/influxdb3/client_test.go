@@ -1,9 +1,18 @@
 package influxdb3
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/ygqygq2/influxdb-sync/internal/common"
 )
 
 func TestNewClient3x(t *testing.T) {
@@ -136,8 +145,169 @@ func TestClient3x_WriteLineProtocol(t *testing.T) {
 	// 测试数据
 	data := fmt.Sprintf("measurement,tag1=value1 field1=1.0 %d", time.Now().UnixNano())
 
-	err = client.WriteLineProtocol(data)
+	err = client.WriteLineProtocol(context.Background(), data)
 	if err != nil {
 		t.Errorf("WriteLineProtocol() error = %v", err)
 	}
 }
+
+func TestResponseError(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusServiceUnavailable,
+		Header:     http.Header{"Retry-After": []string{"2"}},
+		Body:       io.NopCloser(strings.NewReader("overloaded")),
+	}
+	err := responseError(resp, "write failed")
+
+	var ae *common.AdapterError
+	if !errors.As(err, &ae) {
+		t.Fatalf("期望返回 AdapterError, 实际为 %T", err)
+	}
+	if ae.Class != common.ClassRetryable || ae.StatusCode != 503 || ae.RetryAfter != 2*time.Second {
+		t.Errorf("分类错误: %+v", ae)
+	}
+	if !strings.Contains(err.Error(), "overloaded") {
+		t.Errorf("错误信息应包含响应内容: %v", err)
+	}
+}
+
+func TestClient3x_CreateDatabase(t *testing.T) {
+	var bodies []map[string]interface{}
+	exists := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/configure/database" || r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		if exists {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		exists = true
+	}))
+	defer server.Close()
+
+	c, err := NewClient3x(NativeConfig{URL: server.URL, Token: "test-token", Database: "default_db"})
+	if err != nil {
+		t.Fatalf("NewClient3x() error = %v", err)
+	}
+	if err := c.CreateDatabase(context.Background(), "bak_db", 7*24*time.Hour); err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	// 已存在时不报错
+	if err := c.CreateDatabase(context.Background(), "bak_db", 0); err != nil {
+		t.Fatalf("数据库已存在时不应报错: %v", err)
+	}
+
+	if len(bodies) != 2 || bodies[0]["db"] != "bak_db" || bodies[0]["retention_period"] != "7d" {
+		t.Errorf("请求内容不正确: %v", bodies)
+	}
+	if _, ok := bodies[1]["retention_period"]; ok {
+		t.Errorf("永久保留时不应设置 retention_period: %v", bodies[1])
+	}
+}
+
+func TestClient3x_WriteLineProtocolTo(t *testing.T) {
+	var databases []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			return
+		}
+		databases = append(databases, r.URL.Query().Get("database"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	target := NewNativeDataTarget(NativeConfig{URL: server.URL, Database: "default_db"})
+	if err := target.Connect(); err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	points := []common.DataPoint{{Measurement: "cpu", Fields: map[string]interface{}{"value": 1.0}, Time: time.Unix(1, 0)}}
+	for _, db := range []string{"telegraf_1y", ""} {
+		if err := target.WritePoints(context.Background(), db, points); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	// 指定数据库时写入该库，未指定时写入配置的数据库
+	if len(databases) != 2 || databases[0] != "telegraf_1y" || databases[1] != "default_db" {
+		t.Errorf("写入的数据库不正确: %v", databases)
+	}
+}
+
+func TestQuerySQLRowsStreams(t *testing.T) {
+	received := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"v":1}`)
+		w.(http.Flusher).Flush()
+		// 第一行被处理后才发送剩余内容
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			return
+		}
+		fmt.Fprint(w, `{"v":2}`+"\n"+`{"v":3}`)
+	}))
+	defer server.Close()
+
+	c, _ := NewClient3x(NativeConfig{URL: server.URL, Database: "db"})
+	var values []string
+	err := c.QuerySQLRows(context.Background(), "", "SELECT v FROM m", func(row map[string]interface{}) error {
+		if len(values) == 0 {
+			close(received)
+		}
+		values = append(values, row["v"].(json.Number).String())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("QuerySQLRows() error = %v", err)
+	}
+	if strings.Join(values, ",") != "1,2,3" {
+		t.Errorf("QuerySQLRows() rows = %v", values)
+	}
+}
+
+func TestQuerySQLRowsContextDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"v":1}`)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	// 流式读取不受客户端整体超时限制，只由操作的 context 结束
+	c, _ := NewClient3x(NativeConfig{URL: server.URL, Database: "db"})
+	if c.httpClient.Timeout != 0 {
+		t.Errorf("httpClient.Timeout = %v, want 0", c.httpClient.Timeout)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	rows := 0
+	err := c.QuerySQLRows(ctx, "", "SELECT v FROM m", func(map[string]interface{}) error {
+		rows++
+		return nil
+	})
+	if err == nil || rows != 1 {
+		t.Errorf("QuerySQLRows() rows = %d, error = %v, want 1 row and deadline error", rows, err)
+	}
+}
+
+func TestQuerySQLRowsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	c, _ := NewClient3x(NativeConfig{URL: server.URL, Database: "db"})
+	err := c.QuerySQLRows(context.Background(), "", "SELECT 1", func(map[string]interface{}) error { return nil })
+	if common.ErrorClassOf(err) != common.ClassRetryable {
+		t.Errorf("503 should be retryable, got %v", err)
+	}
+
+	v1, _ := NewV1CompatClient(V1CompatConfig{Addr: server.URL})
+	if err := v1.QuerySQLRows(context.Background(), "", "SELECT 1", nil); err == nil {
+		t.Error("QuerySQLRows() should fail outside native mode")
+	}
+}
@@ -2,7 +2,6 @@ package influxdb3
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/ygqygq2/influxdb-sync/internal/common"
 	"github.com/ygqygq2/influxdb-sync/internal/influxdb1"
@@ -17,23 +16,10 @@ func Sync1x3x(ctx context.Context, cfg common.SyncConfig) error {
 		Pass: cfg.SourcePass,
 	})
 
-	// 创建目标适配器 (InfluxDB 3.x, v2 兼容模式)
-	var targetBucket string
-	if cfg.TargetBucket != "" {
-		targetBucket = cfg.TargetBucket
-	} else {
-		targetBucket = fmt.Sprintf("%s%s%s", cfg.TargetDBPrefix, cfg.SourceDB, cfg.TargetDBSuffix)
-	}
-
-	targetConfig := V2CompatConfig{
-		URL:      cfg.TargetAddr,
-		Token:    cfg.TargetToken,
-		Org:      cfg.TargetOrg,
-		Database: targetBucket,
-	}
-	target := &DataTarget3x{
-		client: nil, // 将在连接时初始化
-		config: targetConfig,
+	// 创建目标适配器 (InfluxDB 3.x, 按 compat_mode 选择兼容模式，默认 v2)
+	target, err := NewTarget(cfg, TargetDatabase(cfg, cfg.SourceDB))
+	if err != nil {
+		return err
 	}
 
 	// 创建同步器
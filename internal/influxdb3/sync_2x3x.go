@@ -2,7 +2,6 @@ package influxdb3
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/ygqygq2/influxdb-sync/internal/common"
 	"github.com/ygqygq2/influxdb-sync/internal/influxdb2"
@@ -18,23 +17,10 @@ func Sync2x3x(ctx context.Context, cfg common.SyncConfig) error {
 		Bucket: cfg.SourceBucket,
 	}
 
-	// 创建目标适配器 (InfluxDB 3.x, v2 兼容模式)
-	var targetBucket string
-	if cfg.TargetBucket != "" {
-		targetBucket = cfg.TargetBucket
-	} else {
-		targetBucket = fmt.Sprintf("%s%s%s", cfg.TargetDBPrefix, source.Bucket, cfg.TargetDBSuffix)
-	}
-
-	targetConfig := V2CompatConfig{
-		URL:      cfg.TargetAddr,
-		Token:    cfg.TargetToken,
-		Org:      cfg.TargetOrg,
-		Database: targetBucket,
-	}
-	target := &DataTarget3x{
-		client: nil, // 将在连接时初始化
-		config: targetConfig,
+	// 创建目标适配器 (InfluxDB 3.x, 按 compat_mode 选择兼容模式，默认 v2)
+	target, err := NewTarget(cfg, TargetDatabase(cfg, source.Bucket))
+	if err != nil {
+		return err
 	}
 
 	// 创建同步器
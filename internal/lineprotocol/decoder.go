@@ -0,0 +1,282 @@
+package lineprotocol
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrSyntax 内容不符合 line protocol 语法
+var ErrSyntax = errors.New("line protocol 语法错误")
+
+// Point 解码得到的点
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]interface{}
+	Time        time.Time // 行中没有时间戳时为零值
+}
+
+// Decoder 依次解码 line protocol 内容中的点，跳过空行和 # 开头的注释行。
+// 字符串字段值可以包含换行
+type Decoder struct {
+	data []byte
+	pos  int
+}
+
+// NewDecoder 创建解码 data 的 Decoder
+func NewDecoder(data []byte) *Decoder {
+	return &Decoder{data: data}
+}
+
+// Parse 解码 data 中的全部点
+func Parse(data []byte) ([]Point, error) {
+	d := NewDecoder(data)
+	var points []Point
+	for {
+		p, err := d.Next()
+		if err == io.EOF {
+			return points, nil
+		}
+		if err != nil {
+			return points, err
+		}
+		points = append(points, p)
+	}
+}
+
+// Next 返回下一个点，没有更多内容时返回 io.EOF。
+// 出错时跳过该行，可以继续调用 Next 读取后面的点
+func (d *Decoder) Next() (Point, error) {
+	for d.pos < len(d.data) {
+		switch d.data[d.pos] {
+		case ' ', '\r', '\n':
+			d.pos++
+			continue
+		case '#':
+			d.skipLine()
+			continue
+		}
+		start := d.pos
+		p, err := d.point()
+		if err != nil {
+			line := bytes.Count(d.data[:start], []byte{'\n'}) + 1
+			d.skipLine()
+			return Point{}, fmt.Errorf("第 %d 行: %w", line, err)
+		}
+		return p, nil
+	}
+	return Point{}, io.EOF
+}
+
+func (d *Decoder) skipLine() {
+	if i := bytes.IndexByte(d.data[d.pos:], '\n'); i >= 0 {
+		d.pos += i + 1
+	} else {
+		d.pos = len(d.data)
+	}
+}
+
+// 当前位置的字节，到达末尾时返回 0
+func (d *Decoder) peek() byte {
+	if d.pos < len(d.data) {
+		return d.data[d.pos]
+	}
+	return 0
+}
+
+func syntaxError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrSyntax, fmt.Sprintf(format, args...))
+}
+
+func (d *Decoder) point() (Point, error) {
+	var p Point
+	var err error
+	if p.Measurement, err = d.name(measurementSpecial, ", \n"); err != nil {
+		return p, err
+	}
+	if p.Measurement == "" {
+		return p, syntaxError("measurement 为空")
+	}
+
+	for d.peek() == ',' {
+		d.pos++
+		key, err := d.name(keySpecial, "=, \n")
+		if err != nil {
+			return p, err
+		}
+		if d.peek() != '=' || key == "" {
+			return p, syntaxError("tag %q 缺少值", key)
+		}
+		d.pos++
+		value, err := d.name(keySpecial, ", \n")
+		if err != nil {
+			return p, err
+		}
+		if value == "" {
+			return p, syntaxError("tag %s 的值为空", key)
+		}
+		if p.Tags == nil {
+			p.Tags = make(map[string]string)
+		}
+		p.Tags[key] = value
+	}
+	if d.peek() != ' ' {
+		return p, syntaxError("缺少字段")
+	}
+	d.skipSpaces()
+
+	p.Fields = make(map[string]interface{})
+	for {
+		key, err := d.name(keySpecial, "=, \n")
+		if err != nil {
+			return p, err
+		}
+		if d.peek() != '=' || key == "" {
+			return p, syntaxError("字段 %q 缺少值", key)
+		}
+		d.pos++
+		if p.Fields[key], err = d.value(); err != nil {
+			return p, fmt.Errorf("字段 %s: %w", key, err)
+		}
+		if d.peek() != ',' {
+			break
+		}
+		d.pos++
+	}
+
+	d.skipSpaces()
+	if c := d.peek(); c != 0 && c != '\n' && c != '\r' {
+		start := d.pos
+		for c := d.peek(); c != 0 && c != ' ' && c != '\n' && c != '\r'; c = d.peek() {
+			d.pos++
+		}
+		ts, err := strconv.ParseInt(string(d.data[start:d.pos]), 10, 64)
+		if err != nil {
+			return p, syntaxError("时间戳 %q 无效", d.data[start:d.pos])
+		}
+		p.Time = time.Unix(0, ts).UTC()
+		d.skipSpaces()
+	}
+	if d.peek() == '\r' {
+		d.pos++
+	}
+	switch d.peek() {
+	case 0:
+	case '\n':
+		d.pos++
+	default:
+		return p, syntaxError("时间戳后有多余内容")
+	}
+	return p, nil
+}
+
+func (d *Decoder) skipSpaces() {
+	for d.peek() == ' ' {
+		d.pos++
+	}
+}
+
+// 读取名称直到 stop 中的字符或末尾。反斜杠后为 special 中的字符或反斜杠时是转义，
+// 否则按原样保留
+func (d *Decoder) name(special, stop string) (string, error) {
+	start := d.pos
+	escaped := false
+	for d.pos < len(d.data) {
+		c := d.data[d.pos]
+		if c == '\\' && d.pos+1 < len(d.data) {
+			if next := d.data[d.pos+1]; next == '\\' || isSpecial(next, special) {
+				escaped = true
+				d.pos += 2
+				continue
+			}
+		}
+		if isSpecial(c, stop) {
+			break
+		}
+		d.pos++
+	}
+	raw := d.data[start:d.pos]
+	if !escaped {
+		return string(raw), nil
+	}
+	var sb strings.Builder
+	sb.Grow(len(raw))
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '\\' && i+1 < len(raw) && (raw[i+1] == '\\' || isSpecial(raw[i+1], special)) {
+			i++
+		}
+		sb.WriteByte(raw[i])
+	}
+	return sb.String(), nil
+}
+
+// 读取一个字段值
+func (d *Decoder) value() (interface{}, error) {
+	if d.peek() == '"' {
+		return d.stringValue()
+	}
+	start := d.pos
+	for c := d.peek(); c != 0 && c != ',' && c != ' ' && c != '\n' && c != '\r'; c = d.peek() {
+		d.pos++
+	}
+	tok := string(d.data[start:d.pos])
+	if tok == "" {
+		return nil, syntaxError("字段值为空")
+	}
+	switch tok {
+	case "t", "T", "true", "True", "TRUE":
+		return true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, nil
+	}
+	switch tok[len(tok)-1] {
+	case 'i':
+		v, err := strconv.ParseInt(tok[:len(tok)-1], 10, 64)
+		if err != nil {
+			return nil, syntaxError("整数 %q 无效", tok)
+		}
+		return v, nil
+	case 'u':
+		v, err := strconv.ParseUint(tok[:len(tok)-1], 10, 64)
+		if err != nil {
+			return nil, syntaxError("无符号整数 %q 无效", tok)
+		}
+		return v, nil
+	}
+	// 排除 ParseFloat 额外接受的 NaN、Inf、十六进制和下划线形式
+	if strings.ContainsAny(tok, "xX_") || (tok[0] != '-' && tok[0] != '+' && tok[0] != '.' && (tok[0] < '0' || tok[0] > '9')) {
+		return nil, syntaxError("数值 %q 无效", tok)
+	}
+	v, err := strconv.ParseFloat(tok, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil, syntaxError("数值 %q 无效", tok)
+	}
+	return v, nil
+}
+
+// 读取带双引号的字符串，\" 和 \\ 是转义，其他反斜杠按原样保留
+func (d *Decoder) stringValue() (string, error) {
+	d.pos++
+	var sb strings.Builder
+	for d.pos < len(d.data) {
+		c := d.data[d.pos]
+		switch {
+		case c == '"':
+			d.pos++
+			return sb.String(), nil
+		case c == '\\' && d.pos+1 < len(d.data) && (d.data[d.pos+1] == '"' || d.data[d.pos+1] == '\\'):
+			sb.WriteByte(d.data[d.pos+1])
+			d.pos += 2
+		default:
+			sb.WriteByte(c)
+			d.pos++
+		}
+	}
+	return "", syntaxError("字符串缺少结束的双引号")
+}
@@ -0,0 +1,164 @@
+package lineprotocol
+
+import (
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	data := "# 注释\n" +
+		`cpu\ load,host=a\,b,region=us\=west usage=0.5,count=3i,bytes=7u,up=t,down=FALSE,msg="line1` + "\n" + `line2 \"q\" \\" 1609459200000000000` + "\r\n" +
+		"\n" +
+		`m v=-1.5e3` + "\n" +
+		`m\x v="a\nb" 0`
+	points, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	want := []Point{
+		{
+			Measurement: "cpu load",
+			Tags:        map[string]string{"host": "a,b", "region": "us=west"},
+			Fields: map[string]interface{}{
+				"usage": 0.5, "count": int64(3), "bytes": uint64(7), "up": true, "down": false,
+				"msg": "line1\nline2 \"q\" \\",
+			},
+			Time: time.Unix(0, 1609459200000000000).UTC(),
+		},
+		{Measurement: "m", Fields: map[string]interface{}{"v": -1500.0}},
+		// 不是转义序列的反斜杠按原样保留
+		{Measurement: `m\x`, Fields: map[string]interface{}{"v": `a\nb`}, Time: time.Unix(0, 0).UTC()},
+	}
+	if !reflect.DeepEqual(points, want) {
+		t.Errorf("解析结果不正确:\n得到 %#v\n期望 %#v", points, want)
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	bad := []string{
+		"m",
+		"m,host v=1",
+		"m,host= v=1",
+		"m v",
+		"m v=",
+		"m v=1.5i",
+		"m v=-1u",
+		"m v=NaN",
+		"m v=inf",
+		"m v=0x10",
+		`m v="unterminated`,
+		"m v=1 abc",
+		"m v=1 1 2",
+		",host=a v=1",
+	}
+	for _, line := range bad {
+		if p, err := Parse([]byte(line)); !errors.Is(err, ErrSyntax) {
+			t.Errorf("%q: 期望语法错误, 实际为 %+v, %v", line, p, err)
+		}
+	}
+
+	// 出错的行被跳过，之后的行仍可读取
+	d := NewDecoder([]byte("ok v=1\nbad v=\nok v=2\n"))
+	var got []float64
+	var errs int
+	for {
+		p, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if !strings.Contains(err.Error(), "第 2 行") {
+				t.Errorf("错误应包含行号: %v", err)
+			}
+			errs++
+			continue
+		}
+		got = append(got, p.Fields["v"].(float64))
+	}
+	if errs != 1 || !reflect.DeepEqual(got, []float64{1, 2}) {
+		t.Errorf("期望跳过 1 个错误行并读到 [1 2], 实际为 %d 个错误, %v", errs, got)
+	}
+}
+
+// 编码后再解码应得到原来的点
+func FuzzRoundTrip(f *testing.F) {
+	f.Add("cpu", "host", "server01", "usage", "ok", int64(3), uint64(7), 0.64, true, int64(1609459200000000000))
+	f.Add(`a b,c=d\`, `k\,=`, `v "\`, `f "x"`, "line\nbreak \"q\" \\", int64(math.MinInt64), uint64(math.MaxUint64), -1e-300, false, int64(-1))
+	f.Add(" ", "=", ",", "\\", "", int64(0), uint64(0), 0.0, true, int64(0))
+	f.Fuzz(func(t *testing.T, measurement, tagKey, tagValue, fieldKey, s string, i int64, u uint64, fl float64, b bool, ts int64) {
+		tags := map[string]string{tagKey: tagValue}
+		fields := map[string]interface{}{
+			fieldKey + "_s": s, fieldKey + "_i": i, fieldKey + "_u": u, fieldKey + "_f": fl, fieldKey + "_b": b,
+		}
+		data, err := AppendPoint(nil, measurement, tags, fields, time.Unix(0, ts))
+		if err != nil {
+			if !errors.Is(err, ErrInvalidName) && !errors.Is(err, ErrInvalidValue) {
+				t.Fatalf("意外的编码错误: %v", err)
+			}
+			return
+		}
+		points, err := Parse(data)
+		if err != nil {
+			t.Fatalf("解码 %q 失败: %v", data, err)
+		}
+		if len(points) != 1 {
+			t.Fatalf("%q 应解码为 1 个点, 实际为 %d 个", data, len(points))
+		}
+		p := points[0]
+		if p.Measurement != measurement {
+			t.Errorf("measurement 期望 %q, 实际为 %q", measurement, p.Measurement)
+		}
+		wantTags := map[string]string(nil)
+		if tagKey != "" && tagValue != "" {
+			wantTags = tags
+		}
+		if !reflect.DeepEqual(p.Tags, wantTags) {
+			t.Errorf("tags 期望 %q, 实际为 %q", wantTags, p.Tags)
+		}
+		if !reflect.DeepEqual(p.Fields, fields) {
+			t.Errorf("fields 期望 %#v, 实际为 %#v", fields, p.Fields)
+		}
+		if p.Time.UnixNano() != ts {
+			t.Errorf("时间戳期望 %d, 实际为 %d", ts, p.Time.UnixNano())
+		}
+	})
+}
+
+// 任意输入都不应导致 panic，解码成功的点重新编码后应解码为相同的点
+func FuzzDecode(f *testing.F) {
+	f.Add([]byte("cpu,host=a usage=0.5,count=3i 1609459200000000000\n"))
+	f.Add([]byte(`m\ x,k\=1=v\,2 s="a\"b\\",u=1u,b=t` + "\n# c\nm v=1e10\r\n"))
+	f.Add([]byte("m v=\"multi\nline\" 1\nbad\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		d := NewDecoder(data)
+		for n := 0; n <= len(data); n++ {
+			p, err := d.Next()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				continue
+			}
+			encoded, err := AppendPoint(nil, p.Measurement, p.Tags, p.Fields, p.Time)
+			if err != nil {
+				if errors.Is(err, ErrInvalidName) {
+					continue
+				}
+				t.Fatalf("重新编码 %#v 失败: %v", p, err)
+			}
+			again, err := Parse(encoded)
+			if err != nil || len(again) != 1 {
+				t.Fatalf("重新解码 %q 失败: %v", encoded, err)
+			}
+			if !reflect.DeepEqual(again[0], p) {
+				t.Fatalf("重新编码后不一致:\n%#v\n%#v", p, again[0])
+			}
+		}
+		t.Fatalf("Next 没有推进")
+	})
+}
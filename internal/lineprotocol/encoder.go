@@ -0,0 +1,225 @@
+// Package lineprotocol 实现 InfluxDB line protocol 的编码和解码。
+//
+// 编码时 tag 和字段按键排序，measurement 转义逗号和空格，tag 键、tag 值和字段键
+// 转义逗号、等号和空格，反斜杠统一写为 \\；字段值按类型写入：整数带 i 后缀，
+// 无符号整数带 u 后缀，字符串加双引号并转义双引号和反斜杠。时间戳精度为纳秒。
+package lineprotocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrNoFields 点没有可写入的字段
+	ErrNoFields = errors.New("没有可写入的字段")
+	// ErrInvalidName measurement、tag 或字段名无法编码
+	ErrInvalidName = errors.New("名称无法编码")
+	// ErrInvalidValue 字段值无法编码，如 NaN、Inf 或不支持的类型
+	ErrInvalidValue = errors.New("字段值无法编码")
+)
+
+const (
+	measurementSpecial = ", "
+	keySpecial         = ",= "
+)
+
+// Encoder 把点追加到内部缓冲区，每个点一行并以换行结尾。
+// 缓冲区和排序用的键列表在多次调用间复用，预热后编码不分配内存
+type Encoder struct {
+	buf  []byte
+	keys []string
+}
+
+// Bytes 返回已编码的内容，下次调用 AppendPoint 或 Reset 前有效
+func (e *Encoder) Bytes() []byte { return e.buf }
+
+// Len 返回已编码内容的字节数
+func (e *Encoder) Len() int { return len(e.buf) }
+
+// Reset 清空缓冲区，保留已分配的容量
+func (e *Encoder) Reset() { e.buf = e.buf[:0] }
+
+// AppendPoint 编码一个点。值为 nil 的字段和键或值为空的 tag 会被跳过，
+// t 为零值时不写时间戳。出错时缓冲区保持调用前的内容
+func (e *Encoder) AppendPoint(measurement string, tags map[string]string, fields map[string]interface{}, t time.Time) error {
+	buf, keys, err := appendPoint(e.buf, e.keys[:0], measurement, tags, fields, t)
+	e.keys = keys[:0]
+	if err != nil {
+		return err
+	}
+	e.buf = buf
+	return nil
+}
+
+// AppendPoint 把一个点编码后追加到 dst，规则与 Encoder.AppendPoint 相同
+func AppendPoint(dst []byte, measurement string, tags map[string]string, fields map[string]interface{}, t time.Time) ([]byte, error) {
+	buf, _, err := appendPoint(dst, nil, measurement, tags, fields, t)
+	if err != nil {
+		return dst, err
+	}
+	return buf, nil
+}
+
+func appendPoint(dst []byte, keys []string, measurement string, tags map[string]string, fields map[string]interface{}, t time.Time) ([]byte, []string, error) {
+	if measurement == "" || measurement[0] == '#' {
+		return dst, keys, fmt.Errorf("%w: measurement %q", ErrInvalidName, measurement)
+	}
+	if err := checkName(measurement); err != nil {
+		return dst, keys, err
+	}
+	buf := appendEscaped(dst, measurement, measurementSpecial)
+
+	keys = keys[:0]
+	for k, v := range tags {
+		if k != "" && v != "" {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		v := tags[k]
+		if err := checkName(k); err != nil {
+			return dst, keys, err
+		}
+		if err := checkName(v); err != nil {
+			return dst, keys, err
+		}
+		buf = append(buf, ',')
+		buf = appendEscaped(buf, k, keySpecial)
+		buf = append(buf, '=')
+		buf = appendEscaped(buf, v, keySpecial)
+	}
+
+	keys = keys[:0]
+	for k, v := range fields {
+		if v != nil {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return dst, keys, ErrNoFields
+	}
+	slices.Sort(keys)
+	for i, k := range keys {
+		if k == "" {
+			return dst, keys, fmt.Errorf("%w: 字段名为空", ErrInvalidName)
+		}
+		if err := checkName(k); err != nil {
+			return dst, keys, err
+		}
+		if i == 0 {
+			buf = append(buf, ' ')
+		} else {
+			buf = append(buf, ',')
+		}
+		buf = appendEscaped(buf, k, keySpecial)
+		buf = append(buf, '=')
+		var err error
+		if buf, err = AppendValue(buf, fields[k]); err != nil {
+			return dst, keys, fmt.Errorf("字段 %s: %w", k, err)
+		}
+	}
+
+	if !t.IsZero() {
+		buf = append(buf, ' ')
+		buf = strconv.AppendInt(buf, t.UnixNano(), 10)
+	}
+	return append(buf, '\n'), keys, nil
+}
+
+// AppendValue 按类型编码一个字段值
+func AppendValue(dst []byte, v interface{}) ([]byte, error) {
+	switch x := v.(type) {
+	case float64:
+		return appendFloat(dst, x, 64)
+	case float32:
+		return appendFloat(dst, float64(x), 32)
+	case int64:
+		return append(strconv.AppendInt(dst, x, 10), 'i'), nil
+	case int:
+		return append(strconv.AppendInt(dst, int64(x), 10), 'i'), nil
+	case int32:
+		return append(strconv.AppendInt(dst, int64(x), 10), 'i'), nil
+	case int16:
+		return append(strconv.AppendInt(dst, int64(x), 10), 'i'), nil
+	case int8:
+		return append(strconv.AppendInt(dst, int64(x), 10), 'i'), nil
+	case uint64:
+		return append(strconv.AppendUint(dst, x, 10), 'u'), nil
+	case uint:
+		return append(strconv.AppendUint(dst, uint64(x), 10), 'u'), nil
+	case uint32:
+		return append(strconv.AppendUint(dst, uint64(x), 10), 'u'), nil
+	case uint16:
+		return append(strconv.AppendUint(dst, uint64(x), 10), 'u'), nil
+	case uint8:
+		return append(strconv.AppendUint(dst, uint64(x), 10), 'u'), nil
+	case string:
+		return appendString(dst, x), nil
+	case bool:
+		return strconv.AppendBool(dst, x), nil
+	case json.Number:
+		// 没有类型信息的数值按浮点数写入，与 1.x 写入时的默认类型一致
+		f, err := strconv.ParseFloat(string(x), 64)
+		if err != nil {
+			return dst, fmt.Errorf("%w: %q", ErrInvalidValue, string(x))
+		}
+		return appendFloat(dst, f, 64)
+	}
+	return dst, fmt.Errorf("%w: 不支持的类型 %T", ErrInvalidValue, v)
+}
+
+func appendFloat(dst []byte, f float64, bits int) ([]byte, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return dst, fmt.Errorf("%w: %v", ErrInvalidValue, f)
+	}
+	return strconv.AppendFloat(dst, f, 'g', -1, bits), nil
+}
+
+func appendString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == '"' || c == '\\' {
+			dst = append(dst, '\\')
+		}
+		dst = append(dst, s[i])
+	}
+	return append(dst, '"')
+}
+
+// 转义 special 中的字符和反斜杠
+func appendEscaped(dst []byte, s, special string) []byte {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' || isSpecial(c, special) {
+			dst = append(dst, '\\')
+		}
+		dst = append(dst, c)
+	}
+	return dst
+}
+
+func isSpecial(c byte, special string) bool {
+	for i := 0; i < len(special); i++ {
+		if special[i] == c {
+			return true
+		}
+	}
+	return false
+}
+
+// 名称和 tag 值中不能出现换行
+func checkName(s string) error {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\n' || s[i] == '\r' {
+			return fmt.Errorf("%w: %q 包含换行", ErrInvalidName, s)
+		}
+	}
+	return nil
+}
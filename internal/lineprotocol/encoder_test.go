@@ -0,0 +1,127 @@
+package lineprotocol
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAppendPoint(t *testing.T) {
+	ts := time.Unix(0, 1609459200000000000)
+	tests := []struct {
+		name        string
+		measurement string
+		tags        map[string]string
+		fields      map[string]interface{}
+		time        time.Time
+		want        string
+	}{
+		{
+			name:        "tag 和字段按键排序",
+			measurement: "cpu",
+			tags:        map[string]string{"region": "us", "host": "a"},
+			fields:      map[string]interface{}{"usage": 0.64, "count": int64(3)},
+			time:        ts,
+			want:        "cpu,host=a,region=us count=3i,usage=0.64 1609459200000000000\n",
+		},
+		{
+			name:        "转义",
+			measurement: "cpu load,x=1",
+			tags:        map[string]string{"host name": "a,b=c", `back\slash`: `v\`},
+			fields:      map[string]interface{}{"field key": `say "hi" \o/`},
+			time:        ts,
+			want:        `cpu\ load\,x=1,back\\slash=v\\,host\ name=a\,b\=c field\ key="say \"hi\" \\o/" 1609459200000000000` + "\n",
+		},
+		{
+			name:        "字段类型",
+			measurement: "m",
+			fields: map[string]interface{}{
+				"a": int64(-3), "b": uint64(math.MaxUint64), "c": 1e21, "d": true, "e": json.Number("2"),
+				"f": float32(0.1), "g": 7, "h": nil,
+			},
+			time: ts,
+			want: "m a=-3i,b=18446744073709551615u,c=1e+21,d=true,e=2,f=0.1,g=7i 1609459200000000000\n",
+		},
+		{
+			name:        "跳过空 tag，零值时间不写时间戳",
+			measurement: "m",
+			tags:        map[string]string{"empty": "", "": "x"},
+			fields:      map[string]interface{}{"v": "x"},
+			want:        "m v=\"x\"\n",
+		},
+	}
+	for _, tt := range tests {
+		got, err := AppendPoint(nil, tt.measurement, tt.tags, tt.fields, tt.time)
+		if err != nil {
+			t.Errorf("%s: 编码失败: %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s:\n得到 %s期望 %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAppendPointErrors(t *testing.T) {
+	ts := time.Unix(0, 1)
+	tests := []struct {
+		name        string
+		measurement string
+		tags        map[string]string
+		fields      map[string]interface{}
+		want        error
+	}{
+		{"没有字段", "m", nil, map[string]interface{}{}, ErrNoFields},
+		{"字段都为 nil", "m", nil, map[string]interface{}{"v": nil}, ErrNoFields},
+		{"measurement 为空", "", nil, map[string]interface{}{"v": 1.0}, ErrInvalidName},
+		{"measurement 以 # 开头", "#m", nil, map[string]interface{}{"v": 1.0}, ErrInvalidName},
+		{"tag 值包含换行", "m", map[string]string{"k": "a\nb"}, map[string]interface{}{"v": 1.0}, ErrInvalidName},
+		{"字段名为空", "m", nil, map[string]interface{}{"": 1.0}, ErrInvalidName},
+		{"NaN", "m", nil, map[string]interface{}{"v": math.NaN()}, ErrInvalidValue},
+		{"Inf", "m", nil, map[string]interface{}{"v": math.Inf(-1)}, ErrInvalidValue},
+		{"不支持的类型", "m", nil, map[string]interface{}{"v": []int{1}}, ErrInvalidValue},
+		{"非数值 json.Number", "m", nil, map[string]interface{}{"v": json.Number("abc")}, ErrInvalidValue},
+	}
+	for _, tt := range tests {
+		var enc Encoder
+		_ = enc.AppendPoint("ok", nil, map[string]interface{}{"v": 1.0}, ts)
+		before := string(enc.Bytes())
+		err := enc.AppendPoint(tt.measurement, tt.tags, tt.fields, ts)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: 期望错误 %v, 实际为 %v", tt.name, tt.want, err)
+		}
+		if string(enc.Bytes()) != before {
+			t.Errorf("%s: 出错时不应修改缓冲区", tt.name)
+		}
+	}
+}
+
+func TestEncoderDoesNotAllocate(t *testing.T) {
+	tags := map[string]string{"host": "server01", "region": "us west"}
+	fields := map[string]interface{}{"usage": 0.64, "count": int64(3), "status": "ok", "up": true}
+	ts := time.Unix(0, 1609459200000000000)
+	var enc Encoder
+	allocs := testing.AllocsPerRun(100, func() {
+		enc.Reset()
+		if err := enc.AppendPoint("cpu", tags, fields, ts); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("预热后编码不应分配内存, 实际每次 %.1f 次", allocs)
+	}
+}
+
+func BenchmarkEncoder(b *testing.B) {
+	tags := map[string]string{"host": "server01", "region": "us-west"}
+	fields := map[string]interface{}{"usage": 0.64, "count": int64(3), "status": "ok", "up": true}
+	ts := time.Unix(0, 1609459200000000000)
+	var enc Encoder
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		enc.Reset()
+		_ = enc.AppendPoint("cpu", tags, fields, ts)
+	}
+}
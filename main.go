@@ -7,18 +7,139 @@ import (
 	"github.com/ygqygq2/influxdb-sync/cmd"
 )
 
+// 发布时通过 -ldflags "-X main.version=..." 设置
+var version = "dev"
+
 func main() {
+	cmd.Version = version
+
 	if len(os.Args) < 2 {
 		cmd.ShowUsage()
 		os.Exit(1)
 	}
 
+	// 生成迁移计划
+	if os.Args[1] == "plan" {
+		if len(os.Args) < 3 {
+			cmd.ShowUsage()
+			os.Exit(1)
+		}
+		planPath := "plan.json"
+		if len(os.Args) > 3 {
+			planPath = os.Args[3]
+		}
+		if err := cmd.Plan(os.Args[2], planPath); err != nil {
+			fmt.Println("生成迁移计划失败:", err)
+			os.Exit(cmd.ExitCode(err))
+		}
+		fmt.Println("迁移计划已生成:", planPath)
+		return
+	}
+
+	// 按迁移计划同步
+	if os.Args[1] == "apply" {
+		if len(os.Args) < 3 {
+			cmd.ShowUsage()
+			os.Exit(1)
+		}
+		if err := cmd.Apply(os.Args[2]); err != nil {
+			fmt.Println("同步失败:", err)
+			os.Exit(cmd.ExitCode(err))
+		}
+		fmt.Println("同步完成")
+		return
+	}
+
+	// 校验源端和目标端数据
+	if os.Args[1] == "verify" {
+		if len(os.Args) < 3 {
+			cmd.ShowUsage()
+			os.Exit(1)
+		}
+		outPath := ""
+		if len(os.Args) > 3 {
+			outPath = os.Args[3]
+		}
+		if err := cmd.Verify(os.Args[2], outPath); err != nil {
+			fmt.Println("校验失败:", err)
+			os.Exit(cmd.ExitCode(err))
+		}
+		fmt.Println("校验通过")
+		return
+	}
+
+	// 重新同步不一致的时间窗口
+	if os.Args[1] == "repair" {
+		if len(os.Args) < 3 {
+			cmd.ShowUsage()
+			os.Exit(1)
+		}
+		diffsPath := ""
+		if len(os.Args) > 3 {
+			diffsPath = os.Args[3]
+		}
+		if err := cmd.Repair(os.Args[2], diffsPath); err != nil {
+			fmt.Println("修复失败:", err)
+			os.Exit(cmd.ExitCode(err))
+		}
+		fmt.Println("修复完成")
+		return
+	}
+
+	// 导出或比较源端和目标端的结构
+	if os.Args[1] == "schema" {
+		if len(os.Args) < 4 {
+			cmd.ShowUsage()
+			os.Exit(1)
+		}
+		switch os.Args[2] {
+		case "export":
+			outPath := "schema.json"
+			if len(os.Args) > 4 {
+				outPath = os.Args[4]
+			}
+			if err := cmd.SchemaExport(os.Args[3], outPath); err != nil {
+				fmt.Println("导出结构失败:", err)
+				os.Exit(cmd.ExitCode(err))
+			}
+			fmt.Println("结构已导出:", outPath)
+		case "diff":
+			outPath := ""
+			if len(os.Args) > 4 {
+				outPath = os.Args[4]
+			}
+			if err := cmd.SchemaDiff(os.Args[3], outPath); err != nil {
+				fmt.Println("结构比较失败:", err)
+				os.Exit(cmd.ExitCode(err))
+			}
+			fmt.Println("结构一致")
+		default:
+			cmd.ShowUsage()
+			os.Exit(1)
+		}
+		return
+	}
+
+	// 重放死信目录中的点
+	if os.Args[1] == "replay-dlq" {
+		if len(os.Args) < 3 {
+			cmd.ShowUsage()
+			os.Exit(1)
+		}
+		if err := cmd.ReplayDLQ(os.Args[2]); err != nil {
+			fmt.Println("重放失败:", err)
+			os.Exit(cmd.ExitCode(err))
+		}
+		fmt.Println("重放完成")
+		return
+	}
+
 	cfgPath := os.Args[1]
 
 	// 使用 cmd.Run 执行同步，自动识别版本
 	if err := cmd.Run(cfgPath); err != nil {
 		fmt.Println("同步失败:", err)
-		os.Exit(1)
+		os.Exit(cmd.ExitCode(err))
 	}
 
 	fmt.Println("同步完成")